@@ -18,12 +18,14 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // KyvernoArtifactSpec defines the desired state of KyvernoArtifact
+// +kubebuilder:validation:XValidation:rule="!has(self.targets) || size(self.targets) == 0 || !has(self.smokeTests) || !has(self.smokeTests.revertOnFailure) || !self.smokeTests.revertOnFailure",message="smokeTests.revertOnFailure is not supported with targets"
 type KyvernoArtifactSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
@@ -32,7 +34,8 @@ type KyvernoArtifactSpec struct {
 
 	// url is the location of the artifact such as ghcr.io/OctoKode/kyverno-policies:latest
 	ArtifactUrl *string `json:"url,omitempty"`
-	// type is the type of artifact such as 'oci-image' or 'git-repo'. Only oci-image is supported for now.
+	// type is the type of artifact: oci-image, an OCI artifact of manifests, or helm-chart, a Helm chart stored in
+	// an OCI registry that is rendered with the values in helm before it is applied. Defaults to oci-image.
 	// +optional
 	ArtifactType *string `json:"type,omitempty"`
 	// provider is the artifact provider such as 'github' or 'artifactory'. Both github and artifactory are supported.
@@ -51,6 +54,366 @@ type KyvernoArtifactSpec struct {
 	// Defaults to true, explicitly set in the CRD to ensure active monitoring by default.
 	// +default=true
 	PollForTagChanges *bool `json:"pollForTagChanges,omitempty"`
+	// applyConcurrency is the number of manifest files the watcher applies in parallel. Defaults to 4.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=64
+	// +optional
+	ApplyConcurrency *int32 `json:"applyConcurrency,omitempty"`
+	// kubeApiQPS is the client-side rate limit, in queries per second, of the watcher's Kubernetes client.
+	// Defaults to the client-go default of 5.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	KubeAPIQPS *int32 `json:"kubeApiQPS,omitempty"`
+	// kubeApiBurst is the client-side burst of the watcher's Kubernetes client. Defaults to the client-go default of 10.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	KubeAPIBurst *int32 `json:"kubeApiBurst,omitempty"`
+	// namePrefix is prepended to metadata.name of every object in the artifact, e.g. "vendor-".
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9][-a-z0-9.]*$`
+	// +optional
+	NamePrefix *string `json:"namePrefix,omitempty"`
+	// nameSuffix is appended to metadata.name of every object in the artifact, e.g. "-vendor".
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[-a-z0-9.]*[a-z0-9]$`
+	// +optional
+	NameSuffix *string `json:"nameSuffix,omitempty"`
+	// commonLabels are added to every object in the artifact, overriding labels with the same key in the artifact.
+	// The labels the operator uses for tracking (managed-by, policy-version, artifact-name, artifact-namespace,
+	// policy-checksum) cannot be overridden.
+	// +optional
+	CommonLabels map[string]string `json:"commonLabels,omitempty"`
+	// commonAnnotations are added to every object in the artifact, overriding annotations with the same key in the artifact.
+	// +optional
+	CommonAnnotations map[string]string `json:"commonAnnotations,omitempty"`
+	// include selects the objects of the artifact to apply. An object is applied when it matches any of the
+	// filters; when include is empty, every object is applied.
+	// +optional
+	Include []ObjectFilter `json:"include,omitempty"`
+	// exclude skips objects of the artifact that match any of the filters, even when they are included.
+	// +optional
+	Exclude []ObjectFilter `json:"exclude,omitempty"`
+	// prune deletes objects that this artifact applied earlier but no longer ships, for example because they
+	// were removed from the artifact or are now filtered out. When false they are only reported in status.
+	// +optional
+	Prune *bool `json:"prune,omitempty"`
+	// substitute defines variables that replace ${VAR} placeholders in the artifact's manifests.
+	// They take precedence over variables from substituteFrom.
+	// +optional
+	Substitute map[string]string `json:"substitute,omitempty"`
+	// substituteFrom reads variables from the keys of ConfigMaps and Secrets in the KyvernoArtifact's namespace.
+	// Later entries take precedence over earlier ones.
+	// +optional
+	SubstituteFrom []SubstituteReference `json:"substituteFrom,omitempty"`
+	// substituteStrict fails a revision that uses an undefined variable. Otherwise undefined placeholders are left as they are.
+	// +optional
+	SubstituteStrict *bool `json:"substituteStrict,omitempty"`
+	// kustomize configures how a kustomization in the artifact is built. An artifact with a kustomization.yaml
+	// at its root is built even when kustomize is not set.
+	// +optional
+	Kustomize *KustomizeSpec `json:"kustomize,omitempty"`
+	// helm configures how an artifact of type helm-chart is rendered.
+	// +optional
+	Helm *HelmSpec `json:"helm,omitempty"`
+	// patches modify matching objects of the artifact after it is pulled and before it is applied, in order.
+	// Drift detection compares against the patched objects.
+	// +optional
+	Patches []Patch `json:"patches,omitempty"`
+	// globalExclude is merged into the exclude block of every rule of every Kyverno policy in the artifact,
+	// so that the selected resources, e.g. those in kube-system, are never matched by any of its rules.
+	// +optional
+	GlobalExclude *GlobalExclude `json:"globalExclude,omitempty"`
+	// safetyLimits hold back a revision that would change too much at once, until it is approved by annotating
+	// the KyvernoArtifact with kyverno.octokode.io/approve-revision=<digest>, or <revision> before it was applied.
+	// +optional
+	SafetyLimits *SafetyLimits `json:"safetyLimits,omitempty"`
+	// smokeTests configures what happens when the test fixtures shipped in the artifact, objects annotated with
+	// kyverno.octokode.io/smoke-test, do not get the expected admission result. The fixtures run whether or not
+	// smokeTests is set, against every target when targets are set. revertOnFailure is not supported with targets.
+	// +optional
+	SmokeTests *SmokeTests `json:"smokeTests,omitempty"`
+	// namespaceSelector stamps a copy of every namespaced object of the artifact, such as a Policy, into each
+	// namespace whose labels match, in place of the namespace in the manifest. Copies are added and removed as
+	// namespaces start and stop matching. An empty selector is treated as unset.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// adoption decides what happens to an object of the artifact that already exists in the cluster without being
+	// managed by a watcher, e.g. after migrating a cluster. never leaves the object alone and reports a conflict,
+	// ifIdentical adopts it only when its spec matches the artifact, and always adopts and overwrites it.
+	// Adopted objects get the tracking labels and the kyverno.octokode.io/adopted-at annotation. Defaults to always.
+	// +kubebuilder:validation:Enum=never;ifIdentical;always
+	// +optional
+	Adoption *string `json:"adoption,omitempty"`
+	// targets applies the artifact to remote clusters instead of the cluster the operator runs in. Each target is
+	// applied to, drift-checked and cleaned up on its own, so one unreachable cluster does not hold back the
+	// others, and reported in status.targets. namespaceSelector is ignored when targets are set.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Targets []ClusterTarget `json:"targets,omitempty"`
+	// approval decides whether a new revision is applied as soon as it is detected (auto) or staged and recorded in
+	// status.pendingVersion until the KyvernoArtifact is annotated with
+	// kyverno.octokode.io/approve-revision=<pendingVersion or pendingDigest> (manual). Defaults to auto.
+	// +kubebuilder:validation:Enum=auto;manual
+	// +optional
+	Approval *string `json:"approval,omitempty"`
+	// syncWindows restricts when new revisions are applied, for example to keep enforcement changes out of nights
+	// and weekends. Outside an allowed window, new revisions wait for the next one and the OutsideSyncWindow
+	// condition shows when it opens.
+	// +optional
+	SyncWindows *SyncWindows `json:"syncWindows,omitempty"`
+	// syncMode decides where the artifact is synced. pod runs a dedicated watcher pod for it, which isolates its
+	// credentials and resources from other artifacts. inProcess syncs it inside the operator every pollingInterval,
+	// keeping the watcher state in a ConfigMap. Defaults to the operator's SYNC_MODE setting, which defaults to pod.
+	// +kubebuilder:validation:Enum=pod;inProcess
+	// +optional
+	SyncMode *string `json:"syncMode,omitempty"`
+	// replicas is the number of watcher pods run for the artifact in pod mode. They elect the one that polls and
+	// applies through a Lease, while the others stand by to take over. With more than one replica a
+	// PodDisruptionBudget keeps one of them running through node drains. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// watcherGroup runs the watcher of the artifact in a Deployment shared with the other artifacts of the group in
+	// its namespace, one container per artifact, instead of a Deployment of its own. The group runs as many
+	// replicas as the largest replicas of its artifacts. Ignored in inProcess mode.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=40
+	// +optional
+	WatcherGroup *string `json:"watcherGroup,omitempty"`
+}
+
+const (
+	// ApprovalAuto applies new revisions as soon as they are detected.
+	ApprovalAuto = "auto"
+	// ApprovalManual waits for every new revision to be approved before applying it.
+	ApprovalManual = "manual"
+)
+
+const (
+	// SyncModePod syncs an artifact in a dedicated watcher pod.
+	SyncModePod = "pod"
+	// SyncModeInProcess syncs an artifact inside the operator.
+	SyncModeInProcess = "inProcess"
+)
+
+// SyncWindows are the windows in which new revisions may be applied.
+type SyncWindows struct {
+	// timeZone is the IANA time zone the schedules are evaluated in, e.g. Europe/Berlin. Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+	// windows lists the allow and deny windows. While any deny window is open nothing is applied. When there are
+	// allow windows, revisions are only applied while one of them is open.
+	// +kubebuilder:validation:MinItems=1
+	Windows []SyncWindow `json:"windows"`
+	// driftCorrection decides whether reapplying the current revision to correct drift obeys the windows or happens
+	// at any time. Reapplying it because what it renders to changed always obeys them. Defaults to ignore.
+	// +kubebuilder:validation:Enum=obey;ignore
+	// +optional
+	DriftCorrection *string `json:"driftCorrection,omitempty"`
+	// deletion decides whether pruning policies and deleting them on termination obeys the windows or happens at
+	// any time. Defaults to obey.
+	// +kubebuilder:validation:Enum=obey;ignore
+	// +optional
+	Deletion *string `json:"deletion,omitempty"`
+}
+
+// SyncWindow is a recurring window in which applying revisions is allowed or denied.
+type SyncWindow struct {
+	// kind is allow or deny.
+	// +kubebuilder:validation:Enum=allow;deny
+	Kind string `json:"kind"`
+	// schedule is a standard five-field cron expression for when the window opens, e.g. "0 8 * * 1-4".
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+	// duration is how long the window stays open, e.g. 8h.
+	Duration metav1.Duration `json:"duration"`
+}
+
+const (
+	// SyncWindowAllow is a window in which revisions may be applied.
+	SyncWindowAllow = "allow"
+	// SyncWindowDeny is a window in which revisions are not applied.
+	SyncWindowDeny = "deny"
+	// SyncWindowObey makes an operation wait for an allowed window.
+	SyncWindowObey = "obey"
+	// SyncWindowIgnore lets an operation happen at any time.
+	SyncWindowIgnore = "ignore"
+)
+
+// ClusterTarget is a remote cluster an artifact is applied to.
+type ClusterTarget struct {
+	// name identifies the cluster in status.targets.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// kubeconfigSecretRef points to the Secret holding a kubeconfig for the cluster.
+	KubeconfigSecretRef KubeconfigSecretReference `json:"kubeconfigSecretRef"`
+}
+
+// KubeconfigSecretReference points to a key of a Secret in the KyvernoArtifact's namespace holding a kubeconfig.
+type KubeconfigSecretReference struct {
+	// name of the Secret.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// key of the Secret holding the kubeconfig. Defaults to value, the key Cluster API uses.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+const (
+	// AdoptionNever leaves objects that exist without being managed alone and reports them as conflicts.
+	AdoptionNever = "never"
+	// AdoptionIfIdentical adopts objects that exist without being managed only when their spec matches the artifact.
+	AdoptionIfIdentical = "ifIdentical"
+	// AdoptionAlways adopts and overwrites objects that exist without being managed.
+	AdoptionAlways = "always"
+)
+
+// SmokeTests configures the admission smoke tests run after a revision is applied.
+type SmokeTests struct {
+	// revertOnFailure applies the previous revision again when a smoke test fails. The failed revision is not
+	// applied again until a newer one is published.
+	// +optional
+	RevertOnFailure bool `json:"revertOnFailure,omitempty"`
+}
+
+// SafetyLimits bound how much a single revision may change. Every limit that is set must hold.
+type SafetyLimits struct {
+	// maxRemoved is the maximum number of policies applied by this artifact that a revision may stop shipping,
+	// whether or not they are pruned.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxRemoved *int32 `json:"maxRemoved,omitempty"`
+	// maxChangedPercent is the maximum number of policies a revision may add, change or remove, as a percentage
+	// of the policies currently applied by this artifact. It does not apply while the artifact has no policies.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxChangedPercent *int32 `json:"maxChangedPercent,omitempty"`
+	// minPolicies is the minimum number of policies a revision must ship.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinPolicies *int32 `json:"minPolicies,omitempty"`
+}
+
+// GlobalExclude selects resources that no rule of an artifact may match. Every field that is set adds an
+// alternative to the exclude.any block of each rule, so a resource is excluded when it matches any of them.
+type GlobalExclude struct {
+	// namespaces excludes resources in these namespaces. Kyverno wildcards such as "kube-*" are allowed.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+	// namespaceSelector excludes resources in namespaces whose labels match the selector.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// any lists further Kyverno resource filters, in the form of the entries of a rule's exclude.any, e.g.
+	// {"subjects": [{"kind": "ServiceAccount", "name": "argocd-application-controller", "namespace": "argocd"}]}.
+	// +optional
+	Any []runtime.RawExtension `json:"any,omitempty"`
+}
+
+// Patch modifies the objects of an artifact that match its target.
+type Patch struct {
+	// target selects the objects to patch. Every field that is set must match, against the object before
+	// namePrefix, nameSuffix and the common labels are applied. When target is not set, every object is patched.
+	// +optional
+	Target *ObjectFilter `json:"target,omitempty"`
+	// type is JSON6902 for an RFC 6902 JSON patch, given as a list of operations, or StrategicMerge for a partial
+	// object merged into the target. StrategicMerge merges lists of objects by their name, such as policy rules.
+	// +kubebuilder:validation:Enum=JSON6902;StrategicMerge
+	Type string `json:"type"`
+	// patch is the patch, in YAML or JSON.
+	// +kubebuilder:validation:MinLength=1
+	Patch string `json:"patch"`
+}
+
+const (
+	// PatchTypeJSON6902 is an RFC 6902 JSON patch.
+	PatchTypeJSON6902 = "JSON6902"
+	// PatchTypeStrategicMerge is a partial object merged into the target.
+	PatchTypeStrategicMerge = "StrategicMerge"
+)
+
+// KustomizeSpec configures the kustomize build of an artifact.
+type KustomizeSpec struct {
+	// path is the directory in the artifact holding the kustomization to build, e.g. "overlays/production".
+	// Defaults to the root of the artifact.
+	// +kubebuilder:validation:Pattern=`^[^/].*$`
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+const (
+	// ArtifactTypeOCIImage is an OCI artifact whose layers are manifests.
+	ArtifactTypeOCIImage = "oci-image"
+	// ArtifactTypeHelmChart is a Helm chart pushed to an OCI registry with helm push.
+	ArtifactTypeHelmChart = "helm-chart"
+)
+
+// HelmSpec configures the rendering of a Helm chart artifact.
+type HelmSpec struct {
+	// releaseName is the release name the chart is rendered with. Defaults to the name of the KyvernoArtifact.
+	// +kubebuilder:validation:MaxLength=53
+	// +optional
+	ReleaseName string `json:"releaseName,omitempty"`
+	// values are passed to the chart and take precedence over valuesFrom.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Values *runtime.RawExtension `json:"values,omitempty"`
+	// valuesFrom reads values files from keys of ConfigMaps and Secrets in the KyvernoArtifact's namespace.
+	// Later entries take precedence over earlier ones.
+	// +optional
+	ValuesFrom []HelmValuesReference `json:"valuesFrom,omitempty"`
+}
+
+// HelmValuesReference points to a key of a ConfigMap or Secret holding a Helm values file.
+type HelmValuesReference struct {
+	// kind is ConfigMap or Secret.
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	Kind string `json:"kind"`
+	// name of the ConfigMap or Secret in the KyvernoArtifact's namespace.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// key holding the values file. Defaults to values.yaml.
+	// +optional
+	Key string `json:"key,omitempty"`
+	// optional ignores the reference when the ConfigMap or Secret, or its key, does not exist.
+	// +optional
+	Optional bool `json:"optional,omitempty"`
+}
+
+// SubstituteReference points to a ConfigMap or Secret whose keys are used as substitution variables.
+type SubstituteReference struct {
+	// kind is ConfigMap or Secret.
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	Kind string `json:"kind"`
+	// name of the ConfigMap or Secret in the KyvernoArtifact's namespace.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// optional ignores the reference when the ConfigMap or Secret does not exist.
+	// +optional
+	Optional bool `json:"optional,omitempty"`
+}
+
+// ObjectFilter selects objects of an artifact. Every field that is set must match.
+type ObjectFilter struct {
+	// path is a glob matched against the path of the file in the artifact, which is the
+	// org.opencontainers.image.title of its layer, e.g. "baseline/*.yaml".
+	// +optional
+	Path string `json:"path,omitempty"`
+	// group is the API group of the object, e.g. "kyverno.io".
+	// +optional
+	Group string `json:"group,omitempty"`
+	// version is the API version of the object, e.g. "v1".
+	// +optional
+	Version string `json:"version,omitempty"`
+	// kind is the kind of the object, e.g. "ClusterPolicy".
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// name is a glob matched against metadata.name as it appears in the artifact, before namePrefix and nameSuffix.
+	// +optional
+	Name string `json:"name,omitempty"`
+	// labelSelector matches the labels the object carries in the artifact.
+	// +optional
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
 }
 
 // KyvernoArtifactStatus defines the observed state of KyvernoArtifact.
@@ -74,6 +437,281 @@ type KyvernoArtifactStatus struct {
 	// +listMapKey=type
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// appliedVersion is the last artifact revision whose objects were all applied successfully.
+	// +optional
+	AppliedVersion string `json:"appliedVersion,omitempty"`
+
+	// lastAttemptedVersion is the artifact revision the watcher most recently tried to apply.
+	// +optional
+	LastAttemptedVersion string `json:"lastAttemptedVersion,omitempty"`
+
+	// lastApplyTime is when the watcher last attempted to apply objects to the cluster.
+	// +optional
+	LastApplyTime *metav1.Time `json:"lastApplyTime,omitempty"`
+
+	// applySummary counts the objects of the last apply attempt by outcome.
+	// +optional
+	ApplySummary *ApplySummary `json:"applySummary,omitempty"`
+
+	// failedObjects lists the objects that failed during the last apply attempt, with the reason.
+	// The list is truncated to keep the status object small.
+	// +optional
+	FailedObjects []ObjectStatus `json:"failedObjects,omitempty"`
+
+	// retryAttempts is the number of consecutive failed attempts to apply lastAttemptedVersion.
+	// +optional
+	RetryAttempts int32 `json:"retryAttempts,omitempty"`
+
+	// nextRetryTime is the earliest time the watcher will retry the failed objects.
+	// +optional
+	NextRetryTime *metav1.Time `json:"nextRetryTime,omitempty"`
+
+	// conflicts lists objects shipped by both this artifact and another one. The artifact named in ownedBy
+	// keeps managing the object until it is handed over with the kyverno.octokode.io/handover-to annotation.
+	// Objects that exist without being managed and that spec.adoption does not allow adopting are listed too.
+	// +optional
+	Conflicts []OwnershipConflict `json:"conflicts,omitempty"`
+
+	// staleObjects lists objects labeled with this artifact that it no longer ships, because they were removed from
+	// the artifact or are filtered out. Set spec.prune to delete them. The list is truncated to keep the status object small.
+	// +optional
+	StaleObjects []ObjectReference `json:"staleObjects,omitempty"`
+
+	// heldObjects lists objects of this artifact that carry the kyverno.octokode.io/hold-until annotation. They are
+	// left as they are in the cluster until the hold expires, after which the artifact's version is applied again.
+	// The list is truncated to keep the status object small.
+	// +optional
+	HeldObjects []HeldObject `json:"heldObjects,omitempty"`
+
+	// targets reports the last sync of each cluster in spec.targets.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Targets []TargetStatus `json:"targets,omitempty"`
+
+	// pendingVersion is the revision staged by the watcher that waits for approval when spec.approval is manual.
+	// +optional
+	PendingVersion string `json:"pendingVersion,omitempty"`
+
+	// pendingDigest is the digest of the content of pendingVersion. Approving it instead of the version makes sure
+	// that the reviewed content is applied even if the tag is overwritten.
+	// +optional
+	PendingDigest string `json:"pendingDigest,omitempty"`
+
+	// pendingChanges summarizes how pendingVersion changes the policies in the cluster.
+	// +optional
+	PendingChanges *RevisionChanges `json:"pendingChanges,omitempty"`
+
+	// approvedDigest is the digest of the content last approved when spec.approval is manual. Content with this
+	// digest is applied, retried and reconciled without further approval.
+	// +optional
+	ApprovedDigest string `json:"approvedDigest,omitempty"`
+
+	// rejectedVersion is the revision that was reverted because its smoke tests failed while
+	// spec.smokeTests.revertOnFailure is set. It is not applied again until a newer revision is published.
+	// +optional
+	RejectedVersion string `json:"rejectedVersion,omitempty"`
+}
+
+// RevisionChanges counts how a revision changes the policies applied by an artifact.
+type RevisionChanges struct {
+	// +optional
+	Added int32 `json:"added,omitempty"`
+	// +optional
+	Changed int32 `json:"changed,omitempty"`
+	// +optional
+	Removed int32 `json:"removed,omitempty"`
+}
+
+// TargetStatus is the outcome of the last sync of a remote cluster.
+type TargetStatus struct {
+	// name of the target in spec.targets.
+	Name string `json:"name"`
+	// appliedVersion is the last revision whose objects were all applied to the cluster.
+	// +optional
+	AppliedVersion string `json:"appliedVersion,omitempty"`
+	// lastSyncTime is when the watcher last synced the cluster.
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// applySummary counts the objects of the last sync by outcome.
+	// +optional
+	ApplySummary *ApplySummary `json:"applySummary,omitempty"`
+	// failedObjects lists the objects that failed during the last sync, with the reason. The list is truncated to
+	// keep the status object small.
+	// +optional
+	FailedObjects []ObjectStatus `json:"failedObjects,omitempty"`
+	// staleObjects lists objects labeled with this artifact in the cluster that it no longer ships and that were
+	// not pruned. The list is truncated to keep the status object small.
+	// +optional
+	StaleObjects []ObjectReference `json:"staleObjects,omitempty"`
+	// message explains why the cluster could not be synced, for example because it is unreachable.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ApplyOutcome is the result of applying a single object to the cluster.
+// +kubebuilder:validation:Enum=Created;Updated;Unchanged;Failed;Conflict;Pruned;Held
+type ApplyOutcome string
+
+const (
+	// ApplyOutcomeCreated means the object did not exist and was created.
+	ApplyOutcomeCreated ApplyOutcome = "Created"
+	// ApplyOutcomeUpdated means the object existed and was updated.
+	ApplyOutcomeUpdated ApplyOutcome = "Updated"
+	// ApplyOutcomeUnchanged means the object already matched the artifact and was left alone.
+	ApplyOutcomeUnchanged ApplyOutcome = "Unchanged"
+	// ApplyOutcomeFailed means the object could not be applied.
+	ApplyOutcomeFailed ApplyOutcome = "Failed"
+	// ApplyOutcomeConflict means the object is managed by another artifact and was left alone.
+	ApplyOutcomeConflict ApplyOutcome = "Conflict"
+	// ApplyOutcomePruned means the object is no longer part of the artifact and was deleted.
+	ApplyOutcomePruned ApplyOutcome = "Pruned"
+	// ApplyOutcomeHeld means the object carries an unexpired hold-until annotation and was left alone.
+	ApplyOutcomeHeld ApplyOutcome = "Held"
+)
+
+// Condition types reported on KyvernoArtifact status.
+const (
+	// ConditionAvailable is True when the last attempted revision was fully applied.
+	ConditionAvailable = "Available"
+	// ConditionDegraded is True when one or more objects of the last attempted revision failed to apply.
+	ConditionDegraded = "Degraded"
+	// ConditionOwnershipConflict is True when this artifact shares one or more objects with another artifact.
+	ConditionOwnershipConflict = "OwnershipConflict"
+	// ConditionBlocked is True when a new revision exceeds the safety limits and waits for approval.
+	ConditionBlocked = "Blocked"
+	// ConditionAwaitingApproval is True when spec.approval is manual and a new revision waits for approval.
+	ConditionAwaitingApproval = "AwaitingApproval"
+	// ConditionOutsideSyncWindow is True while spec.syncWindows hold back new revisions, with the time the next
+	// window opens.
+	ConditionOutsideSyncWindow = "OutsideSyncWindow"
+	// ConditionFrozen is True while an operator-wide freeze stops policy changes, with reason FrozenReasonPaused or
+	// FrozenReasonAudit. It is set by the controller from the freeze ConfigMap.
+	ConditionFrozen = "Frozen"
+	// FrozenReasonPaused is the reason of the Frozen condition while changes are paused.
+	FrozenReasonPaused = "Paused"
+	// FrozenReasonAudit is the reason of the Frozen condition while changes are paused and every managed policy is
+	// switched to Audit.
+	FrozenReasonAudit = "Audit"
+)
+
+const (
+	// HandoverAnnotation on a managed object names the artifact that may take the object over from its current owner.
+	HandoverAnnotation = "kyverno.octokode.io/handover-to"
+	// OriginalNameAnnotation records the name an object had in the artifact before namePrefix/nameSuffix were applied.
+	OriginalNameAnnotation = "kyverno.octokode.io/original-name"
+	// CommonMetadataHashAnnotation holds a hash of commonLabels and commonAnnotations, so that changing or removing
+	// one of them causes the object to be updated.
+	CommonMetadataHashAnnotation = "kyverno.octokode.io/common-metadata-hash"
+	// ApproveRevisionAnnotation on a KyvernoArtifact names a revision that may be applied even though it exceeds
+	// the safety limits, or the pending revision or digest to apply when spec.approval is manual.
+	ApproveRevisionAnnotation = "kyverno.octokode.io/approve-revision"
+	// SmokeTestAnnotation marks an object of the artifact as a test fixture instead of an object to apply. Its
+	// value is the expected admission result of a dry-run create: allow, deny or mutate.
+	SmokeTestAnnotation = "kyverno.octokode.io/smoke-test"
+	// SmokeTestExpectAnnotation on a fixture expecting mutate holds the fields, as YAML or JSON, that the
+	// mutated object must contain.
+	SmokeTestExpectAnnotation = "kyverno.octokode.io/smoke-test-expect"
+	// FanOutAnnotation marks a copy of a namespaced object stamped into a namespace matched by namespaceSelector.
+	FanOutAnnotation = "kyverno.octokode.io/fan-out"
+	// AdoptedAtAnnotation records when an object that existed without being managed was adopted by an artifact.
+	AdoptedAtAnnotation = "kyverno.octokode.io/adopted-at"
+	// HoldUntilAnnotation on a managed object holds an RFC3339 time until which the object is neither updated,
+	// pruned nor garbage collected, so that it can be edited or disabled by hand during an incident.
+	HoldUntilAnnotation = "kyverno.octokode.io/hold-until"
+	// FrozenAnnotation marks a managed policy that was switched to Audit by an operator-wide freeze. It is removed
+	// when the artifact's version is applied again after the freeze is lifted.
+	FrozenAnnotation = "kyverno.octokode.io/frozen"
+)
+
+// ApplySummary counts objects by apply outcome.
+type ApplySummary struct {
+	// +optional
+	Created int32 `json:"created,omitempty"`
+	// +optional
+	Updated int32 `json:"updated,omitempty"`
+	// +optional
+	Unchanged int32 `json:"unchanged,omitempty"`
+	// +optional
+	Failed int32 `json:"failed,omitempty"`
+	// +optional
+	Conflicts int32 `json:"conflicts,omitempty"`
+	// +optional
+	Pruned int32 `json:"pruned,omitempty"`
+	// +optional
+	Held int32 `json:"held,omitempty"`
+}
+
+// ObjectStatus describes the outcome of applying a single object from the artifact.
+type ObjectStatus struct {
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// +optional
+	Name string `json:"name,omitempty"`
+	// outcome is what happened to the object.
+	Outcome ApplyOutcome `json:"outcome"`
+	// reason explains a failure.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// ObjectReference identifies an object in the cluster.
+type ObjectReference struct {
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// +optional
+	Name string `json:"name,omitempty"`
+}
+
+// OwnershipConflict describes an object that two artifacts both want to manage.
+type OwnershipConflict struct {
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// +optional
+	Name string `json:"name,omitempty"`
+	// ownedBy is the artifact that currently manages the object. It is empty when the object exists without being
+	// managed by any artifact and spec.adoption does not allow adopting it.
+	OwnedBy string `json:"ownedBy"`
+	// ownedByNamespace is the namespace of the artifact that currently manages the object. It is empty when the
+	// object was applied by a watcher that did not record its namespace yet.
+	// +optional
+	OwnedByNamespace string `json:"ownedByNamespace,omitempty"`
+	// claimedBy is the artifact that also ships the object but was refused.
+	ClaimedBy string `json:"claimedBy"`
+	// claimedByNamespace is the namespace of the artifact that was refused.
+	// +optional
+	ClaimedByNamespace string `json:"claimedByNamespace,omitempty"`
+}
+
+// HeldObject is an object left alone until its hold-until annotation expires.
+type HeldObject struct {
+	// cluster is the target in spec.targets the object is held in. It is empty for the cluster the operator runs
+	// in.
+	// +optional
+	Cluster string `json:"cluster,omitempty"`
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// +optional
+	Name string `json:"name,omitempty"`
+	// until is when the hold expires.
+	Until metav1.Time `json:"until"`
 }
 
 // +kubebuilder:object:root=true
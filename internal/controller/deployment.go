@@ -0,0 +1,483 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+)
+
+const (
+	// watcherPrefix names the Deployment, the PodDisruptionBudget and the Lease of the watcher of an artifact.
+	watcherPrefix = "kyverno-artifact-manager-"
+	// groupPrefix names the Deployment and the PodDisruptionBudget of a watcher group.
+	groupPrefix = "kyverno-artifact-group-"
+	// watcherGroupLabel carries the name of the group on the Deployment of a watcher group.
+	watcherGroupLabel = "kyverno.octokode.io/watcher-group"
+	// templateHashAnnotation records on a watcher Deployment the hash of the pod template it was last rolled out with.
+	templateHashAnnotation = "kyverno.octokode.io/template-hash"
+)
+
+// watcherName returns the name of the Deployment and the Lease of the watcher of the named artifact.
+func watcherName(artifactName string) string {
+	return watcherPrefix + artifactName
+}
+
+// watcherReplicas returns how many watcher pods the artifact asks for.
+func watcherReplicas(artifact *kyvernov1alpha1.KyvernoArtifact) int32 {
+	if artifact.Spec.Replicas != nil && *artifact.Spec.Replicas > 0 {
+		return *artifact.Spec.Replicas
+	}
+	return 1
+}
+
+// watcherGroup returns the watcher group of the artifact, or "" when it runs in a Deployment of its own.
+func watcherGroup(artifact *kyvernov1alpha1.KyvernoArtifact) string {
+	if artifact.Spec.WatcherGroup != nil {
+		return *artifact.Spec.WatcherGroup
+	}
+	return ""
+}
+
+// groupContainerName returns the name of the container of the named artifact in its group. Container names are
+// DNS labels, so long artifact names are shortened and made unique with a hash.
+func groupContainerName(artifactName string) string {
+	name := "watcher-" + artifactName
+	if len(name) <= 63 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(artifactName))
+	return name[:54] + "-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// watcherLabels returns the labels of a watcher Deployment and its pods. component is watcher for the Deployment
+// of an artifact and watcher-group for the Deployment of a group, so that their selectors never overlap.
+func watcherLabels(instance, component string) map[string]string {
+	// These labels are crucial for the watcher's self-reconciliation logic to find other watcher pods.
+	return map[string]string{
+		"app.kubernetes.io/name":       "kyverno-artifact-watcher",
+		"app.kubernetes.io/instance":   instance,
+		"app.kubernetes.io/managed-by": "kyverno-artifact-operator",
+		"app.kubernetes.io/component":  component,
+	}
+}
+
+// watcherContainer builds the container watching artifact. Its /tmp is mounted from the named volume, which keeps
+// the state of watchers sharing a pod apart. Replicas elect the active watcher through the Lease of the artifact,
+// which stays the same when the artifact moves in or out of a group.
+func (r *KyvernoArtifactReconciler) watcherContainer(artifact *kyvernov1alpha1.KyvernoArtifact, name, volume string) (corev1.Container, error) {
+	if artifact.Spec.ArtifactUrl == nil || *artifact.Spec.ArtifactUrl == "" {
+		return corev1.Container{}, fmt.Errorf("spec.ArtifactUrl is required but not set")
+	}
+	envVars, err := r.watcherEnv(artifact)
+	if err != nil {
+		return corev1.Container{}, err
+	}
+	envVars = append(envVars, corev1.EnvVar{Name: "WATCHER_LEASE_NAME", Value: watcherName(artifact.Name)})
+
+	return corev1.Container{
+		Name:            name,
+		Image:           r.Config.WatcherImage,
+		ImagePullPolicy: corev1.PullAlways,
+		Args:            []string{"-watcher"},
+		Env:             envVars,
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      volume,
+				MountPath: "/tmp",
+			},
+		},
+	}, nil
+}
+
+// newWatcherDeployment returns a Deployment running replicas pods of template. Rolling updates start the new
+// pod before stopping an old one, and the standbys take over the lease when the active watcher stops.
+func newWatcherDeployment(name, namespace string, labels map[string]string, replicas int32, template corev1.PodTemplateSpec) (*appsv1.Deployment, error) {
+	maxUnavailable := intstr.FromInt32(0)
+	maxSurge := intstr.FromInt32(1)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RollingUpdateDeploymentStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateDeployment{
+					MaxUnavailable: &maxUnavailable,
+					MaxSurge:       &maxSurge,
+				},
+			},
+		},
+	}
+	if _, err := setWatcherTemplate(deployment, template); err != nil {
+		return nil, err
+	}
+	return deployment, nil
+}
+
+// watcherPodTemplate returns the pod template of a watcher Deployment, with an emptyDir for the /tmp of every
+// container.
+func (r *KyvernoArtifactReconciler) watcherPodTemplate(labels map[string]string, containers []corev1.Container) corev1.PodTemplateSpec {
+	var volumes []corev1.Volume
+	for _, container := range containers {
+		for _, mount := range container.VolumeMounts {
+			volumes = append(volumes, corev1.Volume{
+				Name: mount.Name,
+				VolumeSource: corev1.VolumeSource{
+					EmptyDir: &corev1.EmptyDirVolumeSource{},
+				},
+			})
+		}
+	}
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: labels},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: r.Config.WatcherServiceAccount,
+			Containers:         containers,
+			Volumes:            volumes,
+			RestartPolicy:      corev1.RestartPolicyAlways,
+		},
+	}
+}
+
+// reconcileWatcher runs the watcher of artifact in its own Deployment, or in the Deployment of its group.
+func (r *KyvernoArtifactReconciler) reconcileWatcher(ctx context.Context, artifact *kyvernov1alpha1.KyvernoArtifact) error {
+	group := watcherGroup(artifact)
+	if err := r.leaveGroups(ctx, artifact.Namespace, artifact.Name, group); err != nil {
+		return err
+	}
+	if group == "" {
+		if err := r.reconcileDeployment(ctx, artifact); err != nil {
+			return err
+		}
+	} else {
+		if err := r.reconcileGroup(ctx, artifact.Namespace, group); err != nil {
+			return err
+		}
+		// The watcher in the group takes over the lease from the one in the Deployment of the artifact
+		if err := r.deleteWatcher(ctx, artifact.Namespace, watcherName(artifact.Name)); err != nil {
+			return err
+		}
+	}
+	return r.deleteLegacyPod(ctx, artifact)
+}
+
+// reconcileDeployment creates the watcher Deployment of artifact, and rolls it out when the artifact changed.
+func (r *KyvernoArtifactReconciler) reconcileDeployment(ctx context.Context, artifact *kyvernov1alpha1.KyvernoArtifact) error {
+	log := logf.FromContext(ctx)
+	name := watcherName(artifact.Name)
+	labels := watcherLabels(artifact.Name, "watcher")
+	replicas := watcherReplicas(artifact)
+
+	container, err := r.watcherContainer(artifact, "watcher", "tmp")
+	if err != nil {
+		log.Error(err, "unable to build the watcher container")
+		return err
+	}
+
+	template := r.watcherPodTemplate(labels, []corev1.Container{container})
+
+	deployment := &appsv1.Deployment{}
+	err = r.Get(ctx, client.ObjectKey{Name: name, Namespace: artifact.Namespace}, deployment)
+	if errors.IsNotFound(err) {
+		deployment, err = newWatcherDeployment(name, artifact.Namespace, labels, replicas, template)
+		if err != nil {
+			return err
+		}
+		if err := controllerutil.SetControllerReference(artifact, deployment, r.Scheme); err != nil {
+			log.Error(err, "unable to set controller reference for Deployment")
+			return err
+		}
+		if err := r.Create(ctx, deployment); err != nil {
+			return err
+		}
+		log.Info("Created watcher Deployment", "Name", name)
+		return r.reconcileDisruptionBudget(ctx, deployment)
+	} else if err != nil {
+		log.Error(err, "unable to fetch Deployment")
+		return err
+	}
+
+	rollout, err := setWatcherTemplate(deployment, template)
+	if err != nil {
+		return err
+	}
+	scaled := deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != replicas
+	if rollout || scaled {
+		deployment.Spec.Replicas = &replicas
+		if err := r.Update(ctx, deployment); err != nil {
+			log.Error(err, "unable to update Deployment")
+			return err
+		}
+		log.Info("Updated watcher Deployment", "Name", name, "RolledOut", rollout, "Replicas", replicas)
+	} else {
+		log.Info("Watcher Deployment is up to date", "Name", name, "AvailableReplicas", deployment.Status.AvailableReplicas)
+	}
+	return r.reconcileDisruptionBudget(ctx, deployment)
+}
+
+// reconcileGroup runs the watchers of the artifacts of a group in the namespace in a shared Deployment, one
+// container per artifact. The Deployment is owned by every artifact of the group, and deleted once it is empty.
+func (r *KyvernoArtifactReconciler) reconcileGroup(ctx context.Context, namespace, group string) error {
+	log := logf.FromContext(ctx)
+	name := groupPrefix + group
+	labels := watcherLabels(group, "watcher-group")
+	labels[watcherGroupLabel] = group
+
+	members, err := r.groupMembers(ctx, namespace, group)
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		log.Info("Watcher group is empty, deleting its Deployment", "Name", name)
+		return r.deleteWatcher(ctx, namespace, name)
+	}
+
+	var replicas int32
+	containers := make([]corev1.Container, 0, len(members))
+	owners := make([]metav1.OwnerReference, 0, len(members))
+	for i := range members {
+		member := &members[i]
+		containerName := groupContainerName(member.Name)
+		container, err := r.watcherContainer(member, containerName, containerName)
+		if err != nil {
+			return fmt.Errorf("unable to build the watcher container of %s: %w", member.Name, err)
+		}
+		containers = append(containers, container)
+		owners = append(owners, metav1.OwnerReference{
+			APIVersion: kyvernov1alpha1.GroupVersion.String(),
+			Kind:       "KyvernoArtifact",
+			Name:       member.Name,
+			UID:        member.UID,
+		})
+		replicas = max(replicas, watcherReplicas(member))
+	}
+
+	template := r.watcherPodTemplate(labels, containers)
+
+	deployment := &appsv1.Deployment{}
+	err = r.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, deployment)
+	if errors.IsNotFound(err) {
+		deployment, err = newWatcherDeployment(name, namespace, labels, replicas, template)
+		if err != nil {
+			return err
+		}
+		deployment.OwnerReferences = owners
+		if err := r.Create(ctx, deployment); err != nil {
+			return err
+		}
+		log.Info("Created watcher group Deployment", "Name", name, "Artifacts", len(members))
+		return r.reconcileDisruptionBudget(ctx, deployment)
+	} else if err != nil {
+		log.Error(err, "unable to fetch Deployment")
+		return err
+	}
+
+	// The group rolls out when an artifact joins or leaves it, or when the watcher of one of them changed
+	rollout, err := setWatcherTemplate(deployment, template)
+	if err != nil {
+		return err
+	}
+	scaled := deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != replicas
+	reowned := !equality.Semantic.DeepEqual(deployment.OwnerReferences, owners)
+	if rollout || scaled || reowned {
+		deployment.Spec.Replicas = &replicas
+		deployment.OwnerReferences = owners
+		if err := r.Update(ctx, deployment); err != nil {
+			log.Error(err, "unable to update Deployment")
+			return err
+		}
+		log.Info("Updated watcher group Deployment", "Name", name, "RolledOut", rollout, "Replicas", replicas)
+	}
+	return r.reconcileDisruptionBudget(ctx, deployment)
+}
+
+// groupMembers returns the artifacts of a group in the namespace that run in pod mode, sorted by name so that the
+// containers of the group keep their order.
+func (r *KyvernoArtifactReconciler) groupMembers(ctx context.Context, namespace, group string) ([]kyvernov1alpha1.KyvernoArtifact, error) {
+	var artifacts kyvernov1alpha1.KyvernoArtifactList
+	if err := r.List(ctx, &artifacts, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	var members []kyvernov1alpha1.KyvernoArtifact
+	for _, artifact := range artifacts.Items {
+		if watcherGroup(&artifact) != group || !artifact.DeletionTimestamp.IsZero() ||
+			r.syncMode(&artifact) == kyvernov1alpha1.SyncModeInProcess {
+			continue
+		}
+		members = append(members, artifact)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members, nil
+}
+
+// leaveGroups removes the watcher of the named artifact from the group Deployments in the namespace other than
+// group, after it moved to another group, to its own Deployment or in-process, or was deleted.
+func (r *KyvernoArtifactReconciler) leaveGroups(ctx context.Context, namespace, artifactName, group string) error {
+	var deployments appsv1.DeploymentList
+	if err := r.List(ctx, &deployments, client.InNamespace(namespace), client.HasLabels{watcherGroupLabel}); err != nil {
+		return err
+	}
+	containerName := groupContainerName(artifactName)
+	for _, deployment := range deployments.Items {
+		other := deployment.Labels[watcherGroupLabel]
+		if other == group {
+			continue
+		}
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			if container.Name != containerName {
+				continue
+			}
+			if err := r.reconcileGroup(ctx, namespace, other); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// setWatcherTemplate sets template on deployment, and reports whether it differs from the template the
+// Deployment was last rolled out with. Templates are compared by the hash of the whole desired pod template, taken
+// before the API server fills in defaults, so that every field of the spec and of the operator configuration that
+// ends up in it triggers a rollout.
+func setWatcherTemplate(deployment *appsv1.Deployment, template corev1.PodTemplateSpec) (bool, error) {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return false, fmt.Errorf("unable to hash the watcher pod template: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if deployment.Annotations[templateHashAnnotation] == hash {
+		return false, nil
+	}
+	metav1.SetMetaDataAnnotation(&deployment.ObjectMeta, templateHashAnnotation, hash)
+	deployment.Spec.Template = template
+	return true, nil
+}
+
+// reconcileDisruptionBudget keeps one pod of a watcher Deployment with more than one replica running through
+// voluntary disruptions such as node drains. A single replica gets no budget, since it would block drains.
+func (r *KyvernoArtifactReconciler) reconcileDisruptionBudget(ctx context.Context, deployment *appsv1.Deployment) error {
+	pdb := &policyv1.PodDisruptionBudget{ObjectMeta: metav1.ObjectMeta{Name: deployment.Name, Namespace: deployment.Namespace}}
+	if deployment.Spec.Replicas == nil || *deployment.Spec.Replicas <= 1 {
+		if err := r.Delete(ctx, pdb); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, pdb, func() error {
+		minAvailable := intstr.FromInt32(1)
+		pdb.Labels = deployment.Labels
+		pdb.Spec.MinAvailable = &minAvailable
+		pdb.Spec.Selector = deployment.Spec.Selector
+		return controllerutil.SetControllerReference(deployment, pdb, r.Scheme)
+	})
+	return err
+}
+
+// deleteWatcher deletes the named watcher Deployment and its PodDisruptionBudget in the namespace.
+func (r *KyvernoArtifactReconciler) deleteWatcher(ctx context.Context, namespace, name string) error {
+	objs := []client.Object{
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}},
+		&policyv1.PodDisruptionBudget{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}},
+	}
+	for _, obj := range objs {
+		if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteLegacyPod deletes the bare watcher pod earlier versions of the operator ran for artifact, now that a
+// Deployment runs its watcher.
+func (r *KyvernoArtifactReconciler) deleteLegacyPod(ctx context.Context, artifact *kyvernov1alpha1.KyvernoArtifact) error {
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, client.ObjectKey{Name: watcherName(artifact.Name), Namespace: artifact.Namespace}, pod)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(pod, artifact) || !pod.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	logf.FromContext(ctx).Info("Deleting the watcher pod of an earlier version", "Name", pod.Name)
+	if err := r.Delete(ctx, pod); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// watcherPhase returns the phase the metrics report for the watcher of artifact: Running once one of its pods is
+// available, Pending before, and Unknown when its Deployment cannot be found.
+func (r *KyvernoArtifactReconciler) watcherPhase(ctx context.Context, artifact *kyvernov1alpha1.KyvernoArtifact) string {
+	name := watcherName(artifact.Name)
+	if group := watcherGroup(artifact); group != "" {
+		name = groupPrefix + group
+	}
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: artifact.Namespace}, deployment); err != nil {
+		return "Unknown"
+	}
+	if deployment.Status.AvailableReplicas > 0 {
+		return string(corev1.PodRunning)
+	}
+	return string(corev1.PodPending)
+}
+
+// artifactsForGroup maps the Deployment of a watcher group to the artifacts of the group, so that the group is
+// rebuilt when its Deployment is changed or deleted.
+func (r *KyvernoArtifactReconciler) artifactsForGroup(ctx context.Context, obj client.Object) []reconcile.Request {
+	group, ok := obj.GetLabels()[watcherGroupLabel]
+	if !ok {
+		return nil
+	}
+	members, err := r.groupMembers(ctx, obj.GetNamespace(), group)
+	if err != nil {
+		logf.FromContext(ctx).Error(err, "unable to list the artifacts of watcher group", "group", group)
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(members))
+	for _, member := range members {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&member)})
+	}
+	return requests
+}
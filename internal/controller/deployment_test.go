@@ -0,0 +1,236 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+)
+
+// newWatcherFixture returns a reconciler over a fake client holding the given objects.
+func newWatcherFixture(t *testing.T, objs ...client.Object) (*KyvernoArtifactReconciler, client.Client) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	_ = kyvernov1alpha1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		WithStatusSubresource(&kyvernov1alpha1.KyvernoArtifact{}).
+		Build()
+	return &KyvernoArtifactReconciler{Client: fakeClient, Scheme: scheme, Config: DefaultConfig()}, fakeClient
+}
+
+// newWatchedArtifact returns an artifact in pod mode with the given spec tweaks applied.
+func newWatchedArtifact(name string, mutate func(spec *kyvernov1alpha1.KyvernoArtifactSpec)) *kyvernov1alpha1.KyvernoArtifact {
+	artifact := &kyvernov1alpha1.KyvernoArtifact{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name + "-uid")},
+		Spec:       kyvernov1alpha1.KyvernoArtifactSpec{ArtifactUrl: ptrString("ghcr.io/owner/" + name + ":v1.0.0")},
+	}
+	if mutate != nil {
+		mutate(&artifact.Spec)
+	}
+	return artifact
+}
+
+func reconcileArtifact(t *testing.T, reconciler *KyvernoArtifactReconciler, name string) {
+	t.Helper()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "default"}}
+	if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile(%s) error = %v", name, err)
+	}
+}
+
+func TestReconcileKyvernoArtifact_Replicas(t *testing.T) {
+	artifact := newWatchedArtifact("security", func(spec *kyvernov1alpha1.KyvernoArtifactSpec) { spec.Replicas = ptrInt32(2) })
+	reconciler, fakeClient := newWatcherFixture(t, artifact)
+	key := client.ObjectKey{Name: "kyverno-artifact-manager-security", Namespace: "default"}
+
+	reconcileArtifact(t, reconciler, "security")
+	var deployment appsv1.Deployment
+	if err := fakeClient.Get(context.Background(), key, &deployment); err != nil {
+		t.Fatalf("Failed to get deployment: %v", err)
+	}
+	if *deployment.Spec.Replicas != 2 || deployment.Spec.Strategy.RollingUpdate.MaxUnavailable.IntValue() != 0 {
+		t.Errorf("deployment spec = %+v, want 2 replicas rolled out without downtime", deployment.Spec)
+	}
+	if !metav1.IsControlledBy(&deployment, artifact) {
+		t.Errorf("owner references = %v, want the artifact as controller", deployment.OwnerReferences)
+	}
+	env := make(map[string]string)
+	for _, e := range deployment.Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	if env["WATCHER_LEASE_NAME"] != "kyverno-artifact-manager-security" {
+		t.Errorf("WATCHER_LEASE_NAME = %q, want the lease of the artifact", env["WATCHER_LEASE_NAME"])
+	}
+
+	var pdb policyv1.PodDisruptionBudget
+	if err := fakeClient.Get(context.Background(), key, &pdb); err != nil {
+		t.Fatalf("PodDisruptionBudget should have been created: %v", err)
+	}
+	if pdb.Spec.MinAvailable.IntValue() != 1 || pdb.Spec.Selector.MatchLabels["app.kubernetes.io/instance"] != "security" {
+		t.Errorf("PodDisruptionBudget spec = %+v, want one watcher kept available", pdb.Spec)
+	}
+
+	// Scaling down to a single replica drops the budget, which would block node drains.
+	if err := fakeClient.Get(context.Background(), client.ObjectKeyFromObject(artifact), artifact); err != nil {
+		t.Fatal(err)
+	}
+	artifact.Spec.Replicas = nil
+	if err := fakeClient.Update(context.Background(), artifact); err != nil {
+		t.Fatal(err)
+	}
+	reconcileArtifact(t, reconciler, "security")
+	if err := fakeClient.Get(context.Background(), key, &deployment); err != nil {
+		t.Fatal(err)
+	}
+	if *deployment.Spec.Replicas != 1 {
+		t.Errorf("replicas = %d, want 1", *deployment.Spec.Replicas)
+	}
+	if err := fakeClient.Get(context.Background(), key, &pdb); !errors.IsNotFound(err) {
+		t.Errorf("PodDisruptionBudget should have been deleted, got %v", err)
+	}
+}
+
+func TestReconcileKyvernoArtifact_WatcherGroup(t *testing.T) {
+	inGroup := func(spec *kyvernov1alpha1.KyvernoArtifactSpec) { spec.WatcherGroup = ptrString("baseline") }
+	security := newWatchedArtifact("security", nil)
+	labels := newWatchedArtifact("labels", func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+		inGroup(spec)
+		spec.Replicas = ptrInt32(3)
+	})
+	reconciler, fakeClient := newWatcherFixture(t, security, labels)
+	groupKey := client.ObjectKey{Name: "kyverno-artifact-group-baseline", Namespace: "default"}
+	securityKey := client.ObjectKey{Name: "kyverno-artifact-manager-security", Namespace: "default"}
+
+	containers := func(wantReplicas int32) []string {
+		t.Helper()
+		var deployment appsv1.Deployment
+		if err := fakeClient.Get(context.Background(), groupKey, &deployment); err != nil {
+			t.Fatalf("Failed to get group deployment: %v", err)
+		}
+		var names []string
+		for _, c := range deployment.Spec.Template.Spec.Containers {
+			names = append(names, c.Name)
+		}
+		if *deployment.Spec.Replicas != wantReplicas || len(deployment.OwnerReferences) != len(names) {
+			t.Errorf("group deployment = %d replicas owned by %v, want the largest replicas owned by every artifact",
+				*deployment.Spec.Replicas, deployment.OwnerReferences)
+		}
+		return names
+	}
+
+	reconcileArtifact(t, reconciler, "labels")
+	reconcileArtifact(t, reconciler, "security")
+	if got := containers(3); strings.Join(got, ",") != "watcher-labels" {
+		t.Errorf("containers = %v, want only the artifact of the group", got)
+	}
+
+	// Joining the group moves the watcher out of the Deployment of the artifact.
+	if err := fakeClient.Get(context.Background(), client.ObjectKeyFromObject(security), security); err != nil {
+		t.Fatal(err)
+	}
+	inGroup(&security.Spec)
+	if err := fakeClient.Update(context.Background(), security); err != nil {
+		t.Fatal(err)
+	}
+	reconcileArtifact(t, reconciler, "security")
+	if got := containers(3); strings.Join(got, ",") != "watcher-labels,watcher-security" {
+		t.Errorf("containers = %v, want a container per artifact of the group", got)
+	}
+	if err := fakeClient.Get(context.Background(), securityKey, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Errorf("deployment of the artifact should have been deleted, got %v", err)
+	}
+	if requests := reconciler.artifactsForGroup(context.Background(), &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Labels: map[string]string{watcherGroupLabel: "baseline"}},
+	}); len(requests) != 2 {
+		t.Errorf("artifactsForGroup() = %v, want both artifacts of the group", requests)
+	}
+
+	// A deleted artifact leaves the group, and the group goes away with its last artifact.
+	if err := fakeClient.Delete(context.Background(), labels); err != nil {
+		t.Fatal(err)
+	}
+	reconcileArtifact(t, reconciler, "labels")
+	if got := containers(1); strings.Join(got, ",") != "watcher-security" {
+		t.Errorf("containers = %v, want the deleted artifact removed", got)
+	}
+	if err := fakeClient.Get(context.Background(), client.ObjectKeyFromObject(security), security); err != nil {
+		t.Fatal(err)
+	}
+	security.Spec.WatcherGroup = nil
+	if err := fakeClient.Update(context.Background(), security); err != nil {
+		t.Fatal(err)
+	}
+	reconcileArtifact(t, reconciler, "security")
+	if err := fakeClient.Get(context.Background(), groupKey, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Errorf("empty group deployment should have been deleted, got %v", err)
+	}
+	if err := fakeClient.Get(context.Background(), securityKey, &appsv1.Deployment{}); err != nil {
+		t.Errorf("deployment of the artifact should have been created: %v", err)
+	}
+}
+
+func TestReconcileKyvernoArtifact_DeletesLegacyPod(t *testing.T) {
+	artifact := newWatchedArtifact("security", nil)
+	legacy := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "kyverno-artifact-manager-security",
+		Namespace: "default",
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: kyvernov1alpha1.GroupVersion.String(),
+			Kind:       "KyvernoArtifact",
+			Name:       artifact.Name,
+			UID:        artifact.UID,
+			Controller: ptrBool(true),
+		}},
+	}}
+	reconciler, fakeClient := newWatcherFixture(t, artifact, legacy)
+
+	reconcileArtifact(t, reconciler, "security")
+	if err := fakeClient.Get(context.Background(), client.ObjectKeyFromObject(legacy), &corev1.Pod{}); !errors.IsNotFound(err) {
+		t.Errorf("watcher pod of an earlier version should have been deleted, got %v", err)
+	}
+}
+
+func TestGroupContainerName(t *testing.T) {
+	if got := groupContainerName("security"); got != "watcher-security" {
+		t.Errorf("groupContainerName() = %q, want watcher-security", got)
+	}
+	long := strings.Repeat("a", 60)
+	got := groupContainerName(long)
+	if len(got) > 63 || got == groupContainerName(long+"b") {
+		t.Errorf("groupContainerName() = %q, want a unique name of at most 63 characters", got)
+	}
+}
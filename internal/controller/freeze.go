@@ -0,0 +1,107 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"github.com/OctoKode/kyverno-artifact-operator/internal/k8s"
+)
+
+// getFreeze reads the operator-wide freeze from the freeze ConfigMap. No ConfigMap means no freeze.
+func (r *KyvernoArtifactReconciler) getFreeze(ctx context.Context) (k8s.Freeze, error) {
+	var configMap corev1.ConfigMap
+	key := client.ObjectKey{Namespace: r.Config.OperatorNamespace, Name: k8s.FreezeConfigMapName}
+	if err := r.Get(ctx, key, &configMap); err != nil {
+		if errors.IsNotFound(err) {
+			return k8s.Freeze{}, nil
+		}
+		return k8s.Freeze{}, err
+	}
+	freeze, err := k8s.ParseFreeze(configMap.Data)
+	if err != nil {
+		logf.FromContext(ctx).Error(err, "invalid freeze ConfigMap, pausing changes", "ConfigMap", key.String())
+		if freeze.Reason == "" {
+			freeze.Reason = fmt.Sprintf("invalid freeze ConfigMap: %v", err)
+		}
+	}
+	return freeze, nil
+}
+
+// reconcileFreeze records the operator-wide freeze in the Frozen condition of artifact, which its watcher acts
+// on. An artifact that was never frozen gets no condition.
+func (r *KyvernoArtifactReconciler) reconcileFreeze(ctx context.Context, artifact *kyvernov1alpha1.KyvernoArtifact) error {
+	freeze, err := r.getFreeze(ctx)
+	if err != nil {
+		return err
+	}
+
+	condition := metav1.Condition{
+		Type:    kyvernov1alpha1.ConditionFrozen,
+		Status:  metav1.ConditionFalse,
+		Reason:  "NotFrozen",
+		Message: "Policy changes are not frozen",
+	}
+	switch {
+	case freeze.Enabled && freeze.Mode == k8s.FreezeModeAudit:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = kyvernov1alpha1.FrozenReasonAudit
+		condition.Message = "Policy changes are frozen operator-wide and managed policies are switched to Audit"
+	case freeze.Enabled:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = kyvernov1alpha1.FrozenReasonPaused
+		condition.Message = "Policy changes are frozen operator-wide"
+	case meta.FindStatusCondition(artifact.Status.Conditions, kyvernov1alpha1.ConditionFrozen) == nil:
+		return nil
+	}
+	if freeze.Enabled && freeze.Reason != "" {
+		condition.Message += ": " + freeze.Reason
+	}
+
+	if !meta.SetStatusCondition(&artifact.Status.Conditions, condition) {
+		return nil
+	}
+	return r.Status().Update(ctx, artifact)
+}
+
+// artifactsForFreeze maps a change of the freeze ConfigMap to every KyvernoArtifact, so that the freeze shows up
+// on all of them right away.
+func (r *KyvernoArtifactReconciler) artifactsForFreeze(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetNamespace() != r.Config.OperatorNamespace || obj.GetName() != k8s.FreezeConfigMapName {
+		return nil
+	}
+	var artifacts kyvernov1alpha1.KyvernoArtifactList
+	if err := r.List(ctx, &artifacts); err != nil {
+		logf.FromContext(ctx).Error(err, "unable to list KyvernoArtifacts for the freeze")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(artifacts.Items))
+	for _, artifact := range artifacts.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&artifact)})
+	}
+	return requests
+}
@@ -16,9 +16,61 @@ limitations under the License.
 
 package controller
 
+import (
+	"encoding/json"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+)
+
 func ptrString(s string) *string {
 	return &s
 }
 func ptrInt32(i int32) *int32 {
 	return &i
 }
+
+// jsonEnvField is a structured spec field passed to the watcher as a JSON-encoded environment variable.
+type jsonEnvField struct {
+	name  string
+	value interface{}
+}
+
+// jsonEnvFields lists the structured spec fields the watcher reads, in the order they are added to the pod.
+func jsonEnvFields(spec *kyvernov1alpha1.KyvernoArtifactSpec) []jsonEnvField {
+	return []jsonEnvField{
+		{name: "WATCHER_COMMON_LABELS", value: spec.CommonLabels},
+		{name: "WATCHER_COMMON_ANNOTATIONS", value: spec.CommonAnnotations},
+		{name: "WATCHER_INCLUDE", value: spec.Include},
+		{name: "WATCHER_EXCLUDE", value: spec.Exclude},
+		{name: "WATCHER_PRUNE", value: spec.Prune},
+		{name: "WATCHER_SUBSTITUTE", value: spec.Substitute},
+		{name: "WATCHER_SUBSTITUTE_FROM", value: spec.SubstituteFrom},
+		{name: "WATCHER_SUBSTITUTE_STRICT", value: spec.SubstituteStrict},
+		{name: "WATCHER_KUSTOMIZE", value: spec.Kustomize},
+		{name: "WATCHER_HELM", value: spec.Helm},
+		{name: "WATCHER_PATCHES", value: spec.Patches},
+		{name: "WATCHER_GLOBAL_EXCLUDE", value: spec.GlobalExclude},
+		{name: "WATCHER_SAFETY_LIMITS", value: spec.SafetyLimits},
+		{name: "WATCHER_SMOKE_TESTS", value: spec.SmokeTests},
+		{name: "WATCHER_NAMESPACE_SELECTOR", value: spec.NamespaceSelector},
+		{name: "WATCHER_ADOPTION", value: spec.Adoption},
+		{name: "WATCHER_TARGETS", value: spec.Targets},
+		{name: "WATCHER_APPROVAL", value: spec.Approval},
+		{name: "WATCHER_SYNC_WINDOWS", value: spec.SyncWindows},
+	}
+}
+
+// encodeEnvJSON encodes a spec field for an environment variable. Unset and empty values encode to "",
+// so that the variable is left out of the pod.
+func encodeEnvJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	switch encoded := string(data); encoded {
+	case "null", "{}", "[]":
+		return "", nil
+	default:
+		return encoded, nil
+	}
+}
@@ -145,3 +145,27 @@ func TestPtrInt32NilCheck(t *testing.T) {
 		t.Error("pointer value should remain unchanged when original changes")
 	}
 }
+
+func TestEncodeEnvJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{name: "nil map", value: map[string]string(nil), want: ""},
+		{name: "empty map", value: map[string]string{}, want: ""},
+		{name: "keys are sorted", value: map[string]string{"b": "2", "a": "1"}, want: `{"a":"1","b":"2"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encodeEnvJSON(tt.value)
+			if err != nil {
+				t.Fatalf("encodeEnvJSON() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("encodeEnvJSON() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
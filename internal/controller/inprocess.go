@@ -0,0 +1,442 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"github.com/OctoKode/kyverno-artifact-operator/internal/watcher"
+)
+
+const (
+	// cleanupFinalizer keeps an in-process artifact with deletePoliciesOnTermination until its policies are deleted.
+	cleanupFinalizer = "kyverno.octokode.io/cleanup"
+	// envHashAnnotation records on the state ConfigMap which watcher environment the state belongs to.
+	envHashAnnotation = "kyverno.octokode.io/env-hash"
+	// inProcessPhase is reported by the phase metric for artifacts synced in-process, which have no pod.
+	inProcessPhase = "InProcess"
+)
+
+var (
+	// syncArtifactFunc can be overridden in tests
+	syncArtifactFunc = watcher.Sync
+	// cleanupArtifactFunc can be overridden in tests
+	cleanupArtifactFunc = watcher.Cleanup
+)
+
+// inProcessSync records the generation of an in-process artifact that was synced last, and when it is due again.
+type inProcessSync struct {
+	generation int64
+	next       time.Time
+}
+
+// syncMode returns where artifact is synced: in its own watcher pod or in-process.
+func (r *KyvernoArtifactReconciler) syncMode(artifact *kyvernov1alpha1.KyvernoArtifact) string {
+	if artifact.Spec.SyncMode != nil && *artifact.Spec.SyncMode != "" {
+		return *artifact.Spec.SyncMode
+	}
+	return r.Config.SyncMode
+}
+
+func (r *KyvernoArtifactReconciler) reader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// stateConfigMapName returns the name of the ConfigMap holding the watcher state of an in-process artifact.
+func stateConfigMapName(artifactName string) string {
+	return fmt.Sprintf("kyverno-artifact-state-%s", artifactName)
+}
+
+// stateDir returns the directory an in-process sync of the artifact works in.
+func (r *KyvernoArtifactReconciler) stateDir(key types.NamespacedName) string {
+	return filepath.Join(r.Config.StateDir, key.Namespace, key.Name)
+}
+
+// reconcileInProcess syncs artifact inside the operator, the way its watcher pod would, and requeues it after
+// the polling interval.
+func (r *KyvernoArtifactReconciler) reconcileInProcess(ctx context.Context, artifact *kyvernov1alpha1.KyvernoArtifact) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+	key := client.ObjectKeyFromObject(artifact)
+
+	// An artifact switched from pod mode leaves its watcher group, and waits until its watcher Deployment and its
+	// pods are gone, so that no watcher applies next to the in-process sync.
+	if err := r.leaveGroups(ctx, artifact.Namespace, artifact.Name, ""); err != nil {
+		log.Error(err, "unable to remove the artifact from its watcher group")
+		return ctrl.Result{}, err
+	}
+	name := watcherName(artifact.Name)
+	for _, watcher := range []client.Object{&appsv1.Deployment{}, &corev1.Pod{}} {
+		if err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: artifact.Namespace}, watcher); err == nil {
+			if watcher.GetDeletionTimestamp().IsZero() {
+				log.Info("Artifact is synced in-process, deleting its watcher", "Name", name)
+				if err := r.Delete(ctx, watcher, client.PropagationPolicy(metav1.DeletePropagationForeground)); err != nil && !errors.IsNotFound(err) {
+					log.Error(err, "unable to delete the watcher")
+					return ctrl.Result{}, err
+				}
+			}
+			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		} else if !errors.IsNotFound(err) {
+			log.Error(err, "unable to fetch the watcher")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if !artifact.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalizeInProcess(ctx, artifact)
+	}
+
+	// The policies of a deleted artifact are deleted before it goes away, like a watcher pod does on termination
+	deleteOnTermination := artifact.Spec.DeletePoliciesOnTermination != nil && *artifact.Spec.DeletePoliciesOnTermination
+	var changed bool
+	if deleteOnTermination {
+		changed = controllerutil.AddFinalizer(artifact, cleanupFinalizer)
+	} else {
+		changed = controllerutil.RemoveFinalizer(artifact, cleanupFinalizer)
+	}
+	if changed {
+		if err := r.Update(ctx, artifact); err != nil {
+			log.Error(err, "unable to update finalizers")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.reconcileFreeze(ctx, artifact); err != nil {
+		log.Error(err, "unable to update the Frozen condition")
+		return ctrl.Result{}, err
+	}
+
+	// Events between polls, like the status updates of the sync itself, do not poll again. A spec change does.
+	if wait := r.untilNextSync(key, artifact.Generation); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	config, envHash, err := r.inProcessConfig(ctx, artifact)
+	if err != nil {
+		log.Error(err, "unable to configure the in-process sync")
+		return ctrl.Result{}, err
+	}
+	if err := syncArtifactFunc(config); err != nil {
+		// Like in a watcher pod, a failed poll is retried on the next one. The failure is on the status.
+		log.Error(err, "in-process sync failed")
+	}
+	if err := r.saveState(ctx, artifact, config.StateDir, envHash); err != nil {
+		log.Error(err, "unable to save the sync state")
+		return ctrl.Result{}, err
+	}
+
+	interval := time.Duration(config.PollInterval) * time.Second
+	r.recordSync(key, artifact.Generation, interval)
+	r.updateMetrics(ctx)
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// inProcessConfig builds the watcher configuration of artifact from the environment its watcher pod would get,
+// with the credentials read from the watcher secret, and restores its state. It also returns the hash of the
+// environment, which the state belongs to.
+func (r *KyvernoArtifactReconciler) inProcessConfig(ctx context.Context, artifact *kyvernov1alpha1.KyvernoArtifact) (*watcher.Config, string, error) {
+	if artifact.Spec.ArtifactUrl == nil || *artifact.Spec.ArtifactUrl == "" {
+		return nil, "", fmt.Errorf("spec.ArtifactUrl is required but not set")
+	}
+	envVars, err := r.watcherEnv(artifact)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := json.Marshal(envVars)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(data)
+	envHash := hex.EncodeToString(sum[:])
+
+	env, err := r.resolveEnv(ctx, artifact.Namespace, envVars)
+	if err != nil {
+		return nil, "", err
+	}
+	stateDir := r.stateDir(client.ObjectKeyFromObject(artifact))
+	if err := r.restoreState(ctx, artifact, stateDir, envHash); err != nil {
+		return nil, "", fmt.Errorf("unable to restore the sync state: %w", err)
+	}
+	config, err := watcher.NewConfig(func(name string) string { return env[name] }, stateDir)
+	if err != nil {
+		return nil, "", err
+	}
+	config.PullDir = stateDir
+	return config, envHash, nil
+}
+
+// resolveEnv resolves envVars the way the kubelet does for a watcher pod in namespace.
+func (r *KyvernoArtifactReconciler) resolveEnv(ctx context.Context, namespace string, envVars []corev1.EnvVar) (map[string]string, error) {
+	env := make(map[string]string, len(envVars))
+	secrets := map[string]*corev1.Secret{}
+	for _, envVar := range envVars {
+		switch {
+		case envVar.ValueFrom == nil:
+			env[envVar.Name] = envVar.Value
+		case envVar.ValueFrom.SecretKeyRef != nil:
+			ref := envVar.ValueFrom.SecretKeyRef
+			secret, ok := secrets[ref.Name]
+			if !ok {
+				secret = &corev1.Secret{}
+				if err := r.reader().Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+					return nil, fmt.Errorf("unable to read secret %s/%s: %w", namespace, ref.Name, err)
+				}
+				secrets[ref.Name] = secret
+			}
+			value, ok := secret.Data[ref.Key]
+			if !ok {
+				return nil, fmt.Errorf("secret %s/%s has no key %s", namespace, ref.Name, ref.Key)
+			}
+			env[envVar.Name] = string(value)
+		case envVar.ValueFrom.FieldRef != nil && envVar.ValueFrom.FieldRef.FieldPath == "metadata.namespace":
+			env[envVar.Name] = namespace
+		}
+	}
+	return env, nil
+}
+
+// restoreState writes the state files kept in the state ConfigMap of artifact to stateDir and removes any other
+// files, so that a sync picks up where the last one left off, even on another operator replica. State recorded
+// for a different environment is dropped, so that the sync starts from scratch like a recreated watcher pod.
+func (r *KyvernoArtifactReconciler) restoreState(ctx context.Context, artifact *kyvernov1alpha1.KyvernoArtifact, stateDir, envHash string) error {
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return err
+	}
+	var state corev1.ConfigMap
+	key := client.ObjectKey{Namespace: artifact.Namespace, Name: stateConfigMapName(artifact.Name)}
+	if err := r.reader().Get(ctx, key, &state); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	data := state.Data
+	if state.Annotations[envHashAnnotation] != envHash {
+		data = nil
+	}
+
+	entries, err := os.ReadDir(stateDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, ok := data[entry.Name()]; ok || entry.IsDir() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(stateDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	for name, value := range data {
+		if err := os.WriteFile(filepath.Join(stateDir, name), []byte(value), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveState stores the state files in stateDir in the state ConfigMap of artifact. Pulled revisions live in
+// directories and are not stored.
+func (r *KyvernoArtifactReconciler) saveState(ctx context.Context, artifact *kyvernov1alpha1.KyvernoArtifact, stateDir, envHash string) error {
+	entries, err := os.ReadDir(stateDir)
+	if err != nil {
+		return err
+	}
+	data := map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(stateDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		data[entry.Name()] = string(content)
+	}
+
+	state := &corev1.ConfigMap{}
+	key := client.ObjectKey{Namespace: artifact.Namespace, Name: stateConfigMapName(artifact.Name)}
+	if err := r.reader().Get(ctx, key, state); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		state = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+				Labels: map[string]string{
+					"app.kubernetes.io/name":       "kyverno-artifact-watcher",
+					"app.kubernetes.io/instance":   artifact.Name,
+					"app.kubernetes.io/managed-by": "kyverno-artifact-operator",
+					"app.kubernetes.io/component":  "state",
+				},
+				Annotations: map[string]string{envHashAnnotation: envHash},
+			},
+			Data: data,
+		}
+		if err := controllerutil.SetControllerReference(artifact, state, r.Scheme); err != nil {
+			return err
+		}
+		return r.Create(ctx, state)
+	}
+	if state.Annotations[envHashAnnotation] == envHash && maps.Equal(state.Data, data) {
+		return nil
+	}
+	if state.Annotations == nil {
+		state.Annotations = map[string]string{}
+	}
+	state.Annotations[envHashAnnotation] = envHash
+	state.Data = data
+	return r.Update(ctx, state)
+}
+
+// finalizeInProcess deletes the policies of a deleted in-process artifact, like its watcher pod would on
+// termination, and lets it go. When the sync cannot be configured, for example because the watcher secret was
+// deleted with it, the policies are left to the garbage collector.
+func (r *KyvernoArtifactReconciler) finalizeInProcess(ctx context.Context, artifact *kyvernov1alpha1.KyvernoArtifact) error {
+	log := logf.FromContext(ctx)
+	if controllerutil.ContainsFinalizer(artifact, cleanupFinalizer) {
+		config, _, err := r.inProcessConfig(ctx, artifact)
+		if err != nil {
+			log.Error(err, "unable to configure the cleanup, leaving the policies to the garbage collector")
+		} else if err := cleanupArtifactFunc(config); err != nil {
+			log.Error(err, "unable to clean up policies")
+			return err
+		}
+		controllerutil.RemoveFinalizer(artifact, cleanupFinalizer)
+		if err := r.Update(ctx, artifact); err != nil {
+			log.Error(err, "unable to update finalizers")
+			return err
+		}
+	}
+	r.forgetInProcess(client.ObjectKeyFromObject(artifact))
+	return nil
+}
+
+// releaseInProcess cleans up after an artifact that was switched from in-process to pod mode. The watcher pod
+// starts from scratch, so the sync state and the cleanup finalizer are dropped.
+func (r *KyvernoArtifactReconciler) releaseInProcess(ctx context.Context, artifact *kyvernov1alpha1.KyvernoArtifact) error {
+	key := client.ObjectKeyFromObject(artifact)
+	r.syncsMu.Lock()
+	_, synced := r.syncs[key]
+	r.syncsMu.Unlock()
+	if !synced && !controllerutil.ContainsFinalizer(artifact, cleanupFinalizer) {
+		return nil
+	}
+
+	state := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: stateConfigMapName(artifact.Name), Namespace: artifact.Namespace}}
+	if err := r.Delete(ctx, state); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if controllerutil.RemoveFinalizer(artifact, cleanupFinalizer) {
+		if err := r.Update(ctx, artifact); err != nil {
+			return err
+		}
+	}
+	r.forgetInProcess(key)
+	return nil
+}
+
+// untilNextSync returns how long the in-process artifact has to wait for its next sync. It is due right away
+// when it was not synced yet or its spec changed since.
+func (r *KyvernoArtifactReconciler) untilNextSync(key types.NamespacedName, generation int64) time.Duration {
+	r.syncsMu.Lock()
+	defer r.syncsMu.Unlock()
+	last, ok := r.syncs[key]
+	if !ok || last.generation != generation {
+		return 0
+	}
+	return time.Until(last.next)
+}
+
+// recordSync records that generation of the in-process artifact was synced and is due again after interval.
+func (r *KyvernoArtifactReconciler) recordSync(key types.NamespacedName, generation int64, interval time.Duration) {
+	r.syncsMu.Lock()
+	defer r.syncsMu.Unlock()
+	if r.syncs == nil {
+		r.syncs = map[types.NamespacedName]inProcessSync{}
+	}
+	r.syncs[key] = inProcessSync{generation: generation, next: time.Now().Add(interval)}
+}
+
+// syncNow makes the in-process artifact due for a sync on its next reconciliation.
+func (r *KyvernoArtifactReconciler) syncNow(key types.NamespacedName) {
+	r.syncsMu.Lock()
+	defer r.syncsMu.Unlock()
+	if last, ok := r.syncs[key]; ok {
+		last.next = time.Now()
+		r.syncs[key] = last
+	}
+}
+
+// artifactsForNamespace maps a Namespace to the in-process artifacts whose namespaceSelector matches it, and makes
+// them due, so that copies are stamped and removed right away, as a watcher pod's namespace watch does. Updates
+// are mapped for the old and the new labels, which covers a namespace that stops matching.
+func (r *KyvernoArtifactReconciler) artifactsForNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	var artifacts kyvernov1alpha1.KyvernoArtifactList
+	if err := r.List(ctx, &artifacts); err != nil {
+		logf.FromContext(ctx).Error(err, "unable to list KyvernoArtifacts for the namespace", "namespace", obj.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, artifact := range artifacts.Items {
+		if artifact.Spec.NamespaceSelector == nil || r.syncMode(&artifact) != kyvernov1alpha1.SyncModeInProcess {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(artifact.Spec.NamespaceSelector)
+		if err != nil || !selector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+		key := client.ObjectKeyFromObject(&artifact)
+		r.syncNow(key)
+		requests = append(requests, reconcile.Request{NamespacedName: key})
+	}
+	return requests
+}
+
+// forgetInProcess drops what is kept in memory and on disk for the in-process sync of an artifact.
+func (r *KyvernoArtifactReconciler) forgetInProcess(key types.NamespacedName) {
+	r.syncsMu.Lock()
+	delete(r.syncs, key)
+	r.syncsMu.Unlock()
+	if r.Config.StateDir == "" {
+		return
+	}
+	if err := os.RemoveAll(r.stateDir(key)); err != nil {
+		logf.Log.Error(err, "unable to remove the sync state directory", "artifact", key.String())
+	}
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"github.com/OctoKode/kyverno-artifact-operator/internal/watcher"
+)
+
+// newInProcessFixture returns a fake client holding an in-process artifact and the watcher secret.
+func newInProcessFixture(t *testing.T, spec kyvernov1alpha1.KyvernoArtifactSpec, objs ...client.Object) (client.Client, *runtime.Scheme) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	_ = kyvernov1alpha1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
+
+	spec.ArtifactUrl = ptrString("ghcr.io/owner/package:v1.0.0")
+	spec.PollingInterval = ptrInt32(30)
+	spec.SyncMode = ptrString(kyvernov1alpha1.SyncModeInProcess)
+	artifact := &kyvernov1alpha1.KyvernoArtifact{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-artifact", Namespace: "default", UID: "test-uid-123", Generation: 1},
+		Spec:       spec,
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "kyverno-watcher-secret", Namespace: "default"},
+		Data:       map[string][]byte{"github-token": []byte("test-token")},
+	}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(append([]client.Object{artifact, secret}, objs...)...).
+		WithStatusSubresource(&kyvernov1alpha1.KyvernoArtifact{}).
+		Build()
+	return fakeClient, scheme
+}
+
+func TestReconcileKyvernoArtifact_InProcess(t *testing.T) {
+	watcherDeployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "kyverno-artifact-manager-test-artifact", Namespace: "default"}}
+	fakeClient, scheme := newInProcessFixture(t, kyvernov1alpha1.KyvernoArtifactSpec{}, watcherDeployment)
+
+	// The sync records the revision it applied in its state, like the watcher does.
+	var synced []*watcher.Config
+	var restored []string
+	originalSyncArtifact := syncArtifactFunc
+	syncArtifactFunc = func(config *watcher.Config) error {
+		synced = append(synced, config)
+		last, _ := os.ReadFile(config.LastFile)
+		restored = append(restored, string(last))
+		return os.WriteFile(config.LastFile, []byte("v1.0.0"), 0644)
+	}
+	defer func() { syncArtifactFunc = originalSyncArtifact }()
+
+	config := DefaultConfig()
+	config.StateDir = t.TempDir()
+	reconciler := &KyvernoArtifactReconciler{Client: fakeClient, Scheme: scheme, Config: config}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-artifact", Namespace: "default"}}
+	reconcile := func(r *KyvernoArtifactReconciler) ctrl.Result {
+		t.Helper()
+		result, err := r.Reconcile(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		return result
+	}
+
+	// The watcher Deployment of an artifact switched from pod mode is deleted before the first sync.
+	if result := reconcile(reconciler); result.RequeueAfter != 5*time.Second || len(synced) != 0 {
+		t.Errorf("Reconcile() = %+v with %d sync(s), want a requeue while the watcher goes away", result, len(synced))
+	}
+	if err := fakeClient.Get(context.Background(), client.ObjectKeyFromObject(watcherDeployment), &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Errorf("watcher Deployment should have been deleted, got %v", err)
+	}
+
+	if result := reconcile(reconciler); result.RequeueAfter != 30*time.Second {
+		t.Errorf("Reconcile() RequeueAfter = %v, want the polling interval", result.RequeueAfter)
+	}
+	if len(synced) != 1 {
+		t.Fatalf("expected 1 sync, got %d", len(synced))
+	}
+	if got := synced[0]; got.ArtifactName != "test-artifact" || got.PodNamespace != "default" || got.GithubToken != "test-token" ||
+		got.PullDir != got.StateDir || filepath.Dir(got.LastFile) != filepath.Join(config.StateDir, "default", "test-artifact") {
+		t.Errorf("sync config = %+v, want it built from the artifact and the watcher secret", got)
+	}
+	var state corev1.ConfigMap
+	stateKey := client.ObjectKey{Name: "kyverno-artifact-state-test-artifact", Namespace: "default"}
+	if err := fakeClient.Get(context.Background(), stateKey, &state); err != nil {
+		t.Fatalf("state ConfigMap should have been created: %v", err)
+	}
+	if state.Data["last_seen"] != "v1.0.0" || state.Annotations[envHashAnnotation] == "" {
+		t.Errorf("state ConfigMap = %+v, want the state files and the environment hash", state)
+	}
+
+	// Events before the next poll do not sync again.
+	if result := reconcile(reconciler); result.RequeueAfter <= 0 || result.RequeueAfter > 30*time.Second || len(synced) != 1 {
+		t.Errorf("Reconcile() = %+v with %d sync(s), want to wait for the next poll", result, len(synced))
+	}
+
+	// Another operator replica picks up the state where the last sync left it.
+	config.StateDir = t.TempDir()
+	reconciler = &KyvernoArtifactReconciler{Client: fakeClient, Scheme: scheme, Config: config}
+	reconcile(reconciler)
+	if len(synced) != 2 || restored[1] != "v1.0.0" {
+		t.Errorf("syncs restored %q, want the last seen revision restored", restored)
+	}
+
+	// A spec change syncs right away, and starts from scratch like a recreated watcher pod.
+	var artifact kyvernov1alpha1.KyvernoArtifact
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, &artifact); err != nil {
+		t.Fatal(err)
+	}
+	artifact.Spec.CommonLabels = map[string]string{"team": "platform"}
+	artifact.Generation++
+	if err := fakeClient.Update(context.Background(), &artifact); err != nil {
+		t.Fatal(err)
+	}
+	reconcile(reconciler)
+	if len(synced) != 3 || restored[2] != "" || synced[2].CommonLabels["team"] != "platform" {
+		t.Errorf("syncs restored %q, want a spec change synced from scratch", restored)
+	}
+
+	// Switching back to pod mode creates the watcher Deployment and drops the state.
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, &artifact); err != nil {
+		t.Fatal(err)
+	}
+	artifact.Spec.SyncMode = ptrString(kyvernov1alpha1.SyncModePod)
+	if err := fakeClient.Update(context.Background(), &artifact); err != nil {
+		t.Fatal(err)
+	}
+	reconcile(reconciler)
+	if err := fakeClient.Get(context.Background(), client.ObjectKeyFromObject(watcherDeployment), &appsv1.Deployment{}); err != nil {
+		t.Errorf("watcher Deployment should have been created: %v", err)
+	}
+	if err := fakeClient.Get(context.Background(), stateKey, &state); !errors.IsNotFound(err) {
+		t.Errorf("state ConfigMap should have been deleted, got %v", err)
+	}
+}
+
+func TestReconcileKyvernoArtifact_InProcessMissingSecret(t *testing.T) {
+	fakeClient, scheme := newInProcessFixture(t, kyvernov1alpha1.KyvernoArtifactSpec{ArtifactProvider: ptrString("artifactory")})
+
+	originalSyncArtifact := syncArtifactFunc
+	syncArtifactFunc = func(config *watcher.Config) error {
+		t.Error("an artifact without credentials should not be synced")
+		return nil
+	}
+	defer func() { syncArtifactFunc = originalSyncArtifact }()
+
+	config := DefaultConfig()
+	config.StateDir = t.TempDir()
+	reconciler := &KyvernoArtifactReconciler{Client: fakeClient, Scheme: scheme, Config: config}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-artifact", Namespace: "default"}}
+	if _, err := reconciler.Reconcile(context.Background(), req); err == nil {
+		t.Error("Reconcile() should fail when the secret has no artifactory credentials")
+	}
+}
+
+func TestReconcileKyvernoArtifact_InProcessDeletion(t *testing.T) {
+	fakeClient, scheme := newInProcessFixture(t, kyvernov1alpha1.KyvernoArtifactSpec{DeletePoliciesOnTermination: ptrBool(true)})
+
+	originalSyncArtifact := syncArtifactFunc
+	syncArtifactFunc = func(config *watcher.Config) error { return nil }
+	defer func() { syncArtifactFunc = originalSyncArtifact }()
+	var cleanedUp []string
+	originalCleanupArtifact := cleanupArtifactFunc
+	cleanupArtifactFunc = func(config *watcher.Config) error {
+		cleanedUp = append(cleanedUp, config.ArtifactName)
+		return nil
+	}
+	defer func() { cleanupArtifactFunc = originalCleanupArtifact }()
+
+	config := DefaultConfig()
+	config.StateDir = t.TempDir()
+	reconciler := &KyvernoArtifactReconciler{Client: fakeClient, Scheme: scheme, Config: config}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-artifact", Namespace: "default"}}
+	if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	var artifact kyvernov1alpha1.KyvernoArtifact
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, &artifact); err != nil {
+		t.Fatal(err)
+	}
+	if !controllerutil.ContainsFinalizer(&artifact, cleanupFinalizer) {
+		t.Fatalf("finalizers = %v, want the cleanup finalizer", artifact.Finalizers)
+	}
+
+	if err := fakeClient.Delete(context.Background(), &artifact); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(cleanedUp) != 1 || cleanedUp[0] != "test-artifact" {
+		t.Errorf("cleaned up %v, want the policies of the deleted artifact cleaned up", cleanedUp)
+	}
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, &artifact); !errors.IsNotFound(err) {
+		t.Errorf("artifact should be gone once its policies are cleaned up, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.StateDir, "default", "test-artifact")); !os.IsNotExist(err) {
+		t.Errorf("state directory should have been removed, got %v", err)
+	}
+}
+
+func TestArtifactsForNamespace(t *testing.T) {
+	fakeClient, scheme := newInProcessFixture(t, kyvernov1alpha1.KyvernoArtifactSpec{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}},
+	}, &kyvernov1alpha1.KyvernoArtifact{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-artifact", Namespace: "default"},
+		Spec: kyvernov1alpha1.KyvernoArtifactSpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}},
+		},
+	})
+	reconciler := &KyvernoArtifactReconciler{Client: fakeClient, Scheme: scheme, Config: DefaultConfig()}
+	key := types.NamespacedName{Name: "test-artifact", Namespace: "default"}
+	reconciler.recordSync(key, 1, time.Hour)
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "billing", Labels: map[string]string{"team": "billing"}}}
+	if requests := reconciler.artifactsForNamespace(context.Background(), namespace); len(requests) != 0 {
+		t.Errorf("artifactsForNamespace() = %v, want none for a namespace that does not match", requests)
+	}
+	if wait := reconciler.untilNextSync(key, 1); wait <= 0 {
+		t.Errorf("untilNextSync() = %v, want to wait for the next poll", wait)
+	}
+
+	// Only the in-process artifact is enqueued; a watcher pod watches namespaces itself.
+	namespace.Labels["team"] = "payments"
+	requests := reconciler.artifactsForNamespace(context.Background(), namespace)
+	if len(requests) != 1 || requests[0].NamespacedName != key {
+		t.Errorf("artifactsForNamespace() = %v, want the in-process artifact", requests)
+	}
+	if wait := reconciler.untilNextSync(key, 1); wait > 0 {
+		t.Errorf("untilNextSync() = %v, want the artifact due right away", wait)
+	}
+}
@@ -19,14 +19,12 @@ package controller
 import (
 	"context"
 	"fmt"
-	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
 	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
@@ -40,7 +38,14 @@ const (
 // +kubebuilder:rbac:groups=kyverno.octokode.io,resources=kyvernoartifacts/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=kyverno.octokode.io,resources=kyvernoartifacts/finalizers,verbs=update
 // +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=kyverno.io,resources=policies;clusterpolicies,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=kyverno.io,resources=policies;clusterpolicies;policyexceptions;cleanuppolicies;clustercleanuppolicies;globalcontextentries,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=policies.kyverno.io,resources=validatingpolicies;imagevalidatingpolicies;mutatingpolicies;generatingpolicies;deletingpolicies;policyexceptions,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingadmissionpolicies;validatingadmissionpolicybindings;mutatingadmissionpolicies;mutatingadmissionpolicybindings,verbs=get;list;watch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -54,8 +59,14 @@ func (r *KyvernoArtifactReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	var kyvernoArtifact kyvernov1alpha1.KyvernoArtifact
 	if err := r.Get(ctx, req.NamespacedName, &kyvernoArtifact); err != nil {
 		if errors.IsNotFound(err) {
-			// Resource was deleted - this is expected, pods will be garbage collected via owner references
-			log.Info("KyvernoArtifact deleted, associated pods will be cleaned up automatically", "name", req.Name, "namespace", req.Namespace)
+			// Resource was deleted - this is expected, its Deployment will be garbage collected via owner references
+			log.Info("KyvernoArtifact deleted, associated watchers will be cleaned up automatically", "name", req.Name, "namespace", req.Namespace)
+			r.forgetInProcess(req.NamespacedName)
+			// A watcher group only drops the artifact once the group is rebuilt without it
+			if err := r.leaveGroups(ctx, req.Namespace, req.Name, ""); err != nil {
+				log.Error(err, "unable to remove the artifact from its watcher group")
+				return ctrl.Result{}, err
+			}
 			return ctrl.Result{}, nil
 		}
 		// Unexpected error
@@ -66,277 +77,197 @@ func (r *KyvernoArtifactReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	// Add your reconciliation logic here
 	log.Info("Reconciling KyvernoArtifact", "Name", kyvernoArtifact.Name, "Url", kyvernoArtifact.Spec.ArtifactUrl, "PollingInterval", kyvernoArtifact.Spec.PollingInterval)
 
-	podName := fmt.Sprintf("kyverno-artifact-manager-%s", kyvernoArtifact.Name)
-	pod := &corev1.Pod{}
-	err := r.Get(ctx, client.ObjectKey{Name: podName, Namespace: kyvernoArtifact.Namespace}, pod)
-
-	if err != nil && errors.IsNotFound(err) {
-		// Validate that ArtifactUrl is set
-		if kyvernoArtifact.Spec.ArtifactUrl == nil || *kyvernoArtifact.Spec.ArtifactUrl == "" {
-			err := fmt.Errorf("spec.ArtifactUrl is required but not set")
-			log.Error(err, "unable to create Pod without artifact URL")
-			return ctrl.Result{}, err
-		}
+	// In-process artifacts are synced by the operator itself instead of a watcher pod
+	if r.syncMode(&kyvernoArtifact) == kyvernov1alpha1.SyncModeInProcess {
+		return r.reconcileInProcess(ctx, &kyvernoArtifact)
+	}
+	if err := r.releaseInProcess(ctx, &kyvernoArtifact); err != nil {
+		log.Error(err, "unable to clean up the in-process sync")
+		return ctrl.Result{}, err
+	}
 
-		artifactUrl := *kyvernoArtifact.Spec.ArtifactUrl
+	// Run the watcher of the artifact in its own Deployment, or in the Deployment of its group
+	if err := r.reconcileWatcher(ctx, &kyvernoArtifact); err != nil {
+		log.Error(err, "unable to reconcile the watcher")
+		return ctrl.Result{}, err
+	}
 
-		pollingInterval := "60"
-		if kyvernoArtifact.Spec.PollingInterval != nil {
-			pollingInterval = fmt.Sprintf("%d", *kyvernoArtifact.Spec.PollingInterval)
-		}
+	// Show an operator-wide freeze on the artifact, for its watcher to act on
+	if err := r.reconcileFreeze(ctx, &kyvernoArtifact); err != nil {
+		log.Error(err, "unable to update the Frozen condition")
+		return ctrl.Result{}, err
+	}
 
-		// Determine provider from spec, default to "github" for backward compatibility
-		provider := providerGitHub
-		if kyvernoArtifact.Spec.ArtifactProvider != nil && *kyvernoArtifact.Spec.ArtifactProvider != "" {
-			provider = *kyvernoArtifact.Spec.ArtifactProvider
-		}
+	// Update metrics after successful reconciliation
+	r.updateMetrics(ctx)
 
-		// Build environment variables based on provider
-		envVars := []corev1.EnvVar{
-			{
-				Name:  "IMAGE_BASE",
-				Value: artifactUrl,
-			},
-			{
-				Name:  "POLL_INTERVAL",
-				Value: pollingInterval,
-			},
-			{
-				Name:  "PROVIDER",
-				Value: provider,
-			},
-			{
-				Name:  "ARTIFACT_NAME",
-				Value: kyvernoArtifact.Name,
-			},
-		}
+	return ctrl.Result{}, nil
+}
 
-		if kyvernoArtifact.Spec.DeletePoliciesOnTermination != nil && *kyvernoArtifact.Spec.DeletePoliciesOnTermination {
-			envVars = append(envVars, corev1.EnvVar{
-				Name: "WATCHER_DELETE_POLICIES_ON_TERMINATION",
-				//nolint:goconst // Required value for environment variable
-				Value: "true",
-			})
-		}
+// watcherEnv builds the environment variables of the watcher of artifact. Credentials are referenced from the
+// watcher secret, and POD_NAMESPACE from the namespace the watcher runs in.
+func (r *KyvernoArtifactReconciler) watcherEnv(artifact *kyvernov1alpha1.KyvernoArtifact) ([]corev1.EnvVar, error) {
+	artifactUrl := *artifact.Spec.ArtifactUrl
 
-		if kyvernoArtifact.Spec.ReconcilePoliciesFromChecksum != nil {
-			envVars = append(envVars, corev1.EnvVar{
-				Name:  "WATCHER_CHECKSUM_RECONCILIATION_ENABLED",
-				Value: fmt.Sprintf("%t", *kyvernoArtifact.Spec.ReconcilePoliciesFromChecksum),
-			})
-		}
+	pollingInterval := "60"
+	if artifact.Spec.PollingInterval != nil {
+		pollingInterval = fmt.Sprintf("%d", *artifact.Spec.PollingInterval)
+	}
 
-		if kyvernoArtifact.Spec.PollForTagChanges != nil {
-			envVars = append(envVars, corev1.EnvVar{
-				Name:  "WATCHER_POLL_FOR_TAG_CHANGES_ENABLED",
-				Value: fmt.Sprintf("%t", *kyvernoArtifact.Spec.PollForTagChanges),
-			})
-		}
+	// Determine provider from spec, default to "github" for backward compatibility
+	provider := providerGitHub
+	if artifact.Spec.ArtifactProvider != nil && *artifact.Spec.ArtifactProvider != "" {
+		provider = *artifact.Spec.ArtifactProvider
+	}
 
-		// Add provider-specific credentials
-		switch provider {
-		case providerGitHub:
-			envVars = append(envVars, corev1.EnvVar{
-				Name: "GITHUB_TOKEN",
-				ValueFrom: &corev1.EnvVarSource{
-					SecretKeyRef: &corev1.SecretKeySelector{
-						Key: r.Config.GitHubTokenKey,
-						LocalObjectReference: corev1.LocalObjectReference{
-							Name: r.Config.SecretName,
-						},
-					},
-				},
-			})
-		case "artifactory":
-			envVars = append(envVars, corev1.EnvVar{
-				Name: "ARTIFACTORY_USERNAME",
-				ValueFrom: &corev1.EnvVarSource{
-					SecretKeyRef: &corev1.SecretKeySelector{
-						Key: r.Config.ArtifactoryUsernameKey,
-						LocalObjectReference: corev1.LocalObjectReference{
-							Name: r.Config.SecretName,
-						},
-					},
-				},
-			}, corev1.EnvVar{
-				Name: "ARTIFACTORY_PASSWORD",
-				ValueFrom: &corev1.EnvVarSource{
-					SecretKeyRef: &corev1.SecretKeySelector{
-						Key: r.Config.ArtifactoryPasswordKey,
-						LocalObjectReference: corev1.LocalObjectReference{
-							Name: r.Config.SecretName,
-						},
-					},
-				},
-			})
-		}
+	// Build environment variables based on provider
+	envVars := []corev1.EnvVar{
+		{
+			Name:  "IMAGE_BASE",
+			Value: artifactUrl,
+		},
+		{
+			Name:  "POLL_INTERVAL",
+			Value: pollingInterval,
+		},
+		{
+			Name:  "PROVIDER",
+			Value: provider,
+		},
+		{
+			Name:  "ARTIFACT_NAME",
+			Value: artifact.Name,
+		},
+	}
 
-		// Inject WATCHER_IMAGE and POD_NAMESPACE for self-reconciliation.
-		// WATCHER_IMAGE provides the expected image version for the watcher pod to compare against.
-		// POD_NAMESPACE allows the watcher to discover other pods in its own namespace for reconciliation.
+	if artifact.Spec.DeletePoliciesOnTermination != nil && *artifact.Spec.DeletePoliciesOnTermination {
 		envVars = append(envVars, corev1.EnvVar{
-			Name:  "WATCHER_IMAGE",
-			Value: r.Config.WatcherImage,
-		}, corev1.EnvVar{
-			Name: "POD_NAMESPACE",
-			ValueFrom: &corev1.EnvVarSource{
-				FieldRef: &corev1.ObjectFieldSelector{
-					FieldPath: "metadata.namespace",
-				},
-			},
+			Name: "WATCHER_DELETE_POLICIES_ON_TERMINATION",
+			//nolint:goconst // Required value for environment variable
+			Value: "true",
 		})
+	}
 
-		pod = &corev1.Pod{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      podName,
-				Namespace: kyvernoArtifact.Namespace,
-				// Apply standardized labels to the watcher pod for better discoverability and management.
-				// These labels are crucial for the watcher's self-reconciliation logic to find other watcher pods.
-				Labels: map[string]string{
-					"app.kubernetes.io/name":       "kyverno-artifact-watcher",
-					"app.kubernetes.io/instance":   kyvernoArtifact.Name, // Identifies the KyvernoArtifact resource instance
-					"app.kubernetes.io/managed-by": "kyverno-artifact-operator",
-					"app.kubernetes.io/component":  "watcher",
-				},
-			},
-			Spec: corev1.PodSpec{
-				ServiceAccountName: r.Config.WatcherServiceAccount,
-				Containers: []corev1.Container{
-					{
-						Name:            "watcher",
-						Image:           r.Config.WatcherImage,
-						ImagePullPolicy: corev1.PullAlways,
-						Args:            []string{"-watcher"},
-						Env:             envVars,
-						VolumeMounts: []corev1.VolumeMount{
-							{
-								Name:      "tmp",
-								MountPath: "/tmp",
-							},
-						},
-					},
-				},
-				Volumes: []corev1.Volume{
-					{
-						Name: "tmp",
-						VolumeSource: corev1.VolumeSource{
-							EmptyDir: &corev1.EmptyDirVolumeSource{},
-						},
-					},
-				},
-				RestartPolicy: corev1.RestartPolicyAlways,
-			},
-		}
-
-		if err := controllerutil.SetControllerReference(&kyvernoArtifact, pod, r.Scheme); err != nil {
-			log.Error(err, "unable to set controller reference for Pod")
-			return ctrl.Result{}, err
-		}
-
-		if err := r.Create(ctx, pod); err != nil {
-			return ctrl.Result{}, err
-		}
-		log.Info("Created Pod", "Name", podName)
-	} else if err != nil {
-		log.Error(err, "unable to fetch Pod")
-		return ctrl.Result{}, err
-	} else {
-		// Pod exists - check if it needs to be recreated
-
-		// Check if pod is in a terminal state
-		if pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
-			// The Owns() relationship will trigger reconciliation when the pod is deleted
-			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
-		}
-
-		// Check if the pod configuration needs to be updated by comparing env vars
-		needsUpdate := false
+	if artifact.Spec.ReconcilePoliciesFromChecksum != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "WATCHER_CHECKSUM_RECONCILIATION_ENABLED",
+			Value: fmt.Sprintf("%t", *artifact.Spec.ReconcilePoliciesFromChecksum),
+		})
+	}
 
-		// Get current artifact URL and polling interval from spec
-		currentArtifactUrl := ""
-		if kyvernoArtifact.Spec.ArtifactUrl != nil {
-			currentArtifactUrl = *kyvernoArtifact.Spec.ArtifactUrl
-		}
+	if artifact.Spec.PollForTagChanges != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "WATCHER_POLL_FOR_TAG_CHANGES_ENABLED",
+			Value: fmt.Sprintf("%t", *artifact.Spec.PollForTagChanges),
+		})
+	}
 
-		currentPollingInterval := "60"
-		if kyvernoArtifact.Spec.PollingInterval != nil {
-			currentPollingInterval = fmt.Sprintf("%d", *kyvernoArtifact.Spec.PollingInterval)
-		}
+	if artifact.Spec.ApplyConcurrency != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "WATCHER_APPLY_CONCURRENCY",
+			Value: fmt.Sprintf("%d", *artifact.Spec.ApplyConcurrency),
+		})
+	}
 
-		currentProvider := providerGitHub
-		if kyvernoArtifact.Spec.ArtifactProvider != nil && *kyvernoArtifact.Spec.ArtifactProvider != "" {
-			currentProvider = *kyvernoArtifact.Spec.ArtifactProvider
-		}
+	if artifact.Spec.KubeAPIQPS != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "KUBE_API_QPS",
+			Value: fmt.Sprintf("%d", *artifact.Spec.KubeAPIQPS),
+		})
+	}
 
-		// Check if the pod's environment variables match the current spec
-		if len(pod.Spec.Containers) > 0 {
-			container := pod.Spec.Containers[0]
-			envMap := make(map[string]string)
-			for _, env := range container.Env {
-				if env.Value != "" {
-					envMap[env.Name] = env.Value
-				}
-			}
+	if artifact.Spec.KubeAPIBurst != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "KUBE_API_BURST",
+			Value: fmt.Sprintf("%d", *artifact.Spec.KubeAPIBurst),
+		})
+	}
 
-			// Check if IMAGE_BASE or POLL_INTERVAL or PROVIDER has changed
-			if envMap["IMAGE_BASE"] != currentArtifactUrl {
-				log.Info("Pod needs update: IMAGE_BASE changed", "old", envMap["IMAGE_BASE"], "new", currentArtifactUrl)
-				needsUpdate = true
-			}
-			if envMap["POLL_INTERVAL"] != currentPollingInterval {
-				log.Info("Pod needs update: POLL_INTERVAL changed", "old", envMap["POLL_INTERVAL"], "new", currentPollingInterval)
-				needsUpdate = true
-			}
-			if envMap["PROVIDER"] != currentProvider {
-				log.Info("Pod needs update: PROVIDER changed", "old", envMap["PROVIDER"], "new", currentProvider)
-				needsUpdate = true
-			}
+	if artifact.Spec.ArtifactType != nil && *artifact.Spec.ArtifactType != "" {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "WATCHER_ARTIFACT_TYPE",
+			Value: *artifact.Spec.ArtifactType,
+		})
+	}
 
-			// Check if WATCHER_POLL_FOR_TAG_CHANGES_ENABLED has changed
-			//nolint:goconst // This is the default in the watcher
-			currentPollForTagChanges := "true"
-			if kyvernoArtifact.Spec.PollForTagChanges != nil {
-				currentPollForTagChanges = fmt.Sprintf("%t", *kyvernoArtifact.Spec.PollForTagChanges)
-			}
-			podPollForTagChanges, ok := envMap["WATCHER_POLL_FOR_TAG_CHANGES_ENABLED"]
-			if !ok {
-				// If the env var is not set in the pod, assume the default value
-				//nolint:goconst // This is the default in the watcher
-				podPollForTagChanges = "true"
-			}
-			if podPollForTagChanges != currentPollForTagChanges {
-				log.Info("Pod needs update: WATCHER_POLL_FOR_TAG_CHANGES_ENABLED changed", "old", podPollForTagChanges, "new", currentPollForTagChanges)
-				needsUpdate = true
-			}
+	if artifact.Spec.NamePrefix != nil && *artifact.Spec.NamePrefix != "" {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "WATCHER_NAME_PREFIX",
+			Value: *artifact.Spec.NamePrefix,
+		})
+	}
+	if artifact.Spec.NameSuffix != nil && *artifact.Spec.NameSuffix != "" {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "WATCHER_NAME_SUFFIX",
+			Value: *artifact.Spec.NameSuffix,
+		})
+	}
 
-			// Check if the pod's image needs to be updated
-			// Crucial check for watcher self-reconciliation: ensure the watcher pod is running the latest image.
-			// If the image of the running pod's container doesn't match the expected WatcherImage from the controller's config,
-			// it indicates that the operator itself has been upgraded and this watcher pod is now outdated.
-			// Deleting it will cause Kubernetes to recreate the pod with the correct (latest) image.
-			if container.Image != r.Config.WatcherImage {
-				log.Info("Pod needs update: watcher image changed", "old", container.Image, "new", r.Config.WatcherImage)
-				needsUpdate = true
-			}
+	// Structured spec fields are passed to the watcher as JSON
+	for _, field := range jsonEnvFields(&artifact.Spec) {
+		encoded, err := encodeEnvJSON(field.value)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode %s: %w", field.name, err)
 		}
-
-		if needsUpdate {
-			log.Info("Pod configuration changed, deleting for recreation", "Name", podName)
-			if err := r.Delete(ctx, pod); err != nil && !errors.IsNotFound(err) {
-				log.Error(err, "unable to delete Pod for update")
-				return ctrl.Result{}, err
-			}
-			// The Owns() relationship will trigger reconciliation when the pod is deleted
-			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		if encoded != "" {
+			envVars = append(envVars, corev1.EnvVar{Name: field.name, Value: encoded})
 		}
+	}
 
-		log.Info("Pod already exists and is running", "Name", podName, "Phase", pod.Status.Phase)
+	// Add provider-specific credentials
+	switch provider {
+	case providerGitHub:
+		envVars = append(envVars, corev1.EnvVar{
+			Name: "GITHUB_TOKEN",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					Key: r.Config.GitHubTokenKey,
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: r.Config.SecretName,
+					},
+				},
+			},
+		})
+	case "artifactory":
+		envVars = append(envVars, corev1.EnvVar{
+			Name: "ARTIFACTORY_USERNAME",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					Key: r.Config.ArtifactoryUsernameKey,
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: r.Config.SecretName,
+					},
+				},
+			},
+		}, corev1.EnvVar{
+			Name: "ARTIFACTORY_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					Key: r.Config.ArtifactoryPasswordKey,
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: r.Config.SecretName,
+					},
+				},
+			},
+		})
 	}
 
-	// Update metrics after successful reconciliation
-	r.updateMetrics(ctx)
+	// Inject WATCHER_IMAGE and POD_NAMESPACE for self-reconciliation.
+	// WATCHER_IMAGE provides the expected image version for the watcher pod to compare against.
+	// POD_NAMESPACE allows the watcher to discover other pods in its own namespace for reconciliation.
+	envVars = append(envVars, corev1.EnvVar{
+		Name:  "WATCHER_IMAGE",
+		Value: r.Config.WatcherImage,
+	}, corev1.EnvVar{
+		Name: "POD_NAMESPACE",
+		ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{
+				FieldPath: "metadata.namespace",
+			},
+		},
+	})
 
-	return ctrl.Result{}, nil
+	return envVars, nil
 }
 
 // updateMetrics collects and updates Prometheus metrics for KyvernoArtifacts
@@ -355,17 +286,11 @@ func (r *KyvernoArtifactReconciler) updateMetrics(ctx context.Context) {
 	// Count by pod phase
 	phaseCount := make(map[string]int)
 	for _, artifact := range artifactList.Items {
-		podName := fmt.Sprintf("kyverno-artifact-manager-%s", artifact.Name)
-		pod := &corev1.Pod{}
-		err := r.Get(ctx, client.ObjectKey{Name: podName, Namespace: artifact.Namespace}, pod)
-
-		var phase string
-		if err != nil {
-			phase = "Unknown"
-		} else {
-			phase = string(pod.Status.Phase)
+		if r.syncMode(&artifact) == kyvernov1alpha1.SyncModeInProcess {
+			phaseCount[inProcessPhase]++
+			continue
 		}
-		phaseCount[phase]++
+		phaseCount[r.watcherPhase(ctx, &artifact)]++
 	}
 
 	// Reset all phase metrics first
@@ -375,13 +300,27 @@ func (r *KyvernoArtifactReconciler) updateMetrics(ctx context.Context) {
 	for phase, count := range phaseCount {
 		ArtifactsByPhase.WithLabelValues(phase).Set(float64(count))
 	}
+
+	// Each conflict is recorded on both artifacts; only count it from the side that was refused.
+	ConflictingObjects.Reset()
+	for _, artifact := range artifactList.Items {
+		for _, c := range artifact.Status.Conflicts {
+			if c.ClaimedBy != artifact.Name || (c.ClaimedByNamespace != "" && c.ClaimedByNamespace != artifact.Namespace) {
+				continue
+			}
+			ConflictingObjects.WithLabelValues(c.Kind, c.Namespace, c.Name, c.OwnedBy, c.ClaimedBy).Set(1)
+		}
+	}
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *KyvernoArtifactReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kyvernov1alpha1.KyvernoArtifact{}).
-		Owns(&corev1.Pod{}).
+		Owns(&appsv1.Deployment{}).
+		Watches(&appsv1.Deployment{}, handler.EnqueueRequestsFromMapFunc(r.artifactsForGroup)).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.artifactsForFreeze)).
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.artifactsForNamespace)).
 		Named("kyvernoartifact").
 		Complete(r)
 }
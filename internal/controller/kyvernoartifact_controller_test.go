@@ -19,8 +19,14 @@ package controller
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -106,6 +112,8 @@ func TestReconcileKyvernoArtifact_NotFound(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = kyvernov1alpha1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
 
 	fakeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
 
@@ -132,10 +140,12 @@ func TestReconcileKyvernoArtifact_NotFound(t *testing.T) {
 	}
 }
 
-func TestReconcileKyvernoArtifact_CreatePod(t *testing.T) {
+func TestReconcileKyvernoArtifact_CreateDeployment(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = kyvernov1alpha1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
 
 	artifact := &kyvernov1alpha1.KyvernoArtifact{
 		ObjectMeta: metav1.ObjectMeta{
@@ -187,15 +197,15 @@ func TestReconcileKyvernoArtifact_CreatePod(t *testing.T) {
 		t.Error("Reconcile() should not requeue on success")
 	}
 
-	// Verify pod was created
-	var pods corev1.PodList
-	err = fakeClient.List(context.Background(), &pods, client.InNamespace("default"))
+	// Verify deployment was created
+	var deployments appsv1.DeploymentList
+	err = fakeClient.List(context.Background(), &deployments, client.InNamespace("default"))
 	if err != nil {
-		t.Fatalf("Failed to list pods: %v", err)
+		t.Fatalf("Failed to list deployments: %v", err)
 	}
 
-	if len(pods.Items) != 1 {
-		t.Errorf("Expected 1 pod to be created, got %d", len(pods.Items))
+	if len(deployments.Items) != 1 {
+		t.Errorf("Expected 1 deployment to be created, got %d", len(deployments.Items))
 	}
 }
 
@@ -203,6 +213,8 @@ func TestReconcileKyvernoArtifact_MissingSecret(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = kyvernov1alpha1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
 
 	artifact := &kyvernov1alpha1.KyvernoArtifact{
 		ObjectMeta: metav1.ObjectMeta{
@@ -245,15 +257,15 @@ func TestReconcileKyvernoArtifact_MissingSecret(t *testing.T) {
 		t.Error("Reconcile() should not requeue when creating pod")
 	}
 
-	// Verify pod was created with secret reference
-	var pods corev1.PodList
-	err = fakeClient.List(context.Background(), &pods, client.InNamespace("default"))
+	// Verify deployment was created with secret reference
+	var deployments appsv1.DeploymentList
+	err = fakeClient.List(context.Background(), &deployments, client.InNamespace("default"))
 	if err != nil {
-		t.Fatalf("Failed to list pods: %v", err)
+		t.Fatalf("Failed to list deployments: %v", err)
 	}
 
-	if len(pods.Items) != 1 {
-		t.Errorf("Expected 1 pod to be created, got %d", len(pods.Items))
+	if len(deployments.Items) != 1 {
+		t.Errorf("Expected 1 deployment to be created, got %d", len(deployments.Items))
 	}
 }
 
@@ -267,6 +279,8 @@ func TestReconcileKyvernoArtifact_StatusUpdate(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = kyvernov1alpha1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
 
 	artifact := &kyvernov1alpha1.KyvernoArtifact{
 		ObjectMeta: metav1.ObjectMeta{
@@ -333,6 +347,8 @@ func TestReconcileKyvernoArtifact_ArtifactoryProvider(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = kyvernov1alpha1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
 
 	artifact := &kyvernov1alpha1.KyvernoArtifact{
 		ObjectMeta: metav1.ObjectMeta{
@@ -384,18 +400,18 @@ func TestReconcileKyvernoArtifact_ArtifactoryProvider(t *testing.T) {
 		t.Error("Reconcile() should not requeue on success")
 	}
 
-	// Verify pod was created with correct environment
-	var pods corev1.PodList
-	err = fakeClient.List(context.Background(), &pods, client.InNamespace("default"))
+	// Verify deployment was created with correct environment
+	var deployments appsv1.DeploymentList
+	err = fakeClient.List(context.Background(), &deployments, client.InNamespace("default"))
 	if err != nil {
-		t.Fatalf("Failed to list pods: %v", err)
+		t.Fatalf("Failed to list deployments: %v", err)
 	}
 
-	if len(pods.Items) != 1 {
-		t.Fatalf("Expected 1 pod to be created, got %d", len(pods.Items))
+	if len(deployments.Items) != 1 {
+		t.Fatalf("Expected 1 deployment to be created, got %d", len(deployments.Items))
 	}
 
-	pod := pods.Items[0]
+	pod := deployments.Items[0].Spec.Template
 	if len(pod.Spec.Containers) == 0 {
 		t.Fatal("Pod should have at least one container")
 	}
@@ -444,6 +460,8 @@ func TestReconcileKyvernoArtifact_WithCustomPollInterval(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = kyvernov1alpha1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
 
 	artifact := &kyvernov1alpha1.KyvernoArtifact{
 		ObjectMeta: metav1.ObjectMeta{
@@ -492,17 +510,17 @@ func TestReconcileKyvernoArtifact_WithCustomPollInterval(t *testing.T) {
 	}
 
 	// Verify pod has correct POLL_INTERVAL
-	var pods corev1.PodList
-	err = fakeClient.List(context.Background(), &pods, client.InNamespace("default"))
+	var deployments appsv1.DeploymentList
+	err = fakeClient.List(context.Background(), &deployments, client.InNamespace("default"))
 	if err != nil {
-		t.Fatalf("Failed to list pods: %v", err)
+		t.Fatalf("Failed to list deployments: %v", err)
 	}
 
-	if len(pods.Items) != 1 {
-		t.Fatalf("Expected 1 pod, got %d", len(pods.Items))
+	if len(deployments.Items) != 1 {
+		t.Fatalf("Expected 1 deployment, got %d", len(deployments.Items))
 	}
 
-	container := pods.Items[0].Spec.Containers[0]
+	container := deployments.Items[0].Spec.Template.Spec.Containers[0]
 	pollIntervalEnv := ""
 	for _, env := range container.Env {
 		if env.Name == "POLL_INTERVAL" {
@@ -520,6 +538,8 @@ func TestReconcileKyvernoArtifact_WithZeroPollInterval(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = kyvernov1alpha1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
 
 	artifact := &kyvernov1alpha1.KyvernoArtifact{
 		ObjectMeta: metav1.ObjectMeta{
@@ -568,17 +588,17 @@ func TestReconcileKyvernoArtifact_WithZeroPollInterval(t *testing.T) {
 	}
 
 	// Verify pod has correct POLL_INTERVAL
-	var pods corev1.PodList
-	err = fakeClient.List(context.Background(), &pods, client.InNamespace("default"))
+	var deployments appsv1.DeploymentList
+	err = fakeClient.List(context.Background(), &deployments, client.InNamespace("default"))
 	if err != nil {
-		t.Fatalf("Failed to list pods: %v", err)
+		t.Fatalf("Failed to list deployments: %v", err)
 	}
 
-	if len(pods.Items) != 1 {
-		t.Fatalf("Expected 1 pod, got %d", len(pods.Items))
+	if len(deployments.Items) != 1 {
+		t.Fatalf("Expected 1 deployment, got %d", len(deployments.Items))
 	}
 
-	container := pods.Items[0].Spec.Containers[0]
+	container := deployments.Items[0].Spec.Template.Spec.Containers[0]
 	pollIntervalEnv := ""
 	for _, env := range container.Env {
 		if env.Name == "POLL_INTERVAL" {
@@ -598,6 +618,8 @@ func TestSetupWithManager(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = kyvernov1alpha1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
 
 	reconciler := &KyvernoArtifactReconciler{
 		Scheme: scheme,
@@ -617,6 +639,8 @@ func TestReconcileKyvernoArtifact_RequeueAfterDelay(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = kyvernov1alpha1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
 
 	artifact := &kyvernov1alpha1.KyvernoArtifact{
 		ObjectMeta: metav1.ObjectMeta{
@@ -665,6 +689,8 @@ func TestReconcileKyvernoArtifact_MetricsUpdate(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = kyvernov1alpha1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
 
 	artifact := &kyvernov1alpha1.KyvernoArtifact{
 		ObjectMeta: metav1.ObjectMeta{
@@ -721,10 +747,45 @@ func TestReconcileKyvernoArtifact_MetricsUpdate(t *testing.T) {
 	}
 }
 
+func TestUpdateMetrics_ConflictingObjects(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = kyvernov1alpha1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
+
+	conflict := kyvernov1alpha1.OwnershipConflict{Kind: "ClusterPolicy", Name: "require-labels", OwnedBy: "team-a", ClaimedBy: "team-b"}
+	owner := &kyvernov1alpha1.KyvernoArtifact{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "default"},
+		Status:     kyvernov1alpha1.KyvernoArtifactStatus{Conflicts: []kyvernov1alpha1.OwnershipConflict{conflict}},
+	}
+	claimant := &kyvernov1alpha1.KyvernoArtifact{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-b", Namespace: "default"},
+		Status:     kyvernov1alpha1.KyvernoArtifactStatus{Conflicts: []kyvernov1alpha1.OwnershipConflict{conflict}},
+	}
+
+	reconciler := &KyvernoArtifactReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(owner, claimant).Build(),
+		Scheme: scheme,
+		Config: DefaultConfig(),
+	}
+	reconciler.updateMetrics(context.Background())
+
+	// The conflict is recorded on both artifacts but must only be counted once.
+	if got := testutil.CollectAndCount(ConflictingObjects); got != 1 {
+		t.Errorf("ConflictingObjects has %d series, want 1", got)
+	}
+	if got := testutil.ToFloat64(ConflictingObjects.WithLabelValues("ClusterPolicy", "", "require-labels", "team-a", "team-b")); got != 1 {
+		t.Errorf("ConflictingObjects = %v, want 1", got)
+	}
+}
+
 func TestReconcileKyvernoArtifact_DeletePoliciesOnTermination(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = kyvernov1alpha1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
 
 	tests := []struct {
 		name                        string
@@ -797,17 +858,17 @@ func TestReconcileKyvernoArtifact_DeletePoliciesOnTermination(t *testing.T) {
 			}
 
 			// Verify pod has correct WATCHER_DELETE_POLICIES_ON_TERMINATION env var
-			var pods corev1.PodList
-			err = fakeClient.List(context.Background(), &pods, client.InNamespace("default"))
+			var deployments appsv1.DeploymentList
+			err = fakeClient.List(context.Background(), &deployments, client.InNamespace("default"))
 			if err != nil {
-				t.Fatalf("Failed to list pods: %v", err)
+				t.Fatalf("Failed to list deployments: %v", err)
 			}
 
-			if len(pods.Items) != 1 {
-				t.Fatalf("Expected 1 pod, got %d", len(pods.Items))
+			if len(deployments.Items) != 1 {
+				t.Fatalf("Expected 1 deployment, got %d", len(deployments.Items))
 			}
 
-			container := pods.Items[0].Spec.Containers[0]
+			container := deployments.Items[0].Spec.Template.Spec.Containers[0]
 			foundEnvVar := false
 			for _, env := range container.Env {
 				if env.Name == "WATCHER_DELETE_POLICIES_ON_TERMINATION" {
@@ -829,3 +890,592 @@ func TestReconcileKyvernoArtifact_DeletePoliciesOnTermination(t *testing.T) {
 func ptrBool(b bool) *bool {
 	return &b
 }
+
+// reconcileAndGetWatcherEnv reconciles a KyvernoArtifact with the given spec and returns the
+// plain-value environment variables of the watcher container that was created for it.
+func reconcileAndGetWatcherEnv(t *testing.T, spec kyvernov1alpha1.KyvernoArtifactSpec) map[string]string {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	_ = kyvernov1alpha1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
+
+	artifact := &kyvernov1alpha1.KyvernoArtifact{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-artifact",
+			Namespace: "default",
+			UID:       "test-uid-123",
+		},
+		Spec: spec,
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(artifact).
+		Build()
+
+	reconciler := &KyvernoArtifactReconciler{
+		Client: fakeClient,
+		Scheme: scheme,
+		Config: DefaultConfig(),
+	}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-artifact", Namespace: "default"}}
+	if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v, want nil", err)
+	}
+
+	var deployments appsv1.DeploymentList
+	if err := fakeClient.List(context.Background(), &deployments, client.InNamespace("default")); err != nil {
+		t.Fatalf("Failed to list deployments: %v", err)
+	}
+	if len(deployments.Items) != 1 {
+		t.Fatalf("Expected 1 deployment, got %d", len(deployments.Items))
+	}
+
+	env := make(map[string]string)
+	for _, e := range deployments.Items[0].Spec.Template.Spec.Containers[0].Env {
+		if e.ValueFrom == nil {
+			env[e.Name] = e.Value
+		}
+	}
+	return env
+}
+
+func TestReconcileKyvernoArtifact_ApplyTuning(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    kyvernov1alpha1.KyvernoArtifactSpec
+		want    map[string]string
+		notWant []string
+	}{
+		{
+			name: "tuning fields set",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl:      ptrString("ghcr.io/owner/package:v1.0.0"),
+				ApplyConcurrency: ptrInt32(16),
+				KubeAPIQPS:       ptrInt32(50),
+				KubeAPIBurst:     ptrInt32(100),
+			},
+			want: map[string]string{
+				"WATCHER_APPLY_CONCURRENCY": "16",
+				"KUBE_API_QPS":              "50",
+				"KUBE_API_BURST":            "100",
+			},
+		},
+		{
+			name: "tuning fields unset",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl: ptrString("ghcr.io/owner/package:v1.0.0"),
+			},
+			notWant: []string{"WATCHER_APPLY_CONCURRENCY", "KUBE_API_QPS", "KUBE_API_BURST"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := reconcileAndGetWatcherEnv(t, tt.spec)
+			for name, value := range tt.want {
+				if env[name] != value {
+					t.Errorf("%s = %q, want %q", name, env[name], value)
+				}
+			}
+			for _, name := range tt.notWant {
+				if _, ok := env[name]; ok {
+					t.Errorf("%s should not be set", name)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileKyvernoArtifact_NamePrefixChangeRecreatesPod(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = kyvernov1alpha1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
+
+	artifact := &kyvernov1alpha1.KyvernoArtifact{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-artifact",
+			Namespace: "default",
+			UID:       "test-uid-123",
+		},
+		Spec: kyvernov1alpha1.KyvernoArtifactSpec{
+			ArtifactUrl: ptrString("ghcr.io/owner/package:v1.0.0"),
+			NamePrefix:  ptrString("vendor-"),
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(artifact).
+		Build()
+
+	reconciler := &KyvernoArtifactReconciler{
+		Client: fakeClient,
+		Scheme: scheme,
+		Config: DefaultConfig(),
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-artifact", Namespace: "default"}}
+	deploymentKey := types.NamespacedName{Name: "kyverno-artifact-manager-test-artifact", Namespace: "default"}
+
+	if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := fakeClient.Get(context.Background(), deploymentKey, deployment); err != nil {
+		t.Fatalf("Failed to get deployment: %v", err)
+	}
+	found := false
+	for _, e := range deployment.Spec.Template.Spec.Containers[0].Env {
+		if e.Name == "WATCHER_NAME_PREFIX" && e.Value == "vendor-" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("WATCHER_NAME_PREFIX should be set to vendor-")
+	}
+	hash := deployment.Annotations[templateHashAnnotation]
+
+	// Reconciling an unchanged spec keeps the pods.
+	if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := fakeClient.Get(context.Background(), deploymentKey, deployment); err != nil {
+		t.Fatalf("Deployment should still exist for an unchanged spec: %v", err)
+	}
+	if deployment.Annotations[templateHashAnnotation] != hash {
+		t.Error("Pods should be kept for an unchanged spec")
+	}
+
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, artifact); err != nil {
+		t.Fatalf("Failed to get artifact: %v", err)
+	}
+	artifact.Spec.NamePrefix = ptrString("acme-")
+	if err := fakeClient.Update(context.Background(), artifact); err != nil {
+		t.Fatalf("Failed to update artifact: %v", err)
+	}
+	if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := fakeClient.Get(context.Background(), deploymentKey, deployment); err != nil {
+		t.Fatalf("Failed to get deployment: %v", err)
+	}
+	if deployment.Annotations[templateHashAnnotation] == hash {
+		t.Error("Pods should be recreated when the name prefix changes")
+	}
+}
+
+func TestReconcileKyvernoArtifact_SpecChangeRollsOutDeployment(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    kyvernov1alpha1.KyvernoArtifactSpec
+		wantEnv map[string]string
+		change  func(spec *kyvernov1alpha1.KyvernoArtifactSpec)
+	}{
+		{
+			name: "delete policies on termination",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl: ptrString("ghcr.io/owner/package:v1.0.0"),
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.DeletePoliciesOnTermination = ptrBool(true)
+			},
+		},
+		{
+			name: "checksum reconciliation",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl: ptrString("ghcr.io/owner/package:v1.0.0"),
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.ReconcilePoliciesFromChecksum = ptrBool(true)
+			},
+		},
+		{
+			name: "common labels",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl:       ptrString("ghcr.io/owner/package:v1.0.0"),
+				CommonLabels:      map[string]string{"team": "platform", "cost-center": "42"},
+				CommonAnnotations: map[string]string{"policies.kyverno.io/severity": "medium"},
+			},
+			wantEnv: map[string]string{
+				"WATCHER_COMMON_LABELS":      `{"cost-center":"42","team":"platform"}`,
+				"WATCHER_COMMON_ANNOTATIONS": `{"policies.kyverno.io/severity":"medium"}`,
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				delete(spec.CommonLabels, "cost-center")
+			},
+		},
+		{
+			name: "include filters and pruning",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl: ptrString("ghcr.io/owner/package:v1.0.0"),
+				Include:     []kyvernov1alpha1.ObjectFilter{{Path: "baseline/*.yaml"}},
+				Prune:       ptrBool(true),
+			},
+			wantEnv: map[string]string{
+				"WATCHER_INCLUDE": `[{"path":"baseline/*.yaml"}]`,
+				"WATCHER_PRUNE":   "true",
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.Exclude = []kyvernov1alpha1.ObjectFilter{{Kind: "Policy"}}
+			},
+		},
+		{
+			name: "substitution variables",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl:    ptrString("ghcr.io/owner/package:v1.0.0"),
+				Substitute:     map[string]string{"CLUSTER_NAME": "prod-eu"},
+				SubstituteFrom: []kyvernov1alpha1.SubstituteReference{{Kind: "ConfigMap", Name: "cluster-vars"}},
+			},
+			wantEnv: map[string]string{
+				"WATCHER_SUBSTITUTE":      `{"CLUSTER_NAME":"prod-eu"}`,
+				"WATCHER_SUBSTITUTE_FROM": `[{"kind":"ConfigMap","name":"cluster-vars"}]`,
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.SubstituteStrict = ptrBool(true)
+			},
+		},
+		{
+			name: "kustomize path",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl: ptrString("ghcr.io/owner/package:v1.0.0"),
+				Kustomize:   &kyvernov1alpha1.KustomizeSpec{Path: "overlays/staging"},
+			},
+			wantEnv: map[string]string{
+				"WATCHER_KUSTOMIZE": `{"path":"overlays/staging"}`,
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.Kustomize.Path = "overlays/production"
+			},
+		},
+		{
+			name: "helm chart",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl:  ptrString("ghcr.io/owner/kyverno-policies:3.0.0"),
+				ArtifactType: ptrString(kyvernov1alpha1.ArtifactTypeHelmChart),
+				Helm: &kyvernov1alpha1.HelmSpec{
+					Values:     &runtime.RawExtension{Raw: []byte(`{"podSecurityStandard":"restricted"}`)},
+					ValuesFrom: []kyvernov1alpha1.HelmValuesReference{{Kind: "ConfigMap", Name: "policy-values"}},
+				},
+			},
+			wantEnv: map[string]string{
+				"WATCHER_ARTIFACT_TYPE": "helm-chart",
+				"WATCHER_HELM":          `{"values":{"podSecurityStandard":"restricted"},"valuesFrom":[{"kind":"ConfigMap","name":"policy-values"}]}`,
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.Helm.ReleaseName = "policies"
+			},
+		},
+		{
+			name: "patches",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl: ptrString("ghcr.io/owner/package:v1.0.0"),
+				Patches: []kyvernov1alpha1.Patch{{
+					Target: &kyvernov1alpha1.ObjectFilter{Kind: "ClusterPolicy"},
+					Type:   kyvernov1alpha1.PatchTypeStrategicMerge,
+					Patch:  "spec:\n  background: false\n",
+				}},
+			},
+			wantEnv: map[string]string{
+				"WATCHER_PATCHES": `[{"target":{"kind":"ClusterPolicy"},"type":"StrategicMerge","patch":"spec:\n  background: false\n"}]`,
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.Patches[0].Patch = "spec:\n  background: true\n"
+			},
+		},
+		{
+			name: "global exclude",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl:   ptrString("ghcr.io/owner/package:v1.0.0"),
+				GlobalExclude: &kyvernov1alpha1.GlobalExclude{Namespaces: []string{"kube-system"}},
+			},
+			wantEnv: map[string]string{
+				"WATCHER_GLOBAL_EXCLUDE": `{"namespaces":["kube-system"]}`,
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.GlobalExclude.Namespaces = append(spec.GlobalExclude.Namespaces, "kyverno")
+			},
+		},
+		{
+			name: "safety limits",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl:  ptrString("ghcr.io/owner/package:v1.0.0"),
+				SafetyLimits: &kyvernov1alpha1.SafetyLimits{MaxRemoved: ptrInt32(3)},
+			},
+			wantEnv: map[string]string{
+				"WATCHER_SAFETY_LIMITS": `{"maxRemoved":3}`,
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.SafetyLimits.MaxRemoved = ptrInt32(5)
+			},
+		},
+		{
+			name: "smoke tests",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl: ptrString("ghcr.io/owner/package:v1.0.0"),
+				SmokeTests:  &kyvernov1alpha1.SmokeTests{RevertOnFailure: true},
+			},
+			wantEnv: map[string]string{
+				"WATCHER_SMOKE_TESTS": `{"revertOnFailure":true}`,
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.SmokeTests = nil
+			},
+		},
+		{
+			name: "namespace selector",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl:       ptrString("ghcr.io/owner/package:v1.0.0"),
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}},
+			},
+			wantEnv: map[string]string{
+				"WATCHER_NAMESPACE_SELECTOR": `{"matchLabels":{"team":"payments"}}`,
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.NamespaceSelector.MatchLabels["team"] = "billing"
+			},
+		},
+		{
+			name: "adoption",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl: ptrString("ghcr.io/owner/package:v1.0.0"),
+				Adoption:    ptrString(kyvernov1alpha1.AdoptionIfIdentical),
+			},
+			wantEnv: map[string]string{
+				"WATCHER_ADOPTION": `"ifIdentical"`,
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.Adoption = ptrString(kyvernov1alpha1.AdoptionNever)
+			},
+		},
+		{
+			name: "targets",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl: ptrString("ghcr.io/owner/package:v1.0.0"),
+				Targets: []kyvernov1alpha1.ClusterTarget{
+					{Name: "eu-1", KubeconfigSecretRef: kyvernov1alpha1.KubeconfigSecretReference{Name: "eu-1-kubeconfig"}},
+				},
+			},
+			wantEnv: map[string]string{
+				"WATCHER_TARGETS": `[{"name":"eu-1","kubeconfigSecretRef":{"name":"eu-1-kubeconfig"}}]`,
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.Targets = append(spec.Targets, kyvernov1alpha1.ClusterTarget{
+					Name:                "us-1",
+					KubeconfigSecretRef: kyvernov1alpha1.KubeconfigSecretReference{Name: "us-1-kubeconfig", Key: "kubeconfig"},
+				})
+			},
+		},
+		{
+			name: "approval",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl: ptrString("ghcr.io/owner/package:v1.0.0"),
+				Approval:    ptrString(kyvernov1alpha1.ApprovalManual),
+			},
+			wantEnv: map[string]string{
+				"WATCHER_APPROVAL": `"manual"`,
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.Approval = ptrString(kyvernov1alpha1.ApprovalAuto)
+			},
+		},
+		{
+			name: "sync windows",
+			spec: kyvernov1alpha1.KyvernoArtifactSpec{
+				ArtifactUrl: ptrString("ghcr.io/owner/package:v1.0.0"),
+				SyncWindows: &kyvernov1alpha1.SyncWindows{
+					TimeZone: "Europe/Berlin",
+					Windows: []kyvernov1alpha1.SyncWindow{
+						{Kind: kyvernov1alpha1.SyncWindowAllow, Schedule: "0 8 * * 1-4", Duration: metav1.Duration{Duration: 8 * time.Hour}},
+					},
+				},
+			},
+			wantEnv: map[string]string{
+				"WATCHER_SYNC_WINDOWS": `{"timeZone":"Europe/Berlin","windows":[{"kind":"allow","schedule":"0 8 * * 1-4","duration":"8h0m0s"}]}`,
+			},
+			change: func(spec *kyvernov1alpha1.KyvernoArtifactSpec) {
+				spec.SyncWindows.Deletion = ptrString(kyvernov1alpha1.SyncWindowIgnore)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = kyvernov1alpha1.AddToScheme(scheme)
+			_ = corev1.AddToScheme(scheme)
+			_ = appsv1.AddToScheme(scheme)
+			_ = policyv1.AddToScheme(scheme)
+
+			artifact := &kyvernov1alpha1.KyvernoArtifact{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-artifact",
+					Namespace: "default",
+					UID:       "test-uid-123",
+				},
+				Spec: tt.spec,
+			}
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(artifact).
+				Build()
+
+			reconciler := &KyvernoArtifactReconciler{
+				Client: fakeClient,
+				Scheme: scheme,
+				Config: DefaultConfig(),
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-artifact", Namespace: "default"}}
+			deploymentKey := types.NamespacedName{Name: "kyverno-artifact-manager-test-artifact", Namespace: "default"}
+
+			if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			deployment := &appsv1.Deployment{}
+			if err := fakeClient.Get(context.Background(), deploymentKey, deployment); err != nil {
+				t.Fatalf("Failed to get deployment: %v", err)
+			}
+			env := make(map[string]string)
+			for _, e := range deployment.Spec.Template.Spec.Containers[0].Env {
+				env[e.Name] = e.Value
+			}
+			for name, value := range tt.wantEnv {
+				if env[name] != value {
+					t.Errorf("%s = %q, want %q", name, env[name], value)
+				}
+			}
+
+			// Reconciling an unchanged spec leaves the deployment alone.
+			resourceVersion := deployment.ResourceVersion
+			if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if err := fakeClient.Get(context.Background(), deploymentKey, deployment); err != nil {
+				t.Fatalf("Failed to get deployment: %v", err)
+			}
+			if deployment.ResourceVersion != resourceVersion {
+				t.Error("Deployment should not be updated for an unchanged spec")
+			}
+
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, artifact); err != nil {
+				t.Fatalf("Failed to get artifact: %v", err)
+			}
+			tt.change(&artifact.Spec)
+			if err := fakeClient.Update(context.Background(), artifact); err != nil {
+				t.Fatalf("Failed to update artifact: %v", err)
+			}
+			if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			before := deployment.Spec.Template
+			if err := fakeClient.Get(context.Background(), deploymentKey, deployment); err != nil {
+				t.Fatalf("Failed to get deployment: %v", err)
+			}
+			if equality.Semantic.DeepEqual(before, deployment.Spec.Template) {
+				t.Error("Deployment should roll out a new pod template when the spec changes")
+			}
+		})
+	}
+}
+
+func TestReconcileKyvernoArtifact_ConfigChangeRollsOutDeployment(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(config *Config)
+	}{
+		{name: "secret name", change: func(config *Config) { config.SecretName = "registry-credentials" }},
+		{name: "token key", change: func(config *Config) { config.GitHubTokenKey = "token" }},
+		{name: "service account", change: func(config *Config) { config.WatcherServiceAccount = "policy-watcher" }},
+		{name: "watcher image", change: func(config *Config) { config.WatcherImage = "ghcr.io/octokode/kyverno-artifact-operator:v2.0.0" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			artifact := newWatchedArtifact("security", nil)
+			reconciler, fakeClient := newWatcherFixture(t, artifact)
+			key := client.ObjectKey{Name: "kyverno-artifact-manager-security", Namespace: "default"}
+
+			reconcileArtifact(t, reconciler, "security")
+			var deployment appsv1.Deployment
+			if err := fakeClient.Get(context.Background(), key, &deployment); err != nil {
+				t.Fatalf("Failed to get deployment: %v", err)
+			}
+			hash := deployment.Annotations[templateHashAnnotation]
+			if hash == "" {
+				t.Fatal("Deployment should record the hash of its pod template")
+			}
+
+			tt.change(&reconciler.Config)
+			reconcileArtifact(t, reconciler, "security")
+			if err := fakeClient.Get(context.Background(), key, &deployment); err != nil {
+				t.Fatalf("Failed to get deployment: %v", err)
+			}
+			if deployment.Annotations[templateHashAnnotation] == hash {
+				t.Error("Deployment should roll out a new pod template when the operator configuration changes")
+			}
+		})
+	}
+}
+
+func TestReconcileKyvernoArtifact_Freeze(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = kyvernov1alpha1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
+
+	artifact := &kyvernov1alpha1.KyvernoArtifact{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-artifact", Namespace: "default"},
+		Spec:       kyvernov1alpha1.KyvernoArtifactSpec{ArtifactUrl: ptrString("ghcr.io/owner/package:v1.0.0")},
+	}
+	freeze := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kyverno-artifact-operator-freeze", Namespace: "ops"},
+		Data:       map[string]string{"enabled": "true", "mode": "audit", "reason": "INC-1234"},
+	}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(artifact, freeze).
+		WithStatusSubresource(&kyvernov1alpha1.KyvernoArtifact{}).
+		Build()
+
+	config := DefaultConfig()
+	config.OperatorNamespace = "ops"
+	reconciler := &KyvernoArtifactReconciler{Client: fakeClient, Scheme: scheme, Config: config}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-artifact", Namespace: "default"}}
+
+	if requests := reconciler.artifactsForFreeze(context.Background(), freeze); len(requests) != 1 || requests[0] != req {
+		t.Errorf("artifactsForFreeze() = %v, want the artifact enqueued", requests)
+	}
+
+	frozenCondition := func() *metav1.Condition {
+		t.Helper()
+		if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		var updated kyvernov1alpha1.KyvernoArtifact
+		if err := fakeClient.Get(context.Background(), req.NamespacedName, &updated); err != nil {
+			t.Fatal(err)
+		}
+		return meta.FindStatusCondition(updated.Status.Conditions, kyvernov1alpha1.ConditionFrozen)
+	}
+
+	condition := frozenCondition()
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != kyvernov1alpha1.FrozenReasonAudit ||
+		condition.Message != "Policy changes are frozen operator-wide and managed policies are switched to Audit: INC-1234" {
+		t.Errorf("Frozen condition = %+v, want an audit freeze with its reason", condition)
+	}
+
+	freeze.Data["enabled"] = "false"
+	if err := fakeClient.Update(context.Background(), freeze); err != nil {
+		t.Fatal(err)
+	}
+	if condition := frozenCondition(); condition == nil || condition.Status != metav1.ConditionFalse {
+		t.Errorf("Frozen condition = %+v, want it lifted", condition)
+	}
+}
@@ -38,10 +38,20 @@ var (
 		},
 		[]string{"phase"},
 	)
+
+	// ConflictingObjects reports each object that two artifacts both ship, as recorded on the claiming artifact's status
+	ConflictingObjects = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kyverno_artifact_conflicting_objects",
+			Help: "Objects shipped by more than one KyvernoArtifact, labeled by the owning and the refused artifact",
+		},
+		[]string{"kind", "namespace", "name", "owned_by", "claimed_by"},
+	)
 )
 
 func init() {
 	// Register custom metrics with the controller-runtime metrics registry
 	metrics.Registry.MustRegister(ArtifactCount)
 	metrics.Registry.MustRegister(ArtifactsByPhase)
+	metrics.Registry.MustRegister(ConflictingObjects)
 }
@@ -18,9 +18,15 @@ package controller
 
 import (
 	"os"
+	"path/filepath"
+	"sync"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"github.com/OctoKode/kyverno-artifact-operator/internal/k8s"
 )
 
 // Config holds configurable values for the controller
@@ -31,6 +37,9 @@ type Config struct {
 	GitHubTokenKey         string
 	ArtifactoryUsernameKey string
 	ArtifactoryPasswordKey string
+	OperatorNamespace      string
+	SyncMode               string // Where artifacts without spec.syncMode are synced: pod or inProcess
+	StateDir               string // Directory in-process syncs keep their working files in
 }
 
 // DefaultConfig returns the default configuration
@@ -42,6 +51,9 @@ func DefaultConfig() Config {
 		GitHubTokenKey:         getEnvOrDefault("GITHUB_TOKEN_KEY", "github-token"),
 		ArtifactoryUsernameKey: getEnvOrDefault("ARTIFACTORY_USERNAME_KEY", "artifactory-username"),
 		ArtifactoryPasswordKey: getEnvOrDefault("ARTIFACTORY_PASSWORD_KEY", "artifactory-password"),
+		OperatorNamespace:      k8s.OperatorNamespace(),
+		SyncMode:               getEnvOrDefault("SYNC_MODE", kyvernov1alpha1.SyncModePod),
+		StateDir:               filepath.Join(os.TempDir(), "kyverno-artifact-operator"),
 	}
 }
 
@@ -57,4 +69,11 @@ type KyvernoArtifactReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	Config Config
+	// APIReader reads Secrets and sync state directly from the API server, so that they are not cached
+	// cluster-wide. The client is used when it is nil.
+	APIReader client.Reader
+
+	// syncs records when each in-process artifact is due for its next sync.
+	syncsMu sync.Mutex
+	syncs   map[types.NamespacedName]inProcessSync
 }
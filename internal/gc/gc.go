@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"strings"
 	"time"
 
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
 	"github.com/OctoKode/kyverno-artifact-operator/internal/k8s"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -16,11 +19,16 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
+// watcherGroupLabel carries the name of the group on the pods of a watcher group
+const watcherGroupLabel = "kyverno.octokode.io/watcher-group"
+
 var (
 	// Version is set via ldflags during build
 	Version = "dev"
 	// getKubeClientFunc can be overridden in tests
 	getKubeClientFunc = k8s.GetClient
+	// getRESTMapperFunc can be overridden in tests
+	getRESTMapperFunc = k8s.GetRESTMapper
 	// orphanedPolicies tracks when policies were first detected as orphaned
 	orphanedPolicies = make(map[string]time.Time)
 )
@@ -48,8 +56,25 @@ func collectGarbage() {
 		return
 	}
 
+	// Nothing is deleted while an operator-wide freeze is in effect
+	if isFrozen(clientset) {
+		return
+	}
+
+	// Discover which of the managed Kyverno kinds the cluster serves
+	mapper, err := getRESTMapperFunc()
+	if err != nil {
+		log.Printf("Error getting REST mapper: %v\n", err)
+		return
+	}
+	resources, err := k8s.ManagedResources(mapper)
+	if err != nil {
+		log.Printf("Error discovering managed policy kinds: %v\n", err)
+		return
+	}
+
 	// Get all policies with managed-by=kyverno-watcher label
-	policies := getManagedPolicies(dynamicClient)
+	policies := getManagedPolicies(dynamicClient, resources)
 
 	log.Printf("Found %d managed policies to check\n", len(policies))
 
@@ -58,6 +83,17 @@ func collectGarbage() {
 	for _, policy := range policies {
 		policyKey := getPolicyKey(policy)
 
+		// A held policy may have been edited by hand during an incident, so it is kept until the hold expires
+		until, held, err := k8s.HeldUntil(policy.Annotations, time.Now())
+		if err != nil {
+			log.Printf("Warning: ignoring invalid hold-until annotation of policy %s: %v\n", policy.Name, err)
+		}
+		if held {
+			log.Printf("Policy %s is held until %s, skipping\n", policy.Name, until.Format(time.RFC3339))
+			delete(orphanedPolicies, policyKey)
+			continue
+		}
+
 		if isOrphaned(policy, clientset, dynamicClient) {
 			firstSeen, exists := orphanedPolicies[policyKey]
 			if !exists {
@@ -112,50 +148,34 @@ func collectGarbage() {
 
 // getPolicyKey generates a unique key for a policy
 func getPolicyKey(policy PolicyInfo) string {
+	// Qualify the kind with its group, since kinds such as PolicyException exist in more than one group
+	kind := schema.GroupKind{Group: policy.Resource.Group, Kind: policy.Kind}.String()
 	if policy.Namespace != "" {
-		return fmt.Sprintf("%s/%s/%s", policy.Kind, policy.Namespace, policy.Name)
+		return fmt.Sprintf("%s/%s/%s", kind, policy.Namespace, policy.Name)
 	}
-	return fmt.Sprintf("%s/%s", policy.Kind, policy.Name)
+	return fmt.Sprintf("%s/%s", kind, policy.Name)
 }
 
-// getManagedPolicies returns all Policy and ClusterPolicy resources with managed-by=kyverno-watcher label
-func getManagedPolicies(dynamicClient dynamic.Interface) []PolicyInfo {
+// getManagedPolicies returns the resources of every managed Kyverno kind with managed-by=kyverno-watcher label
+func getManagedPolicies(dynamicClient dynamic.Interface, resources []k8s.ManagedResource) []PolicyInfo {
 	policies := make([]PolicyInfo, 0)
 	ctx := context.Background()
 
-	// Define GVRs for Kyverno policies
-	policyGVR := schema.GroupVersionResource{
-		Group:    "kyverno.io",
-		Version:  "v1",
-		Resource: "policies",
-	}
-	clusterPolicyGVR := schema.GroupVersionResource{
-		Group:    "kyverno.io",
-		Version:  "v1",
-		Resource: "clusterpolicies",
-	}
-
-	// Get namespaced Policies
-	namespacedPolicies, err := getPoliciesByKind(ctx, dynamicClient, policyGVR, "")
-	if err != nil {
-		log.Printf("Warning: failed to list Policy resources: %v\n", err)
-	} else {
-		policies = append(policies, namespacedPolicies...)
-	}
-
-	// Get ClusterPolicies
-	clusterPolicies, err := getPoliciesByKind(ctx, dynamicClient, clusterPolicyGVR, "")
-	if err != nil {
-		log.Printf("Warning: failed to list ClusterPolicy resources: %v\n", err)
-	} else {
-		policies = append(policies, clusterPolicies...)
+	for _, resource := range resources {
+		found, err := getPoliciesByKind(ctx, dynamicClient, resource, "")
+		if err != nil {
+			log.Printf("Warning: failed to list %s resources: %v\n", resource.Kind, err)
+			continue
+		}
+		policies = append(policies, found...)
 	}
 
 	return policies
 }
 
 // getPoliciesByKind retrieves policies of a specific kind with the managed-by label
-func getPoliciesByKind(ctx context.Context, dynamicClient dynamic.Interface, gvr schema.GroupVersionResource, namespace string) ([]PolicyInfo, error) {
+func getPoliciesByKind(ctx context.Context, dynamicClient dynamic.Interface, resource k8s.ManagedResource, namespace string) ([]PolicyInfo, error) {
+	gvr := resource.GVR
 	labelSelector := "managed-by=kyverno-watcher"
 
 	var list interface{}
@@ -183,16 +203,13 @@ func getPoliciesByKind(ctx context.Context, dynamicClient dynamic.Interface, gvr
 
 	policies := make([]PolicyInfo, 0, len(unstructuredList.Items))
 	for _, item := range unstructuredList.Items {
-		kind := "Policy"
-		if gvr.Resource == "clusterpolicies" {
-			kind = "ClusterPolicy"
-		}
-
 		policies = append(policies, PolicyInfo{
-			Name:      item.GetName(),
-			Namespace: item.GetNamespace(),
-			Kind:      kind,
-			Labels:    item.GetLabels(),
+			Name:        item.GetName(),
+			Namespace:   item.GetNamespace(),
+			Kind:        resource.Kind,
+			Resource:    gvr,
+			Labels:      item.GetLabels(),
+			Annotations: item.GetAnnotations(),
 		})
 	}
 
@@ -215,21 +232,28 @@ func isOrphaned(policy PolicyInfo, clientset kubernetes.Interface, dynamicClient
 		return isOrphanedLegacy(policy, policyVersion, clientset, dynamicClient)
 	}
 
-	// Check if the specific KyvernoArtifact exists
-	hasKyvernoArtifact, err := checkForSpecificKyvernoArtifact(dynamicClient, artifactName)
+	// Check if the specific KyvernoArtifact exists. Policies applied before the artifact-namespace label existed
+	// match an artifact of that name in any namespace
+	artifactNamespace := policy.Labels["artifact-namespace"]
+	artifact, err := checkForSpecificKyvernoArtifact(dynamicClient, artifactName, artifactNamespace)
 	if err != nil {
 		log.Printf("Warning: failed to check for KyvernoArtifact %s: %v\n", artifactName, err)
 		return false
 	}
 
-	if !hasKyvernoArtifact {
+	if artifact == nil {
 		log.Printf("Policy %s (version: %s) appears orphaned: KyvernoArtifact %s not found\n",
 			policy.Name, policyVersion, artifactName)
 		return true
 	}
 
+	// The operator syncs in-process artifacts itself, so there is no watcher pod to look for
+	if syncMode(artifact) == kyvernov1alpha1.SyncModeInProcess {
+		return false
+	}
+
 	// Check if the specific watcher pod exists for this artifact
-	hasActiveWatcher, err := checkForSpecificWatcher(clientset, artifactName)
+	hasActiveWatcher, err := checkForSpecificWatcher(clientset, artifact)
 	if err != nil {
 		log.Printf("Warning: failed to check for watcher pod for artifact %s: %v\n", artifactName, err)
 		return false
@@ -277,18 +301,24 @@ func isOrphanedLegacy(policy PolicyInfo, policyVersion string, clientset kuberne
 	return false
 }
 
-// checkForSpecificWatcher checks if the watcher pod for a specific artifact exists and is active
-func checkForSpecificWatcher(clientset kubernetes.Interface, artifactName string) (bool, error) {
+// checkForSpecificWatcher checks if a watcher pod for a specific artifact exists in its namespace and is active.
+// The watcher of a grouped artifact runs in the pods of its group's Deployment, which carry the group's label
+func checkForSpecificWatcher(clientset kubernetes.Interface, artifact *unstructured.Unstructured) (bool, error) {
 	ctx := context.Background()
-	expectedPodPrefix := fmt.Sprintf("kyverno-artifact-manager-%s", artifactName)
+	expectedPodPrefix := fmt.Sprintf("kyverno-artifact-manager-%s", artifact.GetName())
+	listOptions := metav1.ListOptions{}
+	if group, _, _ := unstructured.NestedString(artifact.Object, "spec", "watcherGroup"); group != "" {
+		expectedPodPrefix = fmt.Sprintf("kyverno-artifact-group-%s-", group)
+		listOptions.LabelSelector = fmt.Sprintf("%s=%s", watcherGroupLabel, group)
+	}
 
-	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	pods, err := clientset.CoreV1().Pods(artifact.GetNamespace()).List(ctx, listOptions)
 	if err != nil {
 		return false, fmt.Errorf("failed to list pods: %w", err)
 	}
 
 	for _, pod := range pods.Items {
-		// Pod names start with "kyverno-artifact-manager-{artifactName}" (may have a generated suffix)
+		// Pod names start with the Deployment's name (may have a generated suffix)
 		if strings.HasPrefix(pod.Name, expectedPodPrefix) &&
 			(pod.Status.Phase == corev1.PodRunning || pod.Status.Phase == corev1.PodPending) {
 			return true, nil
@@ -298,8 +328,21 @@ func checkForSpecificWatcher(clientset kubernetes.Interface, artifactName string
 	return false, nil
 }
 
-// checkForSpecificKyvernoArtifact checks if a specific KyvernoArtifact exists
-func checkForSpecificKyvernoArtifact(dynamicClient dynamic.Interface, artifactName string) (bool, error) {
+// syncMode returns where the artifact is synced: its spec.syncMode, or else the operator's SYNC_MODE setting, which
+// the garbage collector shares with the operator.
+func syncMode(artifact *unstructured.Unstructured) string {
+	if mode, _, _ := unstructured.NestedString(artifact.Object, "spec", "syncMode"); mode != "" {
+		return mode
+	}
+	if mode := os.Getenv("SYNC_MODE"); mode != "" {
+		return mode
+	}
+	return kyvernov1alpha1.SyncModePod
+}
+
+// checkForSpecificKyvernoArtifact returns the KyvernoArtifact with the given name in the given namespace, or in any
+// namespace when it is empty, or nil if it does not exist
+func checkForSpecificKyvernoArtifact(dynamicClient dynamic.Interface, artifactName, artifactNamespace string) (*unstructured.Unstructured, error) {
 	ctx := context.Background()
 
 	artifactGVR := schema.GroupVersionResource{
@@ -311,16 +354,17 @@ func checkForSpecificKyvernoArtifact(dynamicClient dynamic.Interface, artifactNa
 	// Check across all namespaces for the specific artifact
 	list, err := dynamicClient.Resource(artifactGVR).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		return false, fmt.Errorf("failed to list kyvernoartifacts: %w", err)
+		return nil, fmt.Errorf("failed to list kyvernoartifacts: %w", err)
 	}
 
-	for _, item := range list.Items {
-		if item.GetName() == artifactName {
-			return true, nil
+	for i := range list.Items {
+		if list.Items[i].GetName() == artifactName &&
+			(artifactNamespace == "" || list.Items[i].GetNamespace() == artifactNamespace) {
+			return &list.Items[i], nil
 		}
 	}
 
-	return false, nil
+	return nil, nil
 }
 
 // checkForActiveWatchers checks if there are any active watcher pods
@@ -367,32 +411,39 @@ func checkForKyvernoArtifacts(dynamicClient dynamic.Interface) (bool, error) {
 func deletePolicy(policy PolicyInfo, dynamicClient dynamic.Interface) error {
 	ctx := context.Background()
 
-	var gvr schema.GroupVersionResource
-	if policy.Kind == "ClusterPolicy" {
-		gvr = schema.GroupVersionResource{
-			Group:    "kyverno.io",
-			Version:  "v1",
-			Resource: "clusterpolicies",
-		}
-	} else {
-		gvr = schema.GroupVersionResource{
-			Group:    "kyverno.io",
-			Version:  "v1",
-			Resource: "policies",
-		}
-	}
-
 	if policy.Namespace != "" {
-		err := dynamicClient.Resource(gvr).Namespace(policy.Namespace).Delete(ctx, policy.Name, metav1.DeleteOptions{})
+		err := dynamicClient.Resource(policy.Resource).Namespace(policy.Namespace).Delete(ctx, policy.Name, metav1.DeleteOptions{})
 		if err != nil {
-			return fmt.Errorf("failed to delete policy: %w", err)
+			return fmt.Errorf("failed to delete %s: %w", policy.Kind, err)
 		}
 	} else {
-		err := dynamicClient.Resource(gvr).Delete(ctx, policy.Name, metav1.DeleteOptions{})
+		err := dynamicClient.Resource(policy.Resource).Delete(ctx, policy.Name, metav1.DeleteOptions{})
 		if err != nil {
-			return fmt.Errorf("failed to delete clusterpolicy: %w", err)
+			return fmt.Errorf("failed to delete %s: %w", policy.Kind, err)
 		}
 	}
 
 	return nil
 }
+
+// isFrozen reports whether the freeze ConfigMap in the operator's namespace freezes policy changes. A freeze that
+// cannot be read counts as frozen, so that garbage collection waits rather than deleting during an incident.
+func isFrozen(clientset kubernetes.Interface) bool {
+	namespace := k8s.OperatorNamespace()
+	configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(context.Background(), k8s.FreezeConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		log.Printf("Error reading freeze ConfigMap %s/%s, skipping garbage collection: %v\n", namespace, k8s.FreezeConfigMapName, err)
+		return true
+	}
+	freeze, err := k8s.ParseFreeze(configMap.Data)
+	if err != nil {
+		log.Printf("Warning: invalid freeze ConfigMap %s/%s: %v\n", namespace, k8s.FreezeConfigMapName, err)
+	}
+	if freeze.Enabled {
+		log.Printf("Policy changes are frozen, skipping garbage collection: %s\n", freeze.Reason)
+	}
+	return freeze.Enabled
+}
@@ -3,9 +3,11 @@ package gc
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/OctoKode/kyverno-artifact-operator/internal/k8s"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -29,6 +31,39 @@ const (
 	kyvernoArtifactVersion = "v1alpha1"
 )
 
+var (
+	policyResource = k8s.ManagedResource{
+		GVR:        schema.GroupVersionResource{Group: kyvernoAPIGroup, Version: kyvernoAPIVersion, Resource: "policies"},
+		Kind:       policyKind,
+		Namespaced: true,
+	}
+	clusterPolicyResource = k8s.ManagedResource{
+		GVR:  schema.GroupVersionResource{Group: kyvernoAPIGroup, Version: kyvernoAPIVersion, Resource: "clusterpolicies"},
+		Kind: clusterPolicyKind,
+	}
+	validatingPolicyResource = k8s.ManagedResource{
+		GVR:  schema.GroupVersionResource{Group: "policies.kyverno.io", Version: "v1alpha1", Resource: "validatingpolicies"},
+		Kind: "ValidatingPolicy",
+	}
+)
+
+// newTestRESTMapper returns a REST mapper serving the kinds of policyResource, clusterPolicyResource and
+// validatingPolicyResource.
+func newTestRESTMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{
+		policyResource.GVR.GroupVersion(),
+		validatingPolicyResource.GVR.GroupVersion(),
+	})
+	for _, resource := range []k8s.ManagedResource{policyResource, clusterPolicyResource, validatingPolicyResource} {
+		scope := meta.RESTScopeRoot
+		if resource.Namespaced {
+			scope = meta.RESTScopeNamespace
+		}
+		mapper.Add(resource.GVR.GroupVersion().WithKind(resource.Kind), scope)
+	}
+	return mapper
+}
+
 func TestPolicyInfo(t *testing.T) {
 	policy := PolicyInfo{
 		Name:      testPolicyName,
@@ -112,12 +147,28 @@ func TestGetManagedPolicies(t *testing.T) {
 		},
 	}
 
-	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme, clusterPolicy, policy)
+	// Create a ValidatingPolicy
+	validatingPolicy := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "policies.kyverno.io/v1alpha1",
+			"kind":       "ValidatingPolicy",
+			"metadata": map[string]interface{}{
+				"name": "test-validating-policy",
+				"labels": map[string]interface{}{
+					managedByLabel:     managedByValue,
+					policyVersionLabel: "v3.0.0",
+				},
+			},
+		},
+	}
 
-	policies := getManagedPolicies(dynamicClient)
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme, clusterPolicy, policy, validatingPolicy)
 
-	if len(policies) != 2 {
-		t.Errorf("Expected 2 policies, got %d", len(policies))
+	resources := []k8s.ManagedResource{policyResource, clusterPolicyResource, validatingPolicyResource}
+	policies := getManagedPolicies(dynamicClient, resources)
+
+	if len(policies) != 3 {
+		t.Errorf("Expected 3 policies, got %d", len(policies))
 	}
 
 	// Verify ClusterPolicy
@@ -141,6 +192,15 @@ func TestGetManagedPolicies(t *testing.T) {
 	if !foundClusterPolicy {
 		t.Error("ClusterPolicy not found in results")
 	}
+	foundValidatingPolicy := false
+	for _, p := range policies {
+		if p.Name == "test-validating-policy" && p.Kind == "ValidatingPolicy" {
+			foundValidatingPolicy = p.Resource == validatingPolicyResource.GVR
+		}
+	}
+	if !foundValidatingPolicy {
+		t.Error("ValidatingPolicy not found in results")
+	}
 	if !foundPolicy {
 		t.Error("Policy not found in results")
 	}
@@ -166,14 +226,8 @@ func TestGetPoliciesByKind(t *testing.T) {
 
 	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme, policy)
 
-	gvr := schema.GroupVersionResource{
-		Group:    kyvernoAPIGroup,
-		Version:  kyvernoAPIVersion,
-		Resource: "policies",
-	}
-
 	ctx := context.Background()
-	policies, err := getPoliciesByKind(ctx, dynamicClient, gvr, "")
+	policies, err := getPoliciesByKind(ctx, dynamicClient, policyResource, "")
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -194,6 +248,7 @@ func TestIsOrphaned(t *testing.T) {
 	tests := []struct {
 		name             string
 		policy           PolicyInfo
+		syncMode         string // SYNC_MODE of the operator
 		pods             []runtime.Object
 		artifacts        []runtime.Object
 		expectedOrphaned bool
@@ -376,10 +431,165 @@ func TestIsOrphaned(t *testing.T) {
 			},
 			expectedOrphaned: true, // Artifact exists but watcher pod is gone
 		},
+		{
+			name: "policy of an in-process artifact without a watcher pod",
+			policy: PolicyInfo{
+				Name: "test-policy",
+				Kind: "Policy",
+				Labels: map[string]string{
+					"managed-by":     "kyverno-watcher",
+					"policy-version": "v1.0.0",
+					"artifact-name":  "my-artifact",
+				},
+			},
+			pods: []runtime.Object{},
+			artifacts: []runtime.Object{
+				&unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"apiVersion": "kyverno.octokode.io/v1alpha1",
+						"kind":       "KyvernoArtifact",
+						"metadata": map[string]interface{}{
+							"name":      "my-artifact",
+							"namespace": "default",
+						},
+						"spec": map[string]interface{}{"syncMode": "inProcess"},
+					},
+				},
+			},
+			expectedOrphaned: false, // The operator syncs it, no watcher pod is expected
+		},
+		{
+			name: "policy of an in-process artifact by default without a watcher pod",
+			policy: PolicyInfo{
+				Name: "test-policy",
+				Kind: "Policy",
+				Labels: map[string]string{
+					"managed-by":     "kyverno-watcher",
+					"policy-version": "v1.0.0",
+					"artifact-name":  "my-artifact",
+				},
+			},
+			syncMode: "inProcess",
+			pods:     []runtime.Object{},
+			artifacts: []runtime.Object{
+				&unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"apiVersion": "kyverno.octokode.io/v1alpha1",
+						"kind":       "KyvernoArtifact",
+						"metadata": map[string]interface{}{
+							"name":      "my-artifact",
+							"namespace": "default",
+						},
+					},
+				},
+			},
+			expectedOrphaned: false,
+		},
+		{
+			name: "policy of a pod artifact overriding the in-process default without a watcher pod",
+			policy: PolicyInfo{
+				Name: "test-policy",
+				Kind: "Policy",
+				Labels: map[string]string{
+					"managed-by":     "kyverno-watcher",
+					"policy-version": "v1.0.0",
+					"artifact-name":  "my-artifact",
+				},
+			},
+			syncMode: "inProcess",
+			pods:     []runtime.Object{},
+			artifacts: []runtime.Object{
+				&unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"apiVersion": "kyverno.octokode.io/v1alpha1",
+						"kind":       "KyvernoArtifact",
+						"metadata": map[string]interface{}{
+							"name":      "my-artifact",
+							"namespace": "default",
+						},
+						"spec": map[string]interface{}{"syncMode": "pod"},
+					},
+				},
+			},
+			expectedOrphaned: true,
+		},
+		{
+			name: "policy of a grouped artifact with a running group pod",
+			policy: PolicyInfo{
+				Name: "test-policy",
+				Kind: "Policy",
+				Labels: map[string]string{
+					"managed-by":         "kyverno-watcher",
+					"policy-version":     "v1.0.0",
+					"artifact-name":      "my-artifact",
+					"artifact-namespace": "default",
+				},
+			},
+			pods: []runtime.Object{
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "kyverno-artifact-group-security-7d9f8b6c5-x2k4p",
+						Namespace: "default",
+						Labels:    map[string]string{watcherGroupLabel: "security"},
+					},
+					Status: corev1.PodStatus{Phase: corev1.PodRunning},
+				},
+			},
+			artifacts: []runtime.Object{
+				&unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"apiVersion": "kyverno.octokode.io/v1alpha1",
+						"kind":       "KyvernoArtifact",
+						"metadata": map[string]interface{}{
+							"name":      "my-artifact",
+							"namespace": "default",
+						},
+						"spec": map[string]interface{}{"watcherGroup": "security"},
+					},
+				},
+			},
+			expectedOrphaned: false,
+		},
+		{
+			name: "policy whose artifact was deleted while a same-named one exists elsewhere",
+			policy: PolicyInfo{
+				Name: "test-policy",
+				Kind: "Policy",
+				Labels: map[string]string{
+					"managed-by":         "kyverno-watcher",
+					"policy-version":     "v1.0.0",
+					"artifact-name":      "my-artifact",
+					"artifact-namespace": "default",
+				},
+			},
+			pods: []runtime.Object{
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "kyverno-artifact-manager-my-artifact",
+						Namespace: "team-b",
+					},
+					Status: corev1.PodStatus{Phase: corev1.PodRunning},
+				},
+			},
+			artifacts: []runtime.Object{
+				&unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"apiVersion": "kyverno.octokode.io/v1alpha1",
+						"kind":       "KyvernoArtifact",
+						"metadata": map[string]interface{}{
+							"name":      "my-artifact",
+							"namespace": "team-b",
+						},
+					},
+				},
+			},
+			expectedOrphaned: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SYNC_MODE", tt.syncMode)
 			clientset := fakeclientset.NewSimpleClientset(tt.pods...)
 
 			// Register KyvernoArtifact list kind
@@ -599,6 +809,7 @@ func TestCheckForSpecificWatcher(t *testing.T) {
 	tests := []struct {
 		name           string
 		artifactName   string
+		watcherGroup   string
 		pods           []runtime.Object
 		expectedActive bool
 		expectError    bool
@@ -674,13 +885,77 @@ func TestCheckForSpecificWatcher(t *testing.T) {
 			expectedActive: false, // Wrong artifact name
 			expectError:    false,
 		},
+		{
+			name:         "watcher pod of a same-named artifact in another namespace",
+			artifactName: "my-artifact",
+			pods: []runtime.Object{
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "kyverno-artifact-manager-my-artifact",
+						Namespace: "team-b",
+					},
+					Status: corev1.PodStatus{Phase: corev1.PodRunning},
+				},
+			},
+			expectedActive: false,
+			expectError:    false,
+		},
+		{
+			name:         "running pod of the artifact's watcher group",
+			artifactName: "my-artifact",
+			watcherGroup: "security",
+			pods: []runtime.Object{
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "kyverno-artifact-group-security-7d9f8b6c5-x2k4p",
+						Namespace: "default",
+						Labels:    map[string]string{watcherGroupLabel: "security"},
+					},
+					Status: corev1.PodStatus{Phase: corev1.PodRunning},
+				},
+			},
+			expectedActive: true,
+			expectError:    false,
+		},
+		{
+			name:         "grouped artifact with only its former watcher pod",
+			artifactName: "my-artifact",
+			watcherGroup: "security",
+			pods: []runtime.Object{
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "kyverno-artifact-group-security-extra-7d9f8b6c5-x2k4p",
+						Namespace: "default",
+						Labels:    map[string]string{watcherGroupLabel: "security-extra"},
+					},
+					Status: corev1.PodStatus{Phase: corev1.PodRunning},
+				},
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "kyverno-artifact-manager-my-artifact-5c6d7e8f9-abcde",
+						Namespace: "default",
+					},
+					Status: corev1.PodStatus{Phase: corev1.PodSucceeded},
+				},
+			},
+			expectedActive: false, // Another group's pod and a terminated pod
+			expectError:    false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			clientset := fakeclientset.NewSimpleClientset(tt.pods...)
+			artifact := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "kyverno.octokode.io/v1alpha1",
+				"kind":       "KyvernoArtifact",
+				"metadata":   map[string]interface{}{"name": tt.artifactName, "namespace": "default"},
+			}}
+			if tt.watcherGroup != "" {
+				artifact.Object["spec"] = map[string]interface{}{"watcherGroup": tt.watcherGroup}
+			}
 
-			hasActive, err := checkForSpecificWatcher(clientset, tt.artifactName)
+			hasActive, err := checkForSpecificWatcher(clientset, artifact)
 
 			if tt.expectError {
 				if err == nil {
@@ -716,10 +991,11 @@ func TestCheckForSpecificKyvernoArtifact(t *testing.T) {
 	}
 
 	tests := []struct {
-		name         string
-		artifactName string
-		artifacts    []runtime.Object
-		expectedHas  bool
+		name              string
+		artifactName      string
+		artifactNamespace string
+		artifacts         []runtime.Object
+		expectedHas       bool
 	}{
 		{
 			name:         "no artifacts",
@@ -788,6 +1064,42 @@ func TestCheckForSpecificKyvernoArtifact(t *testing.T) {
 			},
 			expectedHas: true,
 		},
+		{
+			name:              "same-named artifact in another namespace",
+			artifactName:      "my-artifact",
+			artifactNamespace: "default",
+			artifacts: []runtime.Object{
+				&unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"apiVersion": "kyverno.octokode.io/v1alpha1",
+						"kind":       "KyvernoArtifact",
+						"metadata": map[string]interface{}{
+							"name":      "my-artifact",
+							"namespace": "kube-system",
+						},
+					},
+				},
+			},
+			expectedHas: false,
+		},
+		{
+			name:              "matching artifact in the artifact namespace",
+			artifactName:      "my-artifact",
+			artifactNamespace: "kube-system",
+			artifacts: []runtime.Object{
+				&unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"apiVersion": "kyverno.octokode.io/v1alpha1",
+						"kind":       "KyvernoArtifact",
+						"metadata": map[string]interface{}{
+							"name":      "my-artifact",
+							"namespace": "kube-system",
+						},
+					},
+				},
+			},
+			expectedHas: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -798,12 +1110,12 @@ func TestCheckForSpecificKyvernoArtifact(t *testing.T) {
 				tt.artifacts...,
 			)
 
-			hasArtifact, err := checkForSpecificKyvernoArtifact(dynamicClient, tt.artifactName)
+			artifact, err := checkForSpecificKyvernoArtifact(dynamicClient, tt.artifactName, tt.artifactNamespace)
 			if err != nil {
 				t.Errorf("Expected no error, got %v", err)
 			}
 
-			if hasArtifact != tt.expectedHas {
+			if hasArtifact := artifact != nil; hasArtifact != tt.expectedHas {
 				t.Errorf("Expected hasArtifact=%v, got %v", tt.expectedHas, hasArtifact)
 			}
 		})
@@ -825,6 +1137,7 @@ func TestDeletePolicy(t *testing.T) {
 				Name:      "test-policy",
 				Namespace: "default",
 				Kind:      "Policy",
+				Resource:  policyResource.GVR,
 			},
 			setupObjs: []runtime.Object{
 				&unstructured.Unstructured{
@@ -842,8 +1155,9 @@ func TestDeletePolicy(t *testing.T) {
 		{
 			name: "delete cluster policy",
 			policy: PolicyInfo{
-				Name: "test-cluster-policy",
-				Kind: "ClusterPolicy",
+				Name:     "test-cluster-policy",
+				Kind:     "ClusterPolicy",
+				Resource: clusterPolicyResource.GVR,
 			},
 			setupObjs: []runtime.Object{
 				&unstructured.Unstructured{
@@ -857,6 +1171,25 @@ func TestDeletePolicy(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "delete validating policy",
+			policy: PolicyInfo{
+				Name:     "test-validating-policy",
+				Kind:     "ValidatingPolicy",
+				Resource: validatingPolicyResource.GVR,
+			},
+			setupObjs: []runtime.Object{
+				&unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"apiVersion": "policies.kyverno.io/v1alpha1",
+						"kind":       "ValidatingPolicy",
+						"metadata": map[string]interface{}{
+							"name": "test-validating-policy",
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -870,21 +1203,10 @@ func TestDeletePolicy(t *testing.T) {
 
 			// Verify the policy was deleted
 			ctx := context.Background()
-			var gvr schema.GroupVersionResource
-			if tt.policy.Kind == clusterPolicyKind {
-				gvr = schema.GroupVersionResource{
-					Group:    kyvernoAPIGroup,
-					Version:  kyvernoAPIVersion,
-					Resource: "clusterpolicies",
-				}
-				_, err = dynamicClient.Resource(gvr).Get(ctx, tt.policy.Name, metav1.GetOptions{})
+			if tt.policy.Namespace == "" {
+				_, err = dynamicClient.Resource(tt.policy.Resource).Get(ctx, tt.policy.Name, metav1.GetOptions{})
 			} else {
-				gvr = schema.GroupVersionResource{
-					Group:    kyvernoAPIGroup,
-					Version:  kyvernoAPIVersion,
-					Resource: "policies",
-				}
-				_, err = dynamicClient.Resource(gvr).Namespace(tt.policy.Namespace).Get(ctx, tt.policy.Name, metav1.GetOptions{})
+				_, err = dynamicClient.Resource(tt.policy.Resource).Namespace(tt.policy.Namespace).Get(ctx, tt.policy.Name, metav1.GetOptions{})
 			}
 
 			if err == nil {
@@ -917,22 +1239,119 @@ func TestCollectGarbage(t *testing.T) {
 		},
 	}
 
+	validatingPolicy := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "policies.kyverno.io/v1alpha1",
+			"kind":       "ValidatingPolicy",
+			"metadata": map[string]interface{}{
+				"name": "orphaned-validating-policy",
+				"labels": map[string]interface{}{
+					"managed-by":     "kyverno-watcher",
+					"policy-version": "v1.0.0",
+				},
+			},
+		},
+	}
+
+	heldPolicy := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "kyverno.io/v1",
+			"kind":       "ClusterPolicy",
+			"metadata": map[string]interface{}{
+				"name": "held-policy",
+				"labels": map[string]interface{}{
+					"managed-by":     "kyverno-watcher",
+					"policy-version": "v1.0.0",
+				},
+				"annotations": map[string]interface{}{
+					"kyverno.octokode.io/hold-until": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+				},
+			},
+		},
+	}
+
 	// Register list kinds for all resources we'll query
 	listKinds := map[schema.GroupVersionResource]string{
 		{Group: "kyverno.io", Version: "v1", Resource: "policies"}:                        "PolicyList",
 		{Group: "kyverno.io", Version: "v1", Resource: "clusterpolicies"}:                 "ClusterPolicyList",
+		validatingPolicyResource.GVR:                                                      "ValidatingPolicyList",
 		{Group: "kyverno.octokode.io", Version: "v1alpha1", Resource: "kyvernoartifacts"}: "KyvernoArtifactList",
 	}
 
-	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, listKinds, policy)
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, listKinds, policy, validatingPolicy, heldPolicy)
 	clientset := fakeclientset.NewSimpleClientset()
 
 	getKubeClientFunc = func() (kubernetes.Interface, dynamic.Interface, error) {
 		return clientset, dynamicClient, nil
 	}
+	oldMapperFunc := getRESTMapperFunc
+	defer func() { getRESTMapperFunc = oldMapperFunc }()
+	getRESTMapperFunc = func() (meta.RESTMapper, error) {
+		return newTestRESTMapper(), nil
+	}
+	orphanedPolicies = make(map[string]time.Time)
+	defer func() { orphanedPolicies = make(map[string]time.Time) }()
 
-	// This should run without panicking
+	// The first cycle only records the orphans, the second one deletes them
+	collectGarbage()
 	collectGarbage()
+
+	ctx := context.Background()
+	if _, err := dynamicClient.Resource(policyResource.GVR).Namespace("default").Get(ctx, "orphaned-policy", metav1.GetOptions{}); err == nil {
+		t.Error("Expected orphaned Policy to be deleted")
+	}
+	if _, err := dynamicClient.Resource(validatingPolicyResource.GVR).Get(ctx, "orphaned-validating-policy", metav1.GetOptions{}); err == nil {
+		t.Error("Expected orphaned ValidatingPolicy to be deleted")
+	}
+	if _, err := dynamicClient.Resource(clusterPolicyResource.GVR).Get(ctx, "held-policy", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected held ClusterPolicy to be kept, got %v", err)
+	}
+}
+
+func TestCollectGarbage_Frozen(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "ops")
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	policy := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "kyverno.io/v1",
+			"kind":       "ClusterPolicy",
+			"metadata": map[string]interface{}{
+				"name":   "orphaned-policy",
+				"labels": map[string]interface{}{"managed-by": "kyverno-watcher"},
+			},
+		},
+	}
+	listKinds := map[schema.GroupVersionResource]string{
+		{Group: "kyverno.io", Version: "v1", Resource: "clusterpolicies"}:                 "ClusterPolicyList",
+		{Group: "kyverno.octokode.io", Version: "v1alpha1", Resource: "kyvernoartifacts"}: "KyvernoArtifactList",
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, listKinds, policy)
+	clientset := fakeclientset.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kyverno-artifact-operator-freeze", Namespace: "ops"},
+		Data:       map[string]string{"enabled": "true", "reason": "INC-1234"},
+	})
+
+	oldFunc := getKubeClientFunc
+	defer func() { getKubeClientFunc = oldFunc }()
+	getKubeClientFunc = func() (kubernetes.Interface, dynamic.Interface, error) {
+		return clientset, dynamicClient, nil
+	}
+	oldMapperFunc := getRESTMapperFunc
+	defer func() { getRESTMapperFunc = oldMapperFunc }()
+	getRESTMapperFunc = func() (meta.RESTMapper, error) {
+		return newTestRESTMapper(), nil
+	}
+	orphanedPolicies = make(map[string]time.Time)
+	defer func() { orphanedPolicies = make(map[string]time.Time) }()
+
+	collectGarbage()
+	collectGarbage()
+
+	if _, err := dynamicClient.Resource(clusterPolicyResource.GVR).Get(context.Background(), "orphaned-policy", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected the orphaned ClusterPolicy to be kept while frozen, got %v", err)
+	}
 }
 
 // Integration tests would require:
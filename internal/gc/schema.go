@@ -1,9 +1,13 @@
 package gc
 
+import "k8s.io/apimachinery/pkg/runtime/schema"
+
 // PolicyInfo holds basic policy information
 type PolicyInfo struct {
-	Name      string
-	Namespace string
-	Kind      string
-	Labels    map[string]string
+	Name        string
+	Namespace   string
+	Kind        string
+	Resource    schema.GroupVersionResource
+	Labels      map[string]string
+	Annotations map[string]string
 }
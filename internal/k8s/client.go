@@ -2,6 +2,8 @@ package k8s
 
 import (
 	"fmt"
+	"os"
+	"strconv"
 
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
@@ -9,8 +11,17 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+const (
+	// QPSEnvVar overrides the client-side rate limit (queries per second) of every client built from GetConfig.
+	QPSEnvVar = "KUBE_API_QPS"
+	// BurstEnvVar overrides the client-side burst of every client built from GetConfig.
+	BurstEnvVar = "KUBE_API_BURST"
+)
+
 // GetConfig returns a Kubernetes rest.Config
-// It attempts to use in-cluster config first, then falls back to kubeconfig
+// It attempts to use in-cluster config first, then falls back to kubeconfig.
+// The client-side rate limits can be raised with the KUBE_API_QPS and KUBE_API_BURST environment variables;
+// when they are unset the client-go defaults apply.
 func GetConfig() (*rest.Config, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
@@ -23,9 +34,31 @@ func GetConfig() (*rest.Config, error) {
 			return nil, fmt.Errorf("failed to get kubeconfig: %w", err)
 		}
 	}
+	if err := ApplyRateLimits(config); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
+// ApplyRateLimits sets QPS and Burst on config from the KUBE_API_QPS and KUBE_API_BURST environment variables.
+func ApplyRateLimits(config *rest.Config) error {
+	if value := os.Getenv(QPSEnvVar); value != "" {
+		qps, err := strconv.ParseFloat(value, 32)
+		if err != nil || qps <= 0 {
+			return fmt.Errorf("invalid %s %q: must be a positive number", QPSEnvVar, value)
+		}
+		config.QPS = float32(qps)
+	}
+	if value := os.Getenv(BurstEnvVar); value != "" {
+		burst, err := strconv.Atoi(value)
+		if err != nil || burst <= 0 {
+			return fmt.Errorf("invalid %s %q: must be a positive integer", BurstEnvVar, value)
+		}
+		config.Burst = burst
+	}
+	return nil
+}
+
 // GetClient returns a Kubernetes clientset and dynamic client
 // It attempts to use in-cluster config first, then falls back to kubeconfig
 func GetClient() (kubernetes.Interface, dynamic.Interface, error) {
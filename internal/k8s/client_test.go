@@ -294,3 +294,65 @@ func BenchmarkGetClient(b *testing.B) {
 		_, _, _ = GetClient()
 	}
 }
+
+func TestApplyRateLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		qps       string
+		burst     string
+		wantQPS   float32
+		wantBurst int
+		wantErr   bool
+	}{
+		{
+			name:      "unset keeps client-go defaults",
+			wantQPS:   0,
+			wantBurst: 0,
+		},
+		{
+			name:      "qps and burst set",
+			qps:       "50",
+			burst:     "100",
+			wantQPS:   50,
+			wantBurst: 100,
+		},
+		{
+			name:      "fractional qps",
+			qps:       "7.5",
+			wantQPS:   7.5,
+			wantBurst: 0,
+		},
+		{
+			name:    "invalid qps",
+			qps:     "fast",
+			wantErr: true,
+		},
+		{
+			name:    "negative burst",
+			burst:   "-1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(QPSEnvVar, tt.qps)
+			t.Setenv(BurstEnvVar, tt.burst)
+
+			config := &rest.Config{}
+			err := ApplyRateLimits(config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyRateLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if config.QPS != tt.wantQPS {
+				t.Errorf("QPS = %v, want %v", config.QPS, tt.wantQPS)
+			}
+			if config.Burst != tt.wantBurst {
+				t.Errorf("Burst = %v, want %v", config.Burst, tt.wantBurst)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FreezeConfigMapName is the ConfigMap in the operator's namespace that freezes policy changes across every
+	// artifact.
+	FreezeConfigMapName = "kyverno-artifact-operator-freeze"
+	// FreezeModePause stops applying, pruning, correcting drift and garbage collecting policies.
+	FreezeModePause = "pause"
+	// FreezeModeAudit pauses like FreezeModePause and also switches every managed policy to Audit.
+	FreezeModeAudit = "audit"
+
+	// defaultOperatorNamespace is the namespace the operator is installed into by default.
+	defaultOperatorNamespace = "kyverno-artifact-operator-system"
+	// serviceAccountNamespaceFile holds the namespace of the pod when running in a cluster.
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// Freeze is the operator-wide freeze read from the freeze ConfigMap.
+type Freeze struct {
+	Enabled bool
+	// Mode is FreezeModePause or FreezeModeAudit.
+	Mode string
+	// Reason is shown on every artifact while the freeze is in effect.
+	Reason string
+}
+
+// ParseFreeze reads a freeze from the data of the freeze ConfigMap: enabled is "true" or "false", mode is pause
+// or audit and defaults to pause, and reason is free text. A value that cannot be parsed pauses, so that a typo
+// during an incident does not let changes through; the error is returned for the caller to report.
+func ParseFreeze(data map[string]string) (Freeze, error) {
+	freeze := Freeze{Mode: FreezeModePause, Reason: data["reason"]}
+	if value := strings.TrimSpace(data["enabled"]); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			freeze.Enabled = true
+			return freeze, fmt.Errorf("invalid enabled %q: %w", value, err)
+		}
+		freeze.Enabled = enabled
+	}
+	switch mode := strings.TrimSpace(data["mode"]); mode {
+	case "", FreezeModePause:
+	case FreezeModeAudit:
+		freeze.Mode = FreezeModeAudit
+	default:
+		return freeze, fmt.Errorf("invalid mode %q: must be pause or audit", mode)
+	}
+	return freeze, nil
+}
+
+// OperatorNamespace returns the namespace the operator runs in, from POD_NAMESPACE or the service account of
+// the pod, falling back to the default install namespace.
+func OperatorNamespace() string {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	if data, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+		if namespace := strings.TrimSpace(string(data)); namespace != "" {
+			return namespace
+		}
+	}
+	return defaultOperatorNamespace
+}
@@ -0,0 +1,56 @@
+package k8s
+
+import "testing"
+
+func TestParseFreeze(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    Freeze
+		wantErr bool
+	}{
+		{
+			name: "no data",
+			want: Freeze{Mode: FreezeModePause},
+		},
+		{
+			name: "paused with a reason",
+			data: map[string]string{"enabled": "true", "reason": "INC-1234"},
+			want: Freeze{Enabled: true, Mode: FreezeModePause, Reason: "INC-1234"},
+		},
+		{
+			name: "audit",
+			data: map[string]string{"enabled": "true", "mode": "audit"},
+			want: Freeze{Enabled: true, Mode: FreezeModeAudit},
+		},
+		{
+			name: "lifted",
+			data: map[string]string{"enabled": "false", "mode": "audit"},
+			want: Freeze{Mode: FreezeModeAudit},
+		},
+		{
+			name:    "invalid enabled pauses",
+			data:    map[string]string{"enabled": "yes please"},
+			want:    Freeze{Enabled: true, Mode: FreezeModePause},
+			wantErr: true,
+		},
+		{
+			name:    "invalid mode pauses",
+			data:    map[string]string{"enabled": "true", "mode": "read-only"},
+			want:    Freeze{Enabled: true, Mode: FreezeModePause},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFreeze(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFreeze() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFreeze() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package k8s
+
+import (
+	"time"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+)
+
+// HeldUntil returns the time the hold-until annotation among annotations holds an object until, and whether that
+// time is still after now. An annotation that is not an RFC3339 time does not hold the object, so that a typo
+// cannot keep an object from being reconciled forever; the error is returned for the caller to report.
+func HeldUntil(annotations map[string]string, now time.Time) (time.Time, bool, error) {
+	value, ok := annotations[kyvernov1alpha1.HoldUntilAnnotation]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return until, now.Before(until), nil
+}
@@ -0,0 +1,61 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeldUntil(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		value     *string
+		wantHeld  bool
+		wantUntil time.Time
+		wantErr   bool
+	}{
+		{
+			name: "no annotation",
+		},
+		{
+			name:      "future time holds",
+			value:     strPtr("2026-10-18T15:00:00+02:00"),
+			wantHeld:  true,
+			wantUntil: now.Add(time.Hour),
+		},
+		{
+			name:      "past time no longer holds",
+			value:     strPtr("2026-10-18T11:59:59Z"),
+			wantUntil: now.Add(-time.Second),
+		},
+		{
+			name:    "invalid time does not hold",
+			value:   strPtr("tomorrow"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			annotations := map[string]string{}
+			if tt.value != nil {
+				annotations["kyverno.octokode.io/hold-until"] = *tt.value
+			}
+			until, held, err := HeldUntil(annotations, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HeldUntil() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if held != tt.wantHeld {
+				t.Errorf("HeldUntil() held = %v, want %v", held, tt.wantHeld)
+			}
+			if !until.Equal(tt.wantUntil) {
+				t.Errorf("HeldUntil() until = %v, want %v", until, tt.wantUntil)
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
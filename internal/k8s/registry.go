@@ -0,0 +1,85 @@
+package k8s
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+)
+
+// ManagedKinds are the Kyverno kinds and native Kubernetes admission policies the operator applies from artifacts,
+// and therefore tracks, checks for orphans and deletes. The version is left to discovery, so that whichever
+// version the cluster serves is used.
+var ManagedKinds = []schema.GroupKind{
+	{Group: "kyverno.io", Kind: "ClusterPolicy"},
+	{Group: "kyverno.io", Kind: "Policy"},
+	{Group: "kyverno.io", Kind: "PolicyException"},
+	{Group: "kyverno.io", Kind: "CleanupPolicy"},
+	{Group: "kyverno.io", Kind: "ClusterCleanupPolicy"},
+	{Group: "kyverno.io", Kind: "GlobalContextEntry"},
+	{Group: "policies.kyverno.io", Kind: "ValidatingPolicy"},
+	{Group: "policies.kyverno.io", Kind: "ImageValidatingPolicy"},
+	{Group: "policies.kyverno.io", Kind: "MutatingPolicy"},
+	{Group: "policies.kyverno.io", Kind: "GeneratingPolicy"},
+	{Group: "policies.kyverno.io", Kind: "DeletingPolicy"},
+	{Group: "policies.kyverno.io", Kind: "PolicyException"},
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicy"},
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicyBinding"},
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingAdmissionPolicy"},
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingAdmissionPolicyBinding"},
+}
+
+// ManagedResource is one of ManagedKinds as served by the cluster.
+type ManagedResource struct {
+	GVR        schema.GroupVersionResource
+	Kind       string
+	Namespaced bool
+}
+
+// ManagedResources resolves ManagedKinds with mapper and returns the ones the cluster serves, at their preferred
+// version. Kinds whose CRD is not installed are left out.
+func ManagedResources(mapper meta.RESTMapper) ([]ManagedResource, error) {
+	resources := make([]ManagedResource, 0, len(ManagedKinds))
+	for _, gk := range ManagedKinds {
+		mapping, err := mapper.RESTMapping(gk)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get REST mapping for %s: %w", gk.String(), err)
+		}
+		resources = append(resources, ManagedResource{
+			GVR:        mapping.Resource,
+			Kind:       gk.Kind,
+			Namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+		})
+	}
+	return resources, nil
+}
+
+// NewRESTMapper returns a REST mapper built from the API discovery of the cluster config points to.
+func NewRESTMapper(config *rest.Config) (meta.RESTMapper, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery client: %w", err)
+	}
+	cachedClient := memory.NewMemCacheClient(discoveryClient)
+	apiGroupResources, err := restmapper.GetAPIGroupResources(cachedClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API group resources: %w", err)
+	}
+	return restmapper.NewDiscoveryRESTMapper(apiGroupResources), nil
+}
+
+// GetRESTMapper returns a REST mapper for the cluster GetConfig points to.
+func GetRESTMapper() (meta.RESTMapper, error) {
+	config, err := GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return NewRESTMapper(config)
+}
@@ -0,0 +1,45 @@
+package k8s
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestManagedResources(t *testing.T) {
+	kyvernoV1 := schema.GroupVersion{Group: "kyverno.io", Version: "v1"}
+	kyvernoV2 := schema.GroupVersion{Group: "kyverno.io", Version: "v2"}
+	kyvernoV2beta1 := schema.GroupVersion{Group: "kyverno.io", Version: "v2beta1"}
+	policiesV1alpha1 := schema.GroupVersion{Group: "policies.kyverno.io", Version: "v1alpha1"}
+
+	// The order of the group versions is the preference discovery reports.
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{kyvernoV1, kyvernoV2, kyvernoV2beta1, policiesV1alpha1})
+	mapper.Add(kyvernoV1.WithKind("ClusterPolicy"), meta.RESTScopeRoot)
+	mapper.Add(kyvernoV1.WithKind("Policy"), meta.RESTScopeNamespace)
+	mapper.Add(kyvernoV2.WithKind("PolicyException"), meta.RESTScopeNamespace)
+	mapper.Add(kyvernoV2beta1.WithKind("PolicyException"), meta.RESTScopeNamespace)
+	mapper.Add(policiesV1alpha1.WithKind("ValidatingPolicy"), meta.RESTScopeRoot)
+	// Not one of the managed kinds.
+	mapper.Add(kyvernoV1.WithKind("UpdateRequest"), meta.RESTScopeNamespace)
+
+	resources, err := ManagedResources(mapper)
+	if err != nil {
+		t.Fatalf("ManagedResources() error = %v", err)
+	}
+
+	want := []ManagedResource{
+		{GVR: kyvernoV1.WithResource("clusterpolicies"), Kind: "ClusterPolicy"},
+		{GVR: kyvernoV1.WithResource("policies"), Kind: "Policy", Namespaced: true},
+		{GVR: kyvernoV2.WithResource("policyexceptions"), Kind: "PolicyException", Namespaced: true},
+		{GVR: policiesV1alpha1.WithResource("validatingpolicies"), Kind: "ValidatingPolicy"},
+	}
+	if len(resources) != len(want) {
+		t.Fatalf("ManagedResources() = %+v, want %+v", resources, want)
+	}
+	for i := range want {
+		if resources[i] != want[i] {
+			t.Errorf("resource %d = %+v, want %+v", i, resources[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+)
+
+// admissionPolicyGroup is the API group of the native Kubernetes admission policies and their bindings.
+const admissionPolicyGroup = "admissionregistration.k8s.io"
+
+// boundPolicyKinds maps the native admission policy binding kinds to the kind of the policy their
+// spec.policyName refers to.
+var boundPolicyKinds = map[schema.GroupKind]string{
+	{Group: admissionPolicyGroup, Kind: "ValidatingAdmissionPolicyBinding"}: "ValidatingAdmissionPolicy",
+	{Group: admissionPolicyGroup, Kind: "MutatingAdmissionPolicyBinding"}:   "MutatingAdmissionPolicy",
+}
+
+// isAdmissionPolicyBinding reports whether obj binds a native admission policy.
+func isAdmissionPolicyBinding(obj *unstructured.Unstructured) bool {
+	_, ok := boundPolicyKinds[obj.GroupVersionKind().GroupKind()]
+	return ok
+}
+
+// hasAdmissionPolicyBinding reports whether the manifest file defines an admission policy binding. Files that
+// cannot be read are reported as not having one, so that applying them reports the error.
+func hasAdmissionPolicyBinding(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	decoder := k8syaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(obj); err != nil {
+			return false // io.EOF or a document applyManifestFile reports
+		}
+		if isAdmissionPolicyBinding(obj) {
+			return true
+		}
+	}
+}
+
+// checkBoundPolicy verifies that the admission policy a binding refers to exists in the cluster. Policies are
+// applied before bindings, so a missing policy is neither in the artifact nor otherwise installed.
+func checkBoundPolicy(obj *unstructured.Unstructured, dynamicClient dynamic.Interface, mapper meta.RESTMapper) error {
+	gvk := obj.GroupVersionKind()
+	policyKind := boundPolicyKinds[gvk.GroupKind()]
+	policyName, _, _ := unstructured.NestedString(obj.Object, "spec", "policyName")
+	if policyName == "" {
+		return fmt.Errorf("spec.policyName is not set")
+	}
+	mapping, err := mapper.RESTMapping(schema.GroupKind{Group: gvk.Group, Kind: policyKind}, gvk.Version)
+	if err != nil {
+		return fmt.Errorf("failed to get REST mapping for %s: %w", policyKind, err)
+	}
+	_, err = dynamicClient.Resource(mapping.Resource).Get(context.Background(), policyName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return fmt.Errorf("%s %q referenced by spec.policyName does not exist", policyKind, policyName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get %s %q: %w", policyKind, policyName, err)
+	}
+	return nil
+}
+
+// rewriteBoundPolicyName applies the configured name prefix and suffix to the policy a binding refers to, so
+// that a bundle of policies and bindings keeps working when its names are rewritten.
+func rewriteBoundPolicyName(config *Config, obj *unstructured.Unstructured) {
+	if !isAdmissionPolicyBinding(obj) {
+		return
+	}
+	policyName, _, _ := unstructured.NestedString(obj.Object, "spec", "policyName")
+	if policyName == "" {
+		return
+	}
+	_ = unstructured.SetNestedField(obj.Object, config.NamePrefix+policyName+config.NameSuffix, "spec", "policyName")
+}
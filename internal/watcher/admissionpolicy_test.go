@@ -0,0 +1,79 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestApplyManifestsReal_AdmissionPolicyBindingsAfterPolicies(t *testing.T) {
+	dynamicClient, mapper := newFakePolicyClients()
+	admissionV1 := schema.GroupVersion{Group: admissionPolicyGroup, Version: "v1"}
+	mapper.(*meta.DefaultRESTMapper).Add(admissionV1.WithKind("ValidatingAdmissionPolicy"), meta.RESTScopeRoot)
+	mapper.(*meta.DefaultRESTMapper).Add(admissionV1.WithKind("ValidatingAdmissionPolicyBinding"), meta.RESTScopeRoot)
+
+	// The bindings sort before the policy, as they would in an artifact.
+	dir := t.TempDir()
+	manifests := map[string]string{
+		"a-binding.yaml": "apiVersion: admissionregistration.k8s.io/v1\nkind: ValidatingAdmissionPolicyBinding\n" +
+			"metadata:\n  name: require-owner\nspec:\n  policyName: require-owner\n  validationActions: [Deny]\n",
+		"b-orphaned-binding.yaml": "apiVersion: admissionregistration.k8s.io/v1\nkind: ValidatingAdmissionPolicyBinding\n" +
+			"metadata:\n  name: require-team\nspec:\n  policyName: require-team\n  validationActions: [Deny]\n",
+		"c-policy.yaml": "apiVersion: admissionregistration.k8s.io/v1\nkind: ValidatingAdmissionPolicy\n" +
+			"metadata:\n  name: require-owner\nspec:\n  validations:\n  - expression: has(object.metadata.labels.owner)\n",
+	}
+	var files []string
+	for _, name := range []string{"a-binding.yaml", "b-orphaned-binding.yaml", "c-policy.yaml"} {
+		f := filepath.Join(dir, name)
+		if err := os.WriteFile(f, []byte(manifests[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+
+	results, err := applyManifestsReal(&Config{ApplyConcurrency: 4}, files, mapper, dynamicClient)
+	if err != nil {
+		t.Fatalf("applyManifestsReal() error = %v", err)
+	}
+
+	var created []string
+	for _, action := range dynamicClient.Actions() {
+		if action.GetVerb() == "create" {
+			created = append(created, action.GetResource().Resource)
+		}
+	}
+	if strings.Join(created, ",") != "validatingadmissionpolicies,validatingadmissionpolicybindings" {
+		t.Errorf("created = %v, want the policy and then its binding", created)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if results[0].Outcome != kyvernov1alpha1.ApplyOutcomeCreated || results[2].Outcome != kyvernov1alpha1.ApplyOutcomeCreated {
+		t.Errorf("results = %+v, want the policy and its binding created", results)
+	}
+	orphaned := results[1]
+	if orphaned.Outcome != kyvernov1alpha1.ApplyOutcomeFailed || !strings.Contains(orphaned.Reason, `ValidatingAdmissionPolicy "require-team"`) {
+		t.Errorf("orphaned binding = %+v, want a failure naming the missing policy", orphaned)
+	}
+}
+
+func TestRewriteName_AdmissionPolicyBinding(t *testing.T) {
+	obj := newClusterPolicy("require-owner", nil, map[string]interface{}{"policyName": "require-owner"})
+	obj.SetAPIVersion("admissionregistration.k8s.io/v1")
+	obj.SetKind("ValidatingAdmissionPolicyBinding")
+
+	rewriteName(&Config{NamePrefix: "vendor-"}, obj)
+
+	if obj.GetName() != "vendor-require-owner" {
+		t.Errorf("name = %q, want vendor-require-owner", obj.GetName())
+	}
+	if got := obj.Object["spec"].(map[string]interface{})["policyName"]; got != "vendor-require-owner" {
+		t.Errorf("spec.policyName = %v, want the rewritten policy name", got)
+	}
+}
@@ -0,0 +1,166 @@
+package watcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// stagedDigest returns a digest of the manifests staged in destDir, over their paths relative to destDir and their
+// content, so that the same content always has the same digest. Copies stamped into matching namespaces count
+// once, without their namespace, so that namespaces starting or stopping to match do not need a new approval.
+func stagedDigest(destDir string) (string, error) {
+	files, err := findYAMLFiles(destDir)
+	if err != nil {
+		return "", err
+	}
+	entries := make(map[string]string, len(files))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", f, err)
+		}
+		relPath, err := filepath.Rel(destDir, f)
+		if err != nil {
+			relPath = f
+		}
+		relPath = filepath.ToSlash(relPath)
+		if parts := strings.SplitN(relPath, "/", 3); len(parts) == 3 && parts[0] == fanOutDir {
+			var obj unstructured.Unstructured
+			if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+				return "", fmt.Errorf("failed to parse %s: %w", f, err)
+			}
+			obj.SetNamespace("")
+			if data, err = yaml.Marshal(obj.Object); err != nil {
+				return "", fmt.Errorf("failed to marshal %s: %w", f, err)
+			}
+			relPath = parts[2]
+		}
+		entries[relPath] = calculateSHA256(data)
+	}
+
+	paths := make([]string, 0, len(entries))
+	for relPath := range entries {
+		paths = append(paths, relPath)
+	}
+	sort.Strings(paths)
+	hash := sha256.New()
+	for _, relPath := range paths {
+		_, _ = fmt.Fprintf(hash, "%s %s\n", relPath, entries[relPath])
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// checkApproval reports whether the revision staged in destDir must wait for approval because spec.approval is
+// manual. Content that was approved before is applied right away, so that retries, drift reconciliation and
+// restarts do not need another approval. Other content is recorded as pending; it is approved by annotating the
+// KyvernoArtifact with its version or digest, which is only accepted once it has been recorded as pending, so an
+// approval never applies content that was not reviewed.
+func checkApproval(config *Config, dynamicClient dynamic.Interface, mapper meta.RESTMapper, destDir, revision string) bool {
+	if config.Approval != kyvernov1alpha1.ApprovalManual || dynamicClient == nil || config.ArtifactName == "" {
+		return false
+	}
+
+	digest, err := stagedDigest(destDir)
+	if err != nil {
+		log.Printf("Revision %s is held back, its digest could not be determined: %v\n", revision, err)
+		return true
+	}
+	obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace(config.PodNamespace).Get(context.Background(), config.ArtifactName, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Revision %s is held back, the approval could not be checked: %v\n", revision, err)
+		return true
+	}
+	var artifact kyvernov1alpha1.KyvernoArtifact
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &artifact); err != nil {
+		log.Printf("Revision %s is held back, the approval could not be checked: %v\n", revision, err)
+		return true
+	}
+
+	if artifact.Status.ApprovedDigest == digest {
+		return false
+	}
+
+	// The version of a mutable tag that was overwritten was approved before, so only its digest approves it.
+	approval := artifact.GetAnnotations()[kyvernov1alpha1.ApproveRevisionAnnotation]
+	approved := approval == digest || (approval == revision && revision != artifact.Status.AppliedVersion)
+	if approved && artifact.Status.PendingVersion == revision && artifact.Status.PendingDigest == digest {
+		log.Printf("Revision %s (%s) was approved\n", revision, digest)
+		setApprovalStatus(config, dynamicClient, func(status *kyvernov1alpha1.KyvernoArtifactStatus) {
+			status.ApprovedDigest = digest
+			status.PendingVersion = ""
+			status.PendingDigest = ""
+			status.PendingChanges = nil
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:    kyvernov1alpha1.ConditionAwaitingApproval,
+				Status:  metav1.ConditionFalse,
+				Reason:  "Approved",
+				Message: fmt.Sprintf("Revision %s (%s) was approved", revision, digest),
+			})
+		})
+		return false
+	}
+
+	var pendingChanges *kyvernov1alpha1.RevisionChanges
+	files, err := findYAMLFiles(destDir)
+	var diffs []clusterChanges
+	if err == nil {
+		diffs, err = diffAppliedClusters(config, dynamicClient, mapper, files)
+	}
+	summary := "the changes could not be determined"
+	if err != nil {
+		log.Printf("Warning: failed to diff revision %s: %v\n", revision, err)
+	} else {
+		// With targets, the changes are added up over the targets.
+		changes := totalChanges(diffs)
+		pendingChanges = &kyvernov1alpha1.RevisionChanges{
+			Added:   int32(changes.Added),
+			Changed: int32(changes.Changed),
+			Removed: int32(changes.Removed),
+		}
+		summary = fmt.Sprintf("adds %d, changes %d and removes %d policies", changes.Added, changes.Changed, changes.Removed)
+		if len(config.Targets) > 0 {
+			summary = fmt.Sprintf("%s across %d clusters", summary, len(diffs))
+		}
+	}
+	approveWith := revision
+	if revision == artifact.Status.AppliedVersion {
+		approveWith = digest
+	}
+	message := fmt.Sprintf("Revision %s (%s) %s and waits for approval. Annotate the KyvernoArtifact with %s=%s to apply it",
+		revision, digest, summary, kyvernov1alpha1.ApproveRevisionAnnotation, approveWith)
+	log.Println(message)
+	setApprovalStatus(config, dynamicClient, func(status *kyvernov1alpha1.KyvernoArtifactStatus) {
+		status.PendingVersion = revision
+		status.PendingDigest = digest
+		status.PendingChanges = pendingChanges
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    kyvernov1alpha1.ConditionAwaitingApproval,
+			Status:  metav1.ConditionTrue,
+			Reason:  "ApprovalRequired",
+			Message: message,
+		})
+	})
+	return true
+}
+
+// setApprovalStatus applies mutate to the status of the KyvernoArtifact, logging a failure.
+func setApprovalStatus(config *Config, dynamicClient dynamic.Interface, mutate func(status *kyvernov1alpha1.KyvernoArtifactStatus)) {
+	if err := updateArtifactStatusFunc(config, dynamicClient, mutate); err != nil {
+		log.Printf("Warning: failed to update KyvernoArtifact status: %v\n", err)
+	}
+}
@@ -0,0 +1,141 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+func TestStagedDigest(t *testing.T) {
+	stage := func(namespaces ...string) string {
+		dir := t.TempDir()
+		writeManagedPolicies(t, dir, "vendor", "1", "a")
+		for _, ns := range namespaces {
+			nsDir := filepath.Join(dir, fanOutDir, ns)
+			if err := os.MkdirAll(nsDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			manifest := "apiVersion: kyverno.io/v1\nkind: Policy\nmetadata:\n  name: p\n  namespace: " + ns + "\n"
+			if err := os.WriteFile(filepath.Join(nsDir, "policy.yaml"), []byte(manifest), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		digest, err := stagedDigest(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return digest
+	}
+
+	one := stage("team-a")
+	if !strings.HasPrefix(one, "sha256:") {
+		t.Errorf("stagedDigest() = %q, want a sha256 digest", one)
+	}
+	if two := stage("team-a", "team-b"); two != one {
+		t.Errorf("stagedDigest() = %q, want %q regardless of the namespaces the copies are stamped into", two, one)
+	}
+	if none := stage(); none == one {
+		t.Error("stagedDigest() should change when the staged content changes")
+	}
+}
+
+// setApproval annotates the KyvernoArtifact with approval.
+func setApproval(t *testing.T, dynamicClient dynamic.Interface, config *Config, approval string) {
+	t.Helper()
+	ctx := context.Background()
+	artifacts := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace(config.PodNamespace)
+	obj, err := artifacts.Get(ctx, config.ArtifactName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.SetAnnotations(map[string]string{kyvernov1alpha1.ApproveRevisionAnnotation: approval})
+	if _, err := artifacts.Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getArtifactStatus(t *testing.T, dynamicClient dynamic.Interface, config *Config) kyvernov1alpha1.KyvernoArtifactStatus {
+	t.Helper()
+	obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace(config.PodNamespace).Get(context.Background(), config.ArtifactName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var artifact kyvernov1alpha1.KyvernoArtifact
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &artifact); err != nil {
+		t.Fatal(err)
+	}
+	return artifact.Status
+}
+
+func TestCheckApproval(t *testing.T) {
+	config := &Config{ArtifactName: "vendor", PodNamespace: "default", Approval: kyvernov1alpha1.ApprovalManual}
+	dynamicClient, mapper := newFakePolicyClients(newTestArtifact("vendor", "default"), newManagedPolicy("a", "vendor", "1"))
+	v2 := t.TempDir()
+	writeManagedPolicies(t, v2, "vendor", "2", "a", "b")
+	v3 := t.TempDir()
+	writeManagedPolicies(t, v3, "vendor", "3", "a", "b", "c")
+
+	if !checkApproval(config, dynamicClient, mapper, v2, "v2") {
+		t.Fatal("checkApproval() should hold back a revision that is not approved")
+	}
+	status := getArtifactStatus(t, dynamicClient, config)
+	if status.PendingVersion != "v2" || status.PendingDigest == "" || status.PendingChanges == nil ||
+		status.PendingChanges.Added != 1 || status.PendingChanges.Changed != 1 {
+		t.Errorf("status = %+v, want v2 pending, adding one policy and changing one", status)
+	}
+	condition := meta.FindStatusCondition(status.Conditions, kyvernov1alpha1.ConditionAwaitingApproval)
+	if condition == nil || condition.Status != metav1.ConditionTrue ||
+		!strings.Contains(condition.Message, kyvernov1alpha1.ApproveRevisionAnnotation+"=v2") {
+		t.Errorf("AwaitingApproval condition = %+v, want it to name the approval annotation", condition)
+	}
+
+	// v2 is approved only after v3 replaced it as the pending revision.
+	if !checkApproval(config, dynamicClient, mapper, v3, "v3") {
+		t.Fatal("checkApproval() should hold back v3")
+	}
+	setApproval(t, dynamicClient, config, "v2")
+	if !checkApproval(config, dynamicClient, mapper, v3, "v3") {
+		t.Error("approving an older revision must not apply a newer one")
+	}
+
+	setApproval(t, dynamicClient, config, "v3")
+	if checkApproval(config, dynamicClient, mapper, v3, "v3") {
+		t.Fatal("checkApproval() should let the approved revision through")
+	}
+	status = getArtifactStatus(t, dynamicClient, config)
+	if status.PendingVersion != "" || status.ApprovedDigest == "" {
+		t.Errorf("status = %+v, want v3 approved and nothing pending", status)
+	}
+	if checkApproval(config, dynamicClient, mapper, v3, "v3") {
+		t.Error("checkApproval() should keep letting approved content through")
+	}
+}
+
+func TestCheckApproval_OverwrittenTagNeedsDigest(t *testing.T) {
+	config := &Config{ArtifactName: "vendor", PodNamespace: "default", Approval: kyvernov1alpha1.ApprovalManual}
+	artifact := newTestArtifact("vendor", "default")
+	artifact.SetAnnotations(map[string]string{kyvernov1alpha1.ApproveRevisionAnnotation: "latest"})
+	artifact.Object["status"] = map[string]interface{}{"appliedVersion": "latest"}
+	dynamicClient, mapper := newFakePolicyClients(artifact)
+	destDir := t.TempDir()
+	writeManagedPolicies(t, destDir, "vendor", "2", "a")
+
+	for i := 0; i < 2; i++ {
+		if !checkApproval(config, dynamicClient, mapper, destDir, "latest") {
+			t.Fatal("the approval of the tag's previous content must not approve what it was overwritten with")
+		}
+	}
+	digest := getArtifactStatus(t, dynamicClient, config).PendingDigest
+	setApproval(t, dynamicClient, config, digest)
+	if checkApproval(config, dynamicClient, mapper, destDir, "latest") {
+		t.Error("checkApproval() should let the content through once its digest is approved")
+	}
+}
@@ -1,11 +1,20 @@
 package watcher
 
 import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 	fakedynamic "k8s.io/client-go/dynamic/fake"
 )
 
@@ -88,7 +97,7 @@ func TestGetEnvAsBoolOrDefault(t *testing.T) {
 				}
 			}
 
-			got := getEnvAsBoolOrDefault(tt.key, tt.defaultValue)
+			got := getEnvAsBoolOrDefault(getEnvFunc, tt.key, tt.defaultValue)
 			if got != tt.want {
 				t.Errorf("getEnvAsBoolOrDefault() = %v, want %v", got, tt.want)
 			}
@@ -156,8 +165,9 @@ func TestCleanupPolicies(t *testing.T) {
 						},
 					},
 				},
+				newValidatingPolicy("test-validatingpolicy", map[string]interface{}{"artifact-name": artifactName}),
 			},
-			expectedDeletes: 2,
+			expectedDeletes: 3,
 		},
 		{
 			name:            "no matching policies",
@@ -173,14 +183,17 @@ func TestCleanupPolicies(t *testing.T) {
 			scheme.AddKnownTypeWithName(clusterPolicyGVR.GroupVersion().WithKind("ClusterPolicy"), &unstructured.Unstructured{})
 			scheme.AddKnownTypeWithName(policyGVR.GroupVersion().WithKind("PolicyList"), &unstructured.UnstructuredList{})
 			scheme.AddKnownTypeWithName(clusterPolicyGVR.GroupVersion().WithKind("ClusterPolicyList"), &unstructured.UnstructuredList{})
+			scheme.AddKnownTypeWithName(validatingPoliciesGVR.GroupVersion().WithKind("ValidatingPolicy"), &unstructured.Unstructured{})
+			scheme.AddKnownTypeWithName(validatingPoliciesGVR.GroupVersion().WithKind("ValidatingPolicyList"), &unstructured.UnstructuredList{})
 
 			dynamicClient := fakedynamic.NewSimpleDynamicClient(scheme, tt.existing...)
+			_, mapper := newFakePolicyClients()
 
 			config := &Config{
 				ArtifactName: artifactName,
 			}
 
-			cleanupPolicies(config, dynamicClient)
+			cleanupPolicies(config, dynamicClient, mapper)
 
 			// Verify deletions
 			actions := dynamicClient.Actions()
@@ -197,3 +210,89 @@ func TestCleanupPolicies(t *testing.T) {
 		})
 	}
 }
+
+func TestCleanup(t *testing.T) {
+	owned := map[string]interface{}{"managed-by": "kyverno-watcher", "artifact-name": "security"}
+	deleting := newTestArtifact("security", "default")
+	deleting.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+
+	tests := []struct {
+		name       string
+		artifact   *unstructured.Unstructured
+		wantDelete bool
+	}{
+		{name: "artifact exists", artifact: newTestArtifact("security", "default")},
+		{name: "artifact being deleted", artifact: deleting, wantDelete: true},
+		{name: "artifact gone", wantDelete: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := []runtime.Object{newClusterPolicy("require-labels", owned, map[string]interface{}{})}
+			if tt.artifact != nil {
+				objects = append(objects, tt.artifact)
+			}
+			dynamicClient, mapper := newFakePolicyClients(objects...)
+			originalGetKubernetesClients := getKubernetesClientsFunc
+			getKubernetesClientsFunc = func() (dynamic.Interface, meta.RESTMapper, error) { return dynamicClient, mapper, nil }
+			defer func() { getKubernetesClientsFunc = originalGetKubernetesClients }()
+			originalGetDynamicClient := getDynamicClientFunc
+			getDynamicClientFunc = func() (dynamic.Interface, error) { return dynamicClient, nil }
+			defer func() { getDynamicClientFunc = originalGetDynamicClient }()
+
+			config := &Config{ArtifactName: "security", PodNamespace: "default", LastFile: filepath.Join(t.TempDir(), "last_seen")}
+			if err := Cleanup(config); err != nil {
+				t.Fatalf("Cleanup() error = %v", err)
+			}
+			_, err := dynamicClient.Resource(clusterPoliciesGVR).Get(context.Background(), "require-labels", metav1.GetOptions{})
+			if deleted := errors.IsNotFound(err); deleted != tt.wantDelete {
+				t.Errorf("policy deleted = %v, want %v", deleted, tt.wantDelete)
+			}
+		})
+	}
+}
+
+func TestCleanupPolicies_ScopedToArtifactNamespace(t *testing.T) {
+	tests := []struct {
+		name       string
+		artifacts  []runtime.Object
+		wantRemain []string
+	}{
+		{
+			name:       "unlabeled objects are deleted when the name is unique",
+			artifacts:  []runtime.Object{newTestArtifact("security", "default")},
+			wantRemain: []string{"theirs"},
+		},
+		{
+			name:       "unlabeled objects are kept when the name is shared",
+			artifacts:  []runtime.Object{newTestArtifact("security", "default"), newTestArtifact("security", "other-ns")},
+			wantRemain: []string{"legacy", "theirs"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := append([]runtime.Object{
+				newClusterPolicy("ours", map[string]interface{}{"artifact-name": "security", "artifact-namespace": "default"}, nil),
+				newClusterPolicy("theirs", map[string]interface{}{"artifact-name": "security", "artifact-namespace": "other-ns"}, nil),
+				newClusterPolicy("legacy", map[string]interface{}{"artifact-name": "security"}, nil),
+			}, tt.artifacts...)
+			dynamicClient, mapper := newFakePolicyClients(objects...)
+
+			cleanupPolicies(&Config{ArtifactName: "security", PodNamespace: "default"}, dynamicClient, mapper)
+
+			list, err := dynamicClient.Resource(clusterPoliciesGVR).List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var remain []string
+			for _, item := range list.Items {
+				remain = append(remain, item.GetName())
+			}
+			sort.Strings(remain)
+			if strings.Join(remain, ",") != strings.Join(tt.wantRemain, ",") {
+				t.Errorf("remaining policies = %v, want %v", remain, tt.wantRemain)
+			}
+		})
+	}
+}
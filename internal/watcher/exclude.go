@@ -0,0 +1,335 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// kyvernoRuleKinds are the Kyverno kinds whose spec.rules the global exclude is merged into.
+var kyvernoRuleKinds = map[string]bool{"ClusterPolicy": true, "Policy": true}
+
+// globalExcludeFailure is a policy the global exclude could not be merged into.
+type globalExcludeFailure struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	Err        error
+}
+
+// globalExcludeError is returned by a pull when the global exclude could not be merged into one or more
+// policies. The revision is not applied, so that a rule is never applied without the exclusion.
+type globalExcludeError struct {
+	Failures []globalExcludeFailure
+}
+
+func (e *globalExcludeError) Error() string {
+	messages := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		messages = append(messages, fmt.Sprintf("%s %s: %v", f.Kind, objectKey(f.Namespace, f.Name), f.Err))
+	}
+	return fmt.Sprintf("global exclude could not be merged into %d polic(ies): %s", len(e.Failures), strings.Join(messages, "; "))
+}
+
+func (e *globalExcludeError) objectFailures() []kyvernov1alpha1.ObjectStatus {
+	statuses := make([]kyvernov1alpha1.ObjectStatus, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		statuses = append(statuses, kyvernov1alpha1.ObjectStatus{
+			APIVersion: f.APIVersion,
+			Kind:       f.Kind,
+			Namespace:  f.Namespace,
+			Name:       f.Name,
+			Outcome:    kyvernov1alpha1.ApplyOutcomeFailed,
+			Reason:     fmt.Sprintf("global exclude: %v", f.Err),
+		})
+	}
+	return statuses
+}
+
+// globalExcludeFilters returns the Kyverno resource filters the global exclude adds to exclude.any of every rule,
+// one for each field that is set.
+func globalExcludeFilters(exclude *kyvernov1alpha1.GlobalExclude) ([]interface{}, error) {
+	if exclude == nil {
+		return nil, nil
+	}
+	var filters []interface{}
+	if len(exclude.Namespaces) > 0 {
+		namespaces := make([]interface{}, 0, len(exclude.Namespaces))
+		for _, namespace := range exclude.Namespaces {
+			namespaces = append(namespaces, namespace)
+		}
+		filters = append(filters, map[string]interface{}{
+			"resources": map[string]interface{}{"namespaces": namespaces},
+		})
+	}
+	if exclude.NamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(exclude.NamespaceSelector); err != nil {
+			return nil, fmt.Errorf("namespaceSelector: %w", err)
+		}
+		selector, err := runtime.DefaultUnstructuredConverter.ToUnstructured(exclude.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("namespaceSelector: %w", err)
+		}
+		filters = append(filters, map[string]interface{}{
+			"resources": map[string]interface{}{"namespaceSelector": selector},
+		})
+	}
+	for i, raw := range exclude.Any {
+		var filter map[string]interface{}
+		if err := json.Unmarshal(raw.Raw, &filter); err != nil || len(filter) == 0 {
+			return nil, fmt.Errorf("any[%d] must be a Kyverno resource filter object", i)
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// applyGlobalExclude merges filters into the exclude block of every rule of obj and reports whether obj changed.
+// Objects other than Kyverno policies, and policies without rules, are left alone. A rule whose exclude block
+// cannot be combined with the filters is removed from obj, so that it is never applied without the global exclude,
+// and returned as a skipped rule, while the other rules are applied.
+func applyGlobalExclude(filters []interface{}, obj *unstructured.Unstructured) (bool, []kyvernov1alpha1.ObjectStatus, error) {
+	if len(filters) == 0 || obj.GroupVersionKind().Group != "kyverno.io" || !kyvernoRuleKinds[obj.GetKind()] {
+		return false, nil, nil
+	}
+	rules, found, err := unstructured.NestedSlice(obj.Object, "spec", "rules")
+	if err != nil || !found || len(rules) == 0 {
+		return false, nil, err
+	}
+
+	var skipped []kyvernov1alpha1.ObjectStatus
+	kept := make([]interface{}, 0, len(rules))
+	for i, r := range rules {
+		rule, ok := r.(map[string]interface{})
+		if !ok {
+			return false, nil, fmt.Errorf("rule %d is not an object", i)
+		}
+		exclude, err := mergeExclude(rule["exclude"], filters)
+		if err != nil {
+			log.Printf("Warning: skipping rule %v of %s %s, the global exclude cannot be merged into it: %v\n",
+				rule["name"], obj.GetKind(), objectKey(obj.GetNamespace(), obj.GetName()), err)
+			skipped = append(skipped, kyvernov1alpha1.ObjectStatus{
+				APIVersion: obj.GetAPIVersion(),
+				Kind:       obj.GetKind(),
+				Namespace:  obj.GetNamespace(),
+				Name:       obj.GetName(),
+				Outcome:    kyvernov1alpha1.ApplyOutcomeFailed,
+				Reason:     fmt.Sprintf("global exclude: rule %v was not applied: %v", rule["name"], err),
+			})
+			continue
+		}
+		rule["exclude"] = exclude
+		kept = append(kept, rule)
+	}
+	return true, skipped, unstructured.SetNestedSlice(obj.Object, kept, "spec", "rules")
+}
+
+// skippedRulesPath returns the file the rules a pull into destDir left out are recorded in. It lives next to
+// destDir, so that it is not applied.
+func skippedRulesPath(destDir string) string {
+	return destDir + ".skipped-rules.json"
+}
+
+// saveSkippedRules records the rules a pull into destDir left out, or removes the record when there are none.
+func saveSkippedRules(destDir string, skipped []kyvernov1alpha1.ObjectStatus) {
+	if len(skipped) == 0 {
+		if err := os.Remove(skippedRulesPath(destDir)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to remove skipped rules: %v\n", err)
+		}
+		return
+	}
+	data, err := json.Marshal(skipped)
+	if err == nil {
+		err = os.WriteFile(skippedRulesPath(destDir), data, 0644)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to record skipped rules: %v\n", err)
+	}
+}
+
+// skippedRuleResults returns a failed result for every rule the last pull into destDir left out. The results name
+// no file, because applying the policy again cannot bring the rule back; only a new revision can.
+func skippedRuleResults(destDir string) []ApplyResult {
+	data, err := os.ReadFile(skippedRulesPath(destDir))
+	if err != nil {
+		return nil
+	}
+	var skipped []kyvernov1alpha1.ObjectStatus
+	if err := json.Unmarshal(data, &skipped); err != nil {
+		log.Printf("Warning: failed to read skipped rules: %v\n", err)
+		return nil
+	}
+	results := make([]ApplyResult, 0, len(skipped))
+	for _, s := range skipped {
+		results = append(results, ApplyResult{
+			APIVersion: s.APIVersion,
+			Kind:       s.Kind,
+			Namespace:  s.Namespace,
+			Name:       s.Name,
+			Outcome:    s.Outcome,
+			Reason:     s.Reason,
+		})
+	}
+	return results
+}
+
+// mergeExclude returns a rule's exclude block extended by filters. Kyverno excludes a resource when it matches any
+// entry of exclude.any, so the filters are appended there. Exclude blocks in the legacy form, without any or all,
+// are a single filter and become the first entry of any. The entries of exclude.all must all match, so they are
+// combined into a single filter; when they can never match together, they exclude nothing and are dropped.
+func mergeExclude(existing interface{}, filters []interface{}) (map[string]interface{}, error) {
+	merged := make(map[string]interface{})
+	var anyFilters []interface{}
+
+	switch exclude := existing.(type) {
+	case nil:
+	case map[string]interface{}:
+		anyList, hasAny := exclude["any"]
+		allList, hasAll := exclude["all"]
+		switch {
+		case hasAny && hasAll:
+			return nil, errors.New("exclude sets both any and all")
+		case hasAny:
+			list, ok := anyList.([]interface{})
+			if !ok {
+				return nil, errors.New("exclude.any is not a list")
+			}
+			for k, v := range exclude {
+				merged[k] = v
+			}
+			anyFilters = list
+		case hasAll:
+			list, ok := allList.([]interface{})
+			if !ok {
+				return nil, errors.New("exclude.all is not a list")
+			}
+			combined, err := combineFilters(list)
+			if err != nil {
+				return nil, err
+			}
+			if len(combined) > 0 {
+				anyFilters = []interface{}{combined}
+			}
+		default:
+			if len(exclude) > 0 {
+				anyFilters = []interface{}{exclude}
+			}
+		}
+	default:
+		return nil, errors.New("exclude is not an object")
+	}
+
+	for _, filter := range filters {
+		anyFilters = append(anyFilters, runtime.DeepCopyJSONValue(filter))
+	}
+	merged["any"] = anyFilters
+	return merged, nil
+}
+
+// combineFilters combines the entries of an exclude.all block into a single filter, whose fields Kyverno also
+// requires to match together. It returns nil when the entries can never match together.
+func combineFilters(filters []interface{}) (map[string]interface{}, error) {
+	combined := make(map[string]interface{})
+	for i, f := range filters {
+		filter, ok := f.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("exclude.all[%d] is not an object", i)
+		}
+		merged, satisfiable, err := intersectFilterValues("exclude.all", "", combined, filter)
+		if err != nil || !satisfiable {
+			return nil, err
+		}
+		combined = merged.(map[string]interface{})
+	}
+	return combined, nil
+}
+
+// intersectFilterValues returns a value of the filter field key that matches exactly what both a and b match,
+// and false when nothing matches both. Objects are merged field by field, label selector expressions are
+// concatenated, and lists, which match any of their entries, are reduced to the entries they have in common.
+// Values with wildcards or group and version prefixes cannot be intersected that way and are an error, unless
+// they are equal.
+func intersectFilterValues(path, key string, a, b interface{}) (interface{}, bool, error) {
+	if equality.Semantic.DeepEqual(a, b) {
+		return a, true, nil
+	}
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		merged := make(map[string]interface{}, len(av)+len(bv))
+		for k, v := range av {
+			merged[k] = v
+		}
+		for k, v := range bv {
+			existing, found := merged[k]
+			if !found {
+				merged[k] = v
+				continue
+			}
+			value, satisfiable, err := intersectFilterValues(path+"."+k, k, existing, v)
+			if err != nil || !satisfiable {
+				return nil, false, err
+			}
+			merged[k] = value
+		}
+		return merged, true, nil
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		if key == "matchExpressions" {
+			return append(append([]interface{}{}, av...), bv...), true, nil
+		}
+		if !exactValues(av) || !exactValues(bv) {
+			return nil, false, fmt.Errorf("%s is set in more than one entry with patterns that cannot be combined", path)
+		}
+		var common []interface{}
+		for _, x := range av {
+			for _, y := range bv {
+				if equality.Semantic.DeepEqual(x, y) {
+					common = append(common, x)
+					break
+				}
+			}
+		}
+		return common, len(common) > 0, nil
+	default:
+		if _, isMap := b.(map[string]interface{}); isMap {
+			break
+		}
+		if _, isList := b.([]interface{}); isList {
+			break
+		}
+		if !exactValues([]interface{}{a, b}) {
+			return nil, false, fmt.Errorf("%s is set in more than one entry with patterns that cannot be combined", path)
+		}
+		// Two different exact values never match the same resource.
+		return nil, false, nil
+	}
+	return nil, false, fmt.Errorf("%s is set in more than one entry with values of different types", path)
+}
+
+// exactValues reports whether values only holds values that match themselves, and not strings with wildcards or
+// group and version prefixes, which may match the same resource as a different string.
+func exactValues(values []interface{}) bool {
+	for _, v := range values {
+		if s, ok := v.(string); ok && strings.ContainsAny(s, "*?/") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,278 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+func TestGlobalExcludeFilters(t *testing.T) {
+	filters, err := globalExcludeFilters(&kyvernov1alpha1.GlobalExclude{
+		Namespaces:        []string{"kube-system", "kyverno"},
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"policy.example.com/exempt": "true"}},
+		Any:               []runtime.RawExtension{{Raw: []byte(`{"subjects":[{"kind":"Group","name":"system:nodes"}]}`)}},
+	})
+	if err != nil {
+		t.Fatalf("globalExcludeFilters() error = %v", err)
+	}
+	got, _ := json.Marshal(filters)
+	want := `[{"resources":{"namespaces":["kube-system","kyverno"]}},` +
+		`{"resources":{"namespaceSelector":{"matchLabels":{"policy.example.com/exempt":"true"}}}},` +
+		`{"subjects":[{"kind":"Group","name":"system:nodes"}]}]`
+	if string(got) != want {
+		t.Errorf("globalExcludeFilters() = %s, want %s", got, want)
+	}
+
+	if filters, err := globalExcludeFilters(nil); err != nil || filters != nil {
+		t.Errorf("globalExcludeFilters(nil) = %v, %v, want nil", filters, err)
+	}
+	if _, err := globalExcludeFilters(&kyvernov1alpha1.GlobalExclude{Any: []runtime.RawExtension{{Raw: []byte(`["kube-system"]`)}}}); err == nil {
+		t.Error("globalExcludeFilters() should reject entries that are not objects")
+	}
+	if _, err := globalExcludeFilters(&kyvernov1alpha1.GlobalExclude{NamespaceSelector: &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "a", Operator: "Bogus"}},
+	}}); err == nil {
+		t.Error("globalExcludeFilters() should reject an invalid namespaceSelector")
+	}
+}
+
+func TestMergeExclude(t *testing.T) {
+	global := []interface{}{map[string]interface{}{"resources": map[string]interface{}{"namespaces": []interface{}{"kube-system"}}}}
+	globalJSON := `{"resources":{"namespaces":["kube-system"]}}`
+
+	tests := []struct {
+		name     string
+		existing string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "no exclude",
+			want: `{"any":[` + globalJSON + `]}`,
+		},
+		{
+			name:     "any is extended",
+			existing: `{"any":[{"resources":{"kinds":["Pod"]}}]}`,
+			want:     `{"any":[{"resources":{"kinds":["Pod"]}},` + globalJSON + `]}`,
+		},
+		{
+			name:     "legacy form becomes the first entry of any",
+			existing: `{"resources":{"kinds":["Pod"]},"subjects":[{"kind":"User","name":"admin"}]}`,
+			want:     `{"any":[{"resources":{"kinds":["Pod"]},"subjects":[{"kind":"User","name":"admin"}]},` + globalJSON + `]}`,
+		},
+		{
+			name:     "all with disjoint fields is combined into one filter",
+			existing: `{"all":[{"resources":{"kinds":["Pod"]}},{"clusterRoles":["cluster-admin"]}]}`,
+			want:     `{"any":[{"clusterRoles":["cluster-admin"],"resources":{"kinds":["Pod"]}},` + globalJSON + `]}`,
+		},
+		{
+			name:     "all with entries setting the same field is merged field by field",
+			existing: `{"all":[{"resources":{"kinds":["Pod"]}},{"resources":{"names":["web-*"]}}]}`,
+			want:     `{"any":[{"resources":{"kinds":["Pod"],"names":["web-*"]}},` + globalJSON + `]}`,
+		},
+		{
+			name:     "all with lists of exact values keeps the values in common",
+			existing: `{"all":[{"resources":{"kinds":["Pod","Service"]}},{"resources":{"kinds":["Pod","ConfigMap"]}}]}`,
+			want:     `{"any":[{"resources":{"kinds":["Pod"]}},` + globalJSON + `]}`,
+		},
+		{
+			name: "all with label selectors requires every expression",
+			existing: `{"all":[{"resources":{"selector":{"matchExpressions":[{"key":"a","operator":"Exists"}]}}},` +
+				`{"resources":{"selector":{"matchExpressions":[{"key":"b","operator":"Exists"}]}}}]}`,
+			want: `{"any":[{"resources":{"selector":{"matchExpressions":[{"key":"a","operator":"Exists"},{"key":"b","operator":"Exists"}]}}},` +
+				globalJSON + `]}`,
+		},
+		{
+			name:     "all that never matches excludes nothing",
+			existing: `{"all":[{"resources":{"kinds":["Pod"]}},{"resources":{"kinds":["Service"]}}]}`,
+			want:     `{"any":[` + globalJSON + `]}`,
+		},
+		{
+			name:     "all with different patterns for the same field cannot be combined",
+			existing: `{"all":[{"resources":{"names":["web-*"]}},{"resources":{"names":["*-canary"]}}]}`,
+			wantErr:  true,
+		},
+		{
+			name:     "any and all together are rejected",
+			existing: `{"any":[],"all":[]}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var existing interface{}
+			if tt.existing != "" {
+				if err := json.Unmarshal([]byte(tt.existing), &existing); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := mergeExclude(existing, global)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mergeExclude() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var want map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Errorf("mergeExclude() = %s, want %s", gotJSON, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyGlobalExclude(t *testing.T) {
+	filters := []interface{}{map[string]interface{}{"resources": map[string]interface{}{"namespaces": []interface{}{"kube-system"}}}}
+
+	tests := []struct {
+		name        string
+		manifest    string
+		wantChanged bool
+	}{
+		{
+			name:        "every rule of a ClusterPolicy",
+			manifest:    patchTestPolicy,
+			wantChanged: true,
+		},
+		{
+			name: "kinds without rules are left alone",
+			manifest: "apiVersion: kyverno.io/v2\nkind: CleanupPolicy\nmetadata:\n  name: cleanup\n" +
+				"spec:\n  schedule: \"* * * * *\"\n  match:\n    any:\n    - resources:\n        kinds: [Pod]\n",
+		},
+		{
+			name:     "other groups are left alone",
+			manifest: "apiVersion: example.com/v1\nkind: Policy\nmetadata:\n  name: other\nspec:\n  rules:\n  - name: a\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{}
+			if err := yaml.Unmarshal([]byte(tt.manifest), &obj.Object); err != nil {
+				t.Fatal(err)
+			}
+			before := obj.DeepCopy()
+
+			changed, skipped, err := applyGlobalExclude(filters, obj)
+			if err != nil || len(skipped) > 0 {
+				t.Fatalf("applyGlobalExclude() skipped = %v, error = %v", skipped, err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("applyGlobalExclude() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !tt.wantChanged {
+				if !reflect.DeepEqual(before.Object, obj.Object) {
+					t.Error("object should not be modified")
+				}
+				return
+			}
+			rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+			for _, r := range rules {
+				anyFilters, _, _ := unstructured.NestedSlice(r.(map[string]interface{}), "exclude", "any")
+				if len(anyFilters) != 1 || !reflect.DeepEqual(anyFilters[0], filters[0]) {
+					t.Errorf("rule %v exclude.any = %v, want the global exclude", r.(map[string]interface{})["name"], anyFilters)
+				}
+			}
+		})
+	}
+}
+
+func TestPullImageToDirReal_GlobalExclude(t *testing.T) {
+	originalOrasPull := orasPullFunc
+	defer func() { orasPullFunc = originalOrasPull }()
+
+	filters, err := globalExcludeFilters(&kyvernov1alpha1.GlobalExclude{Namespaces: []string{"kube-system"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{Provider: ProviderArtifactory, ImageBase: "registry.example.com/policies", GlobalExcludeFilters: filters}
+
+	orasPullFunc = func(config *Config, destDir string) error {
+		return os.WriteFile(filepath.Join(destDir, "policy.yaml"), []byte(patchTestPolicy), 0644)
+	}
+	destDir := filepath.Join(t.TempDir(), "image")
+	if _, err := pullImageToDirReal(config, "v1", destDir); err != nil {
+		t.Fatalf("pullImageToDirReal() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(destDir, "policy.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+		t.Fatal(err)
+	}
+	rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+	if _, found, _ := unstructured.NestedSlice(rules[0].(map[string]interface{}), "exclude", "any"); !found {
+		t.Error("the applied policy should carry the global exclude")
+	}
+
+	// A rule whose exclude.all cannot be combined with the global exclude is left out, and the other rules of the
+	// revision are still applied.
+	orasPullFunc = func(config *Config, destDir string) error {
+		return os.WriteFile(filepath.Join(destDir, "policy.yaml"), []byte("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\n"+
+			"metadata:\n  name: strict\nspec:\n  rules:\n  - name: a\n    exclude:\n      all:\n"+
+			"      - resources: {names: [web-*]}\n      - resources: {names: ['*-canary']}\n  - name: b\n"), 0644)
+	}
+	destDir = filepath.Join(t.TempDir(), "image")
+	if _, err := pullImageToDirReal(config, "v1", destDir); err != nil {
+		t.Fatalf("pullImageToDirReal() error = %v, want the revision applied without the rule", err)
+	}
+	data, err = os.ReadFile(filepath.Join(destDir, "policy.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj = &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+		t.Fatal(err)
+	}
+	if rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules"); len(rules) != 1 || rules[0].(map[string]interface{})["name"] != "b" {
+		t.Errorf("rules = %v, want only rule b", rules)
+	}
+	results := skippedRuleResults(destDir)
+	if len(results) != 1 || results[0].Name != "strict" || results[0].Outcome != kyvernov1alpha1.ApplyOutcomeFailed || results[0].File != "" {
+		t.Errorf("skippedRuleResults() = %+v, want a failure for the policy without a file to retry", results)
+	}
+	if files := failedFiles(results); len(files) != 0 {
+		t.Errorf("failedFiles() = %v, want skipped rules not to be retried", files)
+	}
+
+	// The next pull of a revision without skipped rules clears the record.
+	orasPullFunc = func(config *Config, destDir string) error {
+		return os.WriteFile(filepath.Join(destDir, "policy.yaml"), []byte(patchTestPolicy), 0644)
+	}
+	if _, err := pullImageToDirReal(config, "v1", destDir); err != nil {
+		t.Fatal(err)
+	}
+	if results := skippedRuleResults(destDir); len(results) != 0 {
+		t.Errorf("skippedRuleResults() = %+v, want none", results)
+	}
+
+	// A policy whose rules are not objects cannot be applied with the global exclude at all.
+	orasPullFunc = func(config *Config, destDir string) error {
+		return os.WriteFile(filepath.Join(destDir, "policy.yaml"), []byte("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\n"+
+			"metadata:\n  name: broken\nspec:\n  rules:\n  - a\n"), 0644)
+	}
+	_, err = pullImageToDirReal(config, "v1", filepath.Join(t.TempDir(), "image"))
+	var excludeErr *globalExcludeError
+	if !errors.As(err, &excludeErr) || len(excludeErr.Failures) != 1 {
+		t.Fatalf("pullImageToDirReal() error = %v, want a globalExcludeError with one failure", err)
+	}
+	if reason := pullFailureReason(err); reason != "GlobalExcludeFailed" {
+		t.Errorf("pullFailureReason() = %s, want GlobalExcludeFailed", reason)
+	}
+}
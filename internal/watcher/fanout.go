@@ -0,0 +1,226 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// fanOutDir is the directory below the pulled artifact that the copies of namespaced objects are written to.
+	fanOutDir = ".fan-out"
+	// namespaceWatchRetryDelay is how long to wait before watching namespaces again after the watch failed.
+	namespaceWatchRetryDelay = 10 * time.Second
+)
+
+// namespacesGVR is the GroupVersionResource of Namespaces, which namespaceSelector matches.
+var namespacesGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// namespaceFanOut stamps the namespaced objects of an artifact into the namespaces matched by namespaceSelector.
+type namespaceFanOut struct {
+	mapper     meta.RESTMapper
+	namespaces []string
+}
+
+// newNamespaceFanOut returns the fan-out for the namespaces matching right now, or nil when namespaceSelector is
+// not set.
+func newNamespaceFanOut(config *Config) (*namespaceFanOut, error) {
+	if config.NamespaceSelector == "" {
+		return nil, nil
+	}
+	dynamicClient, mapper, err := getKubernetesClientsFunc()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Kubernetes clients for the namespace selector: %w", err)
+	}
+	namespaces, err := matchingNamespaces(config, dynamicClient)
+	if err != nil {
+		return nil, err
+	}
+	return &namespaceFanOut{mapper: mapper, namespaces: namespaces}, nil
+}
+
+// namespaced reports whether obj is of a namespaced kind and is therefore stamped into every matching namespace.
+// Kinds the cluster does not know are left alone, so that applying them reports the missing CRD.
+func (f *namespaceFanOut) namespaced(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	mapping, err := f.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	return err == nil && mapping.Scope.Name() == meta.RESTScopeNameNamespace
+}
+
+// stamp writes a copy of obj for every matching namespace to fanOutDir/<namespace>/relPath in destDir and returns
+// the paths of the copies.
+func (f *namespaceFanOut) stamp(destDir, relPath string, obj *unstructured.Unstructured) ([]string, error) {
+	paths := make([]string, 0, len(f.namespaces))
+	for _, namespace := range f.namespaces {
+		stamped := obj.DeepCopy()
+		stamped.SetNamespace(namespace)
+		annotations := stamped.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[kyvernov1alpha1.FanOutAnnotation] = "true"
+		stamped.SetAnnotations(annotations)
+
+		data, err := yaml.Marshal(stamped)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal copy of %s for namespace %s: %w", relPath, namespace, err)
+		}
+		path := filepath.Join(destDir, fanOutDir, namespace, relPath)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create fan-out directory: %w", err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write copy of %s for namespace %s: %w", relPath, namespace, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// matchingNamespaces returns the sorted names of the namespaces matching namespaceSelector. Namespaces that are
+// being deleted are left out, since nothing can be created in them.
+func matchingNamespaces(config *Config, dynamicClient dynamic.Interface) ([]string, error) {
+	list, err := dynamicClient.Resource(namespacesGVR).List(context.Background(), metav1.ListOptions{LabelSelector: config.NamespaceSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces matching %q: %w", config.NamespaceSelector, err)
+	}
+	namespaces := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		if item.GetDeletionTimestamp() == nil {
+			namespaces = append(namespaces, item.GetName())
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// namespacesHashPath returns the location of the hash of the namespaces the last pull was stamped into.
+// It lives next to the last_seen file.
+func namespacesHashPath(config *Config) string {
+	return filepath.Join(filepath.Dir(config.LastFile), "namespaces_hash")
+}
+
+// namespacesHash returns a stable hash of a sorted list of namespaces.
+func namespacesHash(namespaces []string) string {
+	return calculateSHA256([]byte(strings.Join(namespaces, "\n")))
+}
+
+// saveNamespacesHash records the namespaces a pull was stamped into, so that a change is noticed on a later poll.
+func saveNamespacesHash(config *Config, namespaces []string) {
+	if config.LastFile == "" {
+		return
+	}
+	if err := os.WriteFile(namespacesHashPath(config), []byte(namespacesHash(namespaces)), 0644); err != nil {
+		log.Printf("Warning: failed to write namespaces hash: %v\n", err)
+	}
+}
+
+// namespacesChanged reports whether the namespaces matching namespaceSelector differ from the ones the last pull
+// was stamped into.
+func namespacesChanged(config *Config) bool {
+	if config.NamespaceSelector == "" || config.LastFile == "" {
+		return false
+	}
+	previous, err := os.ReadFile(namespacesHashPath(config))
+	if err != nil {
+		return false // Nothing was stamped yet, the regular tag handling applies the artifact.
+	}
+	dynamicClient, err := getDynamicClientFunc()
+	if err != nil {
+		log.Printf("Warning: failed to check matching namespaces: %v\n", err)
+		return false
+	}
+	namespaces, err := matchingNamespaces(config, dynamicClient)
+	if err != nil {
+		log.Printf("Warning: failed to check matching namespaces: %v\n", err)
+		return false
+	}
+	return namespacesHash(namespaces) != string(previous)
+}
+
+// watchNamespaces signals trigger whenever a namespace matching namespaceSelector is added, changed or deleted,
+// or stops matching, so that copies are stamped and removed without waiting for the next poll. It watches again
+// when the watch ends, until ctx is done. The watch resumes from the last resourceVersion it saw, so that a
+// reconnect does not replay every matching namespace; only when that version has expired does it list them again,
+// and triggers once for what it may have missed.
+func watchNamespaces(ctx context.Context, config *Config, dynamicClient dynamic.Interface, trigger chan<- struct{}) {
+	signal := func() {
+		select {
+		case trigger <- struct{}{}:
+		default: // A reconciliation is already pending.
+		}
+	}
+	wait := func() {
+		select {
+		case <-ctx.Done():
+		case <-time.After(namespaceWatchRetryDelay):
+		}
+	}
+
+	resourceVersion, listed := "", false
+	for ctx.Err() == nil {
+		if !listed {
+			list, err := dynamicClient.Resource(namespacesGVR).List(ctx, metav1.ListOptions{LabelSelector: config.NamespaceSelector})
+			if err != nil {
+				log.Printf("Warning: failed to list namespaces: %v\n", err)
+				wait()
+				continue
+			}
+			if resourceVersion != "" {
+				signal()
+			}
+			resourceVersion, listed = list.GetResourceVersion(), true
+		}
+
+		w, err := dynamicClient.Resource(namespacesGVR).Watch(ctx, metav1.ListOptions{
+			LabelSelector:       config.NamespaceSelector,
+			ResourceVersion:     resourceVersion,
+			AllowWatchBookmarks: true,
+		})
+		if err != nil {
+			if errors.IsResourceExpired(err) || errors.IsGone(err) {
+				listed = false
+				continue
+			}
+			log.Printf("Warning: failed to watch namespaces: %v\n", err)
+			wait()
+			continue
+		}
+		failed := false
+		for event := range w.ResultChan() {
+			if event.Type == watch.Error {
+				if err := errors.FromObject(event.Object); errors.IsResourceExpired(err) || errors.IsGone(err) {
+					listed = false
+				} else {
+					failed = true
+				}
+				continue
+			}
+			if obj, ok := event.Object.(metav1.Object); ok && obj.GetResourceVersion() != "" {
+				resourceVersion = obj.GetResourceVersion()
+			}
+			if event.Type != watch.Bookmark {
+				signal()
+			}
+		}
+		w.Stop()
+		if failed {
+			wait()
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+var policiesGVR = schema.GroupVersionResource{Group: "kyverno.io", Version: "v1", Resource: "policies"}
+
+func newNamespace(name string, labels map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]interface{}{"name": name, "labels": labels},
+	}}
+}
+
+func newPolicy(namespace, name string, annotations map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "kyverno.io/v1",
+		"kind":       "Policy",
+		"metadata": map[string]interface{}{
+			"name":        name,
+			"namespace":   namespace,
+			"labels":      map[string]interface{}{"managed-by": "kyverno-watcher", "artifact-name": "payments"},
+			"annotations": annotations,
+		},
+		"spec": map[string]interface{}{},
+	}}
+}
+
+func TestPullImageToDirReal_NamespaceFanOut(t *testing.T) {
+	payments := map[string]interface{}{"team": "payments"}
+	dynamicClient, mapper := newFakePolicyClients(
+		newNamespace("payments-a", payments),
+		newNamespace("payments-b", payments),
+		newNamespace("other", nil),
+	)
+
+	originalGetK8sClients := getKubernetesClientsFunc
+	getKubernetesClientsFunc = func() (dynamic.Interface, meta.RESTMapper, error) { return dynamicClient, mapper, nil }
+	defer func() { getKubernetesClientsFunc = originalGetK8sClients }()
+	originalGetDynamicClient := getDynamicClientFunc
+	getDynamicClientFunc = func() (dynamic.Interface, error) { return dynamicClient, nil }
+	defer func() { getDynamicClientFunc = originalGetDynamicClient }()
+	originalOrasPull := orasPullFunc
+	defer func() { orasPullFunc = originalOrasPull }()
+
+	orasPullFunc = func(config *Config, destDir string) error {
+		if err := os.WriteFile(filepath.Join(destDir, "cluster.yaml"), []byte(patchTestPolicy), 0644); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(destDir, "policy.yaml"), []byte("apiVersion: kyverno.io/v1\nkind: Policy\n"+
+			"metadata:\n  name: require-owner\n  namespace: template\nspec:\n  rules: []\n"), 0644)
+	}
+
+	stateDir := t.TempDir()
+	config := &Config{
+		Provider:          ProviderArtifactory,
+		ImageBase:         "registry.example.com/policies",
+		ArtifactName:      "payments",
+		NamespaceSelector: "team=payments",
+		LastFile:          filepath.Join(stateDir, "last_seen"),
+	}
+	destDir := filepath.Join(t.TempDir(), "image")
+	checksums, err := pullImageToDirReal(config, "v1", destDir)
+	if err != nil {
+		t.Fatalf("pullImageToDirReal() error = %v", err)
+	}
+
+	if _, ok := checksums[filepath.Join(destDir, "cluster.yaml")]; !ok {
+		t.Error("cluster-scoped objects should be applied as they are")
+	}
+	if _, ok := checksums[filepath.Join(destDir, "policy.yaml")]; ok || len(checksums) != 3 {
+		t.Errorf("checksums = %v, want the ClusterPolicy and one Policy per matching namespace", checksums)
+	}
+	for _, namespace := range []string{"payments-a", "payments-b"} {
+		data, err := os.ReadFile(filepath.Join(destDir, fanOutDir, namespace, "policy.yaml"))
+		if err != nil {
+			t.Fatalf("copy for %s: %v", namespace, err)
+		}
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+			t.Fatal(err)
+		}
+		if obj.GetNamespace() != namespace || obj.GetAnnotations()[kyvernov1alpha1.FanOutAnnotation] != "true" {
+			t.Errorf("copy for %s has namespace %q and annotations %v", namespace, obj.GetNamespace(), obj.GetAnnotations())
+		}
+		if obj.GetLabels()["artifact-name"] != "payments" || obj.GetLabels()["policy-checksum"] == "" {
+			t.Errorf("copy for %s should carry the artifact's labels, got %v", namespace, obj.GetLabels())
+		}
+	}
+
+	if namespacesChanged(config) {
+		t.Error("namespacesChanged() should be false right after a pull")
+	}
+	other, err := dynamicClient.Resource(namespacesGVR).Get(context.Background(), "other", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.SetLabels(map[string]string{"team": "payments"})
+	if _, err := dynamicClient.Resource(namespacesGVR).Update(context.Background(), other, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !namespacesChanged(config) {
+		t.Error("namespacesChanged() should be true once another namespace matches")
+	}
+}
+
+func TestHandleStaleObjects_NamespaceFanOut(t *testing.T) {
+	copyAnnotations := map[string]interface{}{kyvernov1alpha1.FanOutAnnotation: "true"}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "payments-a.yaml")
+	data, err := yaml.Marshal(newPolicy("payments-a", "require-owner", copyAnnotations).Object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		files       []string
+		wantDeleted []string
+		wantStale   []string
+	}{
+		{
+			name:        "copies in namespaces that stopped matching are removed without pruning",
+			files:       []string{file},
+			wantDeleted: []string{"payments-b"},
+			wantStale:   []string{"legacy"},
+		},
+		{
+			name:        "copies are removed when no namespace matches any more",
+			wantDeleted: []string{"payments-a", "payments-b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{ArtifactName: "payments", PodNamespace: "default", NamespaceSelector: "team=payments"}
+			var namespaces []runtime.Object
+			if len(tt.files) > 0 {
+				namespaces = append(namespaces, newNamespace("payments-a", map[string]interface{}{"team": "payments"}))
+			}
+			dynamicClient, mapper := newFakePolicyClients(append(namespaces,
+				newNamespace("payments-b", nil),
+				newPolicy("payments-a", "require-owner", copyAnnotations),
+				newPolicy("payments-b", "require-owner", copyAnnotations),
+				newPolicy("legacy", "require-owner", nil),
+				newTestArtifact("payments", "default"),
+			)...)
+
+			results := handleStaleObjects(config, dynamicClient, mapper, tt.files)
+
+			if got := int(summarizeResults(results).Pruned); got != len(tt.wantDeleted) {
+				t.Errorf("pruned = %d, want %d", got, len(tt.wantDeleted))
+			}
+			deleted := map[string]bool{}
+			for _, namespace := range tt.wantDeleted {
+				deleted[namespace] = true
+			}
+			for _, namespace := range []string{"payments-a", "payments-b", "legacy"} {
+				_, err := dynamicClient.Resource(policiesGVR).Namespace(namespace).Get(context.Background(), "require-owner", metav1.GetOptions{})
+				if gone := err != nil; gone != deleted[namespace] {
+					t.Errorf("policy in %s deleted = %v, want %v", namespace, gone, deleted[namespace])
+				}
+			}
+
+			obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace("default").Get(context.Background(), "payments", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var artifact kyvernov1alpha1.KyvernoArtifact
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &artifact); err != nil {
+				t.Fatal(err)
+			}
+			if len(artifact.Status.StaleObjects) != len(tt.wantStale) ||
+				(len(tt.wantStale) > 0 && artifact.Status.StaleObjects[0].Namespace != tt.wantStale[0]) {
+				t.Errorf("StaleObjects = %+v, want the policy in %v", artifact.Status.StaleObjects, tt.wantStale)
+			}
+		})
+	}
+}
+
+func TestWatchNamespaces(t *testing.T) {
+	dynamicClient, _ := newFakePolicyClients()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	trigger := make(chan struct{}, 1)
+	go watchNamespaces(ctx, &Config{NamespaceSelector: "team=payments"}, dynamicClient, trigger)
+
+	// The fake client only delivers events to watches that are already open.
+	deadline := time.After(5 * time.Second)
+	for i := 0; ; i++ {
+		ns := newNamespace(fmt.Sprintf("payments-%d", i), map[string]interface{}{"team": "payments"})
+		if _, err := dynamicClient.Resource(namespacesGVR).Create(ctx, ns, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-trigger:
+			return
+		case <-deadline:
+			t.Fatal("a namespace event should trigger a reconciliation")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestWatchNamespaces_ResumesFromResourceVersion(t *testing.T) {
+	dynamicClient, _ := newFakePolicyClients()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lists := 0
+	dynamicClient.PrependReactor("list", "namespaces", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		lists++
+		list := &unstructured.UnstructuredList{Object: map[string]interface{}{"apiVersion": "v1", "kind": "NamespaceList"}}
+		list.SetResourceVersion(fmt.Sprintf("%d0", lists))
+		return true, list, nil
+	})
+
+	// The first watch delivers a namespace and ends, the second one has expired, the third one ends the test.
+	var resourceVersions []string
+	dynamicClient.PrependWatchReactor("namespaces", func(action clienttesting.Action) (bool, watch.Interface, error) {
+		resourceVersions = append(resourceVersions, action.(clienttesting.WatchActionImpl).WatchRestrictions.ResourceVersion)
+		w := watch.NewFakeWithChanSize(2, false)
+		switch len(resourceVersions) {
+		case 1:
+			ns := newNamespace("payments", map[string]interface{}{"team": "payments"})
+			ns.SetResourceVersion("15")
+			w.Add(ns)
+		case 2:
+			w.Error(&apierrors.NewResourceExpired("too old resource version").ErrStatus)
+		default:
+			cancel()
+		}
+		w.Stop()
+		return true, w, nil
+	})
+
+	trigger := make(chan struct{}, 2)
+	watchNamespaces(ctx, &Config{NamespaceSelector: "team=payments"}, dynamicClient, trigger)
+
+	want := []string{"10", "15", "20"}
+	if fmt.Sprint(resourceVersions) != fmt.Sprint(want) {
+		t.Errorf("watched from resource versions %v, want %v", resourceVersions, want)
+	}
+	if len(trigger) != 2 {
+		t.Errorf("got %d trigger(s), want one for the event and one after listing again", len(trigger))
+	}
+}
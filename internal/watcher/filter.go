@@ -0,0 +1,87 @@
+package watcher
+
+import (
+	"fmt"
+	"log"
+	"path"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// validateFilter checks the globs and label selector of a filter, so that a typo fails at startup
+// instead of silently matching nothing.
+func validateFilter(filter kyvernov1alpha1.ObjectFilter) error {
+	if _, err := path.Match(filter.Path, ""); err != nil {
+		return fmt.Errorf("path %q: %w", filter.Path, err)
+	}
+	if _, err := path.Match(filter.Name, ""); err != nil {
+		return fmt.Errorf("name %q: %w", filter.Name, err)
+	}
+	if filter.LabelSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(filter.LabelSelector); err != nil {
+			return fmt.Errorf("labelSelector: %w", err)
+		}
+	}
+	return nil
+}
+
+// selectObject reports whether an object read from relPath in the artifact passes the include and exclude filters.
+// It must be called before the watcher adds its own names, labels and annotations.
+func selectObject(config *Config, relPath string, obj *unstructured.Unstructured) bool {
+	if len(config.Include) > 0 {
+		included := false
+		for _, filter := range config.Include {
+			if filterMatches(filter, relPath, obj) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, filter := range config.Exclude {
+		if filterMatches(filter, relPath, obj) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterMatches reports whether every field set on the filter matches the object.
+func filterMatches(filter kyvernov1alpha1.ObjectFilter, relPath string, obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	if filter.Group != "" && filter.Group != gvk.Group {
+		return false
+	}
+	if filter.Version != "" && filter.Version != gvk.Version {
+		return false
+	}
+	if filter.Kind != "" && filter.Kind != gvk.Kind {
+		return false
+	}
+	if filter.Path != "" {
+		if matched, _ := path.Match(filter.Path, relPath); !matched {
+			return false
+		}
+	}
+	if filter.Name != "" {
+		if matched, _ := path.Match(filter.Name, obj.GetName()); !matched {
+			return false
+		}
+	}
+	if filter.LabelSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(filter.LabelSelector)
+		if err != nil {
+			log.Printf("Warning: invalid label selector in filter: %v\n", err)
+			return false
+		}
+		if !selector.Matches(labels.Set(obj.GetLabels())) {
+			return false
+		}
+	}
+	return true
+}
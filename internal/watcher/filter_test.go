@@ -0,0 +1,109 @@
+package watcher
+
+import (
+	"testing"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSelectObject(t *testing.T) {
+	policy := func(kind, name string, labels map[string]string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("kyverno.io/v1")
+		obj.SetKind(kind)
+		obj.SetName(name)
+		obj.SetLabels(labels)
+		return obj
+	}
+
+	tests := []struct {
+		name    string
+		include []kyvernov1alpha1.ObjectFilter
+		exclude []kyvernov1alpha1.ObjectFilter
+		path    string
+		obj     *unstructured.Unstructured
+		want    bool
+	}{
+		{
+			name: "no filters selects everything",
+			path: "baseline/require-labels.yaml",
+			obj:  policy("ClusterPolicy", "require-labels", nil),
+			want: true,
+		},
+		{
+			name:    "included by path glob",
+			include: []kyvernov1alpha1.ObjectFilter{{Path: "baseline/*.yaml"}},
+			path:    "baseline/require-labels.yaml",
+			obj:     policy("ClusterPolicy", "require-labels", nil),
+			want:    true,
+		},
+		{
+			name:    "not matched by any include",
+			include: []kyvernov1alpha1.ObjectFilter{{Path: "baseline/*.yaml"}, {Kind: "Policy"}},
+			path:    "restricted/disallow-privileged.yaml",
+			obj:     policy("ClusterPolicy", "disallow-privileged", nil),
+			want:    false,
+		},
+		{
+			name:    "include fields must all match",
+			include: []kyvernov1alpha1.ObjectFilter{{Group: "kyverno.io", Kind: "ClusterPolicy", Name: "require-*"}},
+			path:    "require-labels.yaml",
+			obj:     policy("ClusterPolicy", "disallow-latest-tag", nil),
+			want:    false,
+		},
+		{
+			name: "excluded by label selector",
+			exclude: []kyvernov1alpha1.ObjectFilter{{LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"tier": "experimental"},
+			}}},
+			path: "require-labels.yaml",
+			obj:  policy("ClusterPolicy", "require-labels", map[string]string{"tier": "experimental"}),
+			want: false,
+		},
+		{
+			name:    "exclude wins over include",
+			include: []kyvernov1alpha1.ObjectFilter{{Kind: "ClusterPolicy"}},
+			exclude: []kyvernov1alpha1.ObjectFilter{{Name: "require-labels"}},
+			path:    "require-labels.yaml",
+			obj:     policy("ClusterPolicy", "require-labels", nil),
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Include: tt.include, Exclude: tt.exclude}
+			if got := selectObject(config, tt.path, tt.obj); got != tt.want {
+				t.Errorf("selectObject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  kyvernov1alpha1.ObjectFilter
+		wantErr bool
+	}{
+		{name: "valid", filter: kyvernov1alpha1.ObjectFilter{Path: "baseline/*.yaml", Name: "require-*"}},
+		{name: "bad path glob", filter: kyvernov1alpha1.ObjectFilter{Path: "baseline/[.yaml"}, wantErr: true},
+		{
+			name: "bad label selector",
+			filter: kyvernov1alpha1.ObjectFilter{LabelSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: "Sometimes"}},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateFilter(tt.filter); (err != nil) != tt.wantErr {
+				t.Errorf("validateFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"github.com/OctoKode/kyverno-artifact-operator/internal/k8s"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+// auditAction is the Kyverno and admission policy action that reports violations instead of denying requests.
+const auditAction = "Audit"
+
+// freezePath returns the location of the file holding the reason of the Frozen condition while a freeze is in
+// effect. It lives next to the last_seen file.
+func freezePath(config *Config) string {
+	return filepath.Join(filepath.Dir(config.LastFile), "frozen")
+}
+
+// keepFreezeLifted records the lifted audit freeze again, so that the next poll reports it as lifted once more. It
+// is used when the sync windows defer reapplying the artifact's version.
+func keepFreezeLifted(config *Config) {
+	if err := os.WriteFile(freezePath(config), []byte(kyvernov1alpha1.FrozenReasonAudit), 0644); err != nil {
+		log.Printf("Warning: failed to write freeze file: %v\n", err)
+	}
+}
+
+// checkFreeze reports whether an operator-wide freeze is in effect, as recorded by the controller in the Frozen
+// condition of the KyvernoArtifact, and whether a freeze that switched policies to Audit was lifted since the last
+// poll, so that the artifact's version is applied again. In audit mode, the managed policies are switched to
+// Audit once when the freeze starts. A freeze that cannot be read counts as in effect, so that nothing is applied or
+// pruned during an incident; the recorded freeze is kept until the condition can be read again. Once the artifact
+// is gone, the last recorded freeze decides.
+func checkFreeze(config *Config) (frozen, lifted bool) {
+	if config.ArtifactName == "" || config.LastFile == "" {
+		return false, false
+	}
+	previous, _ := os.ReadFile(freezePath(config))
+	dynamicClient, mapper, err := getKubernetesClientsFunc()
+	if err != nil {
+		log.Printf("Warning: failed to check for a freeze, treating changes as frozen: %v\n", err)
+		return true, false
+	}
+	condition, err := frozenCondition(config, dynamicClient)
+	if errors.IsNotFound(err) {
+		return len(previous) > 0, false
+	}
+	if err != nil {
+		log.Printf("Warning: failed to check for a freeze, treating changes as frozen: %v\n", err)
+		return true, false
+	}
+
+	if condition == nil || condition.Status != metav1.ConditionTrue {
+		if len(previous) == 0 {
+			return false, false
+		}
+		log.Println("The freeze was lifted")
+		if err := os.Remove(freezePath(config)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to remove freeze file: %v\n", err)
+		}
+		return false, string(previous) == kyvernov1alpha1.FrozenReasonAudit
+	}
+
+	log.Printf("Policy changes are frozen: %s\n", condition.Message)
+	if condition.Reason == kyvernov1alpha1.FrozenReasonAudit && string(previous) != kyvernov1alpha1.FrozenReasonAudit {
+		if err := auditAppliedClusters(config, dynamicClient, mapper); err != nil {
+			// Switching is tried again on the next poll.
+			log.Printf("Warning: failed to switch policies to Audit: %v\n", err)
+			return true, false
+		}
+	}
+	if string(previous) != condition.Reason {
+		// A freeze that switched policies to Audit keeps being recorded as one, so that lifting it restores them
+		// even when it was changed to pause in between.
+		reason := condition.Reason
+		if string(previous) == kyvernov1alpha1.FrozenReasonAudit {
+			reason = kyvernov1alpha1.FrozenReasonAudit
+		}
+		if err := os.WriteFile(freezePath(config), []byte(reason), 0644); err != nil {
+			log.Printf("Warning: failed to write freeze file: %v\n", err)
+		}
+	}
+	return true, false
+}
+
+// frozenCondition returns the Frozen condition of the KyvernoArtifact, or nil when it has none.
+func frozenCondition(config *Config, dynamicClient dynamic.Interface) (*metav1.Condition, error) {
+	obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace(config.PodNamespace).Get(context.Background(), config.ArtifactName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var artifact kyvernov1alpha1.KyvernoArtifact
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &artifact); err != nil {
+		return nil, err
+	}
+	return meta.FindStatusCondition(artifact.Status.Conditions, kyvernov1alpha1.ConditionFrozen), nil
+}
+
+// auditAppliedClusters switches the policies of this artifact to Audit in every cluster it is applied to. A target
+// that cannot be reached fails the switch, so that it is tried again on the next poll.
+func auditAppliedClusters(config *Config, localClient dynamic.Interface, localMapper meta.RESTMapper) error {
+	clusters, err := appliedClusters(config, localClient, localMapper)
+	if err != nil {
+		return err
+	}
+	var failures []string
+	for _, c := range clusters {
+		if err := auditManagedPolicies(config, c.dynamicClient, c.mapper); err != nil {
+			failures = append(failures, c.describe(err.Error()))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// auditManagedPolicies switches every policy of this artifact that can deny requests to Audit and marks it with
+// the frozen annotation. Held objects are left alone.
+func auditManagedPolicies(config *Config, dynamicClient dynamic.Interface, mapper meta.RESTMapper) error {
+	resources, err := k8s.ManagedResources(mapper)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	var failures []string
+	for _, resource := range resources {
+		list, err := listArtifactObjects(ctx, config, dynamicClient, resource.GVR)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("failed to list %s: %w", resource.GVR.Resource, err)
+		}
+		for i := range list.Items {
+			item := &list.Items[i]
+			if _, held := isHeld(item); held || !switchToAudit(item) {
+				continue
+			}
+			annotations := item.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[kyvernov1alpha1.FrozenAnnotation] = k8s.FreezeModeAudit
+			item.SetAnnotations(annotations)
+
+			client := dynamicClient.Resource(resource.GVR)
+			if item.GetNamespace() != "" {
+				_, err = client.Namespace(item.GetNamespace()).Update(ctx, item, metav1.UpdateOptions{})
+			} else {
+				_, err = client.Update(ctx, item, metav1.UpdateOptions{})
+			}
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s %s: %v", item.GetKind(), objectKey(item.GetNamespace(), item.GetName()), err))
+				continue
+			}
+			log.Printf("Switched %s %s to Audit\n", item.GetKind(), objectKey(item.GetNamespace(), item.GetName()))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// switchToAudit sets every action of obj that can deny requests to Audit and reports whether obj can deny
+// requests at all. Kyverno policies keep unset actions unset, since they default to Audit. ValidatingPolicies,
+// ImageValidatingPolicies and ValidatingAdmissionPolicyBindings get validationActions set, since they default
+// to denying or require it.
+func switchToAudit(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	switch {
+	case gvk.Group == "kyverno.io" && (gvk.Kind == "ClusterPolicy" || gvk.Kind == "Policy"):
+		if _, found, _ := unstructured.NestedString(obj.Object, "spec", "validationFailureAction"); found {
+			_ = unstructured.SetNestedField(obj.Object, auditAction, "spec", "validationFailureAction")
+		}
+		auditOverrides(obj.Object, "spec", "validationFailureActionOverrides")
+		rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+		for _, r := range rules {
+			rule, ok := r.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if _, found, _ := unstructured.NestedString(rule, "validate", "failureAction"); found {
+				_ = unstructured.SetNestedField(rule, auditAction, "validate", "failureAction")
+			}
+			auditOverrides(rule, "validate", "failureActionOverrides")
+			verifyImages, _, _ := unstructured.NestedSlice(rule, "verifyImages")
+			for _, v := range verifyImages {
+				if verify, ok := v.(map[string]interface{}); ok {
+					if _, found := verify["failureAction"]; found {
+						verify["failureAction"] = auditAction
+					}
+				}
+			}
+			if len(verifyImages) > 0 {
+				_ = unstructured.SetNestedSlice(rule, verifyImages, "verifyImages")
+			}
+		}
+		if rules != nil {
+			_ = unstructured.SetNestedSlice(obj.Object, rules, "spec", "rules")
+		}
+		return true
+	case gvk.Group == "policies.kyverno.io" && (gvk.Kind == "ValidatingPolicy" || gvk.Kind == "ImageValidatingPolicy"),
+		gvk.Group == "admissionregistration.k8s.io" && gvk.Kind == "ValidatingAdmissionPolicyBinding":
+		_ = unstructured.SetNestedStringSlice(obj.Object, []string{auditAction}, "spec", "validationActions")
+		return true
+	default:
+		return false
+	}
+}
+
+// auditOverrides sets the action of every entry of the overrides list at fields of obj to Audit.
+func auditOverrides(obj map[string]interface{}, fields ...string) {
+	overrides, found, _ := unstructured.NestedSlice(obj, fields...)
+	if !found {
+		return
+	}
+	for _, o := range overrides {
+		if override, ok := o.(map[string]interface{}); ok {
+			override["action"] = auditAction
+		}
+	}
+	_ = unstructured.SetNestedSlice(obj, overrides, fields...)
+}
@@ -0,0 +1,193 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestSwitchToAudit(t *testing.T) {
+	tests := []struct {
+		name       string
+		obj        map[string]interface{}
+		wantSwitch bool
+		wantSpec   map[string]interface{}
+	}{
+		{
+			name: "ClusterPolicy",
+			obj: map[string]interface{}{
+				"apiVersion": "kyverno.io/v1",
+				"kind":       "ClusterPolicy",
+				"spec": map[string]interface{}{
+					"validationFailureAction":          "Enforce",
+					"validationFailureActionOverrides": []interface{}{map[string]interface{}{"action": "Enforce", "namespaces": []interface{}{"prod"}}},
+					"rules": []interface{}{
+						map[string]interface{}{"name": "enforced", "validate": map[string]interface{}{"failureAction": "Enforce"}},
+						map[string]interface{}{"name": "default", "validate": map[string]interface{}{"message": "m"}},
+						map[string]interface{}{"name": "images", "verifyImages": []interface{}{map[string]interface{}{"failureAction": "Enforce"}}},
+					},
+				},
+			},
+			wantSwitch: true,
+			wantSpec: map[string]interface{}{
+				"validationFailureAction":          "Audit",
+				"validationFailureActionOverrides": []interface{}{map[string]interface{}{"action": "Audit", "namespaces": []interface{}{"prod"}}},
+				"rules": []interface{}{
+					map[string]interface{}{"name": "enforced", "validate": map[string]interface{}{"failureAction": "Audit"}},
+					map[string]interface{}{"name": "default", "validate": map[string]interface{}{"message": "m"}},
+					map[string]interface{}{"name": "images", "verifyImages": []interface{}{map[string]interface{}{"failureAction": "Audit"}}},
+				},
+			},
+		},
+		{
+			name: "ValidatingPolicy denies by default",
+			obj: map[string]interface{}{
+				"apiVersion": "policies.kyverno.io/v1alpha1",
+				"kind":       "ValidatingPolicy",
+				"spec":       map[string]interface{}{},
+			},
+			wantSwitch: true,
+			wantSpec:   map[string]interface{}{"validationActions": []interface{}{"Audit"}},
+		},
+		{
+			name: "ValidatingAdmissionPolicyBinding",
+			obj: map[string]interface{}{
+				"apiVersion": "admissionregistration.k8s.io/v1",
+				"kind":       "ValidatingAdmissionPolicyBinding",
+				"spec":       map[string]interface{}{"policyName": "p", "validationActions": []interface{}{"Deny", "Warn"}},
+			},
+			wantSwitch: true,
+			wantSpec:   map[string]interface{}{"policyName": "p", "validationActions": []interface{}{"Audit"}},
+		},
+		{
+			name: "MutatingPolicy cannot deny",
+			obj: map[string]interface{}{
+				"apiVersion": "policies.kyverno.io/v1alpha1",
+				"kind":       "MutatingPolicy",
+				"spec":       map[string]interface{}{"matchConstraints": map[string]interface{}{}},
+			},
+			wantSpec: map[string]interface{}{"matchConstraints": map[string]interface{}{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{Object: tt.obj}
+			if switched := switchToAudit(obj); switched != tt.wantSwitch {
+				t.Errorf("switchToAudit() = %v, want %v", switched, tt.wantSwitch)
+			}
+			if !reflect.DeepEqual(obj.Object["spec"], tt.wantSpec) {
+				t.Errorf("spec = %v, want %v", obj.Object["spec"], tt.wantSpec)
+			}
+		})
+	}
+}
+
+// setFrozenCondition sets the Frozen condition of the security artifact, or removes it when reason is empty.
+func setFrozenCondition(t *testing.T, dynamicClient dynamic.Interface, config *Config, reason string) {
+	t.Helper()
+	err := updateArtifactStatus(config, dynamicClient, func(status *kyvernov1alpha1.KyvernoArtifactStatus) {
+		if reason == "" {
+			meta.RemoveStatusCondition(&status.Conditions, kyvernov1alpha1.ConditionFrozen)
+			return
+		}
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:   kyvernov1alpha1.ConditionFrozen,
+			Status: metav1.ConditionTrue,
+			Reason: reason,
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckFreeze(t *testing.T) {
+	config := &Config{ArtifactName: "security", PodNamespace: "default", LastFile: filepath.Join(t.TempDir(), "last_seen")}
+	owned := map[string]interface{}{"managed-by": "kyverno-watcher", "artifact-name": "security"}
+	dynamicClient, mapper := newFakePolicyClients(
+		newTestArtifact("security", "default"),
+		newClusterPolicy("require-labels", owned, map[string]interface{}{"validationFailureAction": "Enforce"}),
+	)
+
+	originalGetKubernetesClients := getKubernetesClientsFunc
+	getKubernetesClientsFunc = func() (dynamic.Interface, meta.RESTMapper, error) { return dynamicClient, mapper, nil }
+	defer func() { getKubernetesClientsFunc = originalGetKubernetesClients }()
+
+	validationFailureAction := func() (string, string) {
+		t.Helper()
+		obj, err := dynamicClient.Resource(clusterPoliciesGVR).Get(context.Background(), "require-labels", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		action, _, _ := unstructured.NestedString(obj.Object, "spec", "validationFailureAction")
+		return action, obj.GetAnnotations()[kyvernov1alpha1.FrozenAnnotation]
+	}
+
+	if frozen, lifted := checkFreeze(config); frozen || lifted {
+		t.Fatalf("checkFreeze() = %v, %v, want no freeze", frozen, lifted)
+	}
+
+	setFrozenCondition(t, dynamicClient, config, kyvernov1alpha1.FrozenReasonAudit)
+	if frozen, _ := checkFreeze(config); !frozen {
+		t.Fatal("checkFreeze() should report the freeze")
+	}
+	if action, annotation := validationFailureAction(); action != "Audit" || annotation != "audit" {
+		t.Errorf("policy = %s with annotation %q, want it switched to Audit and marked", action, annotation)
+	}
+
+	// Downgrading to pause keeps the policies in Audit until the freeze is lifted.
+	setFrozenCondition(t, dynamicClient, config, kyvernov1alpha1.FrozenReasonPaused)
+	if frozen, _ := checkFreeze(config); !frozen {
+		t.Fatal("checkFreeze() should report the freeze")
+	}
+
+	setFrozenCondition(t, dynamicClient, config, "")
+	if frozen, lifted := checkFreeze(config); frozen || !lifted {
+		t.Errorf("checkFreeze() = %v, %v, want the audit freeze lifted", frozen, lifted)
+	}
+	if frozen, lifted := checkFreeze(config); frozen || lifted {
+		t.Errorf("checkFreeze() = %v, %v, want the lift reported once", frozen, lifted)
+	}
+}
+
+func TestCheckFreeze_FailsClosed(t *testing.T) {
+	config := &Config{ArtifactName: "security", PodNamespace: "default", LastFile: filepath.Join(t.TempDir(), "last_seen")}
+	if err := os.WriteFile(freezePath(config), []byte(kyvernov1alpha1.FrozenReasonAudit), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dynamicClient, mapper := newFakePolicyClients(newTestArtifact("security", "default"))
+	dynamicClient.PrependReactor("get", "kyvernoartifacts", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewServiceUnavailable("etcd is down")
+	})
+
+	originalGetKubernetesClients := getKubernetesClientsFunc
+	defer func() { getKubernetesClientsFunc = originalGetKubernetesClients }()
+
+	getKubernetesClientsFunc = func() (dynamic.Interface, meta.RESTMapper, error) {
+		return nil, nil, fmt.Errorf("no kubeconfig")
+	}
+	if frozen, lifted := checkFreeze(config); !frozen || lifted {
+		t.Errorf("checkFreeze() without a client = %v, %v, want frozen", frozen, lifted)
+	}
+
+	getKubernetesClientsFunc = func() (dynamic.Interface, meta.RESTMapper, error) { return dynamicClient, mapper, nil }
+	if frozen, lifted := checkFreeze(config); !frozen || lifted {
+		t.Errorf("checkFreeze() with an unreadable artifact = %v, %v, want frozen", frozen, lifted)
+	}
+	if reason, _ := os.ReadFile(freezePath(config)); string(reason) != kyvernov1alpha1.FrozenReasonAudit {
+		t.Errorf("freeze file = %q, want the recorded freeze kept", reason)
+	}
+}
@@ -0,0 +1,324 @@
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"oras.land/oras-go/v2/content"
+)
+
+const (
+	// HelmChartContentMediaType is the media type of the layer helm push stores a packaged chart in.
+	HelmChartContentMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+
+	// helmChartFile is the name, relative to the artifact root, a pulled chart layer is saved as.
+	helmChartFile = "chart.tgz"
+
+	// helmOutputDir is the directory, relative to the artifact root, that rendered objects are written to.
+	helmOutputDir = "helm"
+
+	// helmBinary is the helm command that renders charts. The watcher image ships it.
+	helmBinary = "helm"
+)
+
+var (
+	// errHelmTemplate wraps errors of rendering a Helm chart, as opposed to pulling it.
+	errHelmTemplate = errors.New("helm template failed")
+
+	// helmTemplateFunc can be overridden in tests
+	helmTemplateFunc = helmTemplate
+)
+
+// renderHelmChart renders the chart pulled into destDir when the artifact is a helm-chart, and replaces the
+// contents of destDir with the rendered manifests, so that they go through the same pipeline as plain manifests.
+// The chart is rendered offline: hooks and chart tests are left out and nothing is installed.
+func renderHelmChart(config *Config, destDir string) error {
+	if config.ArtifactType != kyvernov1alpha1.ArtifactTypeHelmChart {
+		return nil
+	}
+	chart, err := findHelmChart(destDir)
+	if err != nil {
+		return err
+	}
+
+	// Values files are written outside the artifact, so that values read from Secrets are never applied.
+	workDir, err := os.MkdirTemp("", "helm-")
+	if err != nil {
+		return fmt.Errorf("failed to create a directory for helm: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(workDir); err != nil {
+			log.Printf("Warning: failed to remove %s: %v\n", workDir, err)
+		}
+	}()
+	valueFiles, err := writeHelmValues(config, workDir)
+	if err != nil {
+		return err
+	}
+
+	release := config.ArtifactName
+	if config.Helm != nil && config.Helm.ReleaseName != "" {
+		release = config.Helm.ReleaseName
+	}
+	if release == "" {
+		release = "release"
+	}
+	log.Printf("Rendering Helm chart %s as release %s\n", filepath.Base(chart), release)
+	out, err := helmTemplateFunc(workDir, release, config.PodNamespace, chart, valueFiles)
+	if err != nil {
+		return err
+	}
+
+	// Replace the chart with the rendered manifests.
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(destDir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", entry.Name(), err)
+		}
+	}
+
+	files := splitHelmOutput(out)
+	for _, f := range files {
+		file := filepath.Join(destDir, filepath.FromSlash(f.path))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, f.data, 0644); err != nil {
+			return fmt.Errorf("failed to write rendered manifest %s: %w", file, err)
+		}
+	}
+	log.Printf("Helm rendered %d file(s)\n", len(files))
+	return nil
+}
+
+// findHelmChart returns the packaged chart in destDir: the chart layer saved as chart.tgz, or the only .tgz file
+// when the chart was pushed with a file name.
+func findHelmChart(destDir string) (string, error) {
+	chart := filepath.Join(destDir, helmChartFile)
+	if _, err := os.Stat(chart); err == nil {
+		return chart, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(destDir, "*.tgz"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) != 1 {
+		return "", fmt.Errorf("%w: the artifact must hold exactly one chart layer of type %s, found %d",
+			errHelmTemplate, HelmChartContentMediaType, len(matches))
+	}
+	return matches[0], nil
+}
+
+// writeHelmValues writes the values of spec.helm to files in dir, in the order helm applies them: valuesFrom in
+// order, then the inline values.
+func writeHelmValues(config *Config, dir string) ([]string, error) {
+	if config.Helm == nil {
+		return nil, nil
+	}
+	var files []string
+	write := func(data []byte) error {
+		file := filepath.Join(dir, fmt.Sprintf("values-%d.yaml", len(files)))
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			return fmt.Errorf("failed to write helm values: %w", err)
+		}
+		files = append(files, file)
+		return nil
+	}
+
+	if len(config.Helm.ValuesFrom) > 0 {
+		dynamicClient, err := getDynamicClientFunc()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Kubernetes client for helm values: %w", err)
+		}
+		for _, ref := range config.Helm.ValuesFrom {
+			data, err := readHelmValues(config, dynamicClient, ref)
+			if err != nil {
+				return nil, err
+			}
+			if data == nil {
+				continue
+			}
+			if err := write(data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if config.Helm.Values != nil && len(config.Helm.Values.Raw) > 0 {
+		// JSON is valid YAML, so the values are passed as they are.
+		if err := write(config.Helm.Values.Raw); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// readHelmValues returns the values file at ref.Key of the referenced ConfigMap or Secret, or nil when an optional
+// reference does not exist.
+func readHelmValues(config *Config, dynamicClient dynamic.Interface, ref kyvernov1alpha1.HelmValuesReference) ([]byte, error) {
+	gvr := configMapsGVR
+	if ref.Kind == "Secret" {
+		gvr = secretsGVR
+	}
+	key := ref.Key
+	if key == "" {
+		key = "values.yaml"
+	}
+	obj, err := dynamicClient.Resource(gvr).Namespace(config.PodNamespace).Get(context.Background(), ref.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) && ref.Optional {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get %s %s/%s: %w", ref.Kind, config.PodNamespace, ref.Name, err)
+	}
+	value, found, err := unstructured.NestedString(obj.Object, "data", key)
+	if err != nil || !found {
+		if ref.Optional {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s %s/%s has no key %s", ref.Kind, config.PodNamespace, ref.Name, key)
+	}
+	if ref.Kind == "Secret" {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key %s of Secret %s/%s: %w", key, config.PodNamespace, ref.Name, err)
+		}
+		return decoded, nil
+	}
+	return []byte(value), nil
+}
+
+// helmTemplate runs helm template on chart and returns the rendered manifests. Helm keeps its cache and
+// configuration in workDir, so that it needs nothing but the chart.
+func helmTemplate(workDir, release, namespace, chart string, valueFiles []string) ([]byte, error) {
+	args := []string{"template", release, chart, "--no-hooks", "--skip-tests"}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	for _, f := range valueFiles {
+		args = append(args, "--values", f)
+	}
+	cmd := exec.Command(helmBinary, args...)
+	cmd.Env = append(os.Environ(),
+		"HELM_CACHE_HOME="+filepath.Join(workDir, "cache"),
+		"HELM_CONFIG_HOME="+filepath.Join(workDir, "config"),
+		"HELM_DATA_HOME="+filepath.Join(workDir, "data"),
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %v: %s", errHelmTemplate, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// helmOutputFile is a file of rendered manifests.
+type helmOutputFile struct {
+	path string
+	data []byte
+}
+
+// splitHelmOutput splits the output of helm template into one file per template, at helm/<template path>, e.g.
+// helm/templates/baseline/disallow-privileged.yaml, which is the path include and exclude filters match.
+// Documents without content are dropped.
+func splitHelmOutput(out []byte) []helmOutputFile {
+	var files []helmOutputFile
+	index := make(map[string]int)
+	add := func(doc []string) {
+		source := ""
+		empty := true
+		for _, line := range doc {
+			trimmed := strings.TrimSpace(line)
+			if s, ok := strings.CutPrefix(trimmed, "# Source: "); ok && source == "" {
+				source = s
+			}
+			if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+				empty = false
+			}
+		}
+		if empty {
+			return
+		}
+		p := helmOutputPath(source)
+		data := []byte(strings.Join(doc, "\n") + "\n")
+		if i, ok := index[p]; ok {
+			files[i].data = append(append(files[i].data, []byte("---\n")...), data...)
+			return
+		}
+		index[p] = len(files)
+		files = append(files, helmOutputFile{path: p, data: data})
+	}
+
+	var doc []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimRight(line, " \t") == "---" {
+			add(doc)
+			doc = nil
+			continue
+		}
+		doc = append(doc, line)
+	}
+	add(doc)
+	return files
+}
+
+// helmOutputPath returns the path a document rendered from the template at source is written to. The chart name
+// that helm puts in front of the template path is dropped.
+func helmOutputPath(source string) string {
+	if _, rest, ok := strings.Cut(source, "/"); ok {
+		if clean := path.Clean(rest); filepath.IsLocal(filepath.FromSlash(clean)) {
+			return path.Join(helmOutputDir, clean)
+		}
+	}
+	return path.Join(helmOutputDir, "rendered.yaml")
+}
+
+// saveHelmChartLayers writes the chart layers of the manifest described by desc, which was pulled into store, to
+// destDir as chart.tgz. helm push does not name its layers, so the ORAS file store keeps them in memory.
+func saveHelmChartLayers(ctx context.Context, store content.Fetcher, desc ocispec.Descriptor, destDir string) error {
+	data, err := content.FetchAll(ctx, store, desc)
+	if err != nil {
+		return fmt.Errorf("failed to read the manifest: %w", err)
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("failed to decode the manifest: %w", err)
+	}
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != HelmChartContentMediaType || layer.Annotations[ocispec.AnnotationTitle] != "" {
+			continue
+		}
+		chart, err := content.FetchAll(ctx, store, layer)
+		if err != nil {
+			return fmt.Errorf("failed to read the chart layer: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(destDir, helmChartFile), chart, 0644); err != nil {
+			return fmt.Errorf("failed to write the chart: %w", err)
+		}
+	}
+	return nil
+}
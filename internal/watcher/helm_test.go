@@ -0,0 +1,222 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/content/memory"
+)
+
+const helmTemplateOutput = `---
+# Source: kyverno-policies/templates/baseline/disallow-privileged.yaml
+apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: disallow-privileged
+spec:
+  validationFailureAction: Audit
+---
+# Source: kyverno-policies/templates/baseline/disallow-privileged.yaml
+apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: disallow-privileged-init
+---
+# Source: kyverno-policies/templates/empty.yaml
+# nothing rendered
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unnamed-source
+`
+
+func newValuesObject(kind, name string, data map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": name, "namespace": "policies"},
+		"data":       data,
+	}}
+}
+
+func TestRenderHelmChart(t *testing.T) {
+	dynamicClient, _ := newFakePolicyClients(
+		newValuesObject("ConfigMap", "defaults", map[string]interface{}{"values.yaml": "mode: Audit\n"}),
+		newValuesObject("Secret", "credentials", map[string]interface{}{
+			"overrides.yaml": base64.StdEncoding.EncodeToString([]byte("mode: Enforce\n")),
+		}),
+	)
+	originalGetDynamicClient := getDynamicClientFunc
+	getDynamicClientFunc = func() (dynamic.Interface, error) { return dynamicClient, nil }
+	defer func() { getDynamicClientFunc = originalGetDynamicClient }()
+
+	var gotRelease, gotNamespace, gotChart string
+	var gotValues []string
+	originalHelmTemplate := helmTemplateFunc
+	helmTemplateFunc = func(workDir, release, namespace, chart string, valueFiles []string) ([]byte, error) {
+		gotRelease, gotNamespace, gotChart = release, namespace, filepath.Base(chart)
+		for _, f := range valueFiles {
+			if strings.HasPrefix(f, chart) || !strings.HasPrefix(f, workDir) {
+				t.Errorf("values file %s should be written to the work directory", f)
+			}
+			data, err := os.ReadFile(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotValues = append(gotValues, strings.TrimSpace(string(data)))
+		}
+		return []byte(helmTemplateOutput), nil
+	}
+	defer func() { helmTemplateFunc = originalHelmTemplate }()
+
+	config := &Config{
+		ArtifactType: kyvernov1alpha1.ArtifactTypeHelmChart,
+		ArtifactName: "vendor",
+		PodNamespace: "policies",
+		Helm: &kyvernov1alpha1.HelmSpec{
+			Values: &runtime.RawExtension{Raw: []byte(`{"mode":"Warn"}`)},
+			ValuesFrom: []kyvernov1alpha1.HelmValuesReference{
+				{Kind: "ConfigMap", Name: "defaults"},
+				{Kind: "ConfigMap", Name: "missing", Optional: true},
+				{Kind: "Secret", Name: "credentials", Key: "overrides.yaml"},
+			},
+		},
+	}
+	dir := t.TempDir()
+	writeArtifactFiles(t, dir, map[string]string{helmChartFile: "chart"})
+
+	if err := renderHelmChart(config, dir); err != nil {
+		t.Fatalf("renderHelmChart() error = %v", err)
+	}
+	if gotRelease != "vendor" || gotNamespace != "policies" || gotChart != helmChartFile {
+		t.Errorf("helm template got release %q, namespace %q, chart %q", gotRelease, gotNamespace, gotChart)
+	}
+	wantValues := []string{"mode: Audit", "mode: Enforce", `{"mode":"Warn"}`}
+	if strings.Join(gotValues, "|") != strings.Join(wantValues, "|") {
+		t.Errorf("values = %q, want %q", gotValues, wantValues)
+	}
+
+	wantFiles := []string{"helm/rendered.yaml", "helm/templates/baseline/disallow-privileged.yaml"}
+	if got := listArtifactFiles(t, dir); strings.Join(got, ",") != strings.Join(wantFiles, ",") {
+		t.Fatalf("files = %v, want %v", got, wantFiles)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "helm", "templates", "baseline", "disallow-privileged.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "name: disallow-privileged\n") || !strings.Contains(string(data), "name: disallow-privileged-init") {
+		t.Errorf("documents of the same template should share a file, got:\n%s", data)
+	}
+}
+
+func TestRenderHelmChart_Errors(t *testing.T) {
+	originalHelmTemplate := helmTemplateFunc
+	helmTemplateFunc = func(workDir, release, namespace, chart string, valueFiles []string) ([]byte, error) {
+		return []byte(helmTemplateOutput), nil
+	}
+	defer func() { helmTemplateFunc = originalHelmTemplate }()
+
+	tests := []struct {
+		name    string
+		config  *Config
+		files   map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "plain artifacts are left as they are",
+			config: &Config{ArtifactType: kyvernov1alpha1.ArtifactTypeOCIImage},
+			files:  map[string]string{"policy.yaml": "kind: ClusterPolicy\n"},
+		},
+		{
+			name:   "a chart pushed with a file name is found",
+			config: &Config{ArtifactType: kyvernov1alpha1.ArtifactTypeHelmChart},
+			files:  map[string]string{"kyverno-policies-3.0.0.tgz": "chart"},
+		},
+		{
+			name:    "an artifact without a chart fails",
+			config:  &Config{ArtifactType: kyvernov1alpha1.ArtifactTypeHelmChart},
+			files:   map[string]string{"policy.yaml": "kind: ClusterPolicy\n"},
+			wantErr: true,
+		},
+		{
+			name: "a missing values key fails",
+			config: &Config{ArtifactType: kyvernov1alpha1.ArtifactTypeHelmChart, PodNamespace: "policies", Helm: &kyvernov1alpha1.HelmSpec{
+				ValuesFrom: []kyvernov1alpha1.HelmValuesReference{{Kind: "ConfigMap", Name: "defaults", Key: "prod.yaml"}},
+			}},
+			files:   map[string]string{helmChartFile: "chart"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dynamicClient, _ := newFakePolicyClients(newValuesObject("ConfigMap", "defaults", map[string]interface{}{"values.yaml": "{}"}))
+			originalGetDynamicClient := getDynamicClientFunc
+			getDynamicClientFunc = func() (dynamic.Interface, error) { return dynamicClient, nil }
+			defer func() { getDynamicClientFunc = originalGetDynamicClient }()
+
+			dir := t.TempDir()
+			writeArtifactFiles(t, dir, tt.files)
+			err := renderHelmChart(tt.config, dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderHelmChart() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPullFailureReason_HelmTemplate(t *testing.T) {
+	err := renderHelmChart(&Config{ArtifactType: kyvernov1alpha1.ArtifactTypeHelmChart}, t.TempDir())
+	if !errors.Is(err, errHelmTemplate) {
+		t.Fatalf("renderHelmChart() error = %v, want errHelmTemplate", err)
+	}
+	if got := pullFailureReason(err); got != "HelmTemplateFailed" {
+		t.Errorf("pullFailureReason() = %q, want HelmTemplateFailed", got)
+	}
+}
+
+func TestSaveHelmChartLayers(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	push := func(mediaType string, data []byte) ocispec.Descriptor {
+		desc := content.NewDescriptorFromBytes(mediaType, data)
+		if err := store.Push(ctx, desc, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		return desc
+	}
+	chart := push(HelmChartContentMediaType, []byte("chart"))
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    push("application/vnd.cncf.helm.config.v1+json", []byte("{}")),
+		Layers:    []ocispec.Descriptor{chart},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := push(ocispec.MediaTypeImageManifest, manifest)
+
+	dir := t.TempDir()
+	if err := saveHelmChartLayers(ctx, store, desc, dir); err != nil {
+		t.Fatalf("saveHelmChartLayers() error = %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, helmChartFile)); err != nil || string(data) != "chart" {
+		t.Errorf("%s = %q, %v, want the chart layer", helmChartFile, data, err)
+	}
+}
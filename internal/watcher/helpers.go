@@ -8,17 +8,20 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
 	"github.com/OctoKode/kyverno-artifact-operator/internal/k8s"
 	"github.com/google/go-containerregistry/pkg/name"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/client-go/discovery"
-	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/rest"
 	"sigs.k8s.io/yaml"
 )
 
@@ -28,14 +31,29 @@ func calculateSHA256(data []byte) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// managedBySelector selects every object applied by a watcher.
+const managedBySelector = "managed-by=kyverno-watcher"
+
 // checksumsChanged compares the checksums of freshly pulled manifests against
 // the versions in the cluster. It returns true if any manifest is new or has changed,
-// along with a list of files that need to be applied.
+// along with a list of files that need to be applied. Objects held with the hold-until annotation are skipped.
+// Managed objects are listed once per resource type instead of being fetched one at a time,
+// which keeps the number of API calls independent of the number of policies in the artifact.
 func checksumsChanged(newChecksums map[string]string, dynamicClient dynamic.Interface, mapper meta.RESTMapper) (bool, []string, error) {
 	var filesToApply []string
 	changed := false
 
-	for file, newChecksum := range newChecksums {
+	files := make([]string, 0, len(newChecksums))
+	for file := range newChecksums {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	managed := make(map[schema.GroupVersionResource]map[string]*unstructured.Unstructured)
+	listFailed := make(map[schema.GroupVersionResource]bool)
+
+	for _, file := range files {
+		newChecksum := newChecksums[file]
 		fileContent, err := os.ReadFile(file)
 		if err != nil {
 			log.Printf("Warning: failed to read file %s for checksum comparison: %v\n", file, err)
@@ -54,21 +72,35 @@ func checksumsChanged(newChecksums map[string]string, dynamicClient dynamic.Inte
 			continue
 		}
 
-		var existingPolicy *unstructured.Unstructured
+		gvr := mapping.Resource
+		if listFailed[gvr] {
+			continue
+		}
+		existingObjects, listed := managed[gvr]
+		if !listed {
+			existingObjects, err = listManagedObjects(dynamicClient, gvr)
+			if err != nil {
+				log.Printf("Warning: failed to list managed %s: %v\n", gvr.Resource, err)
+				listFailed[gvr] = true
+				continue
+			}
+			managed[gvr] = existingObjects
+		}
+
+		namespace := ""
 		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
-			existingPolicy, err = dynamicClient.Resource(mapping.Resource).Namespace(manifest.GetNamespace()).Get(context.Background(), manifest.GetName(), metav1.GetOptions{})
-		} else {
-			existingPolicy, err = dynamicClient.Resource(mapping.Resource).Get(context.Background(), manifest.GetName(), metav1.GetOptions{})
+			namespace = manifest.GetNamespace()
+		}
+		existingPolicy, found := existingObjects[objectKey(namespace, manifest.GetName())]
+		if !found {
+			log.Printf("Policy %s/%s not found. Adding to apply list.\n", manifest.GetNamespace(), manifest.GetName())
+			filesToApply = append(filesToApply, file)
+			changed = true
+			continue
 		}
 
-		if err != nil {
-			if strings.Contains(err.Error(), "not found") {
-				log.Printf("Policy %s/%s not found. Adding to apply list.\n", manifest.GetNamespace(), manifest.GetName())
-				filesToApply = append(filesToApply, file)
-				changed = true
-			} else {
-				log.Printf("Warning: failed to get existing policy %s/%s: %v\n", manifest.GetNamespace(), manifest.GetName(), err)
-			}
+		if until, held := isHeld(existingPolicy); held {
+			log.Printf("Policy %s/%s is held until %s. Skipping.\n", manifest.GetNamespace(), manifest.GetName(), until.Format(time.RFC3339))
 			continue
 		}
 
@@ -99,6 +131,31 @@ func checksumsChanged(newChecksums map[string]string, dynamicClient dynamic.Inte
 	return changed, filesToApply, nil
 }
 
+// listManagedObjects lists every object of the given resource carrying the managed-by label, across all
+// namespaces, keyed by objectKey.
+func listManagedObjects(dynamicClient dynamic.Interface, gvr schema.GroupVersionResource) (map[string]*unstructured.Unstructured, error) {
+	list, err := dynamicClient.Resource(gvr).List(context.Background(), metav1.ListOptions{
+		LabelSelector: managedBySelector,
+	})
+	if err != nil {
+		return nil, err
+	}
+	objects := make(map[string]*unstructured.Unstructured, len(list.Items))
+	for i := range list.Items {
+		item := &list.Items[i]
+		objects[objectKey(item.GetNamespace(), item.GetName())] = item
+	}
+	return objects, nil
+}
+
+// objectKey identifies an object of a known resource type by namespace and name.
+func objectKey(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
 // tagChanged checks if the artifact tag has changed since the last check.
 // It returns true if the tag is new, the latest tag, the previous tag, and any error.
 func tagChanged(config *Config) (bool, string, string, error) {
@@ -180,20 +237,185 @@ func getKubernetesClients() (dynamic.Interface, meta.RESTMapper, error) {
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get kubeconfig: %w", err)
 	}
+	return newKubernetesClients(kubeConfig)
+}
+
+// newKubernetesClients returns a dynamic client and a discovery-based REST mapper for the cluster kubeConfig
+// points to.
+func newKubernetesClients(kubeConfig *rest.Config) (dynamic.Interface, meta.RESTMapper, error) {
 	dynamicClient, err := dynamic.NewForConfig(kubeConfig)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create dynamic client: %w", err)
 	}
-	discoveryClient, err := discovery.NewDiscoveryClientForConfig(kubeConfig)
+	mapper, err := k8s.NewRESTMapper(kubeConfig)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create discovery client: %w", err)
+		return nil, nil, err
 	}
-	cachedClient := memory.NewMemCacheClient(discoveryClient)
-	apiGroupResources, err := restmapper.GetAPIGroupResources(cachedClient)
+
+	return dynamicClient, mapper, nil
+}
+
+const (
+	// retryBaseDelay is the delay before the first retry of a partially applied revision.
+	retryBaseDelay = 30 * time.Second
+	// retryMaxDelay caps the exponential backoff between retries.
+	retryMaxDelay = 15 * time.Minute
+)
+
+// retryStatePath returns the location of the retry state file, which lives next to the last_seen file.
+func retryStatePath(config *Config) string {
+	return filepath.Join(filepath.Dir(config.LastFile), "retry_state.json")
+}
+
+// loadRetryState reads the persisted retry state. It returns nil if there is nothing to retry.
+func loadRetryState(config *Config) (*retryState, error) {
+	data, err := os.ReadFile(retryStatePath(config))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get API group resources: %w", err)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read retry state: %w", err)
+	}
+	var state retryState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse retry state: %w", err)
 	}
-	mapper := restmapper.NewDiscoveryRESTMapper(apiGroupResources)
+	return &state, nil
+}
 
-	return dynamicClient, mapper, nil
+// saveRetryState persists the retry state so failed objects are retried on a later cycle.
+func saveRetryState(config *Config, state *retryState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal retry state: %w", err)
+	}
+	if err := os.WriteFile(retryStatePath(config), data, 0644); err != nil {
+		return fmt.Errorf("failed to write retry state: %w", err)
+	}
+	return nil
+}
+
+// clearRetryState removes the retry state once a revision has been fully applied.
+func clearRetryState(config *Config) {
+	if err := os.Remove(retryStatePath(config)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: failed to remove retry state: %v\n", err)
+	}
+}
+
+// retryBackoff returns how long to wait before the given retry attempt, doubling from
+// retryBaseDelay up to retryMaxDelay.
+func retryBackoff(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+	return delay
+}
+
+// failedFiles returns the sorted, de-duplicated list of files that had at least one failed or conflicting object.
+// Conflicting files are retried too, so an object is picked up once its owner hands it over.
+func failedFiles(results []ApplyResult) []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, r := range results {
+		failed := r.Outcome == kyvernov1alpha1.ApplyOutcomeFailed || r.Outcome == kyvernov1alpha1.ApplyOutcomeConflict
+		// Failures without a file, such as skipped rules, cannot be fixed by applying again.
+		if failed && r.File != "" && !seen[r.File] {
+			seen[r.File] = true
+			files = append(files, r.File)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// rewriteName applies the configured name prefix and suffix to obj and records the name it had in the artifact.
+func rewriteName(config *Config, obj *unstructured.Unstructured) {
+	if config.NamePrefix == "" && config.NameSuffix == "" {
+		return
+	}
+	rewriteBoundPolicyName(config, obj)
+	original := obj.GetName()
+	if original == "" {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[kyvernov1alpha1.OriginalNameAnnotation] = original
+	obj.SetAnnotations(annotations)
+	obj.SetName(config.NamePrefix + original + config.NameSuffix)
+}
+
+// applyCommonMetadata merges the configured common labels and annotations into obj, overriding the artifact's own
+// values, and records a hash of them so that a later change or removal is detected.
+func applyCommonMetadata(config *Config, obj *unstructured.Unstructured) {
+	if len(config.CommonLabels) == 0 && len(config.CommonAnnotations) == 0 {
+		return
+	}
+
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	for k, v := range config.CommonLabels {
+		labels[k] = v
+	}
+	obj.SetLabels(labels)
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	for k, v := range config.CommonAnnotations {
+		annotations[k] = v
+	}
+	annotations[kyvernov1alpha1.CommonMetadataHashAnnotation] = commonMetadataHash(config)
+	obj.SetAnnotations(annotations)
+}
+
+// commonMetadataHash returns a short, stable hash of the common labels and annotations, or an empty string when
+// none are configured.
+func commonMetadataHash(config *Config) string {
+	if len(config.CommonLabels) == 0 && len(config.CommonAnnotations) == 0 {
+		return ""
+	}
+	// json.Marshal sorts map keys, so the hash is stable.
+	data, _ := json.Marshal([]map[string]string{config.CommonLabels, config.CommonAnnotations})
+	return calculateSHA256(data)[:16]
+}
+
+// commonMetadataHashPath returns the location of the file remembering the common metadata the last pull was
+// rendered with.
+func commonMetadataHashPath(config *Config) string {
+	return filepath.Join(filepath.Dir(config.LastFile), "common_metadata_hash")
+}
+
+// saveCommonMetadataHash remembers the common metadata a pull was rendered with.
+func saveCommonMetadataHash(config *Config) {
+	if config.LastFile == "" {
+		return
+	}
+	if err := os.WriteFile(commonMetadataHashPath(config), []byte(commonMetadataHash(config)), 0644); err != nil {
+		log.Printf("Warning: failed to write common metadata hash: %v\n", err)
+	}
+}
+
+// commonMetadataChanged reports whether the common labels and annotations differ from the ones the last pull was
+// rendered with. They are not part of the policy checksums, so checksum reconciliation would not notice. State
+// written before the hash was recorded counts as rendered without common metadata.
+func commonMetadataChanged(config *Config) bool {
+	if config.LastFile == "" {
+		return false
+	}
+	previous, err := os.ReadFile(commonMetadataHashPath(config))
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: failed to read common metadata hash: %v\n", err)
+		return false
+	}
+	return commonMetadataHash(config) != string(previous)
 }
@@ -0,0 +1,143 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"github.com/OctoKode/kyverno-artifact-operator/internal/k8s"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// isHeld reports whether obj carries a hold-until annotation that has not expired yet, and until when.
+// An annotation that cannot be parsed is logged and ignored.
+func isHeld(obj *unstructured.Unstructured) (time.Time, bool) {
+	until, held, err := k8s.HeldUntil(obj.GetAnnotations(), time.Now())
+	if err != nil {
+		log.Printf("Warning: ignoring %s of %s %s: %v\n", kyvernov1alpha1.HoldUntilAnnotation, obj.GetKind(), objectKey(obj.GetNamespace(), obj.GetName()), err)
+	}
+	return until, held
+}
+
+// heldUntilPath returns the location of the file holding the time the earliest hold on an object of this artifact
+// expires. It lives next to the last_seen file.
+func heldUntilPath(config *Config) string {
+	return filepath.Join(filepath.Dir(config.LastFile), "held_until")
+}
+
+// holdExpired reports whether a hold recorded by reportHeldObjects has expired since, so that the artifact's
+// version of the held object is applied again.
+func holdExpired(config *Config) bool {
+	if config.LastFile == "" {
+		return false
+	}
+	data, err := os.ReadFile(heldUntilPath(config))
+	if err != nil {
+		return false // Nothing is held.
+	}
+	until, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		log.Printf("Warning: failed to parse held until file: %v\n", err)
+		return true
+	}
+	return !time.Now().Before(until)
+}
+
+// reportHeldObjects lists the objects labeled with this artifact that are held, in every cluster it is applied to,
+// records them in status.heldObjects and remembers when the earliest hold expires.
+func reportHeldObjects(config *Config, dynamicClient dynamic.Interface, mapper meta.RESTMapper) {
+	if config.ArtifactName == "" || dynamicClient == nil {
+		return
+	}
+	clusters, err := appliedClusters(config, dynamicClient, mapper)
+	if err != nil {
+		log.Printf("Warning: skipping held object check: %v\n", err)
+		return
+	}
+
+	ctx := context.Background()
+	var held []kyvernov1alpha1.HeldObject
+	for _, c := range clusters {
+		resources, err := k8s.ManagedResources(c.mapper)
+		if err != nil {
+			log.Printf("Warning: skipping held object check: %s\n", c.describe(err.Error()))
+			return
+		}
+		for _, resource := range resources {
+			list, err := listArtifactObjects(ctx, config, c.dynamicClient, resource.GVR)
+			if err != nil {
+				if errors.IsNotFound(err) {
+					continue
+				}
+				log.Printf("Warning: skipping held object check: %s\n",
+					c.describe(fmt.Sprintf("failed to list %s: %v", resource.GVR.Resource, err)))
+				return
+			}
+			for i := range list.Items {
+				item := &list.Items[i]
+				until, ok := isHeld(item)
+				if !ok {
+					continue
+				}
+				held = append(held, kyvernov1alpha1.HeldObject{
+					Cluster:    c.name,
+					APIVersion: item.GetAPIVersion(),
+					Kind:       item.GetKind(),
+					Namespace:  item.GetNamespace(),
+					Name:       item.GetName(),
+					Until:      metav1.NewTime(until),
+				})
+			}
+		}
+	}
+
+	sort.Slice(held, func(i, j int) bool {
+		if !held[i].Until.Equal(&held[j].Until) {
+			return held[i].Until.Before(&held[j].Until)
+		}
+		if held[i].Cluster != held[j].Cluster {
+			return held[i].Cluster < held[j].Cluster
+		}
+		if held[i].Kind != held[j].Kind {
+			return held[i].Kind < held[j].Kind
+		}
+		return objectKey(held[i].Namespace, held[i].Name) < objectKey(held[j].Namespace, held[j].Name)
+	})
+	saveHeldUntil(config, held)
+	if len(held) > maxFailedObjectsInStatus {
+		held = held[:maxFailedObjectsInStatus]
+	}
+	err = updateArtifactStatusFunc(config, dynamicClient, func(status *kyvernov1alpha1.KyvernoArtifactStatus) {
+		status.HeldObjects = held
+	})
+	if err != nil {
+		log.Printf("Warning: failed to update KyvernoArtifact status: %v\n", err)
+	}
+}
+
+// saveHeldUntil records when the earliest of the sorted holds expires, or forgets it when nothing is held.
+func saveHeldUntil(config *Config, held []kyvernov1alpha1.HeldObject) {
+	if config.LastFile == "" {
+		return
+	}
+	if len(held) == 0 {
+		if err := os.Remove(heldUntilPath(config)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to remove held until file: %v\n", err)
+		}
+		return
+	}
+	until := held[0].Until.UTC().Format(time.RFC3339)
+	if err := os.WriteFile(heldUntilPath(config), []byte(until), 0644); err != nil {
+		log.Printf("Warning: failed to write held until file: %v\n", err)
+	}
+}
@@ -0,0 +1,157 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var clusterPoliciesGVR = schema.GroupVersionResource{Group: "kyverno.io", Version: "v1", Resource: "clusterpolicies"}
+
+// newHeldClusterPolicy returns a ClusterPolicy of the security artifact held until the given time.
+func newHeldClusterPolicy(name string, spec map[string]interface{}, until time.Time) *unstructured.Unstructured {
+	obj := newClusterPolicy(name, map[string]interface{}{"managed-by": "kyverno-watcher", "artifact-name": "security"}, spec)
+	obj.SetAnnotations(map[string]string{kyvernov1alpha1.HoldUntilAnnotation: until.UTC().Format(time.RFC3339)})
+	return obj
+}
+
+func TestApplyResource_Held(t *testing.T) {
+	desired := newClusterPolicy("require-labels", map[string]interface{}{"managed-by": "kyverno-watcher", "artifact-name": "security"},
+		map[string]interface{}{"validationFailureAction": "Enforce"})
+	edited := map[string]interface{}{"validationFailureAction": "Audit"}
+
+	tests := []struct {
+		name       string
+		until      time.Time
+		want       kyvernov1alpha1.ApplyOutcome
+		wantAction string
+	}{
+		{
+			name:       "a held object is left as it is",
+			until:      time.Now().Add(time.Hour),
+			want:       kyvernov1alpha1.ApplyOutcomeHeld,
+			wantAction: "Audit",
+		},
+		{
+			name:       "an expired hold restores the artifact's version",
+			until:      time.Now().Add(-time.Minute),
+			want:       kyvernov1alpha1.ApplyOutcomeUpdated,
+			wantAction: "Enforce",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dynamicClient, mapper := newFakePolicyClients(newHeldClusterPolicy("require-labels", edited, tt.until))
+
+			got, err := applyResource(&Config{}, desired.DeepCopy(), dynamicClient, mapper)
+			if err != nil || got != tt.want {
+				t.Fatalf("applyResource() = %s, %v, want %s", got, err, tt.want)
+			}
+			obj, err := dynamicClient.Resource(clusterPoliciesGVR).Get(context.Background(), "require-labels", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action, _, _ := unstructured.NestedString(obj.Object, "spec", "validationFailureAction"); action != tt.wantAction {
+				t.Errorf("validationFailureAction = %q, want %q", action, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestChecksumsChanged_SkipsHeld(t *testing.T) {
+	dir := t.TempDir()
+	spec := map[string]interface{}{"background": true}
+	specBytes, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := filepath.Join(dir, "held.yaml")
+	if err := os.WriteFile(f, []byte("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: held\nspec:\n  background: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dynamicClient, mapper := newFakePolicyClients(newHeldClusterPolicy("held", map[string]interface{}{"background": false}, time.Now().Add(time.Hour)))
+
+	changed, files, err := checksumsChanged(map[string]string{f: calculateSHA256(specBytes)[:48]}, dynamicClient, mapper)
+	if err != nil {
+		t.Fatalf("checksumsChanged() error = %v", err)
+	}
+	if changed || len(files) != 0 {
+		t.Errorf("checksumsChanged() = %v, %v, want a held policy to be skipped", changed, files)
+	}
+}
+
+func TestHandleStaleObjects_SkipsHeld(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "keep.yaml")
+	if err := os.WriteFile(file, []byte("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: keep\nspec: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{ArtifactName: "security", PodNamespace: "default", Prune: true}
+	dynamicClient, mapper := newFakePolicyClients(
+		newHeldClusterPolicy("keep", map[string]interface{}{}, time.Now().Add(time.Hour)),
+		newHeldClusterPolicy("dropped", map[string]interface{}{}, time.Now().Add(time.Hour)),
+		newTestArtifact("security", "default"),
+	)
+
+	if results := handleStaleObjects(config, dynamicClient, mapper, []string{file}); len(results) != 0 {
+		t.Errorf("handleStaleObjects() = %+v, want nothing pruned", results)
+	}
+	if _, err := dynamicClient.Resource(clusterPoliciesGVR).Get(context.Background(), "dropped", metav1.GetOptions{}); err != nil {
+		t.Errorf("a held object should not be pruned: %v", err)
+	}
+}
+
+func TestReportHeldObjects(t *testing.T) {
+	config := &Config{ArtifactName: "security", PodNamespace: "default", LastFile: filepath.Join(t.TempDir(), "last_seen")}
+	later := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	sooner := time.Now().Add(time.Hour).Truncate(time.Second)
+	dynamicClient, mapper := newFakePolicyClients(
+		newHeldClusterPolicy("later", map[string]interface{}{}, later),
+		newHeldClusterPolicy("sooner", map[string]interface{}{}, sooner),
+		newHeldClusterPolicy("expired", map[string]interface{}{}, time.Now().Add(-time.Hour)),
+		newTestArtifact("security", "default"),
+	)
+
+	reportHeldObjects(config, dynamicClient, mapper)
+
+	obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace("default").Get(context.Background(), "security", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var artifact kyvernov1alpha1.KyvernoArtifact
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &artifact); err != nil {
+		t.Fatal(err)
+	}
+	held := artifact.Status.HeldObjects
+	if len(held) != 2 || held[0].Name != "sooner" || held[1].Name != "later" || !held[0].Until.Time.Equal(sooner) {
+		t.Errorf("HeldObjects = %+v, want sooner and later, earliest first", held)
+	}
+	if holdExpired(config) {
+		t.Error("holdExpired() should be false while the holds last")
+	}
+
+	if err := os.WriteFile(heldUntilPath(config), []byte(time.Now().Add(-time.Second).UTC().Format(time.RFC3339)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !holdExpired(config) {
+		t.Error("holdExpired() should be true once the earliest hold expired")
+	}
+
+	empty, mapper := newFakePolicyClients(newTestArtifact("security", "default"))
+	reportHeldObjects(config, empty, mapper)
+	if _, err := os.Stat(heldUntilPath(config)); !os.IsNotExist(err) {
+		t.Errorf("the held until file should be removed when nothing is held, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// errKustomizeBuild wraps errors of the kustomize build itself, as opposed to reading or writing the artifact.
+var errKustomizeBuild = errors.New("kustomize build failed")
+
+// kustomizeOutputDir is the directory, relative to the artifact root, that rendered objects are written to.
+const kustomizeOutputDir = "kustomize"
+
+// hasKustomization reports whether dir holds a kustomization file.
+func hasKustomization(dir string) bool {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// renderKustomization builds the kustomization at config.KustomizePath in destDir, or at its root when no path is
+// configured, and replaces the contents of destDir with the rendered objects, one per file, so that they go through
+// the same pipeline as plain manifests. An artifact without a kustomization is left as it is, unless a path was
+// configured explicitly.
+func renderKustomization(config *Config, destDir string) error {
+	root := filepath.Join(destDir, filepath.FromSlash(config.KustomizePath))
+	if !hasKustomization(root) {
+		if config.KustomizePath != "" {
+			return fmt.Errorf("%w: no kustomization found at %s in the artifact", errKustomizeBuild, config.KustomizePath)
+		}
+		return nil
+	}
+
+	// Build from an in-memory copy of the artifact, so that a kustomization cannot read files outside of it.
+	fSys := filesys.MakeFsInMemory()
+	err := filepath.Walk(destDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(destDir, p)
+		if err != nil {
+			return err
+		}
+		target := path.Join("/", filepath.ToSlash(rel))
+		if info.IsDir() {
+			return fSys.MkdirAll(target)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return fSys.WriteFile(target, data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read the artifact for kustomize: %w", err)
+	}
+
+	log.Printf("Building kustomization at %s\n", path.Join("/", config.KustomizePath))
+	resMap, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fSys, path.Join("/", config.KustomizePath))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errKustomizeBuild, err)
+	}
+
+	// Replace the sources with the rendered objects.
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(destDir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", entry.Name(), err)
+		}
+	}
+
+	for _, res := range resMap.Resources() {
+		data, err := res.AsYAML()
+		if err != nil {
+			return fmt.Errorf("failed to encode %s %s: %w", res.GetKind(), res.GetName(), err)
+		}
+		file := filepath.Join(destDir, filepath.FromSlash(renderedObjectPath(res.GetKind(), res.GetNamespace(), res.GetName())))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			return fmt.Errorf("failed to write rendered manifest %s: %w", file, err)
+		}
+	}
+	log.Printf("Kustomize rendered %d object(s)\n", resMap.Size())
+	return nil
+}
+
+// renderedObjectPath returns the path, relative to the artifact root, that a rendered object is written to:
+// kustomize/<kind>/<name>.yaml, or kustomize/<kind>/<namespace>/<name>.yaml for namespaced objects.
+// It is also the path include and exclude filters match.
+func renderedObjectPath(kind, namespace, name string) string {
+	parts := []string{kustomizeOutputDir, sanitizePath(kind)}
+	if namespace != "" {
+		parts = append(parts, sanitizePath(namespace))
+	}
+	return strings.Join(append(parts, sanitizePath(name)+".yaml"), "/")
+}
@@ -0,0 +1,136 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeArtifactFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func listArtifactFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestRenderKustomization(t *testing.T) {
+	artifact := map[string]string{
+		"base/kustomization.yaml": "resources:\n- require-labels.yaml\n- restrict-image.yaml\n",
+		"base/require-labels.yaml": "apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: require-labels\n" +
+			"spec:\n  validationFailureAction: Audit\n",
+		"base/restrict-image.yaml": "apiVersion: kyverno.io/v1\nkind: Policy\nmetadata:\n  name: restrict-image\n" +
+			"  namespace: apps\nspec:\n  validationFailureAction: Audit\n",
+		"overlays/production/kustomization.yaml": "resources:\n- ../../base\nlabels:\n- pairs:\n    env: production\n" +
+			"patches:\n- target:\n    kind: ClusterPolicy\n  patch: |-\n    - op: replace\n" +
+			"      path: /spec/validationFailureAction\n      value: Enforce\n",
+	}
+
+	tests := []struct {
+		name      string
+		files     map[string]string
+		path      string
+		wantFiles []string
+		wantErr   bool
+		check     func(t *testing.T, dir string)
+	}{
+		{
+			name:  "overlay is rendered into one file per object",
+			files: artifact,
+			path:  "overlays/production",
+			wantFiles: []string{
+				"kustomize/ClusterPolicy/require-labels.yaml",
+				"kustomize/Policy/apps/restrict-image.yaml",
+			},
+			check: func(t *testing.T, dir string) {
+				data, err := os.ReadFile(filepath.Join(dir, "kustomize/ClusterPolicy/require-labels.yaml"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, want := range []string{"env: production", "validationFailureAction: Enforce"} {
+					if !strings.Contains(string(data), want) {
+						t.Errorf("rendered manifest does not contain %q:\n%s", want, data)
+					}
+				}
+			},
+		},
+		{
+			name: "kustomization at the root is built without a path",
+			files: map[string]string{
+				"kustomization.yaml":       "resources:\n- base\n",
+				"base/kustomization.yaml":  artifact["base/kustomization.yaml"],
+				"base/require-labels.yaml": artifact["base/require-labels.yaml"],
+				"base/restrict-image.yaml": artifact["base/restrict-image.yaml"],
+			},
+			wantFiles: []string{
+				"kustomize/ClusterPolicy/require-labels.yaml",
+				"kustomize/Policy/apps/restrict-image.yaml",
+			},
+		},
+		{
+			name:      "artifact without a kustomization is left as is",
+			files:     map[string]string{"require-labels.yaml": artifact["base/require-labels.yaml"]},
+			wantFiles: []string{"require-labels.yaml"},
+		},
+		{
+			name:    "configured path without a kustomization fails",
+			files:   artifact,
+			path:    "overlays/staging",
+			wantErr: true,
+		},
+		{
+			name:    "resources outside of the artifact cannot be read",
+			files:   map[string]string{"kustomization.yaml": "resources:\n- ../../../etc/hosts\n"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeArtifactFiles(t, dir, tt.files)
+
+			err := renderKustomization(&Config{KustomizePath: tt.path}, dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderKustomization() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if reason := pullFailureReason(err); reason != "KustomizeFailed" {
+					t.Errorf("pullFailureReason() = %s, want KustomizeFailed", reason)
+				}
+				return
+			}
+			if got := listArtifactFiles(t, dir); strings.Join(got, ",") != strings.Join(tt.wantFiles, ",") {
+				t.Errorf("files = %v, want %v", got, tt.wantFiles)
+			}
+			if tt.check != nil {
+				tt.check(t, dir)
+			}
+		})
+	}
+}
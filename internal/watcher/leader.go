@@ -0,0 +1,84 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/OctoKode/kyverno-artifact-operator/internal/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	// leaseDuration is how long standbys wait before taking over the lease of a replica that stopped renewing it.
+	leaseDuration = 15 * time.Second
+	// leaseRenewDeadline is how long the active replica keeps retrying to renew the lease before it gives up.
+	leaseRenewDeadline = 10 * time.Second
+	// leaseRetryPeriod is how often replicas try to acquire or renew the lease.
+	leaseRetryPeriod = 2 * time.Second
+)
+
+// runElected runs run once this replica holds the lease of the watcher, and returns when the lease is lost so that
+// the replica restarts as a standby. Standbys keep waiting for the lease with the artifact already configured. On
+// termination the lease is released, so that a standby takes over right away.
+func runElected(config *Config, run func(ctx context.Context)) error {
+	kubeConfig, err := k8s.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get kubeconfig: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+	identity := config.Identity
+	if identity == "" {
+		if identity, err = os.Hostname(); err != nil {
+			return fmt.Errorf("failed to get the identity of this replica: %w", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: config.LeaseName, Namespace: config.PodNamespace},
+			Client:     clientset.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		},
+		LeaseDuration: leaseDuration,
+		RenewDeadline: leaseRenewDeadline,
+		RetryPeriod:   leaseRetryPeriod,
+		// Released on termination, so that a standby does not wait for the lease to expire
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.Printf("Acquired lease %s/%s, syncing the artifact\n", config.PodNamespace, config.LeaseName)
+				run(ctx)
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() == nil {
+					log.Printf("Lost lease %s/%s, restarting as a standby\n", config.PodNamespace, config.LeaseName)
+				}
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					log.Printf("Standing by, %s holds lease %s/%s\n", leader, config.PodNamespace, config.LeaseName)
+				}
+			},
+		},
+		Name: config.LeaseName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set up the lease election: %w", err)
+	}
+	elector.Run(ctx)
+	return nil
+}
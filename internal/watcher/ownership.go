@@ -0,0 +1,281 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// ownershipConflictError is returned by applyResource when the object in the cluster is labeled with
+// another artifact's name or namespace and has not been handed over.
+type ownershipConflictError struct {
+	Owner          string
+	OwnerNamespace string
+}
+
+func (e *ownershipConflictError) Error() string {
+	owner := e.Owner
+	if e.OwnerNamespace != "" {
+		owner = e.OwnerNamespace + "/" + e.Owner
+	}
+	return fmt.Sprintf("object is managed by KyvernoArtifact %q; annotate it with %s=<artifact> to hand it over",
+		owner, kyvernov1alpha1.HandoverAnnotation)
+}
+
+// checkOwnership refuses to let desired overwrite an existing object that belongs to a different artifact.
+// Artifacts are told apart by the artifact-name label and, when both objects carry it, the artifact-namespace label.
+// The current owner can release the object by setting the handover annotation to the claiming artifact's name;
+// the annotation is not part of the desired object, so the update that takes the object over also removes it.
+func checkOwnership(existing, desired *unstructured.Unstructured) error {
+	claimant := desired.GetLabels()["artifact-name"]
+	owner := existing.GetLabels()["artifact-name"]
+	claimantNamespace := desired.GetLabels()["artifact-namespace"]
+	ownerNamespace := existing.GetLabels()["artifact-namespace"]
+	sameNamespace := claimantNamespace == "" || ownerNamespace == "" || claimantNamespace == ownerNamespace
+	if claimant == "" || owner == "" || (owner == claimant && sameNamespace) {
+		return nil
+	}
+	if existing.GetAnnotations()[kyvernov1alpha1.HandoverAnnotation] == claimant {
+		log.Printf("Taking over %s %s from KyvernoArtifact %s (handed over to %s)\n",
+			existing.GetKind(), existing.GetName(), owner, claimant)
+		return nil
+	}
+	return &ownershipConflictError{Owner: owner, OwnerNamespace: ownerNamespace}
+}
+
+// unmanagedObjectError is returned by applyResource when an object of the artifact already exists without being
+// managed by a watcher and spec.adoption does not allow adopting it.
+type unmanagedObjectError struct {
+	Adoption string
+}
+
+func (e *unmanagedObjectError) Error() string {
+	if e.Adoption == kyvernov1alpha1.AdoptionIfIdentical {
+		return "object exists without being managed by a watcher and its spec differs from the artifact; set adoption to always to adopt it"
+	}
+	return "object exists without being managed by a watcher; set adoption to ifIdentical or always to adopt it"
+}
+
+// isUnmanaged reports whether existing was not applied by a watcher, e.g. because it predates the operator.
+func isUnmanaged(existing *unstructured.Unstructured) bool {
+	labels := existing.GetLabels()
+	return labels["managed-by"] != "kyverno-watcher" && labels["artifact-name"] == ""
+}
+
+// checkAdoption decides, according to spec.adoption, whether desired may take over an existing object that is not
+// managed by a watcher. An adopted object is annotated with the time it was adopted, and the annotation is kept
+// on every later update.
+func checkAdoption(config *Config, existing, desired *unstructured.Unstructured) error {
+	adoptedAt, adopted := existing.GetAnnotations()[kyvernov1alpha1.AdoptedAtAnnotation]
+	if !adopted {
+		if !isUnmanaged(existing) {
+			return nil
+		}
+		switch config.Adoption {
+		case kyvernov1alpha1.AdoptionNever:
+			return &unmanagedObjectError{Adoption: config.Adoption}
+		case kyvernov1alpha1.AdoptionIfIdentical:
+			// Kyverno defaults fields the manifest leaves out, such as admission, so the spec only has to contain
+			// the manifest's, like in drift detection.
+			if _, identical := containsFields(existing.Object["spec"], desired.Object["spec"], "spec"); !identical {
+				return &unmanagedObjectError{Adoption: config.Adoption}
+			}
+		}
+		log.Printf("Adopting %s %s, it exists without being managed by a watcher\n", existing.GetKind(), existing.GetName())
+		adoptedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	annotations := desired.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[kyvernov1alpha1.AdoptedAtAnnotation] = adoptedAt
+	desired.SetAnnotations(annotations)
+	return nil
+}
+
+// conflictsFromResults turns the conflicting results of an apply attempt into status entries claimed by claimant.
+func conflictsFromResults(claimant types.NamespacedName, results []ApplyResult) []kyvernov1alpha1.OwnershipConflict {
+	var conflicts []kyvernov1alpha1.OwnershipConflict
+	for _, r := range results {
+		if r.Outcome != kyvernov1alpha1.ApplyOutcomeConflict {
+			continue
+		}
+		conflicts = append(conflicts, kyvernov1alpha1.OwnershipConflict{
+			APIVersion:         r.APIVersion,
+			Kind:               r.Kind,
+			Namespace:          r.Namespace,
+			Name:               r.Name,
+			OwnedBy:            r.Owner,
+			OwnedByNamespace:   r.OwnerNamespace,
+			ClaimedBy:          claimant.Name,
+			ClaimedByNamespace: claimant.Namespace,
+		})
+	}
+	return conflicts
+}
+
+// replaceClaimedConflicts drops every conflict claimed by claimant from the status, adds the given ones and
+// refreshes the OwnershipConflict condition. It returns the owners named by the dropped entries. Entries recorded
+// without the namespace of the claimant are dropped as well.
+func replaceClaimedConflicts(status *kyvernov1alpha1.KyvernoArtifactStatus, claimant types.NamespacedName, conflicts []kyvernov1alpha1.OwnershipConflict) []types.NamespacedName {
+	var previousOwners []types.NamespacedName
+	kept := status.Conflicts[:0]
+	for _, c := range status.Conflicts {
+		if c.ClaimedBy == claimant.Name && (c.ClaimedByNamespace == "" || c.ClaimedByNamespace == claimant.Namespace) {
+			previousOwners = append(previousOwners, types.NamespacedName{Namespace: c.OwnedByNamespace, Name: c.OwnedBy})
+			continue
+		}
+		kept = append(kept, c)
+	}
+	status.Conflicts = append(kept, conflicts...)
+	if len(status.Conflicts) == 0 {
+		status.Conflicts = nil
+	}
+
+	if len(status.Conflicts) > 0 {
+		unmanaged := 0
+		for _, c := range status.Conflicts {
+			if c.OwnedBy == "" {
+				unmanaged++
+			}
+		}
+		message := fmt.Sprintf("%d object(s) are shipped by more than one artifact", len(status.Conflicts)-unmanaged)
+		if unmanaged > 0 {
+			message += fmt.Sprintf(", %d exist without being managed", unmanaged)
+		}
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    kyvernov1alpha1.ConditionOwnershipConflict,
+			Status:  metav1.ConditionTrue,
+			Reason:  "ObjectsShared",
+			Message: message,
+		})
+	} else if meta.FindStatusCondition(status.Conditions, kyvernov1alpha1.ConditionOwnershipConflict) != nil {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    kyvernov1alpha1.ConditionOwnershipConflict,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NoConflicts",
+			Message: "No objects are shipped by more than one artifact",
+		})
+	}
+
+	return previousOwners
+}
+
+// reportConflictsToOwners mirrors this artifact's conflicts onto the status of every artifact that owns one of
+// the contested objects, and clears stale entries from owners that are no longer in conflict with it. Owners are
+// found by the artifact-namespace label of the contested object; objects applied before the label existed are
+// skipped until their owner's watcher relabels them.
+func reportConflictsToOwners(config *Config, dynamicClient dynamic.Interface, previousOwners []types.NamespacedName, conflicts []kyvernov1alpha1.OwnershipConflict) {
+	if config.ArtifactName == "" || dynamicClient == nil {
+		return
+	}
+
+	byOwner := make(map[types.NamespacedName][]kyvernov1alpha1.OwnershipConflict)
+	for _, owner := range previousOwners {
+		byOwner[owner] = nil
+	}
+	for _, c := range conflicts {
+		owner := types.NamespacedName{Namespace: c.OwnedByNamespace, Name: c.OwnedBy}
+		byOwner[owner] = append(byOwner[owner], c)
+	}
+
+	owners := make([]types.NamespacedName, 0, len(byOwner))
+	for owner := range byOwner {
+		// Objects that exist without being managed have no owner to report to.
+		if owner.Name == "" {
+			continue
+		}
+		if owner.Namespace == "" {
+			log.Printf("Warning: not reporting ownership conflicts to KyvernoArtifact %s, its objects do not record its namespace yet\n", owner.Name)
+			continue
+		}
+		owners = append(owners, owner)
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i].String() < owners[j].String() })
+
+	claimant := types.NamespacedName{Namespace: config.PodNamespace, Name: config.ArtifactName}
+	for _, owner := range owners {
+		ownerConflicts := byOwner[owner]
+		err := updateNamedArtifactStatus(dynamicClient, owner.Namespace, owner.Name, func(status *kyvernov1alpha1.KyvernoArtifactStatus) {
+			replaceClaimedConflicts(status, claimant, ownerConflicts)
+		})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Warning: failed to report ownership conflicts on KyvernoArtifact %s: %v\n", owner, err)
+		}
+	}
+}
+
+// managedObjectSelector returns the label selector of the objects applied by this artifact. Artifacts of the same
+// name in other namespaces are told apart by the artifact-namespace label.
+func managedObjectSelector(config *Config) string {
+	if config.PodNamespace == "" {
+		return fmt.Sprintf("artifact-name=%s", config.ArtifactName)
+	}
+	return fmt.Sprintf("artifact-name=%s,artifact-namespace=%s", config.ArtifactName, config.PodNamespace)
+}
+
+// listArtifactObjects lists the objects of gvr applied by this artifact, in every namespace. Objects applied before
+// the artifact-namespace label existed only carry the artifact's name. They are included as long as no artifact of
+// the same name exists in another namespace, since they could belong to either; an artifact that still ships them
+// adds the label on its next apply.
+func listArtifactObjects(ctx context.Context, config *Config, dynamicClient dynamic.Interface, gvr schema.GroupVersionResource) (*unstructured.UnstructuredList, error) {
+	list, err := dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{LabelSelector: managedObjectSelector(config)})
+	if err != nil || config.PodNamespace == "" {
+		return list, err
+	}
+
+	legacy, err := dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("artifact-name=%s,!artifact-namespace", config.ArtifactName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(legacy.Items) == 0 {
+		return list, nil
+	}
+	shared, err := artifactNameShared(ctx, config, dynamicClient)
+	if err != nil {
+		log.Printf("Warning: leaving %d %s without the artifact-namespace label alone: %v\n", len(legacy.Items), gvr.Resource, err)
+		return list, nil
+	}
+	if shared {
+		log.Printf("Warning: leaving %d %s without the artifact-namespace label alone, a KyvernoArtifact named %s exists in another namespace\n",
+			len(legacy.Items), gvr.Resource, config.ArtifactName)
+		return list, nil
+	}
+	list.Items = append(list.Items, legacy.Items...)
+	return list, nil
+}
+
+// artifactNameShared reports whether a KyvernoArtifact with this artifact's name exists in another namespace. A
+// cluster without the KyvernoArtifact CRD, such as a target cluster, has none.
+func artifactNameShared(ctx context.Context, config *Config, dynamicClient dynamic.Interface) (bool, error) {
+	list, err := dynamicClient.Resource(kyvernoArtifactsGVR).List(ctx, metav1.ListOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to list KyvernoArtifacts: %w", err)
+	}
+	for _, item := range list.Items {
+		if item.GetName() == config.ArtifactName && item.GetNamespace() != config.PodNamespace {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,158 @@
+package watcher
+
+import (
+	"fmt"
+	"strings"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/kustomize/kyaml/yaml/merge2"
+	"sigs.k8s.io/yaml"
+)
+
+// patchFailure is a patch that could not be applied to one of its targets.
+type patchFailure struct {
+	Patch      int
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	Err        error
+}
+
+// patchError is returned by a pull when patches failed on one or more targets. The revision is not applied, so
+// that an object is never applied without the change a patch makes to it.
+type patchError struct {
+	Failures []patchFailure
+}
+
+func (e *patchError) Error() string {
+	messages := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		messages = append(messages, fmt.Sprintf("patch %d on %s %s: %v", f.Patch, f.Kind, objectKey(f.Namespace, f.Name), f.Err))
+	}
+	return fmt.Sprintf("%d patch target(s) failed: %s", len(e.Failures), strings.Join(messages, "; "))
+}
+
+func (e *patchError) objectFailures() []kyvernov1alpha1.ObjectStatus {
+	statuses := make([]kyvernov1alpha1.ObjectStatus, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		statuses = append(statuses, kyvernov1alpha1.ObjectStatus{
+			APIVersion: f.APIVersion,
+			Kind:       f.Kind,
+			Namespace:  f.Namespace,
+			Name:       f.Name,
+			Outcome:    kyvernov1alpha1.ApplyOutcomeFailed,
+			Reason:     fmt.Sprintf("patch %d: %v", f.Patch, f.Err),
+		})
+	}
+	return statuses
+}
+
+// validatePatch checks the target and the content of a patch, so that a typo fails at startup
+// instead of failing every revision.
+func validatePatch(patch kyvernov1alpha1.Patch) error {
+	if patch.Target != nil {
+		if err := validateFilter(*patch.Target); err != nil {
+			return fmt.Errorf("target: %w", err)
+		}
+	}
+	switch patch.Type {
+	case kyvernov1alpha1.PatchTypeJSON6902:
+		if _, err := decodeJSON6902(patch.Patch); err != nil {
+			return err
+		}
+	case kyvernov1alpha1.PatchTypeStrategicMerge:
+		var partial map[string]interface{}
+		if err := yaml.Unmarshal([]byte(patch.Patch), &partial); err != nil || partial == nil {
+			return fmt.Errorf("a StrategicMerge patch must be an object: %v", err)
+		}
+	default:
+		return fmt.Errorf("unknown patch type %q", patch.Type)
+	}
+	return nil
+}
+
+// decodeJSON6902 decodes an RFC 6902 patch given in YAML or JSON.
+func decodeJSON6902(patch string) (jsonpatch.Patch, error) {
+	data, err := yaml.YAMLToJSON([]byte(patch))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON6902 patch: %w", err)
+	}
+	ops, err := jsonpatch.DecodePatch(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON6902 patch: %w", err)
+	}
+	return ops, nil
+}
+
+// applyPatches applies the patches whose target matches obj, in order, and returns the indexes of the patches
+// that matched. relPath is the path of the object's file in the artifact. Each patch sees the result of the
+// previous ones; a failing patch leaves obj as it was before that patch.
+func applyPatches(config *Config, relPath string, obj *unstructured.Unstructured) ([]int, []patchFailure) {
+	var matched []int
+	var failures []patchFailure
+	for i, patch := range config.Patches {
+		if patch.Target != nil && !filterMatches(*patch.Target, relPath, obj) {
+			continue
+		}
+		matched = append(matched, i)
+		if err := applyPatch(patch, obj); err != nil {
+			failures = append(failures, patchFailure{
+				Patch:      i,
+				APIVersion: obj.GetAPIVersion(),
+				Kind:       obj.GetKind(),
+				Namespace:  obj.GetNamespace(),
+				Name:       obj.GetName(),
+				Err:        err,
+			})
+		}
+	}
+	return matched, failures
+}
+
+// applyPatch applies a single patch to obj.
+func applyPatch(patch kyvernov1alpha1.Patch, obj *unstructured.Unstructured) error {
+	current, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	var patched []byte
+	switch patch.Type {
+	case kyvernov1alpha1.PatchTypeJSON6902:
+		ops, err := decodeJSON6902(patch.Patch)
+		if err != nil {
+			return err
+		}
+		if patched, err = ops.Apply(current); err != nil {
+			return err
+		}
+	case kyvernov1alpha1.PatchTypeStrategicMerge:
+		// Kyverno kinds have no schema here, so kyaml is told to infer associative lists, which merges
+		// lists of objects by their name and makes it possible to change a single rule of a policy.
+		merged, err := merge2.MergeStrings(patch.Patch, string(current), true, kyaml.MergeOptions{
+			ListIncreaseDirection: kyaml.MergeOptionsListAppend,
+		})
+		if err != nil {
+			return err
+		}
+		if patched, err = yaml.YAMLToJSON([]byte(merged)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown patch type %q", patch.Type)
+	}
+
+	var result unstructured.Unstructured
+	if err := result.UnmarshalJSON(patched); err != nil {
+		return fmt.Errorf("patched object is invalid: %w", err)
+	}
+	if result.GroupVersionKind() != obj.GroupVersionKind() {
+		return fmt.Errorf("patch must not change the apiVersion or kind")
+	}
+	obj.Object = result.Object
+	return nil
+}
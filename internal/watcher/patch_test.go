@@ -0,0 +1,263 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const patchTestPolicy = `apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: require-labels
+  labels:
+    vendor: acme
+spec:
+  validationFailureAction: Audit
+  rules:
+  - name: check-team
+    validate:
+      message: "label team is required"
+  - name: check-owner
+    validate:
+      message: "label owner is required"
+`
+
+func newPatchTestPolicy(t *testing.T) *unstructured.Unstructured {
+	t.Helper()
+	obj := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal([]byte(patchTestPolicy), &obj.Object); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func TestApplyPatches(t *testing.T) {
+	tests := []struct {
+		name         string
+		patches      []kyvernov1alpha1.Patch
+		wantMatched  int
+		wantFailures int
+		check        func(t *testing.T, obj *unstructured.Unstructured)
+	}{
+		{
+			name: "JSON6902 patch replaces a field",
+			patches: []kyvernov1alpha1.Patch{{
+				Target: &kyvernov1alpha1.ObjectFilter{Kind: "ClusterPolicy", Name: "require-*"},
+				Type:   kyvernov1alpha1.PatchTypeJSON6902,
+				Patch:  "- op: replace\n  path: /spec/rules/0/validate/message\n  value: \"ask the platform team\"\n",
+			}},
+			wantMatched: 1,
+			check: func(t *testing.T, obj *unstructured.Unstructured) {
+				rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+				message, _, _ := unstructured.NestedString(rules[0].(map[string]interface{}), "validate", "message")
+				if message != "ask the platform team" {
+					t.Errorf("message = %q", message)
+				}
+			},
+		},
+		{
+			name: "StrategicMerge patch merges a single rule by name",
+			patches: []kyvernov1alpha1.Patch{{
+				Target: &kyvernov1alpha1.ObjectFilter{LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"vendor": "acme"}}},
+				Type:   kyvernov1alpha1.PatchTypeStrategicMerge,
+				Patch: "spec:\n  rules:\n  - name: check-owner\n    exclude:\n      any:\n      - resources:\n" +
+					"          namespaces: [kube-system]\n",
+			}},
+			wantMatched: 1,
+			check: func(t *testing.T, obj *unstructured.Unstructured) {
+				rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+				if len(rules) != 2 {
+					t.Fatalf("rules = %v, want 2 rules", rules)
+				}
+				if _, found, _ := unstructured.NestedFieldNoCopy(rules[0].(map[string]interface{}), "exclude"); found {
+					t.Error("check-team should not have been patched")
+				}
+				if _, found, _ := unstructured.NestedFieldNoCopy(rules[1].(map[string]interface{}), "exclude"); !found {
+					t.Error("check-owner should have an exclude")
+				}
+				message, _, _ := unstructured.NestedString(rules[1].(map[string]interface{}), "validate", "message")
+				if message != "label owner is required" {
+					t.Errorf("check-owner message = %q, the rest of the rule should be kept", message)
+				}
+			},
+		},
+		{
+			name: "patches for other targets are skipped",
+			patches: []kyvernov1alpha1.Patch{{
+				Target: &kyvernov1alpha1.ObjectFilter{Kind: "Policy"},
+				Type:   kyvernov1alpha1.PatchTypeStrategicMerge,
+				Patch:  "spec:\n  validationFailureAction: Enforce\n",
+			}},
+			check: func(t *testing.T, obj *unstructured.Unstructured) {
+				action, _, _ := unstructured.NestedString(obj.Object, "spec", "validationFailureAction")
+				if action != "Audit" {
+					t.Errorf("validationFailureAction = %q, want Audit", action)
+				}
+			},
+		},
+		{
+			name: "patches apply in order",
+			patches: []kyvernov1alpha1.Patch{
+				{Type: kyvernov1alpha1.PatchTypeStrategicMerge, Patch: "spec:\n  validationFailureAction: Enforce\n"},
+				{Type: kyvernov1alpha1.PatchTypeJSON6902, Patch: `[{"op": "test", "path": "/spec/validationFailureAction", "value": "Enforce"}]`},
+			},
+			wantMatched: 2,
+		},
+		{
+			name: "failing patch is reported and leaves the object unchanged",
+			patches: []kyvernov1alpha1.Patch{{
+				Type:  kyvernov1alpha1.PatchTypeJSON6902,
+				Patch: "- op: remove\n  path: /spec/background\n",
+			}},
+			wantMatched:  1,
+			wantFailures: 1,
+		},
+		{
+			name: "patch changing the kind fails",
+			patches: []kyvernov1alpha1.Patch{{
+				Type:  kyvernov1alpha1.PatchTypeStrategicMerge,
+				Patch: "kind: Policy\n",
+			}},
+			wantMatched:  1,
+			wantFailures: 1,
+			check: func(t *testing.T, obj *unstructured.Unstructured) {
+				if obj.GetKind() != "ClusterPolicy" {
+					t.Errorf("kind = %s, want ClusterPolicy", obj.GetKind())
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := newPatchTestPolicy(t)
+			matched, failures := applyPatches(&Config{Patches: tt.patches}, "policies/require-labels.yaml", obj)
+			if len(matched) != tt.wantMatched {
+				t.Errorf("matched = %v, want %d patch(es)", matched, tt.wantMatched)
+			}
+			if len(failures) != tt.wantFailures {
+				t.Errorf("failures = %v, want %d", failures, tt.wantFailures)
+			}
+			for _, f := range failures {
+				if f.Kind != "ClusterPolicy" || f.Name != "require-labels" {
+					t.Errorf("failure target = %s %s, want ClusterPolicy require-labels", f.Kind, f.Name)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, obj)
+			}
+		})
+	}
+}
+
+func TestValidatePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   kyvernov1alpha1.Patch
+		wantErr bool
+	}{
+		{
+			name:  "JSON6902",
+			patch: kyvernov1alpha1.Patch{Type: kyvernov1alpha1.PatchTypeJSON6902, Patch: "- op: add\n  path: /spec/background\n  value: false\n"},
+		},
+		{
+			name:  "StrategicMerge",
+			patch: kyvernov1alpha1.Patch{Type: kyvernov1alpha1.PatchTypeStrategicMerge, Patch: "spec:\n  background: false\n"},
+		},
+		{
+			name:    "JSON6902 that is not a list",
+			patch:   kyvernov1alpha1.Patch{Type: kyvernov1alpha1.PatchTypeJSON6902, Patch: "spec:\n  background: false\n"},
+			wantErr: true,
+		},
+		{
+			name:    "StrategicMerge that is not an object",
+			patch:   kyvernov1alpha1.Patch{Type: kyvernov1alpha1.PatchTypeStrategicMerge, Patch: "- a\n- b\n"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid target",
+			patch:   kyvernov1alpha1.Patch{Type: kyvernov1alpha1.PatchTypeStrategicMerge, Patch: "spec: {}\n", Target: &kyvernov1alpha1.ObjectFilter{Name: "["}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			patch:   kyvernov1alpha1.Patch{Type: "Merge", Patch: "spec: {}\n"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePatch(tt.patch); (err != nil) != tt.wantErr {
+				t.Errorf("validatePatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPullImageToDirReal_Patches(t *testing.T) {
+	originalOrasPull := orasPullFunc
+	defer func() { orasPullFunc = originalOrasPull }()
+	orasPullFunc = func(config *Config, destDir string) error {
+		return os.WriteFile(filepath.Join(destDir, "policy.yaml"), []byte(patchTestPolicy), 0644)
+	}
+
+	pull := func(patches []kyvernov1alpha1.Patch) (string, *unstructured.Unstructured, error) {
+		t.Helper()
+		destDir := filepath.Join(t.TempDir(), "image")
+		config := &Config{Provider: ProviderArtifactory, ImageBase: "registry.example.com/policies", Patches: patches}
+		checksums, err := pullImageToDirReal(config, "v1", destDir)
+		if err != nil {
+			return "", nil, err
+		}
+		data, err := os.ReadFile(filepath.Join(destDir, "policy.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+			t.Fatal(err)
+		}
+		return checksums[filepath.Join(destDir, "policy.yaml")], obj, nil
+	}
+
+	unpatched, _, err := pull(nil)
+	if err != nil {
+		t.Fatalf("pullImageToDirReal() error = %v", err)
+	}
+	patched, obj, err := pull([]kyvernov1alpha1.Patch{{
+		Type:  kyvernov1alpha1.PatchTypeStrategicMerge,
+		Patch: "spec:\n  validationFailureAction: Enforce\n",
+	}})
+	if err != nil {
+		t.Fatalf("pullImageToDirReal() error = %v", err)
+	}
+	if action, _, _ := unstructured.NestedString(obj.Object, "spec", "validationFailureAction"); action != "Enforce" {
+		t.Errorf("validationFailureAction = %q, want Enforce", action)
+	}
+	if patched == unpatched {
+		t.Error("checksum should be calculated from the patched object")
+	}
+	if obj.GetLabels()["policy-checksum"] != patched {
+		t.Errorf("policy-checksum label = %q, want %q", obj.GetLabels()["policy-checksum"], patched)
+	}
+
+	_, _, err = pull([]kyvernov1alpha1.Patch{{
+		Type:  kyvernov1alpha1.PatchTypeJSON6902,
+		Patch: "- op: remove\n  path: /spec/background\n",
+	}})
+	var patchErr *patchError
+	if !errors.As(err, &patchErr) || len(patchErr.Failures) != 1 {
+		t.Fatalf("pullImageToDirReal() error = %v, want a patchError with one failure", err)
+	}
+	if reason := pullFailureReason(err); reason != "PatchFailed" {
+		t.Errorf("pullFailureReason() = %s, want PatchFailed", reason)
+	}
+}
@@ -0,0 +1,201 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"github.com/OctoKode/kyverno-artifact-operator/internal/k8s"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+)
+
+// desiredObjects reads every document in files and returns the policy-checksum label of the objects they define,
+// keyed by resource and objectKey. The version is left out of the key, so that an object is matched whichever of
+// the served versions the artifact and the cluster use. Any file that cannot be read or mapped makes the whole set unreliable,
+// so an error is returned instead of a partial set.
+func desiredObjects(files []string, mapper meta.RESTMapper) (map[schema.GroupResource]map[string]string, error) {
+	desired := make(map[schema.GroupResource]map[string]string)
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", file, err)
+		}
+		decoder := k8syaml.NewYAMLOrJSONDecoder(f, 4096)
+		for {
+			obj := &unstructured.Unstructured{}
+			if err := decoder.Decode(obj); err != nil {
+				if err == io.EOF {
+					break
+				}
+				_ = f.Close()
+				return nil, fmt.Errorf("failed to decode %s: %w", file, err)
+			}
+			if len(obj.Object) == 0 {
+				continue
+			}
+			gvk := obj.GroupVersionKind()
+			mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			if err != nil {
+				_ = f.Close()
+				return nil, fmt.Errorf("failed to get REST mapping for %s in %s: %w", gvk.String(), file, err)
+			}
+			namespace := ""
+			if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+				namespace = obj.GetNamespace()
+			}
+			resource := mapping.Resource.GroupResource()
+			if desired[resource] == nil {
+				desired[resource] = make(map[string]string)
+			}
+			desired[resource][objectKey(namespace, obj.GetName())] = obj.GetLabels()["policy-checksum"]
+		}
+		_ = f.Close()
+	}
+	return desired, nil
+}
+
+// handleStaleObjects finds objects labeled with this artifact that none of files define any more, because they
+// were removed from the artifact or are now filtered out. With pruning enabled they are deleted and returned as
+// Pruned results; otherwise, and for objects that could not be deleted, they are reported in status.staleObjects.
+// Copies stamped into a namespace that no longer matches namespaceSelector are always deleted. Held objects are
+// left in place.
+func handleStaleObjects(config *Config, dynamicClient dynamic.Interface, mapper meta.RESTMapper, files []string) []ApplyResult {
+	if config.ArtifactName == "" || dynamicClient == nil {
+		return nil
+	}
+	results, stale, err := pruneStaleObjects(config, dynamicClient, mapper, files)
+	if err != nil {
+		log.Printf("Warning: skipping stale object check: %v\n", err)
+		return nil
+	}
+	err = updateArtifactStatusFunc(config, dynamicClient, func(status *kyvernov1alpha1.KyvernoArtifactStatus) {
+		status.StaleObjects = stale
+	})
+	if err != nil {
+		log.Printf("Warning: failed to update KyvernoArtifact status: %v\n", err)
+	}
+	return results
+}
+
+// pruneStaleObjects does the work of handleStaleObjects in the cluster dynamicClient points to and returns the
+// Pruned results and the sorted, truncated stale objects instead of recording them in status.
+func pruneStaleObjects(config *Config, dynamicClient dynamic.Interface, mapper meta.RESTMapper, files []string) ([]ApplyResult, []kyvernov1alpha1.ObjectReference, error) {
+	// An empty pull is far more likely to be a broken artifact or an overly strict filter than a request
+	// to remove everything, so it never marks objects as stale. An artifact of namespaced objects is empty,
+	// though, when no namespace matches the namespace selector, so copies are still removed then.
+	onlyCopies := len(files) == 0
+	if onlyCopies && config.NamespaceSelector == "" {
+		return nil, nil, fmt.Errorf("the artifact has no selected manifests")
+	}
+
+	desired, err := desiredObjects(files, mapper)
+	if err != nil {
+		return nil, nil, err
+	}
+	var matching map[string]bool
+	if config.NamespaceSelector != "" {
+		namespaces, err := matchingNamespaces(config, dynamicClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		matching = make(map[string]bool, len(namespaces))
+		for _, namespace := range namespaces {
+			matching[namespace] = true
+		}
+	}
+
+	resources, err := k8s.ManagedResources(mapper)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := context.Background()
+	deleteAllowed := deletionAllowed(config)
+	var stale []kyvernov1alpha1.ObjectReference
+	var results []ApplyResult
+
+	for _, resource := range resources {
+		gvr := resource.GVR
+		list, err := listArtifactObjects(ctx, config, dynamicClient, gvr)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue // The CRD is not installed, so nothing of this kind can be stale.
+			}
+			return nil, nil, fmt.Errorf("failed to list %s: %w", gvr.Resource, err)
+		}
+		for _, item := range list.Items {
+			if _, ok := desired[gvr.GroupResource()][objectKey(item.GetNamespace(), item.GetName())]; ok {
+				continue
+			}
+			if until, held := isHeld(&item); held {
+				log.Printf("%s %s/%s is held until %s, leaving it in place\n", item.GetKind(), item.GetNamespace(), item.GetName(), until.Format(time.RFC3339))
+				continue
+			}
+			ref := kyvernov1alpha1.ObjectReference{
+				APIVersion: item.GetAPIVersion(),
+				Kind:       item.GetKind(),
+				Namespace:  item.GetNamespace(),
+				Name:       item.GetName(),
+			}
+			unmatchedCopy := matching != nil && item.GetAnnotations()[kyvernov1alpha1.FanOutAnnotation] == "true" &&
+				!matching[ref.Namespace]
+			switch {
+			case onlyCopies && !unmatchedCopy:
+				continue
+			case !config.Prune && !unmatchedCopy:
+				log.Printf("%s %s/%s is no longer part of the artifact; enable pruning to delete it\n", ref.Kind, ref.Namespace, ref.Name)
+				stale = append(stale, ref)
+				continue
+			case !deleteAllowed:
+				log.Printf("%s %s/%s is no longer part of the artifact; it is deleted in the next sync window\n", ref.Kind, ref.Namespace, ref.Name)
+				stale = append(stale, ref)
+				continue
+			case unmatchedCopy:
+				log.Printf("Removing %s %s/%s, the namespace no longer matches the namespace selector\n", ref.Kind, ref.Namespace, ref.Name)
+			default:
+				log.Printf("Pruning %s %s/%s, it is no longer part of the artifact\n", ref.Kind, ref.Namespace, ref.Name)
+			}
+
+			resource := dynamicClient.Resource(gvr)
+			if ref.Namespace != "" {
+				err = resource.Namespace(ref.Namespace).Delete(ctx, ref.Name, metav1.DeleteOptions{})
+			} else {
+				err = resource.Delete(ctx, ref.Name, metav1.DeleteOptions{})
+			}
+			if err != nil && !errors.IsNotFound(err) {
+				log.Printf("Failed to prune %s %s/%s: %v\n", ref.Kind, ref.Namespace, ref.Name, err)
+				stale = append(stale, ref)
+				continue
+			}
+			results = append(results, ApplyResult{
+				APIVersion: ref.APIVersion,
+				Kind:       ref.Kind,
+				Namespace:  ref.Namespace,
+				Name:       ref.Name,
+				Outcome:    kyvernov1alpha1.ApplyOutcomePruned,
+			})
+		}
+	}
+
+	sort.Slice(stale, func(i, j int) bool {
+		if stale[i].Kind != stale[j].Kind {
+			return stale[i].Kind < stale[j].Kind
+		}
+		return objectKey(stale[i].Namespace, stale[i].Name) < objectKey(stale[j].Namespace, stale[j].Name)
+	})
+	if len(stale) > maxFailedObjectsInStatus {
+		stale = stale[:maxFailedObjectsInStatus]
+	}
+	return results, stale, nil
+}
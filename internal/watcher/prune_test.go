@@ -0,0 +1,129 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestHandleStaleObjects(t *testing.T) {
+	clusterPoliciesGVR := schema.GroupVersionResource{Group: "kyverno.io", Version: "v1", Resource: "clusterpolicies"}
+	owned := map[string]interface{}{"managed-by": "kyverno-watcher", "artifact-name": "security"}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "keep.yaml")
+	if err := os.WriteFile(file, []byte("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: keep\nspec: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		prune       bool
+		files       []string
+		wantPruned  int
+		wantStale   []string
+		wantDeleted bool
+	}{
+		{
+			name:      "stale objects are reported",
+			files:     []string{file},
+			wantStale: []string{"dropped", "dropped-vpol"},
+		},
+		{
+			name:        "stale objects are pruned",
+			prune:       true,
+			files:       []string{file},
+			wantPruned:  2,
+			wantDeleted: true,
+		},
+		{
+			name:  "nothing is pruned for an empty artifact",
+			prune: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{ArtifactName: "security", PodNamespace: "default", Prune: tt.prune}
+			dynamicClient, mapper := newFakePolicyClients([]runtime.Object{
+				newClusterPolicy("keep", owned, map[string]interface{}{}),
+				newClusterPolicy("dropped", owned, map[string]interface{}{}),
+				newClusterPolicy("someone-elses", map[string]interface{}{"artifact-name": "other"}, map[string]interface{}{}),
+				newValidatingPolicy("dropped-vpol", owned),
+				newTestArtifact("security", "default"),
+			}...)
+
+			results := handleStaleObjects(config, dynamicClient, mapper, tt.files)
+
+			if got := int(summarizeResults(results).Pruned); got != tt.wantPruned {
+				t.Errorf("pruned = %d, want %d", got, tt.wantPruned)
+			}
+			_, err := dynamicClient.Resource(clusterPoliciesGVR).Get(context.Background(), "dropped", metav1.GetOptions{})
+			if deleted := err != nil; deleted != tt.wantDeleted {
+				t.Errorf("dropped deleted = %v, want %v", deleted, tt.wantDeleted)
+			}
+			_, err = dynamicClient.Resource(validatingPoliciesGVR).Get(context.Background(), "dropped-vpol", metav1.GetOptions{})
+			if deleted := err != nil; deleted != tt.wantDeleted {
+				t.Errorf("dropped-vpol deleted = %v, want %v", deleted, tt.wantDeleted)
+			}
+			for _, name := range []string{"keep", "someone-elses"} {
+				if _, err := dynamicClient.Resource(clusterPoliciesGVR).Get(context.Background(), name, metav1.GetOptions{}); err != nil {
+					t.Errorf("%s should not be deleted: %v", name, err)
+				}
+			}
+
+			obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace("default").Get(context.Background(), "security", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get artifact: %v", err)
+			}
+			var artifact kyvernov1alpha1.KyvernoArtifact
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &artifact); err != nil {
+				t.Fatalf("failed to convert artifact: %v", err)
+			}
+			var stale []string
+			for _, ref := range artifact.Status.StaleObjects {
+				stale = append(stale, ref.Name)
+			}
+			if strings.Join(stale, ",") != strings.Join(tt.wantStale, ",") {
+				t.Errorf("StaleObjects = %v, want %v", stale, tt.wantStale)
+			}
+		})
+	}
+}
+
+func TestHandleStaleObjects_SameNameInAnotherNamespace(t *testing.T) {
+	ours := map[string]interface{}{"managed-by": "kyverno-watcher", "artifact-name": "security", "artifact-namespace": "default"}
+	theirs := map[string]interface{}{"managed-by": "kyverno-watcher", "artifact-name": "security", "artifact-namespace": "team-b"}
+	dynamicClient, mapper := newFakePolicyClients(
+		newClusterPolicy("dropped", ours, map[string]interface{}{}),
+		newClusterPolicy("team-b-policy", theirs, map[string]interface{}{}),
+		newTestArtifact("security", "default"),
+		newTestArtifact("security", "team-b"),
+	)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "keep.yaml")
+	if err := os.WriteFile(file, []byte("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: keep\nspec: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{ArtifactName: "security", PodNamespace: "default", Prune: true}
+	results := handleStaleObjects(config, dynamicClient, mapper, []string{file})
+
+	if got := int(summarizeResults(results).Pruned); got != 1 {
+		t.Errorf("pruned = %d, want 1", got)
+	}
+	if _, err := dynamicClient.Resource(clusterPoliciesGVR).Get(context.Background(), "dropped", metav1.GetOptions{}); err == nil {
+		t.Error("dropped should be pruned")
+	}
+	if _, err := dynamicClient.Resource(clusterPoliciesGVR).Get(context.Background(), "team-b-policy", metav1.GetOptions{}); err != nil {
+		t.Errorf("the policy of the artifact in team-b should not be pruned: %v", err)
+	}
+}
@@ -0,0 +1,275 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"github.com/OctoKode/kyverno-artifact-operator/internal/k8s"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// revisionChanges counts how a revision changes the policies applied by this artifact.
+type revisionChanges struct {
+	Current int // Policies in the cluster labeled with this artifact
+	Desired int // Policies the revision ships
+	Added   int
+	Changed int
+	Removed int
+}
+
+// diffRevision compares the policies defined by files with the ones labeled with this artifact in the cluster.
+// A policy counts as changed when its policy-checksum label differs.
+func diffRevision(config *Config, dynamicClient dynamic.Interface, mapper meta.RESTMapper, files []string) (revisionChanges, error) {
+	var changes revisionChanges
+	desired, err := desiredObjects(files, mapper)
+	if err != nil {
+		return changes, err
+	}
+
+	ctx := context.Background()
+	resources, err := k8s.ManagedResources(mapper)
+	if err != nil {
+		return changes, err
+	}
+	for _, resource := range resources {
+		gvr := resource.GVR
+		want := desired[gvr.GroupResource()]
+		changes.Desired += len(want)
+
+		list, err := listArtifactObjects(ctx, config, dynamicClient, gvr)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				changes.Added += len(want)
+				continue
+			}
+			return changes, fmt.Errorf("failed to list %s: %w", gvr.Resource, err)
+		}
+
+		current := make(map[string]bool, len(list.Items))
+		for _, item := range list.Items {
+			key := objectKey(item.GetNamespace(), item.GetName())
+			current[key] = true
+			checksum, ok := want[key]
+			switch {
+			case !ok:
+				changes.Removed++
+			case checksum != item.GetLabels()["policy-checksum"]:
+				changes.Changed++
+			}
+		}
+		changes.Current += len(current)
+		for key := range want {
+			if !current[key] {
+				changes.Added++
+			}
+		}
+	}
+	return changes, nil
+}
+
+// clusterChanges is how a revision changes the policies of one of the clusters it is applied to.
+type clusterChanges struct {
+	cluster cluster
+	changes revisionChanges
+}
+
+// diffAppliedClusters compares the policies defined by files with the ones labeled with this artifact in every
+// cluster it is applied to: each target with spec.targets, the local cluster otherwise.
+func diffAppliedClusters(config *Config, localClient dynamic.Interface, localMapper meta.RESTMapper, files []string) ([]clusterChanges, error) {
+	clusters, err := appliedClusters(config, localClient, localMapper)
+	if err != nil {
+		return nil, err
+	}
+	diffs := make([]clusterChanges, 0, len(clusters))
+	for _, c := range clusters {
+		changes, err := diffRevision(config, c.dynamicClient, c.mapper, files)
+		if err != nil {
+			if c.name != "" {
+				err = fmt.Errorf("cluster %s: %w", c.name, err)
+			}
+			return nil, err
+		}
+		diffs = append(diffs, clusterChanges{cluster: c, changes: changes})
+	}
+	return diffs, nil
+}
+
+// totalChanges adds up the changes of a revision over the clusters it is applied to.
+func totalChanges(diffs []clusterChanges) revisionChanges {
+	var total revisionChanges
+	for _, d := range diffs {
+		total.Current += d.changes.Current
+		total.Desired += d.changes.Desired
+		total.Added += d.changes.Added
+		total.Changed += d.changes.Changed
+		total.Removed += d.changes.Removed
+	}
+	return total
+}
+
+// limitBreaches describes every safety limit that changes exceed.
+func limitBreaches(limits *kyvernov1alpha1.SafetyLimits, changes revisionChanges) []string {
+	var breaches []string
+	if limits.MaxRemoved != nil && changes.Removed > int(*limits.MaxRemoved) {
+		breaches = append(breaches, fmt.Sprintf("removes %d policies, more than maxRemoved %d", changes.Removed, *limits.MaxRemoved))
+	}
+	if limits.MaxChangedPercent != nil && changes.Current > 0 {
+		changed := changes.Added + changes.Changed + changes.Removed
+		if changed*100 > int(*limits.MaxChangedPercent)*changes.Current {
+			breaches = append(breaches, fmt.Sprintf("changes %d of %d policies (%d%%), more than maxChangedPercent %d%%",
+				changed, changes.Current, changed*100/changes.Current, *limits.MaxChangedPercent))
+		}
+	}
+	if limits.MinPolicies != nil && changes.Desired < int(*limits.MinPolicies) {
+		breaches = append(breaches, fmt.Sprintf("ships %d policies, fewer than minPolicies %d", changes.Desired, *limits.MinPolicies))
+	}
+	return breaches
+}
+
+// revisionApproved reports whether the KyvernoArtifact is annotated to apply the revision with the given digest
+// despite the safety limits. Like with manual approval, the tag only approves a revision that has not been applied
+// yet: once it was applied, content pushed to the same tag later is only approved by its digest.
+func revisionApproved(config *Config, dynamicClient dynamic.Interface, revision, digest string) (bool, error) {
+	if config.ArtifactName == "" || config.PodNamespace == "" {
+		return false, nil
+	}
+	obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace(config.PodNamespace).Get(context.Background(), config.ArtifactName, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to get KyvernoArtifact %s/%s: %w", config.PodNamespace, config.ArtifactName, err)
+	}
+	approval := obj.GetAnnotations()[kyvernov1alpha1.ApproveRevisionAnnotation]
+	if approval == "" {
+		return false, nil
+	}
+	if approval == digest {
+		return true, nil
+	}
+	applied, _, _ := unstructured.NestedString(obj.Object, "status", "appliedVersion")
+	return approval == revision && revision != applied, nil
+}
+
+// checkedDigestPath returns the location of the file remembering the digest of the last revision that passed the
+// safety limits. It lives next to the last_seen file.
+func checkedDigestPath(config *Config) string {
+	return filepath.Join(filepath.Dir(config.LastFile), "checked_digest")
+}
+
+// saveCheckedDigest remembers that the revision staged in destDir passed the safety limits.
+func saveCheckedDigest(config *Config, destDir string) {
+	if config.LastFile == "" {
+		return
+	}
+	digest, err := stagedDigest(destDir)
+	if err == nil {
+		err = os.WriteFile(checkedDigestPath(config), []byte(digest), 0644)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to record the checked digest: %v\n", err)
+	}
+}
+
+// revisionContentChanged reports whether the revision staged in destDir differs from the last one that passed the
+// safety limits, such as a mutable tag that was overwritten. Correcting drift of an unchanged revision is not
+// subject to the limits, since manual edits of many policies would otherwise block their repair. Without a record,
+// e.g. after the watcher restarted, the revision counts as unchanged when it is the applied version in the status.
+func revisionContentChanged(config *Config, dynamicClient dynamic.Interface, destDir, revision string) bool {
+	if config.SafetyLimits == nil || dynamicClient == nil {
+		return false
+	}
+	digest, err := stagedDigest(destDir)
+	if err != nil {
+		return true
+	}
+	if config.LastFile != "" {
+		if previous, err := os.ReadFile(checkedDigestPath(config)); err == nil {
+			return string(previous) != digest
+		}
+	}
+	if config.ArtifactName == "" || config.PodNamespace == "" {
+		return true
+	}
+	obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace(config.PodNamespace).Get(context.Background(), config.ArtifactName, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Warning: failed to get KyvernoArtifact %s/%s: %v\n", config.PodNamespace, config.ArtifactName, err)
+		return true
+	}
+	if applied, _, _ := unstructured.NestedString(obj.Object, "status", "appliedVersion"); applied != revision {
+		return true
+	}
+	saveCheckedDigest(config, destDir)
+	return false
+}
+
+// checkSafetyLimits reports whether the revision prepared in destDir must be held back because it exceeds the
+// safety limits and has not been approved, and records the outcome in the Blocked condition. When the changes
+// cannot be determined the revision is held back as well, since the limits cannot be verified.
+func checkSafetyLimits(config *Config, dynamicClient dynamic.Interface, mapper meta.RESTMapper, destDir, revision string) bool {
+	if config.SafetyLimits == nil || dynamicClient == nil {
+		return false
+	}
+
+	blocked, reason, message := false, "WithinLimits", fmt.Sprintf("Revision %s is within the safety limits", revision)
+
+	// With targets, every target has to be within the limits.
+	digest, err := stagedDigest(destDir)
+	var breaches []string
+	if err == nil {
+		var files []string
+		var diffs []clusterChanges
+		if files, err = findYAMLFiles(destDir); err == nil {
+			diffs, err = diffAppliedClusters(config, dynamicClient, mapper, files)
+		}
+		for _, d := range diffs {
+			for _, breach := range limitBreaches(config.SafetyLimits, d.changes) {
+				breaches = append(breaches, d.cluster.describe(breach))
+			}
+		}
+	}
+	if err != nil {
+		blocked, reason = true, "LimitCheckFailed"
+		message = fmt.Sprintf("Revision %s is held back, the safety limits could not be checked: %v", revision, err)
+	} else if len(breaches) > 0 {
+		approved, err := revisionApproved(config, dynamicClient, revision, digest)
+		if err != nil {
+			log.Printf("Warning: failed to check approval of revision %s: %v\n", revision, err)
+		}
+		if approved {
+			reason = "Approved"
+			message = fmt.Sprintf("Revision %s (%s) exceeds the safety limits but was approved: %s",
+				revision, digest, strings.Join(breaches, ", "))
+		} else {
+			blocked, reason = true, "LimitExceeded"
+			message = fmt.Sprintf("Revision %s (%s) exceeds the safety limits: %s. Annotate the KyvernoArtifact with %s=%s to apply it",
+				revision, digest, strings.Join(breaches, ", "), kyvernov1alpha1.ApproveRevisionAnnotation, digest)
+		}
+	}
+	log.Println(message)
+
+	status := metav1.ConditionFalse
+	if blocked {
+		status = metav1.ConditionTrue
+	} else {
+		saveCheckedDigest(config, destDir)
+	}
+	err = updateArtifactStatusFunc(config, dynamicClient, func(s *kyvernov1alpha1.KyvernoArtifactStatus) {
+		meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+			Type:    kyvernov1alpha1.ConditionBlocked,
+			Status:  status,
+			Reason:  reason,
+			Message: message,
+		})
+	})
+	if err != nil {
+		log.Printf("Warning: failed to update KyvernoArtifact status: %v\n", err)
+	}
+	return blocked
+}
@@ -0,0 +1,350 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+func ptrInt32(i int32) *int32    { return &i }
+func ptrString(s string) *string { return &s }
+
+func TestLimitBreaches(t *testing.T) {
+	limits := &kyvernov1alpha1.SafetyLimits{
+		MaxRemoved:        ptrInt32(2),
+		MaxChangedPercent: ptrInt32(50),
+		MinPolicies:       ptrInt32(5),
+	}
+
+	tests := []struct {
+		name    string
+		changes revisionChanges
+		want    []string
+	}{
+		{
+			name:    "within limits",
+			changes: revisionChanges{Current: 10, Desired: 10, Changed: 3, Added: 1, Removed: 1},
+		},
+		{
+			name:    "exactly at the limits",
+			changes: revisionChanges{Current: 10, Desired: 8, Changed: 3, Removed: 2},
+		},
+		{
+			name:    "too many removed",
+			changes: revisionChanges{Current: 10, Desired: 7, Removed: 3},
+			want:    []string{"removes 3 policies"},
+		},
+		{
+			name:    "too many changed",
+			changes: revisionChanges{Current: 10, Desired: 10, Changed: 6},
+			want:    []string{"changes 6 of 10 policies (60%)"},
+		},
+		{
+			name:    "near-empty artifact breaches every limit",
+			changes: revisionChanges{Current: 10, Desired: 1, Removed: 9},
+			want:    []string{"removes 9 policies", "changes 9 of 10 policies", "ships 1 policies"},
+		},
+		{
+			name:    "first install only checks the minimum",
+			changes: revisionChanges{Current: 0, Desired: 12, Added: 12},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := limitBreaches(limits, tt.changes)
+			if len(got) != len(tt.want) {
+				t.Fatalf("limitBreaches() = %v, want %d breach(es)", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(got[i], want) {
+					t.Errorf("breach %d = %q, want prefix %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+// newManagedPolicy returns a ClusterPolicy labeled as applied by artifact with the given checksum.
+func newManagedPolicy(name, artifact, checksum string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "kyverno.io/v1",
+		"kind":       "ClusterPolicy",
+		"metadata": map[string]interface{}{
+			"name":   name,
+			"labels": map[string]interface{}{"artifact-name": artifact, "policy-checksum": checksum},
+		},
+	}}
+}
+
+// writeManagedPolicies writes one prepared ClusterPolicy manifest per name into dir.
+func writeManagedPolicies(t *testing.T, dir, artifact, checksum string, names ...string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		manifest := fmt.Sprintf("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: %s\n"+
+			"  labels:\n    artifact-name: %s\n    policy-checksum: %s\n", name, artifact, checksum)
+		if err := os.WriteFile(filepath.Join(dir, name+".yaml"), []byte(manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckSafetyLimits(t *testing.T) {
+	config := &Config{
+		ArtifactName: "vendor",
+		PodNamespace: "default",
+		SafetyLimits: &kyvernov1alpha1.SafetyLimits{MaxRemoved: ptrInt32(1)},
+	}
+
+	tests := []struct {
+		name        string
+		ships       []string
+		approval    string
+		applied     string
+		wantBlocked bool
+		wantReason  string
+	}{
+		{
+			name:       "within limits",
+			ships:      []string{"a", "b", "c"},
+			wantReason: "WithinLimits",
+		},
+		{
+			name:        "limit exceeded",
+			ships:       []string{"a"},
+			wantBlocked: true,
+			wantReason:  "LimitExceeded",
+		},
+		{
+			name:        "approval of another revision does not count",
+			ships:       []string{"a"},
+			approval:    "v1",
+			wantBlocked: true,
+			wantReason:  "LimitExceeded",
+		},
+		{
+			name:       "approved",
+			ships:      []string{"a"},
+			approval:   "v2",
+			wantReason: "Approved",
+		},
+		{
+			name:       "approved by digest",
+			ships:      []string{"a"},
+			approval:   "digest",
+			applied:    "v2",
+			wantReason: "Approved",
+		},
+		{
+			name:        "approval of an applied tag does not cover content pushed to it later",
+			ships:       []string{"a"},
+			approval:    "v2",
+			applied:     "v2",
+			wantBlocked: true,
+			wantReason:  "LimitExceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destDir := t.TempDir()
+			writeManagedPolicies(t, destDir, "vendor", "1", tt.ships...)
+			digest, err := stagedDigest(destDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			artifact := newTestArtifact(config.ArtifactName, config.PodNamespace)
+			approval := tt.approval
+			if approval == "digest" {
+				approval = digest
+			}
+			if approval != "" {
+				artifact.SetAnnotations(map[string]string{kyvernov1alpha1.ApproveRevisionAnnotation: approval})
+			}
+			if tt.applied != "" {
+				if err := unstructured.SetNestedField(artifact.Object, tt.applied, "status", "appliedVersion"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dynamicClient, mapper := newFakePolicyClients(
+				artifact,
+				newManagedPolicy("a", "vendor", "1"),
+				newManagedPolicy("b", "vendor", "1"),
+				newManagedPolicy("c", "vendor", "1"),
+			)
+
+			if blocked := checkSafetyLimits(config, dynamicClient, mapper, destDir, "v2"); blocked != tt.wantBlocked {
+				t.Errorf("checkSafetyLimits() = %v, want %v", blocked, tt.wantBlocked)
+			}
+
+			obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace(config.PodNamespace).Get(context.Background(), config.ArtifactName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got kyvernov1alpha1.KyvernoArtifact
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &got); err != nil {
+				t.Fatal(err)
+			}
+			condition := meta.FindStatusCondition(got.Status.Conditions, kyvernov1alpha1.ConditionBlocked)
+			if condition == nil || condition.Reason != tt.wantReason || (condition.Status == metav1.ConditionTrue) != tt.wantBlocked {
+				t.Errorf("Blocked condition = %+v, want reason %s", condition, tt.wantReason)
+			}
+			if tt.wantBlocked && !strings.Contains(condition.Message, kyvernov1alpha1.ApproveRevisionAnnotation+"="+digest) {
+				t.Errorf("Blocked message %q should explain how to approve", condition.Message)
+			}
+		})
+	}
+}
+
+func TestWatchLoop_BlockedRevisionIsNotApplied(t *testing.T) {
+	artifact := newTestArtifact("vendor", "default")
+	dynamicClient, mapper := newFakePolicyClients(
+		artifact,
+		newManagedPolicy("a", "vendor", "1"),
+		newManagedPolicy("b", "vendor", "1"),
+		newManagedPolicy("c", "vendor", "1"),
+	)
+
+	originalGetK8sClients := getKubernetesClientsFunc
+	getKubernetesClientsFunc = func() (dynamic.Interface, meta.RESTMapper, error) { return dynamicClient, mapper, nil }
+	defer func() { getKubernetesClientsFunc = originalGetK8sClients }()
+
+	originalTagChangedFunc := tagChangedFunc
+	tagChangedFunc = func(config *Config) (bool, string, string, error) {
+		prev, _ := os.ReadFile(config.LastFile)
+		return string(prev) != "v2", "v2", string(prev), nil
+	}
+	defer func() { tagChangedFunc = originalTagChangedFunc }()
+
+	originalPullImageToDirFunc := pullImageToDirFunc
+	pullImageToDirFunc = func(config *Config, tag, destDir string) (map[string]string, error) {
+		_ = os.RemoveAll(destDir)
+		writeManagedPolicies(t, destDir, "vendor", "1", "a")
+		return map[string]string{filepath.Join(destDir, "a.yaml"): "1"}, nil
+	}
+	defer func() { pullImageToDirFunc = originalPullImageToDirFunc }()
+	defer func() { _ = os.RemoveAll("/tmp/image-v2") }()
+
+	applied := false
+	originalApplyManifestsFunc := applyManifestsFunc
+	applyManifestsFunc = func(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) ([]ApplyResult, error) {
+		applied = true
+		return nil, nil
+	}
+	defer func() { applyManifestsFunc = originalApplyManifestsFunc }()
+
+	config := &Config{
+		PollForTagChanges: true,
+		StateDir:          t.TempDir(),
+		ArtifactName:      "vendor",
+		PodNamespace:      "default",
+		SafetyLimits:      &kyvernov1alpha1.SafetyLimits{MinPolicies: ptrInt32(2)},
+	}
+	config.LastFile = filepath.Join(config.StateDir, "last_seen")
+
+	if err := watchLoop(config); err != nil {
+		t.Fatalf("watchLoop() error = %v", err)
+	}
+	if applied {
+		t.Fatal("a blocked revision must not be applied")
+	}
+	if _, err := os.Stat(config.LastFile); !os.IsNotExist(err) {
+		t.Fatal("last_seen must not be written for a blocked revision")
+	}
+
+	// Approving the revision lets the next poll apply it.
+	obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace("default").Get(context.Background(), "vendor", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.SetAnnotations(map[string]string{kyvernov1alpha1.ApproveRevisionAnnotation: "v2"})
+	if _, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace("default").Update(context.Background(), obj, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := watchLoop(config); err != nil {
+		t.Fatalf("watchLoop() error = %v", err)
+	}
+	if !applied {
+		t.Error("an approved revision should be applied")
+	}
+}
+
+func TestWatchLoop_DriftCorrectionIsNotLimited(t *testing.T) {
+	artifact := newTestArtifact("vendor", "default")
+	artifact.Object["status"] = map[string]interface{}{"appliedVersion": "v1"}
+	dynamicClient, mapper := newFakePolicyClients(
+		artifact,
+		newManagedPolicy("a", "vendor", "edited"),
+		newManagedPolicy("b", "vendor", "edited"),
+		newManagedPolicy("c", "vendor", "edited"),
+	)
+
+	originalGetK8sClients := getKubernetesClientsFunc
+	getKubernetesClientsFunc = func() (dynamic.Interface, meta.RESTMapper, error) { return dynamicClient, mapper, nil }
+	defer func() { getKubernetesClientsFunc = originalGetK8sClients }()
+
+	checksum := "1"
+	originalPullImageToDirFunc := pullImageToDirFunc
+	pullImageToDirFunc = func(config *Config, tag, destDir string) (map[string]string, error) {
+		_ = os.RemoveAll(destDir)
+		writeManagedPolicies(t, destDir, "vendor", checksum, "a", "b", "c")
+		return map[string]string{filepath.Join(destDir, "a.yaml"): checksum}, nil
+	}
+	defer func() { pullImageToDirFunc = originalPullImageToDirFunc }()
+
+	originalChecksumsChanged := checksumsChangedFunc
+	checksumsChangedFunc = func(newChecksums map[string]string, dynamicClient dynamic.Interface, mapper meta.RESTMapper) (bool, []string, error) {
+		return true, []string{"a.yaml"}, nil
+	}
+	defer func() { checksumsChangedFunc = originalChecksumsChanged }()
+
+	applied := false
+	originalApplyManifestsFunc := applyManifestsFunc
+	applyManifestsFunc = func(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) ([]ApplyResult, error) {
+		applied = true
+		return nil, nil
+	}
+	defer func() { applyManifestsFunc = originalApplyManifestsFunc }()
+
+	config := &Config{
+		ImageBase:                     "ghcr.io/owner/policies:v1",
+		ReconcilePoliciesFromChecksum: true,
+		StateDir:                      t.TempDir(),
+		PullDir:                       t.TempDir(),
+		ArtifactName:                  "vendor",
+		PodNamespace:                  "default",
+		SafetyLimits:                  &kyvernov1alpha1.SafetyLimits{MaxChangedPercent: ptrInt32(10)},
+	}
+	config.LastFile = filepath.Join(config.StateDir, "last_seen")
+
+	// Every policy was edited by hand. Repairing them restores the applied revision, which the limits do not cover.
+	if err := watchLoop(config); err != nil {
+		t.Fatalf("watchLoop() error = %v", err)
+	}
+	if !applied {
+		t.Fatal("drift of the applied revision should be corrected despite the safety limits")
+	}
+
+	// The tag was overwritten with different content, which is a new revision subject to the limits.
+	applied, checksum = false, "2"
+	if err := watchLoop(config); err != nil {
+		t.Fatalf("watchLoop() error = %v", err)
+	}
+	if applied {
+		t.Error("an overwritten tag exceeding the safety limits must not be applied")
+	}
+}
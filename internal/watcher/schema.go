@@ -1,19 +1,29 @@
 package watcher
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
 	ProviderGitHub      = "github"
 	ProviderArtifactory = "artifactory"
+
+	// defaultApplyConcurrency is how many manifest files are applied in parallel unless WATCHER_APPLY_CONCURRENCY says otherwise.
+	defaultApplyConcurrency = 4
 )
 
+// reservedLabels are set by the watcher on every applied object and cannot be overridden by common labels.
+var reservedLabels = []string{"managed-by", "policy-version", "artifact-name", "artifact-namespace", "policy-checksum"}
+
 var (
 	// logFatal can be overridden in tests
 	logFatal = func(v ...interface{}) {
@@ -52,11 +62,60 @@ type Config struct {
 	Provider                      string
 	Username                      string
 	Password                      string
-	ArtifactName                  string // Name of the KyvernoArtifact resource that owns this watcher
-	DeletePoliciesOnTermination   bool   // Whether to delete policies on termination
-	ReconcilePoliciesFromChecksum bool   // Whether to reconcile policies based on checksums
-	WatcherImage                  string // WatcherImage is the full container image string for the watcher itself, used by the self-reconciliation logic to check if it's running the latest version.
-	PodNamespace                  string // PodNamespace is the Kubernetes namespace where this watcher pod is currently running, used by the self-reconciliation logic to discover other watcher pods.
+	ArtifactName                  string                                // Name of the KyvernoArtifact resource that owns this watcher
+	DeletePoliciesOnTermination   bool                                  // Whether to delete policies on termination
+	ReconcilePoliciesFromChecksum bool                                  // Whether to reconcile policies based on checksums
+	WatcherImage                  string                                // WatcherImage is the full container image string for the watcher itself, used by the self-reconciliation logic to check if it's running the latest version.
+	PodNamespace                  string                                // PodNamespace is the Kubernetes namespace where this watcher pod is currently running, used by the self-reconciliation logic to discover other watcher pods.
+	ApplyConcurrency              int                                   // Number of manifest files applied in parallel
+	NamePrefix                    string                                // Prepended to metadata.name of every applied object
+	NameSuffix                    string                                // Appended to metadata.name of every applied object
+	CommonLabels                  map[string]string                     // Labels added to every applied object
+	CommonAnnotations             map[string]string                     // Annotations added to every applied object
+	Include                       []kyvernov1alpha1.ObjectFilter        // Objects of the artifact to apply; all when empty
+	Exclude                       []kyvernov1alpha1.ObjectFilter        // Objects of the artifact to skip
+	Prune                         bool                                  // Whether to delete objects the artifact no longer ships
+	Substitute                    map[string]string                     // Literal ${VAR} substitution variables
+	SubstituteFrom                []kyvernov1alpha1.SubstituteReference // ConfigMaps and Secrets holding substitution variables
+	SubstituteStrict              bool                                  // Whether an undefined variable fails the revision
+	KustomizePath                 string                                // Directory of the kustomization to build, relative to the artifact root
+	ArtifactType                  string                                // oci-image, or helm-chart for a Helm chart that is rendered before it is applied
+	Helm                          *kyvernov1alpha1.HelmSpec             // Release name and values a Helm chart is rendered with
+	Patches                       []kyvernov1alpha1.Patch               // Patches applied to matching objects before they are applied
+	GlobalExcludeFilters          []interface{}                         // Kyverno resource filters added to exclude.any of every rule
+	SafetyLimits                  *kyvernov1alpha1.SafetyLimits         // Limits on how much a revision may change without approval
+	SmokeTests                    *kyvernov1alpha1.SmokeTests           // What to do when a smoke test of an applied revision fails
+	NamespaceSelector             string                                // Label selector of the namespaces namespaced objects are stamped into; empty disables the fan-out
+	Adoption                      string                                // How objects that exist without being managed are treated: never, ifIdentical or always
+	Targets                       []kyvernov1alpha1.ClusterTarget       // Remote clusters to apply to instead of the local one
+	Approval                      string                                // Whether new revisions are applied right away (auto) or wait for approval (manual)
+	SyncWindows                   *kyvernov1alpha1.SyncWindows          // When new revisions, drift correction and deletion may happen
+	PullDir                       string                                // Directory revisions are pulled into; /tmp when empty
+	LeaseName                     string                                // Lease the replicas of the watcher elect the active one through; no election when empty
+	Identity                      string                                // Identity of this replica in the lease election
+}
+
+// ApplyResult records what happened to a single object when a manifest file was applied.
+type ApplyResult struct {
+	File       string
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	Outcome    kyvernov1alpha1.ApplyOutcome
+	Reason     string
+	Owner      string // Artifact that already manages the object, set when Outcome is Conflict
+	// OwnerNamespace is the namespace of Owner, empty when the object does not record it
+	OwnerNamespace string
+}
+
+// retryState is persisted next to the last_seen file when a revision could not be fully applied.
+// It remembers which files still need to be applied and when the next attempt is due.
+type retryState struct {
+	Revision    string    `json:"revision"`
+	Files       []string  `json:"files"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
 }
 
 type GitHubPackageVersion struct {
@@ -69,22 +128,44 @@ type GitHubPackageVersion struct {
 	} `json:"metadata"`
 }
 
+// loadConfig reads the configuration of the watcher pod from its environment variables and exits when it is
+// invalid.
 func loadConfig() *Config {
-	provider := strings.ToLower(getEnvOrDefault("PROVIDER", ProviderGitHub))
+	config, err := NewConfig(getEnvFunc, stateDirBase)
+	if err != nil {
+		logFatal(err.Error())
+	}
+	if config.Provider == ProviderGitHub {
+		// Log token prefix for debugging (don't log full token)
+		tokenPrefix := config.GithubToken
+		if len(tokenPrefix) > 10 {
+			tokenPrefix = tokenPrefix[:10] + "..."
+		}
+		log.Printf("Using GitHub token: %s (length: %d)\n", tokenPrefix, len(config.GithubToken))
+	} else {
+		log.Printf("Using Artifactory with username: %s\n", config.Username)
+	}
+	return config
+}
+
+// NewConfig builds the configuration of a watcher from the variables returned by getenv, which are the
+// environment variables the operator sets on watcher pods, keeping its state in stateDir.
+func NewConfig(getenv func(string) string, stateDir string) (*Config, error) {
+	provider := strings.ToLower(getEnvOrDefault(getenv, "PROVIDER", ProviderGitHub))
 
 	var githubToken, username, password string
 	var owner, packageName string
 
-	imageBase := getEnvFunc("IMAGE_BASE")
+	imageBase := getenv("IMAGE_BASE")
 	if imageBase == "" {
-		logFatal("IMAGE_BASE environment variable must be set (e.g., ghcr.io/owner/package)")
+		return nil, fmt.Errorf("IMAGE_BASE environment variable must be set (e.g., ghcr.io/owner/package)")
 	}
 
 	switch provider {
 	case ProviderGitHub:
-		githubToken = strings.TrimSpace(getEnvFunc("GITHUB_TOKEN"))
+		githubToken = strings.TrimSpace(getenv("GITHUB_TOKEN"))
 		if githubToken == "" {
-			logFatal("GITHUB_TOKEN environment variable must be set")
+			return nil, fmt.Errorf("GITHUB_TOKEN environment variable must be set")
 		}
 
 		// Validate token format - GitHub tokens should only contain alphanumeric and underscores
@@ -98,61 +179,180 @@ func loadConfig() *Config {
 		}, githubToken)
 
 		if githubToken == "" {
-			logFatal("GITHUB_TOKEN contains only invalid characters")
+			return nil, fmt.Errorf("GITHUB_TOKEN contains only invalid characters")
 		}
 
-		// Log token prefix for debugging (don't log full token)
-		tokenPrefix := githubToken
-		if len(tokenPrefix) > 10 {
-			tokenPrefix = tokenPrefix[:10] + "..."
-		}
-		log.Printf("Using GitHub token: %s (length: %d)\n", tokenPrefix, len(githubToken))
-
 		// Parse IMAGE_BASE to extract owner and package
 		// Expected format: ghcr.io/owner/package or ghcr.io/owner/package:tag
 		var err error
 		owner, packageName, err = parseImageBase(imageBase)
 		if err != nil {
-			logFatal(fmt.Sprintf("Failed to parse IMAGE_BASE: %v", err))
+			return nil, fmt.Errorf("failed to parse IMAGE_BASE: %v", err)
 		}
 	case ProviderArtifactory:
-		username = strings.TrimSpace(getEnvFunc("ARTIFACTORY_USERNAME"))
-		password = strings.TrimSpace(getEnvFunc("ARTIFACTORY_PASSWORD"))
+		username = strings.TrimSpace(getenv("ARTIFACTORY_USERNAME"))
+		password = strings.TrimSpace(getenv("ARTIFACTORY_PASSWORD"))
 		if username == "" || password == "" {
-			logFatal("ARTIFACTORY_USERNAME and ARTIFACTORY_PASSWORD environment variables must be set for artifactory provider")
+			return nil, fmt.Errorf("ARTIFACTORY_USERNAME and ARTIFACTORY_PASSWORD environment variables must be set for artifactory provider")
 		}
-		log.Printf("Using Artifactory with username: %s\n", username)
 	default:
-		logFatal(fmt.Sprintf("Unsupported PROVIDER: %s (must be 'github' or 'artifactory')", provider))
+		return nil, fmt.Errorf("unsupported PROVIDER: %s (must be 'github' or 'artifactory')", provider)
+	}
+
+	pollInterval := getEnvAsIntOrDefault(getenv, "POLL_INTERVAL", 30)
+	pollForTagChanges := getEnvAsBoolOrDefault(getenv, "WATCHER_POLL_FOR_TAG_CHANGES_ENABLED", true)
+	githubAPIOwnerType := getEnvOrDefault(getenv, "GITHUB_API_OWNER_TYPE", "users")
+	deletePoliciesOnTermination := getEnvAsBoolOrDefault(getenv, "WATCHER_DELETE_POLICIES_ON_TERMINATION", false)
+	reconcilePoliciesFromChecksum := getEnvAsBoolOrDefault(getenv, "WATCHER_CHECKSUM_RECONCILIATION_ENABLED", false)
+	applyConcurrency := getEnvAsIntOrDefault(getenv, "WATCHER_APPLY_CONCURRENCY", defaultApplyConcurrency)
+	if applyConcurrency < 1 {
+		applyConcurrency = 1
 	}
+	namePrefix := getenv("WATCHER_NAME_PREFIX")
+	nameSuffix := getenv("WATCHER_NAME_SUFFIX")
+	prune := getEnvAsBoolOrDefault(getenv, "WATCHER_PRUNE", false)
+	substituteStrict := getEnvAsBoolOrDefault(getenv, "WATCHER_SUBSTITUTE_STRICT", false)
 
-	pollInterval := getEnvAsIntOrDefault("POLL_INTERVAL", 30)
-	pollForTagChanges := getEnvAsBoolOrDefault("WATCHER_POLL_FOR_TAG_CHANGES_ENABLED", true)
-	githubAPIOwnerType := getEnvOrDefault("GITHUB_API_OWNER_TYPE", "users")
-	deletePoliciesOnTermination := getEnvAsBoolOrDefault("WATCHER_DELETE_POLICIES_ON_TERMINATION", false)
-	reconcilePoliciesFromChecksum := getEnvAsBoolOrDefault("WATCHER_CHECKSUM_RECONCILIATION_ENABLED", false)
+	// Structured spec fields are passed by the operator as JSON
+	var commonLabels, commonAnnotations, substitute map[string]string
+	var include, exclude []kyvernov1alpha1.ObjectFilter
+	var substituteFrom []kyvernov1alpha1.SubstituteReference
+	var kustomize kyvernov1alpha1.KustomizeSpec
+	var helm *kyvernov1alpha1.HelmSpec
+	var patches []kyvernov1alpha1.Patch
+	var globalExclude *kyvernov1alpha1.GlobalExclude
+	var safetyLimits *kyvernov1alpha1.SafetyLimits
+	var smokeTests *kyvernov1alpha1.SmokeTests
+	var targets []kyvernov1alpha1.ClusterTarget
+	var namespaceLabelSelector *metav1.LabelSelector
+	var syncWindows *kyvernov1alpha1.SyncWindows
+	adoption := kyvernov1alpha1.AdoptionAlways
+	approval := kyvernov1alpha1.ApprovalAuto
+	for key, v := range map[string]interface{}{
+		"WATCHER_COMMON_LABELS":      &commonLabels,
+		"WATCHER_COMMON_ANNOTATIONS": &commonAnnotations,
+		"WATCHER_INCLUDE":            &include,
+		"WATCHER_EXCLUDE":            &exclude,
+		"WATCHER_SUBSTITUTE":         &substitute,
+		"WATCHER_SUBSTITUTE_FROM":    &substituteFrom,
+		"WATCHER_KUSTOMIZE":          &kustomize,
+		"WATCHER_HELM":               &helm,
+		"WATCHER_PATCHES":            &patches,
+		"WATCHER_GLOBAL_EXCLUDE":     &globalExclude,
+		"WATCHER_SAFETY_LIMITS":      &safetyLimits,
+		"WATCHER_SMOKE_TESTS":        &smokeTests,
+		"WATCHER_TARGETS":            &targets,
+		"WATCHER_NAMESPACE_SELECTOR": &namespaceLabelSelector,
+		"WATCHER_ADOPTION":           &adoption,
+		"WATCHER_APPROVAL":           &approval,
+		"WATCHER_SYNC_WINDOWS":       &syncWindows,
+	} {
+		if err := getEnvAsJSON(getenv, key, v); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, filter := range append(append([]kyvernov1alpha1.ObjectFilter{}, include...), exclude...) {
+		if err := validateFilter(filter); err != nil {
+			return nil, fmt.Errorf("invalid include/exclude filter: %v", err)
+		}
+	}
+	if kustomize.Path != "" && !filepath.IsLocal(kustomize.Path) {
+		return nil, fmt.Errorf("invalid kustomize path %q: it must be a relative path inside the artifact", kustomize.Path)
+	}
+	artifactType := getEnvOrDefault(getenv, "WATCHER_ARTIFACT_TYPE", kyvernov1alpha1.ArtifactTypeOCIImage)
+	switch artifactType {
+	case kyvernov1alpha1.ArtifactTypeOCIImage, kyvernov1alpha1.ArtifactTypeHelmChart:
+	case "oci":
+		// Earlier versions of the documentation called plain artifacts oci.
+		artifactType = kyvernov1alpha1.ArtifactTypeOCIImage
+	default:
+		log.Printf("Warning: artifact type %s is not supported, treating the artifact as %s\n", artifactType, kyvernov1alpha1.ArtifactTypeOCIImage)
+		artifactType = kyvernov1alpha1.ArtifactTypeOCIImage
+	}
+	if helm != nil {
+		for i, ref := range helm.ValuesFrom {
+			if ref.Kind != "ConfigMap" && ref.Kind != "Secret" {
+				return nil, fmt.Errorf("invalid helm.valuesFrom %d: kind must be ConfigMap or Secret, got %q", i, ref.Kind)
+			}
+		}
+	}
+	for i, patch := range patches {
+		if err := validatePatch(patch); err != nil {
+			return nil, fmt.Errorf("invalid patch %d: %v", i, err)
+		}
+	}
+	excludeFilters, err := globalExcludeFilters(globalExclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid globalExclude: %v", err)
+	}
+	for i := range targets {
+		if targets[i].KubeconfigSecretRef.Key == "" {
+			targets[i].KubeconfigSecretRef.Key = defaultKubeconfigKey
+		}
+	}
+	if namespaceLabelSelector != nil && len(targets) > 0 {
+		log.Println("Warning: ignoring namespaceSelector, it is not supported with targets")
+		namespaceLabelSelector = nil
+	}
+	if smokeTests != nil && smokeTests.RevertOnFailure && len(targets) > 0 {
+		log.Println("Warning: ignoring smokeTests.revertOnFailure, it is not supported with targets")
+		smokeTests.RevertOnFailure = false
+	}
+	var namespaceSelector string
+	if namespaceLabelSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(namespaceLabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespaceSelector: %v", err)
+		}
+		namespaceSelector = selector.String()
+	}
+	switch adoption {
+	case kyvernov1alpha1.AdoptionNever, kyvernov1alpha1.AdoptionIfIdentical, kyvernov1alpha1.AdoptionAlways:
+	default:
+		return nil, fmt.Errorf("invalid adoption %q: must be never, ifIdentical or always", adoption)
+	}
+	switch approval {
+	case kyvernov1alpha1.ApprovalAuto, kyvernov1alpha1.ApprovalManual:
+	default:
+		return nil, fmt.Errorf("invalid approval %q: must be auto or manual", approval)
+	}
+	if _, err := parseSyncWindows(syncWindows); err != nil {
+		return nil, fmt.Errorf("invalid syncWindows: %v", err)
+	}
+	for _, key := range reservedLabels {
+		if _, ok := commonLabels[key]; ok {
+			log.Printf("Warning: ignoring common label %s, it is reserved for the operator\n", key)
+			delete(commonLabels, key)
+		}
+	}
 	// Retrieve the expected watcher image from environment variable, injected by the operator.
-	watcherImage := getEnvFunc("WATCHER_IMAGE")
+	watcherImage := getenv("WATCHER_IMAGE")
 	// Retrieve the watcher pod's namespace from environment variable, injected via Downward API by the operator.
-	podNamespace := getEnvFunc("POD_NAMESPACE")
+	podNamespace := getenv("POD_NAMESPACE")
 
 	// Get artifact name from pod name (format: kyverno-artifact-manager-{artifactName})
 	// This is used to link policies back to their source KyvernoArtifact for garbage collection
-	artifactName := getEnvFunc("ARTIFACT_NAME")
+	artifactName := getenv("ARTIFACT_NAME")
 	if artifactName == "" {
 		// Try to extract from hostname/pod name as fallback
-		hostname := getEnvFunc("HOSTNAME")
+		hostname := getenv("HOSTNAME")
 		if strings.HasPrefix(hostname, "kyverno-artifact-manager-") {
 			artifactName = strings.TrimPrefix(hostname, "kyverno-artifact-manager-")
 		}
 	}
 
+	// Replicas of the watcher elect the one that polls and applies through a Lease in their namespace
+	leaseName := getenv("WATCHER_LEASE_NAME")
+	if leaseName != "" && podNamespace == "" {
+		return nil, fmt.Errorf("WATCHER_LEASE_NAME requires POD_NAMESPACE")
+	}
+
 	// Normalize package name for API path
 	packageNormalized := strings.ReplaceAll(packageName, "/", "%2F")
 
-	stateDir := stateDirBase
 	if err := os.MkdirAll(stateDir, 0755); err != nil {
-		logFatal(fmt.Sprintf("Failed to create state directory: %v", err))
+		return nil, fmt.Errorf("failed to create state directory: %v", err)
 	}
 	lastFile := filepath.Join(stateDir, "last_seen")
 
@@ -175,11 +375,36 @@ func loadConfig() *Config {
 		ReconcilePoliciesFromChecksum: reconcilePoliciesFromChecksum,
 		WatcherImage:                  watcherImage,
 		PodNamespace:                  podNamespace,
-	}
+		ApplyConcurrency:              applyConcurrency,
+		NamePrefix:                    namePrefix,
+		NameSuffix:                    nameSuffix,
+		CommonLabels:                  commonLabels,
+		CommonAnnotations:             commonAnnotations,
+		Include:                       include,
+		Exclude:                       exclude,
+		Prune:                         prune,
+		Substitute:                    substitute,
+		SubstituteFrom:                substituteFrom,
+		SubstituteStrict:              substituteStrict,
+		KustomizePath:                 kustomize.Path,
+		ArtifactType:                  artifactType,
+		Helm:                          helm,
+		Patches:                       patches,
+		GlobalExcludeFilters:          excludeFilters,
+		SafetyLimits:                  safetyLimits,
+		SmokeTests:                    smokeTests,
+		NamespaceSelector:             namespaceSelector,
+		Adoption:                      adoption,
+		Targets:                       targets,
+		Approval:                      approval,
+		SyncWindows:                   syncWindows,
+		LeaseName:                     leaseName,
+		Identity:                      getenv("HOSTNAME"),
+	}, nil
 }
 
-func getEnvAsBoolOrDefault(key string, defaultValue bool) bool {
-	if value := getEnvFunc(key); value != "" {
+func getEnvAsBoolOrDefault(getenv func(string) string, key string, defaultValue bool) bool {
+	if value := getenv(key); value != "" {
 		switch strings.ToLower(value) {
 		case "t", "true", "1":
 			return true
@@ -213,15 +438,25 @@ func parseImageBase(imageBase string) (owner, packageName string, err error) {
 	return owner, packageName, nil
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := getEnvFunc(key); value != "" {
+func getEnvOrDefault(getenv func(string) string, key, defaultValue string) string {
+	if value := getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
 
-func getEnvAsIntOrDefault(key string, defaultValue int) int {
-	if value := getEnvFunc(key); value != "" {
+// getEnvAsJSON decodes a JSON-encoded environment variable set by the operator into v. An unset variable leaves v untouched.
+func getEnvAsJSON(getenv func(string) string, key string, v interface{}) error {
+	if value := getenv(key); value != "" {
+		if err := json.Unmarshal([]byte(value), v); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func getEnvAsIntOrDefault(getenv func(string) string, key string, defaultValue int) int {
+	if value := getenv(key); value != "" {
 		var intVal int
 		if _, err := fmt.Sscanf(value, "%d", &intVal); err == nil {
 			return intVal
@@ -0,0 +1,398 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// The admission results a smoke test fixture can expect.
+const (
+	smokeTestAllow  = "allow"
+	smokeTestDeny   = "deny"
+	smokeTestMutate = "mutate"
+)
+
+// smokeTestFailure is a fixture that did not get the expected admission result.
+type smokeTestFailure struct {
+	Cluster    string // Name of the target the fixture failed in, empty for the local cluster
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	Err        error
+}
+
+// smokeTestError is returned when one or more smoke tests of an applied revision failed.
+type smokeTestError struct {
+	Failures []smokeTestFailure
+}
+
+// inconclusive reports whether every failed fixture could not be submitted at all, e.g. because the watcher may
+// not create its kind. Such failures say nothing about the revision, so it is not reverted for them.
+func (e *smokeTestError) inconclusive() bool {
+	for _, f := range e.Failures {
+		var inconclusive *inconclusiveSmokeTestError
+		if !stderrors.As(f.Err, &inconclusive) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *smokeTestError) Error() string {
+	messages := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		message := fmt.Sprintf("%s %s: %v", f.Kind, objectKey(f.Namespace, f.Name), f.Err)
+		if f.Cluster != "" {
+			message = fmt.Sprintf("cluster %s: %s", f.Cluster, message)
+		}
+		messages = append(messages, message)
+	}
+	return fmt.Sprintf("%d smoke test(s) failed: %s", len(e.Failures), strings.Join(messages, "; "))
+}
+
+func (e *smokeTestError) objectFailures() []kyvernov1alpha1.ObjectStatus {
+	statuses := make([]kyvernov1alpha1.ObjectStatus, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		reason := fmt.Sprintf("smoke test: %v", f.Err)
+		if f.Cluster != "" {
+			reason = fmt.Sprintf("cluster %s: %s", f.Cluster, reason)
+		}
+		statuses = append(statuses, kyvernov1alpha1.ObjectStatus{
+			APIVersion: f.APIVersion,
+			Kind:       f.Kind,
+			Namespace:  f.Namespace,
+			Name:       f.Name,
+			Outcome:    kyvernov1alpha1.ApplyOutcomeFailed,
+			Reason:     reason,
+		})
+	}
+	return statuses
+}
+
+// inconclusiveSmokeTestError is returned for a fixture the watcher is not allowed to submit.
+type inconclusiveSmokeTestError struct {
+	Err error
+}
+
+func (e *inconclusiveSmokeTestError) Error() string {
+	return fmt.Sprintf("inconclusive, the watcher may not submit the fixture: %v", e.Err)
+}
+
+func (e *inconclusiveSmokeTestError) Unwrap() error {
+	return e.Err
+}
+
+// isSmokeTest reports whether obj is a test fixture rather than an object to apply.
+func isSmokeTest(obj *unstructured.Unstructured) bool {
+	_, ok := obj.GetAnnotations()[kyvernov1alpha1.SmokeTestAnnotation]
+	return ok
+}
+
+// smokeTestDir returns the directory the fixtures of the artifact pulled into destDir are moved to. It lives
+// next to destDir, so that nothing reading the objects to apply from destDir sees the fixtures.
+func smokeTestDir(destDir string) string {
+	return destDir + ".smoke-tests"
+}
+
+// moveSmokeTest writes the fixture read from f, with its variables substituted, to the same relative path in
+// the smoke test directory and removes it from destDir.
+func moveSmokeTest(destDir, f string, data []byte) error {
+	relPath, err := filepath.Rel(destDir, f)
+	if err != nil {
+		relPath = filepath.Base(f)
+	}
+	target := filepath.Join(smokeTestDir(destDir), relPath)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create smoke test directory: %w", err)
+	}
+	if err := os.WriteFile(target, data, 0644); err != nil {
+		return fmt.Errorf("failed to write smoke test %s: %w", relPath, err)
+	}
+	return os.Remove(f)
+}
+
+// runSmokeTests submits every fixture in dir as a server-side dry-run create and compares the admission result
+// with the one the fixture expects. Nothing is persisted. It returns a smokeTestError listing the fixtures that
+// failed.
+func runSmokeTests(config *Config, dynamicClient dynamic.Interface, mapper meta.RESTMapper, dir string) error {
+	files, err := findYAMLFiles(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to list smoke tests: %w", err)
+	}
+
+	var failures []smokeTestFailure
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("failed to read smoke test %s: %w", f, err)
+		}
+		var obj unstructured.Unstructured
+		if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+			return fmt.Errorf("failed to parse smoke test %s: %w", f, err)
+		}
+
+		if err := runSmokeTest(config, dynamicClient, mapper, &obj); err != nil {
+			failures = append(failures, smokeTestFailure{
+				APIVersion: obj.GetAPIVersion(),
+				Kind:       obj.GetKind(),
+				Namespace:  obj.GetNamespace(),
+				Name:       obj.GetName(),
+				Err:        err,
+			})
+			continue
+		}
+		log.Printf("Smoke test %s %s passed\n", obj.GetKind(), objectKey(obj.GetNamespace(), obj.GetName()))
+	}
+
+	if len(failures) > 0 {
+		return &smokeTestError{Failures: failures}
+	}
+	if len(files) > 0 {
+		log.Printf("All %d smoke test(s) passed\n", len(files))
+	}
+	return nil
+}
+
+// runSmokeTestsOnClusters runs the smoke tests in dir against every cluster the artifact is applied to, and
+// returns a smokeTestError listing the fixtures that failed in any of them.
+func runSmokeTestsOnClusters(config *Config, localClient dynamic.Interface, localMapper meta.RESTMapper, dir string) error {
+	if len(config.Targets) == 0 {
+		return runSmokeTests(config, localClient, localMapper, dir)
+	}
+	// Without fixtures, the targets do not have to be reached.
+	files, err := findYAMLFiles(dir)
+	if os.IsNotExist(err) || (err == nil && len(files) == 0) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list smoke tests: %w", err)
+	}
+	clusters, err := appliedClusters(config, localClient, localMapper)
+	if err != nil {
+		return err
+	}
+	var failures []smokeTestFailure
+	for _, c := range clusters {
+		err := runSmokeTests(config, c.dynamicClient, c.mapper, dir)
+		var testErr *smokeTestError
+		switch {
+		case stderrors.As(err, &testErr):
+			for _, f := range testErr.Failures {
+				f.Cluster = c.name
+				failures = append(failures, f)
+			}
+		case err != nil:
+			return fmt.Errorf("cluster %s: %w", c.name, err)
+		}
+	}
+	if len(failures) > 0 {
+		return &smokeTestError{Failures: failures}
+	}
+	return nil
+}
+
+// runSmokeTest dry-run creates a single fixture and checks the admission result. Namespaced fixtures without a
+// namespace are created in the namespace of the KyvernoArtifact.
+func runSmokeTest(config *Config, dynamicClient dynamic.Interface, mapper meta.RESTMapper, obj *unstructured.Unstructured) error {
+	gvk := obj.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return fmt.Errorf("failed to get REST mapping for %s: %w", gvk.String(), err)
+	}
+	var resource dynamic.ResourceInterface = dynamicClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(config.PodNamespace)
+		}
+		resource = dynamicClient.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+	}
+
+	annotations := obj.GetAnnotations()
+	expect := annotations[kyvernov1alpha1.SmokeTestAnnotation]
+	var want map[string]interface{}
+	switch expect {
+	case smokeTestAllow, smokeTestDeny:
+	case smokeTestMutate:
+		if err := yaml.Unmarshal([]byte(annotations[kyvernov1alpha1.SmokeTestExpectAnnotation]), &want); err != nil || len(want) == 0 {
+			return fmt.Errorf("%s must hold the fields expected after mutation", kyvernov1alpha1.SmokeTestExpectAnnotation)
+		}
+	default:
+		return fmt.Errorf("unknown expectation %q, want allow, deny or mutate", expect)
+	}
+
+	result, err := resource.Create(context.Background(), obj, metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+	switch {
+	case err != nil && admissionDenied(err):
+		if expect == smokeTestDeny {
+			return nil
+		}
+		return fmt.Errorf("expected %s, but the request was denied: %v", expect, err)
+	case err != nil && (errors.IsForbidden(err) || errors.IsUnauthorized(err)):
+		return &inconclusiveSmokeTestError{Err: err}
+	case err != nil:
+		return fmt.Errorf("dry-run create failed: %w", err)
+	case expect == smokeTestDeny:
+		return fmt.Errorf("expected deny, but the request was allowed")
+	case expect == smokeTestMutate:
+		var got interface{}
+		data, err := json.Marshal(result.Object)
+		if err == nil {
+			err = json.Unmarshal(data, &got)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read the mutated object: %w", err)
+		}
+		if path, ok := containsFields(got, want, ""); !ok {
+			return fmt.Errorf("expected the mutated object to contain %s", path)
+		}
+	}
+	return nil
+}
+
+// admissionDenied reports whether err is an admission webhook or ValidatingAdmissionPolicy rejecting the request,
+// as opposed to, for example, the watcher lacking the permission to create the object or the object being invalid.
+func admissionDenied(err error) bool {
+	var apiStatus errors.APIStatus
+	if !stderrors.As(err, &apiStatus) {
+		return false
+	}
+	status := apiStatus.Status()
+	// The API server reports a webhook's denial as `admission webhook "<name>" denied the request: <message>`,
+	// with the code the webhook sets, 400 by default.
+	if strings.Contains(status.Message, "admission webhook") && strings.Contains(status.Message, "denied the request") {
+		return true
+	}
+	// A ValidatingAdmissionPolicy denies with the reason of the failed validation. Its message names the policy,
+	// and it adds the denial as a cause that names no field. Validation errors of the object name the field, and
+	// authorization errors have no cause.
+	if strings.Contains(status.Message, "ValidatingAdmissionPolicy") && strings.Contains(status.Message, "denied request") {
+		return true
+	}
+	if status.Details != nil {
+		for _, cause := range status.Details.Causes {
+			if cause.Type == "" && cause.Field == "" && cause.Message != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsFields reports whether got contains every field of want with the same value. Lists must have the same
+// length and match element by element. When a field does not match, its path is returned.
+func containsFields(got, want interface{}, path string) (string, bool) {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return path, false
+		}
+		for k, v := range w {
+			if p, ok := containsFields(g[k], v, path+"."+k); !ok {
+				return p, false
+			}
+		}
+		return path, true
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			return path, false
+		}
+		for i := range w {
+			if p, ok := containsFields(g[i], w[i], fmt.Sprintf("%s[%d]", path, i)); !ok {
+				return p, false
+			}
+		}
+		return path, true
+	default:
+		return path, reflect.DeepEqual(got, want)
+	}
+}
+
+// verifyRevision runs the smoke tests of the revision that was just applied from destDir. When they fail the
+// revision is marked Degraded and, if spec.smokeTests.revertOnFailure is set, the previous revision is applied
+// again and the failed one is rejected until a newer revision is published.
+func verifyRevision(config *Config, dynamicClient dynamic.Interface, mapper meta.RESTMapper, destDir, revision, previous string) error {
+	testErr := runSmokeTestsOnClusters(config, dynamicClient, mapper, smokeTestDir(destDir))
+	if testErr == nil {
+		return nil
+	}
+	log.Printf("Smoke tests of revision %s failed: %v\n", revision, testErr)
+
+	// A revision is only reverted for fixtures that got the wrong admission result, not for ones that could not
+	// be submitted.
+	var smokeErr *smokeTestError
+	inconclusive := stderrors.As(testErr, &smokeErr) && smokeErr.inconclusive()
+	if inconclusive || config.SmokeTests == nil || !config.SmokeTests.RevertOnFailure || previous == "" || previous == revision {
+		reportSmokeTestFailure(config, dynamicClient, revision, "", testErr)
+		return fmt.Errorf("revision %s: %w", revision, testErr)
+	}
+
+	log.Printf("Reverting to revision %s\n", previous)
+	if err := revertRevision(config, dynamicClient, mapper, previous); err != nil {
+		reportSmokeTestFailure(config, dynamicClient, revision, "", testErr)
+		return fmt.Errorf("revision %s: %w; revert to %s failed: %v", revision, testErr, previous, err)
+	}
+	if err := os.WriteFile(config.LastFile, []byte(previous), 0644); err != nil {
+		log.Printf("Warning: failed to write last file: %v\n", err)
+	}
+	reportSmokeTestFailure(config, dynamicClient, revision, previous, testErr)
+	return fmt.Errorf("revision %s: %w; reverted to %s", revision, testErr, previous)
+}
+
+// revertRevision pulls and applies the given revision again, pruning what the failed revision added if
+// spec.prune is set.
+func revertRevision(config *Config, dynamicClient dynamic.Interface, mapper meta.RESTMapper, revision string) error {
+	destDir := revisionDir(config, revision)
+	checksums, err := pullImageToDirFunc(config, revision, destDir)
+	if err != nil {
+		return fmt.Errorf("pull failed: %w", err)
+	}
+	files := make([]string, 0, len(checksums))
+	for f := range checksums {
+		files = append(files, f)
+	}
+	results, err := applyManifestsFunc(config, files, mapper, dynamicClient)
+	if err != nil {
+		return fmt.Errorf("apply manifests failed: %w", err)
+	}
+	results = append(results, handleStaleObjectsInDir(config, dynamicClient, mapper, destDir)...)
+	if failed := failedFiles(results); len(failed) > 0 {
+		return fmt.Errorf("%d file(s) failed to apply", len(failed))
+	}
+	return nil
+}
+
+// rejectedRevision returns status.rejectedVersion of the KyvernoArtifact, the revision that was reverted after its
+// smoke tests failed. It is kept in the status rather than the state directory so that it survives a restart.
+func rejectedRevision(config *Config, dynamicClient dynamic.Interface) string {
+	if config.ArtifactName == "" || config.PodNamespace == "" {
+		return ""
+	}
+	obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace(config.PodNamespace).Get(context.Background(), config.ArtifactName, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Warning: failed to get KyvernoArtifact %s/%s: %v\n", config.PodNamespace, config.ArtifactName, err)
+		return ""
+	}
+	rejected, _, _ := unstructured.NestedString(obj.Object, "status", "rejectedVersion")
+	return rejected
+}
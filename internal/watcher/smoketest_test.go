@@ -0,0 +1,337 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/dynamic"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// newSmokeTestClients returns fake clients that know Pods and act as admission control: Pods labeled
+// privileged=true are denied by a webhook, privileged=policy by a ValidatingAdmissionPolicy, privileged=forbidden
+// by RBAC and privileged=bad-request as a malformed request, and all other Pods get the label team=platform.
+func newSmokeTestClients(objects ...runtime.Object) (*fakedynamic.FakeDynamicClient, meta.RESTMapper) {
+	dynamicClient, mapper := newFakePolicyClients(objects...)
+	mapper.(*meta.DefaultRESTMapper).Add(schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, meta.RESTScopeNamespace)
+
+	dynamicClient.PrependReactor("create", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		pod := action.(clienttesting.CreateAction).GetObject().(*unstructured.Unstructured).DeepCopy()
+		labels := pod.GetLabels()
+		switch labels["privileged"] {
+		case "true":
+			return true, nil, &apierrors.StatusError{ErrStatus: metav1.Status{
+				Status:  metav1.StatusFailure,
+				Code:    http.StatusBadRequest,
+				Message: `admission webhook "validate.kyverno.svc-fail" denied the request: privileged pods are not allowed`,
+			}}
+		case "bad-request":
+			return true, nil, apierrors.NewBadRequest("the body of the request was in an unknown format")
+		case "policy":
+			err := apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, pod.GetName(), errors.New("privileged pods are not allowed"))
+			err.ErrStatus.Reason = metav1.StatusReasonInvalid
+			err.ErrStatus.Code = http.StatusUnprocessableEntity
+			err.ErrStatus.Details.Causes = append(err.ErrStatus.Details.Causes, metav1.StatusCause{Message: "privileged pods are not allowed"})
+			return true, nil, err
+		case "forbidden":
+			return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, pod.GetName(), errors.New("watcher cannot create pods"))
+		case "invalid":
+			return true, nil, apierrors.NewInvalid(schema.GroupKind{Kind: "Pod"}, pod.GetName(), field.ErrorList{
+				field.Required(field.NewPath("spec", "containers"), ""),
+			})
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels["team"] = "platform"
+		pod.SetLabels(labels)
+		return true, pod, nil
+	})
+	return dynamicClient, mapper
+}
+
+// smokeTestPod returns a fixture Pod with the given expectation and labels.
+func smokeTestPod(name, expect, expected string, labels map[string]string) string {
+	manifest := fmt.Sprintf("apiVersion: v1\nkind: Pod\nmetadata:\n  name: %s\n  annotations:\n    %s: %s\n",
+		name, kyvernov1alpha1.SmokeTestAnnotation, expect)
+	if expected != "" {
+		manifest += fmt.Sprintf("    %s: '%s'\n", kyvernov1alpha1.SmokeTestExpectAnnotation, expected)
+	}
+	if len(labels) > 0 {
+		manifest += "  labels:\n"
+		for k, v := range labels {
+			manifest += fmt.Sprintf("    %s: %q\n", k, v)
+		}
+	}
+	return manifest + "spec:\n  containers:\n  - name: app\n    image: nginx\n"
+}
+
+func TestRunSmokeTests(t *testing.T) {
+	config := &Config{ArtifactName: "vendor", PodNamespace: "policies"}
+	dynamicClient, mapper := newSmokeTestClients()
+
+	dir := t.TempDir()
+	fixtures := map[string]string{
+		"allowed.yaml":        smokeTestPod("allowed", "allow", "", nil),
+		"denied.yaml":         smokeTestPod("denied", "deny", "", map[string]string{"privileged": "true"}),
+		"policy-denied.yaml":  smokeTestPod("policy-denied", "deny", "", map[string]string{"privileged": "policy"}),
+		"invalid.yaml":        smokeTestPod("invalid", "deny", "", map[string]string{"privileged": "invalid"}),
+		"mutated.yaml":        smokeTestPod("mutated", "mutate", `{"metadata":{"labels":{"team":"platform"}}}`, nil),
+		"not-denied.yaml":     smokeTestPod("not-denied", "deny", "", nil),
+		"not-allowed.yaml":    smokeTestPod("not-allowed", "allow", "", map[string]string{"privileged": "true"}),
+		"not-mutated.yaml":    smokeTestPod("not-mutated", "mutate", "metadata: {labels: {team: security}}", nil),
+		"rbac-forbidden.yaml": smokeTestPod("rbac-forbidden", "deny", "", map[string]string{"privileged": "forbidden"}),
+		"bad-request.yaml":    smokeTestPod("bad-request", "deny", "", map[string]string{"privileged": "bad-request"}),
+		"unknown.yaml":        smokeTestPod("unknown", "reject", "", nil),
+	}
+	for name, manifest := range fixtures {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := runSmokeTests(config, dynamicClient, mapper, dir)
+	var testErr *smokeTestError
+	if !errors.As(err, &testErr) {
+		t.Fatalf("runSmokeTests() error = %v, want a smokeTestError", err)
+	}
+	var failed []string
+	for _, f := range testErr.Failures {
+		if f.Namespace != "policies" {
+			t.Errorf("%s: namespace = %q, want the artifact's namespace", f.Name, f.Namespace)
+		}
+		var inconclusive *inconclusiveSmokeTestError
+		if got := errors.As(f.Err, &inconclusive); got != (f.Name == "rbac-forbidden") {
+			t.Errorf("%s: inconclusive = %v, want it only for the fixture the watcher may not create", f.Name, got)
+		}
+		failed = append(failed, f.Name)
+	}
+	sort.Strings(failed)
+	want := []string{"bad-request", "invalid", "not-allowed", "not-denied", "not-mutated", "rbac-forbidden", "unknown"}
+	if strings.Join(failed, ",") != strings.Join(want, ",") {
+		t.Errorf("failed smoke tests = %v, want %v", failed, want)
+	}
+
+	if err := runSmokeTests(config, dynamicClient, mapper, filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("runSmokeTests() without fixtures error = %v", err)
+	}
+}
+
+func TestPullImageToDirReal_SetsAsideSmokeTests(t *testing.T) {
+	originalOrasPull := orasPullFunc
+	defer func() { orasPullFunc = originalOrasPull }()
+
+	orasPullFunc = func(config *Config, destDir string) error {
+		if err := os.WriteFile(filepath.Join(destDir, "policy.yaml"), []byte(patchTestPolicy), 0644); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(destDir, "tests"), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(destDir, "tests", "pod.yaml"), []byte(smokeTestPod("bad", "deny", "", nil)), 0644)
+	}
+
+	config := &Config{Provider: ProviderArtifactory, ImageBase: "registry.example.com/policies", ArtifactName: "vendor"}
+	destDir := filepath.Join(t.TempDir(), "image")
+	checksums, err := pullImageToDirReal(config, "v1", destDir)
+	if err != nil {
+		t.Fatalf("pullImageToDirReal() error = %v", err)
+	}
+	if _, ok := checksums[filepath.Join(destDir, "policy.yaml")]; !ok || len(checksums) != 1 {
+		t.Errorf("checksums = %v, want only the policy", checksums)
+	}
+	if files, _ := findYAMLFiles(destDir); len(files) != 1 {
+		t.Errorf("files to apply = %v, want only the policy", files)
+	}
+	if _, err := os.Stat(filepath.Join(smokeTestDir(destDir), "tests", "pod.yaml")); err != nil {
+		t.Errorf("fixture should be set aside: %v", err)
+	}
+}
+
+func TestWatchLoop_SmokeTestFailureReverts(t *testing.T) {
+	dynamicClient, mapper := newSmokeTestClients(newTestArtifact("vendor", "default"))
+
+	originalGetK8sClients := getKubernetesClientsFunc
+	getKubernetesClientsFunc = func() (dynamic.Interface, meta.RESTMapper, error) { return dynamicClient, mapper, nil }
+	defer func() { getKubernetesClientsFunc = originalGetK8sClients }()
+
+	latest := "v2"
+	originalTagChangedFunc := tagChangedFunc
+	tagChangedFunc = func(config *Config) (bool, string, string, error) {
+		prev, _ := os.ReadFile(config.LastFile)
+		return string(prev) != latest, latest, string(prev), nil
+	}
+	defer func() { tagChangedFunc = originalTagChangedFunc }()
+
+	// Revision v2 ships a fixture expecting an unprivileged Pod to be denied, which the webhook allows.
+	originalPullImageToDirFunc := pullImageToDirFunc
+	pullImageToDirFunc = func(config *Config, tag, destDir string) (map[string]string, error) {
+		_ = os.RemoveAll(destDir)
+		_ = os.RemoveAll(smokeTestDir(destDir))
+		writeManagedPolicies(t, destDir, "vendor", tag, "a")
+		if tag == "v2" {
+			writeManagedPolicies(t, smokeTestDir(destDir), "vendor", tag)
+			if err := os.WriteFile(filepath.Join(smokeTestDir(destDir), "pod.yaml"), []byte(smokeTestPod("unprivileged", "deny", "", nil)), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return map[string]string{filepath.Join(destDir, "a.yaml"): tag}, nil
+	}
+	defer func() { pullImageToDirFunc = originalPullImageToDirFunc }()
+	defer func() {
+		for _, tag := range []string{"v1", "v2", "v3"} {
+			_ = os.RemoveAll("/tmp/image-" + tag)
+			_ = os.RemoveAll(smokeTestDir("/tmp/image-" + tag))
+		}
+	}()
+
+	var applied []string
+	originalApplyManifestsFunc := applyManifestsFunc
+	applyManifestsFunc = func(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) ([]ApplyResult, error) {
+		applied = append(applied, filepath.Base(filepath.Dir(files[0])))
+		return nil, nil
+	}
+	defer func() { applyManifestsFunc = originalApplyManifestsFunc }()
+
+	config := &Config{
+		PollForTagChanges: true,
+		StateDir:          t.TempDir(),
+		ArtifactName:      "vendor",
+		PodNamespace:      "default",
+		SmokeTests:        &kyvernov1alpha1.SmokeTests{RevertOnFailure: true},
+	}
+	config.LastFile = filepath.Join(config.StateDir, "last_seen")
+	if err := os.WriteFile(config.LastFile, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var testErr *smokeTestError
+	if err := watchLoop(config); !errors.As(err, &testErr) {
+		t.Fatalf("watchLoop() error = %v, want a smoke test failure", err)
+	}
+	if strings.Join(applied, ",") != "image-v2,image-v1" {
+		t.Errorf("applied = %v, want v2 and then the revert to v1", applied)
+	}
+	if last, _ := os.ReadFile(config.LastFile); string(last) != "v1" {
+		t.Errorf("last_seen = %q, want v1", last)
+	}
+
+	obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace("default").Get(context.Background(), "vendor", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var artifact kyvernov1alpha1.KyvernoArtifact
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &artifact); err != nil {
+		t.Fatal(err)
+	}
+	if artifact.Status.AppliedVersion != "v1" {
+		t.Errorf("AppliedVersion = %q, want v1", artifact.Status.AppliedVersion)
+	}
+	degraded := meta.FindStatusCondition(artifact.Status.Conditions, kyvernov1alpha1.ConditionDegraded)
+	if degraded == nil || degraded.Status != metav1.ConditionTrue || degraded.Reason != "SmokeTestFailed" {
+		t.Errorf("Degraded condition = %+v, want reason SmokeTestFailed", degraded)
+	}
+	if len(artifact.Status.FailedObjects) != 1 || artifact.Status.FailedObjects[0].Name != "unprivileged" {
+		t.Errorf("FailedObjects = %+v, want the failed fixture", artifact.Status.FailedObjects)
+	}
+
+	if artifact.Status.RejectedVersion != "v2" {
+		t.Errorf("RejectedVersion = %q, want v2", artifact.Status.RejectedVersion)
+	}
+
+	// The rejected revision is not applied again, even by a restarted watcher, but a newer one is.
+	config.StateDir = t.TempDir()
+	config.LastFile = filepath.Join(config.StateDir, "last_seen")
+	if err := os.WriteFile(config.LastFile, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	applied = nil
+	if err := watchLoop(config); err != nil {
+		t.Fatalf("watchLoop() error = %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("applied = %v, the rejected revision must not be applied again", applied)
+	}
+	latest = "v3"
+	if err := watchLoop(config); err != nil {
+		t.Fatalf("watchLoop() error = %v", err)
+	}
+	if strings.Join(applied, ",") != "image-v3" {
+		t.Errorf("applied = %v, want v3", applied)
+	}
+	obj, err = dynamicClient.Resource(kyvernoArtifactsGVR).Namespace("default").Get(context.Background(), "vendor", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejected, _, _ := unstructured.NestedString(obj.Object, "status", "rejectedVersion"); rejected != "" {
+		t.Errorf("rejectedVersion = %q, want it cleared once v3 is applied", rejected)
+	}
+}
+
+func TestVerifyRevision_InconclusiveDoesNotRevert(t *testing.T) {
+	dynamicClient, mapper := newSmokeTestClients(newTestArtifact("vendor", "default"))
+
+	originalPullImageToDirFunc := pullImageToDirFunc
+	pullImageToDirFunc = func(config *Config, tag, destDir string) (map[string]string, error) {
+		t.Errorf("revision %s should not be pulled for a revert", tag)
+		return nil, nil
+	}
+	defer func() { pullImageToDirFunc = originalPullImageToDirFunc }()
+
+	config := &Config{
+		StateDir:     t.TempDir(),
+		ArtifactName: "vendor",
+		PodNamespace: "default",
+		SmokeTests:   &kyvernov1alpha1.SmokeTests{RevertOnFailure: true},
+	}
+	config.LastFile = filepath.Join(config.StateDir, "last_seen")
+	if err := os.WriteFile(config.LastFile, []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destDir := filepath.Join(t.TempDir(), "image-v2")
+	if err := os.MkdirAll(smokeTestDir(destDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fixture := smokeTestPod("forbidden", "deny", "", map[string]string{"privileged": "forbidden"})
+	if err := os.WriteFile(filepath.Join(smokeTestDir(destDir), "pod.yaml"), []byte(fixture), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyRevision(config, dynamicClient, mapper, destDir, "v2", "v1"); err == nil {
+		t.Fatal("verifyRevision() error = nil, want the inconclusive smoke test")
+	}
+	if last, _ := os.ReadFile(config.LastFile); string(last) != "v2" {
+		t.Errorf("last_seen = %q, want v2 to stay applied", last)
+	}
+	obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace("default").Get(context.Background(), "vendor", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var artifact kyvernov1alpha1.KyvernoArtifact
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &artifact); err != nil {
+		t.Fatal(err)
+	}
+	if artifact.Status.RejectedVersion != "" {
+		t.Errorf("RejectedVersion = %q, want none", artifact.Status.RejectedVersion)
+	}
+	degraded := meta.FindStatusCondition(artifact.Status.Conditions, kyvernov1alpha1.ConditionDegraded)
+	if degraded == nil || degraded.Reason != "SmokeTestInconclusive" {
+		t.Errorf("Degraded condition = %+v, want reason SmokeTestInconclusive", degraded)
+	}
+}
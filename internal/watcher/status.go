@@ -0,0 +1,270 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	clientretry "k8s.io/client-go/util/retry"
+)
+
+// maxFailedObjectsInStatus caps how many failed objects are written to the KyvernoArtifact status.
+const maxFailedObjectsInStatus = 50
+
+var (
+	// updateArtifactStatusFunc can be overridden in tests
+	updateArtifactStatusFunc = updateArtifactStatus
+
+	// kyvernoArtifactsGVR is the GroupVersionResource of the KyvernoArtifact that owns this watcher.
+	kyvernoArtifactsGVR = schema.GroupVersionResource{
+		Group:    "kyverno.octokode.io",
+		Version:  "v1alpha1",
+		Resource: "kyvernoartifacts",
+	}
+)
+
+// updateArtifactStatus fetches the KyvernoArtifact that owns this watcher, lets mutate change its status
+// and writes the result back through the status subresource. It is a no-op when the watcher does not
+// know which artifact it belongs to.
+func updateArtifactStatus(config *Config, dynamicClient dynamic.Interface, mutate func(status *kyvernov1alpha1.KyvernoArtifactStatus)) error {
+	if config.ArtifactName == "" || config.PodNamespace == "" || dynamicClient == nil {
+		return nil
+	}
+	return updateNamedArtifactStatus(dynamicClient, config.PodNamespace, config.ArtifactName, mutate)
+}
+
+// updateNamedArtifactStatus applies mutate to the status of the given KyvernoArtifact, retrying on conflicts.
+func updateNamedArtifactStatus(dynamicClient dynamic.Interface, namespace, name string, mutate func(status *kyvernov1alpha1.KyvernoArtifactStatus)) error {
+	ctx := context.Background()
+	resource := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace(namespace)
+
+	return clientretry.RetryOnConflict(clientretry.DefaultRetry, func() error {
+		obj, err := resource.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get KyvernoArtifact %s/%s: %w", namespace, name, err)
+		}
+
+		var artifact kyvernov1alpha1.KyvernoArtifact
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &artifact); err != nil {
+			return fmt.Errorf("failed to convert KyvernoArtifact: %w", err)
+		}
+
+		before := artifact.Status.DeepCopy()
+		mutate(&artifact.Status)
+		if equality.Semantic.DeepEqual(before, &artifact.Status) {
+			return nil
+		}
+
+		status, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&artifact.Status)
+		if err != nil {
+			return fmt.Errorf("failed to convert KyvernoArtifact status: %w", err)
+		}
+		if err := unstructured.SetNestedField(obj.Object, status, "status"); err != nil {
+			return fmt.Errorf("failed to set KyvernoArtifact status: %w", err)
+		}
+
+		_, err = resource.UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// reportApplyResults records the outcome of an apply attempt for the given revision on the KyvernoArtifact status.
+// A nil retry means every object was applied and the revision is now the applied version. Ownership conflicts
+// are recorded on this artifact and on the artifacts that own the contested objects.
+func reportApplyResults(config *Config, dynamicClient dynamic.Interface, revision string, results []ApplyResult, retry *retryState) {
+	claimant := types.NamespacedName{Namespace: config.PodNamespace, Name: config.ArtifactName}
+	conflicts := conflictsFromResults(claimant, results)
+	var previousOwners []types.NamespacedName
+
+	err := updateArtifactStatusFunc(config, dynamicClient, func(status *kyvernov1alpha1.KyvernoArtifactStatus) {
+		now := metav1.Now()
+		summary := summarizeResults(results)
+
+		status.LastAttemptedVersion = revision
+		status.LastApplyTime = &now
+		status.ApplySummary = &summary
+		previousOwners = replaceClaimedConflicts(status, claimant, conflicts)
+		status.FailedObjects = failedObjectStatuses(results)
+
+		if retry == nil {
+			status.AppliedVersion = revision
+			if status.RejectedVersion != revision {
+				status.RejectedVersion = ""
+			}
+			status.RetryAttempts = 0
+			status.NextRetryTime = nil
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:    kyvernov1alpha1.ConditionAvailable,
+				Status:  metav1.ConditionTrue,
+				Reason:  "RevisionApplied",
+				Message: fmt.Sprintf("Revision %s applied", revision),
+			})
+			// Rules the global exclude could not be merged into were left out of the revision.
+			if len(status.FailedObjects) > 0 {
+				meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+					Type:    kyvernov1alpha1.ConditionDegraded,
+					Status:  metav1.ConditionTrue,
+					Reason:  "RulesSkipped",
+					Message: fmt.Sprintf("Revision %s applied without %d rule(s), see failedObjects", revision, len(status.FailedObjects)),
+				})
+				return
+			}
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:    kyvernov1alpha1.ConditionDegraded,
+				Status:  metav1.ConditionFalse,
+				Reason:  "RevisionApplied",
+				Message: fmt.Sprintf("Revision %s applied", revision),
+			})
+			return
+		}
+
+		next := metav1.NewTime(retry.NextAttempt)
+		status.RetryAttempts = int32(retry.Attempts)
+		status.NextRetryTime = &next
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    kyvernov1alpha1.ConditionDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  "ApplyFailed",
+			Message: fmt.Sprintf("%d object(s) of revision %s failed to apply, retrying at %s", summary.Failed+summary.Conflicts, revision, retry.NextAttempt.Format(time.RFC3339)),
+		})
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    kyvernov1alpha1.ConditionAvailable,
+			Status:  metav1.ConditionFalse,
+			Reason:  "ApplyFailed",
+			Message: fmt.Sprintf("Revision %s is only partially applied", revision),
+		})
+	})
+	if err != nil {
+		log.Printf("Warning: failed to update KyvernoArtifact status: %v\n", err)
+	}
+
+	reportConflictsToOwners(config, dynamicClient, previousOwners, conflicts)
+}
+
+// failedObjectStatuses returns the failed results, truncated to keep the status object small.
+func failedObjectStatuses(results []ApplyResult) []kyvernov1alpha1.ObjectStatus {
+	var statuses []kyvernov1alpha1.ObjectStatus
+	for _, r := range results {
+		if r.Outcome != kyvernov1alpha1.ApplyOutcomeFailed {
+			continue
+		}
+		if len(statuses) == maxFailedObjectsInStatus {
+			break
+		}
+		statuses = append(statuses, kyvernov1alpha1.ObjectStatus{
+			APIVersion: r.APIVersion,
+			Kind:       r.Kind,
+			Namespace:  r.Namespace,
+			Name:       r.Name,
+			Outcome:    r.Outcome,
+			Reason:     r.Reason,
+		})
+	}
+	return statuses
+}
+
+// objectFailuresError is implemented by errors that fail a revision because of individual objects.
+type objectFailuresError interface {
+	error
+	objectFailures() []kyvernov1alpha1.ObjectStatus
+}
+
+// reportRevisionFailure records that the given revision could not be prepared for apply at all, for example
+// because the pull, the variable substitution, a patch or the global exclude failed. The previously applied version stays in place.
+// Errors caused by individual objects, such as patch failures, list them in failedObjects.
+func reportRevisionFailure(config *Config, dynamicClient dynamic.Interface, revision, reason string, failure error) {
+	err := updateArtifactStatusFunc(config, dynamicClient, func(status *kyvernov1alpha1.KyvernoArtifactStatus) {
+		status.LastAttemptedVersion = revision
+		setObjectFailures(status, failure)
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    kyvernov1alpha1.ConditionDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  reason,
+			Message: failure.Error(),
+		})
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    kyvernov1alpha1.ConditionAvailable,
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: fmt.Sprintf("Revision %s could not be applied", revision),
+		})
+	})
+	if err != nil {
+		log.Printf("Warning: failed to update KyvernoArtifact status: %v\n", err)
+	}
+}
+
+// reportSmokeTestFailure records that the smoke tests of an applied revision failed. The revision stays applied
+// unless it was reverted, in which case reverted names the revision that was applied again.
+func reportSmokeTestFailure(config *Config, dynamicClient dynamic.Interface, revision, reverted string, failure error) {
+	err := updateArtifactStatusFunc(config, dynamicClient, func(status *kyvernov1alpha1.KyvernoArtifactStatus) {
+		status.LastAttemptedVersion = revision
+		setObjectFailures(status, failure)
+		message := fmt.Sprintf("Revision %s: %v", revision, failure)
+		reason := "SmokeTestFailed"
+		var smokeErr *smokeTestError
+		if errors.As(failure, &smokeErr) && smokeErr.inconclusive() {
+			reason = "SmokeTestInconclusive"
+		}
+		if reverted != "" {
+			status.AppliedVersion = reverted
+			status.RejectedVersion = revision
+			message = fmt.Sprintf("%s; reverted to revision %s", message, reverted)
+		}
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    kyvernov1alpha1.ConditionDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  reason,
+			Message: message,
+		})
+	})
+	if err != nil {
+		log.Printf("Warning: failed to update KyvernoArtifact status: %v\n", err)
+	}
+}
+
+// setObjectFailures lists the objects that caused failure in failedObjects, if it is caused by individual objects.
+func setObjectFailures(status *kyvernov1alpha1.KyvernoArtifactStatus, failure error) {
+	var objErr objectFailuresError
+	if errors.As(failure, &objErr) {
+		status.FailedObjects = objErr.objectFailures()
+		if len(status.FailedObjects) > maxFailedObjectsInStatus {
+			status.FailedObjects = status.FailedObjects[:maxFailedObjectsInStatus]
+		}
+	}
+}
+
+// summarizeResults counts apply results by outcome.
+func summarizeResults(results []ApplyResult) kyvernov1alpha1.ApplySummary {
+	var summary kyvernov1alpha1.ApplySummary
+	for _, r := range results {
+		switch r.Outcome {
+		case kyvernov1alpha1.ApplyOutcomeCreated:
+			summary.Created++
+		case kyvernov1alpha1.ApplyOutcomeUpdated:
+			summary.Updated++
+		case kyvernov1alpha1.ApplyOutcomeUnchanged:
+			summary.Unchanged++
+		case kyvernov1alpha1.ApplyOutcomeFailed:
+			summary.Failed++
+		case kyvernov1alpha1.ApplyOutcomeConflict:
+			summary.Conflicts++
+		case kyvernov1alpha1.ApplyOutcomePruned:
+			summary.Pruned++
+		case kyvernov1alpha1.ApplyOutcomeHeld:
+			summary.Held++
+		}
+	}
+	return summary
+}
@@ -0,0 +1,248 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newTestArtifact(name, namespace string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "kyverno.octokode.io/v1alpha1",
+			"kind":       "KyvernoArtifact",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": namespace,
+			},
+			"spec": map[string]interface{}{},
+		},
+	}
+}
+
+func TestReportApplyResults(t *testing.T) {
+	config := &Config{ArtifactName: "my-artifact", PodNamespace: "default"}
+
+	tests := []struct {
+		name          string
+		results       []ApplyResult
+		retry         *retryState
+		wantApplied   string
+		wantDegraded  metav1.ConditionStatus
+		wantFailed    int
+		wantAttempts  int32
+		wantNextRetry bool
+	}{
+		{
+			name: "all objects applied",
+			results: []ApplyResult{
+				{Kind: "ClusterPolicy", Name: "a", Outcome: kyvernov1alpha1.ApplyOutcomeCreated},
+				{Kind: "ClusterPolicy", Name: "b", Outcome: kyvernov1alpha1.ApplyOutcomeUnchanged},
+			},
+			wantApplied:  "v2",
+			wantDegraded: metav1.ConditionFalse,
+		},
+		{
+			name: "partial failure",
+			results: []ApplyResult{
+				{Kind: "ClusterPolicy", Name: "a", Outcome: kyvernov1alpha1.ApplyOutcomeCreated},
+				{Kind: "ClusterPolicy", Name: "b", Outcome: kyvernov1alpha1.ApplyOutcomeFailed, Reason: "admission webhook denied"},
+			},
+			retry:         &retryState{Revision: "v2", Files: []string{"b.yaml"}, Attempts: 2, NextAttempt: time.Now().Add(time.Minute)},
+			wantDegraded:  metav1.ConditionTrue,
+			wantFailed:    1,
+			wantAttempts:  2,
+			wantNextRetry: true,
+		},
+		{
+			name: "applied without skipped rules",
+			results: []ApplyResult{
+				{Kind: "ClusterPolicy", Name: "a", Outcome: kyvernov1alpha1.ApplyOutcomeCreated},
+				{Kind: "ClusterPolicy", Name: "a", Outcome: kyvernov1alpha1.ApplyOutcomeFailed, Reason: "global exclude: rule b was not applied"},
+			},
+			wantApplied:  "v2",
+			wantDegraded: metav1.ConditionTrue,
+			wantFailed:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dynamicClient, _ := newFakePolicyClients(newTestArtifact(config.ArtifactName, config.PodNamespace))
+
+			reportApplyResults(config, dynamicClient, "v2", tt.results, tt.retry)
+
+			obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace(config.PodNamespace).Get(context.Background(), config.ArtifactName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get artifact: %v", err)
+			}
+			var artifact kyvernov1alpha1.KyvernoArtifact
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &artifact); err != nil {
+				t.Fatalf("failed to convert artifact: %v", err)
+			}
+			status := artifact.Status
+
+			if status.LastAttemptedVersion != "v2" {
+				t.Errorf("LastAttemptedVersion = %q, want v2", status.LastAttemptedVersion)
+			}
+			if status.AppliedVersion != tt.wantApplied {
+				t.Errorf("AppliedVersion = %q, want %q", status.AppliedVersion, tt.wantApplied)
+			}
+			if len(status.FailedObjects) != tt.wantFailed {
+				t.Errorf("FailedObjects = %v, want %d entries", status.FailedObjects, tt.wantFailed)
+			}
+			if status.RetryAttempts != tt.wantAttempts {
+				t.Errorf("RetryAttempts = %d, want %d", status.RetryAttempts, tt.wantAttempts)
+			}
+			if (status.NextRetryTime != nil) != tt.wantNextRetry {
+				t.Errorf("NextRetryTime = %v, want set=%v", status.NextRetryTime, tt.wantNextRetry)
+			}
+			if status.ApplySummary == nil || int(status.ApplySummary.Failed) != tt.wantFailed {
+				t.Errorf("ApplySummary = %+v, want %d failed", status.ApplySummary, tt.wantFailed)
+			}
+			degraded := meta.FindStatusCondition(status.Conditions, kyvernov1alpha1.ConditionDegraded)
+			if degraded == nil || degraded.Status != tt.wantDegraded {
+				t.Errorf("Degraded condition = %+v, want status %s", degraded, tt.wantDegraded)
+			}
+		})
+	}
+}
+
+func TestUpdateArtifactStatus_NoArtifactName(t *testing.T) {
+	called := false
+	err := updateArtifactStatus(&Config{}, nil, func(status *kyvernov1alpha1.KyvernoArtifactStatus) {
+		called = true
+	})
+	if err != nil {
+		t.Fatalf("updateArtifactStatus() error = %v", err)
+	}
+	if called {
+		t.Error("mutate should not be called when the watcher has no artifact name")
+	}
+}
+
+func TestReportApplyResults_OwnershipConflict(t *testing.T) {
+	config := &Config{ArtifactName: "team-b", PodNamespace: "team-b-ns"}
+	dynamicClient, _ := newFakePolicyClients(
+		newTestArtifact("team-a", "team-a-ns"),
+		newTestArtifact("team-b", "team-b-ns"),
+		newTestArtifact("team-a", "other-ns"),
+	)
+
+	getStatus := func(name, namespace string) kyvernov1alpha1.KyvernoArtifactStatus {
+		t.Helper()
+		obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace(namespace).Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get artifact %s: %v", name, err)
+		}
+		var artifact kyvernov1alpha1.KyvernoArtifact
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &artifact); err != nil {
+			t.Fatalf("failed to convert artifact: %v", err)
+		}
+		return artifact.Status
+	}
+
+	results := []ApplyResult{
+		{Kind: "ClusterPolicy", Name: "require-labels", Outcome: kyvernov1alpha1.ApplyOutcomeConflict, Owner: "team-a", OwnerNamespace: "team-a-ns"},
+		{Kind: "ClusterPolicy", Name: "other", Outcome: kyvernov1alpha1.ApplyOutcomeCreated},
+	}
+	reportApplyResults(config, dynamicClient, "v1", results, &retryState{Revision: "v1", Attempts: 1, NextAttempt: time.Now()})
+
+	for _, side := range []struct{ name, namespace string }{{"team-a", "team-a-ns"}, {"team-b", "team-b-ns"}} {
+		status := getStatus(side.name, side.namespace)
+		if len(status.Conflicts) != 1 {
+			t.Fatalf("%s: Conflicts = %+v, want 1 entry", side.name, status.Conflicts)
+		}
+		if c := status.Conflicts[0]; c.OwnedBy != "team-a" || c.OwnedByNamespace != "team-a-ns" ||
+			c.ClaimedBy != "team-b" || c.ClaimedByNamespace != "team-b-ns" || c.Name != "require-labels" {
+			t.Errorf("%s: conflict = %+v", side.name, c)
+		}
+		if !meta.IsStatusConditionTrue(status.Conditions, kyvernov1alpha1.ConditionOwnershipConflict) {
+			t.Errorf("%s: OwnershipConflict condition should be True, got %+v", side.name, status.Conditions)
+		}
+	}
+	// An artifact with the owner's name in another namespace does not own the object.
+	if status := getStatus("team-a", "other-ns"); len(status.Conflicts) != 0 {
+		t.Errorf("same-named artifact in another namespace: Conflicts = %+v, want none", status.Conflicts)
+	}
+	if got := getStatus("team-b", "team-b-ns").ApplySummary.Conflicts; got != 1 {
+		t.Errorf("ApplySummary.Conflicts = %d, want 1", got)
+	}
+
+	// Once the object has been handed over, the conflict is cleared on both artifacts.
+	results[0].Outcome = kyvernov1alpha1.ApplyOutcomeUpdated
+	results[0].Owner = ""
+	results[0].OwnerNamespace = ""
+	reportApplyResults(config, dynamicClient, "v1", results, nil)
+
+	for _, side := range []struct{ name, namespace string }{{"team-a", "team-a-ns"}, {"team-b", "team-b-ns"}} {
+		status := getStatus(side.name, side.namespace)
+		if len(status.Conflicts) != 0 {
+			t.Errorf("%s: Conflicts = %+v, want none", side.name, status.Conflicts)
+		}
+		if !meta.IsStatusConditionFalse(status.Conditions, kyvernov1alpha1.ConditionOwnershipConflict) {
+			t.Errorf("%s: OwnershipConflict condition should be False, got %+v", side.name, status.Conditions)
+		}
+	}
+}
+
+func TestReplaceClaimedConflicts_Unmanaged(t *testing.T) {
+	status := &kyvernov1alpha1.KyvernoArtifactStatus{}
+	vendor := types.NamespacedName{Namespace: "default", Name: "vendor"}
+	replaceClaimedConflicts(status, vendor, conflictsFromResults(vendor, []ApplyResult{
+		{Kind: "ClusterPolicy", Name: "require-labels", Outcome: kyvernov1alpha1.ApplyOutcomeConflict, Owner: "team-a"},
+		{Kind: "ClusterPolicy", Name: "legacy", Outcome: kyvernov1alpha1.ApplyOutcomeConflict},
+	}))
+
+	condition := meta.FindStatusCondition(status.Conditions, kyvernov1alpha1.ConditionOwnershipConflict)
+	want := "1 object(s) are shipped by more than one artifact, 1 exist without being managed"
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Message != want {
+		t.Errorf("OwnershipConflict condition = %+v, want message %q", condition, want)
+	}
+}
+
+func TestReportRevisionFailure_ObjectFailures(t *testing.T) {
+	config := &Config{ArtifactName: "my-artifact", PodNamespace: "default"}
+	dynamicClient, _ := newFakePolicyClients(newTestArtifact(config.ArtifactName, config.PodNamespace))
+
+	failure := &patchError{Failures: []patchFailure{{
+		Patch:      1,
+		APIVersion: "kyverno.io/v1",
+		Kind:       "ClusterPolicy",
+		Name:       "require-labels",
+		Err:        errors.New("missing value"),
+	}}}
+	reportRevisionFailure(config, dynamicClient, "v3", pullFailureReason(failure), failure)
+
+	obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace(config.PodNamespace).Get(context.Background(), config.ArtifactName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get artifact: %v", err)
+	}
+	var artifact kyvernov1alpha1.KyvernoArtifact
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &artifact); err != nil {
+		t.Fatalf("failed to convert artifact: %v", err)
+	}
+
+	degraded := meta.FindStatusCondition(artifact.Status.Conditions, kyvernov1alpha1.ConditionDegraded)
+	if degraded == nil || degraded.Reason != "PatchFailed" {
+		t.Errorf("Degraded condition = %+v, want reason PatchFailed", degraded)
+	}
+	want := kyvernov1alpha1.ObjectStatus{
+		APIVersion: "kyverno.io/v1",
+		Kind:       "ClusterPolicy",
+		Name:       "require-labels",
+		Outcome:    kyvernov1alpha1.ApplyOutcomeFailed,
+		Reason:     "patch 1: missing value",
+	}
+	if len(artifact.Status.FailedObjects) != 1 || artifact.Status.FailedObjects[0] != want {
+		t.Errorf("FailedObjects = %+v, want [%+v]", artifact.Status.FailedObjects, want)
+	}
+}
@@ -0,0 +1,201 @@
+package watcher
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/OctoKode/kyverno-artifact-operator/internal/k8s"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	// resolveVariablesFunc can be overridden in tests
+	resolveVariablesFunc = resolveVariables
+	// getDynamicClientFunc can be overridden in tests
+	getDynamicClientFunc = getDynamicClient
+
+	// placeholderPattern matches ${VAR} and the escaped form $${VAR}, which is written out as a literal ${VAR}.
+	placeholderPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	// variableNamePattern is the set of keys usable as variables.
+	variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	configMapsGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	secretsGVR    = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+)
+
+// substitutionError is returned when strict substitution finds placeholders without a value.
+type substitutionError struct {
+	File      string
+	Undefined []string
+}
+
+func (e *substitutionError) Error() string {
+	return fmt.Sprintf("undefined substitution variable(s) in %s: %s", e.File, strings.Join(e.Undefined, ", "))
+}
+
+// substitutionEnabled reports whether the artifact defines any substitution variables.
+func substitutionEnabled(config *Config) bool {
+	return len(config.Substitute) > 0 || len(config.SubstituteFrom) > 0
+}
+
+// getDynamicClient returns a dynamic client without the discovery round trips getKubernetesClients makes.
+func getDynamicClient() (dynamic.Interface, error) {
+	kubeConfig, err := k8s.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubeconfig: %w", err)
+	}
+	return dynamic.NewForConfig(kubeConfig)
+}
+
+// resolveVariables collects the substitution variables from the referenced ConfigMaps and Secrets, in order,
+// and then from the literal values, so that later sources override earlier ones.
+func resolveVariables(config *Config, dynamicClient dynamic.Interface) (map[string]string, error) {
+	vars := make(map[string]string)
+	ctx := context.Background()
+
+	for _, ref := range config.SubstituteFrom {
+		gvr := configMapsGVR
+		if ref.Kind == "Secret" {
+			gvr = secretsGVR
+		}
+		obj, err := dynamicClient.Resource(gvr).Namespace(config.PodNamespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) && ref.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get %s %s/%s: %w", ref.Kind, config.PodNamespace, ref.Name, err)
+		}
+
+		data, _, err := unstructured.NestedStringMap(obj.Object, "data")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read data of %s %s/%s: %w", ref.Kind, config.PodNamespace, ref.Name, err)
+		}
+		for key, value := range data {
+			if !variableNamePattern.MatchString(key) {
+				log.Printf("Warning: ignoring key %s of %s %s, it is not a valid variable name\n", key, ref.Kind, ref.Name)
+				continue
+			}
+			if ref.Kind == "Secret" {
+				decoded, err := base64.StdEncoding.DecodeString(value)
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode key %s of Secret %s/%s: %w", key, config.PodNamespace, ref.Name, err)
+				}
+				value = string(decoded)
+			}
+			vars[key] = value
+		}
+	}
+
+	for key, value := range config.Substitute {
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// substituteVariables replaces the ${VAR} placeholders in data. Undefined placeholders are left as they are,
+// unless strict is set, in which case a substitutionError naming them is returned.
+func substituteVariables(file string, data []byte, vars map[string]string, strict bool) ([]byte, error) {
+	undefined := make(map[string]bool)
+	out := placeholderPattern.ReplaceAllFunc(data, func(match []byte) []byte {
+		if match[1] == '$' {
+			return match[1:] // $${VAR} is an escaped, literal ${VAR}
+		}
+		name := string(placeholderPattern.FindSubmatch(match)[1])
+		if value, ok := vars[name]; ok {
+			return []byte(value)
+		}
+		undefined[name] = true
+		return match
+	})
+
+	if strict && len(undefined) > 0 {
+		names := make([]string, 0, len(undefined))
+		for name := range undefined {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, &substitutionError{File: filepath.Base(file), Undefined: names}
+	}
+	return out, nil
+}
+
+// variablesHash returns a short, stable hash of the resolved variables.
+func variablesHash(vars map[string]string) string {
+	// json.Marshal sorts map keys, so the hash is stable.
+	data, _ := json.Marshal(vars)
+	return calculateSHA256(data)[:16]
+}
+
+// substitutionHashPath returns the location of the file remembering the variables the last pull was rendered with.
+func substitutionHashPath(config *Config) string {
+	return filepath.Join(filepath.Dir(config.LastFile), "substitution_hash")
+}
+
+// saveVariablesHash remembers the variables a pull was rendered with.
+func saveVariablesHash(config *Config, vars map[string]string) {
+	if config.LastFile == "" {
+		return
+	}
+	if err := os.WriteFile(substitutionHashPath(config), []byte(variablesHash(vars)), 0644); err != nil {
+		log.Printf("Warning: failed to write substitution hash: %v\n", err)
+	}
+}
+
+// variablesChanged reports whether the variables from the referenced ConfigMaps and Secrets differ from the ones
+// the last pull was rendered with. Literal values are part of the pod spec, so changing them restarts the watcher.
+func variablesChanged(config *Config) bool {
+	if len(config.SubstituteFrom) == 0 || config.LastFile == "" {
+		return false
+	}
+	previous, err := os.ReadFile(substitutionHashPath(config))
+	if err != nil {
+		return false // Nothing was rendered yet, the regular tag handling applies the artifact.
+	}
+	dynamicClient, err := getDynamicClientFunc()
+	if err != nil {
+		log.Printf("Warning: failed to check substitution variables: %v\n", err)
+		return false
+	}
+	vars, err := resolveVariablesFunc(config, dynamicClient)
+	if err != nil {
+		log.Printf("Warning: failed to check substitution variables: %v\n", err)
+		return false
+	}
+	return variablesHash(vars) != string(previous)
+}
+
+// pullFailureReason returns the status condition reason for an error returned by a pull.
+func pullFailureReason(err error) string {
+	var subErr *substitutionError
+	if errors.As(err, &subErr) {
+		return "SubstitutionFailed"
+	}
+	if errors.Is(err, errKustomizeBuild) {
+		return "KustomizeFailed"
+	}
+	if errors.Is(err, errHelmTemplate) {
+		return "HelmTemplateFailed"
+	}
+	var patchErr *patchError
+	if errors.As(err, &patchErr) {
+		return "PatchFailed"
+	}
+	var excludeErr *globalExcludeError
+	if errors.As(err, &excludeErr) {
+		return "GlobalExcludeFailed"
+	}
+	return "PullFailed"
+}
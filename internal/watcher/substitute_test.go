@@ -0,0 +1,183 @@
+package watcher
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+func TestSubstituteVariables(t *testing.T) {
+	vars := map[string]string{"CLUSTER_NAME": "prod-eu", "REGISTRY": "registry.example.com"}
+
+	tests := []struct {
+		name    string
+		input   string
+		strict  bool
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "defined variables are replaced",
+			input: "message: ${CLUSTER_NAME} only allows ${REGISTRY}/*",
+			want:  "message: prod-eu only allows registry.example.com/*",
+		},
+		{
+			name:  "undefined variables are kept",
+			input: "value: ${UNKNOWN}",
+			want:  "value: ${UNKNOWN}",
+		},
+		{
+			name:    "undefined variables fail in strict mode",
+			input:   "value: ${UNKNOWN} ${CLUSTER_NAME}",
+			strict:  true,
+			wantErr: true,
+		},
+		{
+			name:   "escaped placeholders are written literally",
+			input:  "value: $${CLUSTER_NAME}",
+			strict: true,
+			want:   "value: ${CLUSTER_NAME}",
+		},
+		{
+			name:  "kyverno variables are untouched",
+			input: "value: '{{ request.object.metadata.name }}'",
+			want:  "value: '{{ request.object.metadata.name }}'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := substituteVariables("policy.yaml", []byte(tt.input), vars, tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("substituteVariables() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if reason := pullFailureReason(err); reason != "SubstitutionFailed" {
+					t.Errorf("pullFailureReason() = %s, want SubstitutionFailed", reason)
+				}
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("substituteVariables() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveVariables(t *testing.T) {
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "cluster-vars", "namespace": "default"},
+		"data":       map[string]interface{}{"CLUSTER_NAME": "prod-eu", "REGISTRY": "from-configmap", "not-a-var": "x"},
+	}}
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "cluster-secrets", "namespace": "default"},
+		"data":       map[string]interface{}{"REGISTRY": base64.StdEncoding.EncodeToString([]byte("from-secret"))},
+	}}
+	dynamicClient, _ := newFakePolicyClients(configMap, secret)
+
+	config := &Config{
+		PodNamespace: "default",
+		SubstituteFrom: []kyvernov1alpha1.SubstituteReference{
+			{Kind: "ConfigMap", Name: "cluster-vars"},
+			{Kind: "Secret", Name: "cluster-secrets"},
+			{Kind: "ConfigMap", Name: "missing", Optional: true},
+		},
+		Substitute: map[string]string{"TEAM": "platform"},
+	}
+
+	vars, err := resolveVariables(config, dynamicClient)
+	if err != nil {
+		t.Fatalf("resolveVariables() error = %v", err)
+	}
+	want := map[string]string{"CLUSTER_NAME": "prod-eu", "REGISTRY": "from-secret", "TEAM": "platform"}
+	if len(vars) != len(want) {
+		t.Errorf("resolveVariables() = %v, want %v", vars, want)
+	}
+	for k, v := range want {
+		if vars[k] != v {
+			t.Errorf("%s = %q, want %q", k, vars[k], v)
+		}
+	}
+
+	config.SubstituteFrom = append(config.SubstituteFrom, kyvernov1alpha1.SubstituteReference{Kind: "Secret", Name: "required"})
+	if _, err := resolveVariables(config, dynamicClient); err == nil {
+		t.Error("resolveVariables() should fail for a missing, non-optional reference")
+	}
+}
+
+func TestPullImageToDirReal_SubstitutionChangesChecksum(t *testing.T) {
+	originalOrasPull := orasPullFunc
+	originalResolve := resolveVariablesFunc
+	originalGetDynamicClient := getDynamicClientFunc
+	defer func() {
+		orasPullFunc = originalOrasPull
+		resolveVariablesFunc = originalResolve
+		getDynamicClientFunc = originalGetDynamicClient
+	}()
+	orasPullFunc = func(config *Config, destDir string) error {
+		return os.WriteFile(filepath.Join(destDir, "policy.yaml"),
+			[]byte("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: restrict-registries\nspec:\n  pattern: \"${REGISTRY}/*\"\n"), 0644)
+	}
+	getDynamicClientFunc = func() (dynamic.Interface, error) { return nil, nil }
+
+	stateDir := t.TempDir()
+	config := &Config{
+		Provider:       ProviderArtifactory,
+		ImageBase:      "registry.example.com/policies",
+		LastFile:       filepath.Join(stateDir, "last_seen"),
+		SubstituteFrom: []kyvernov1alpha1.SubstituteReference{{Kind: "ConfigMap", Name: "cluster-vars"}},
+	}
+
+	pull := func(registry string) string {
+		t.Helper()
+		resolveVariablesFunc = func(config *Config, dynamicClient dynamic.Interface) (map[string]string, error) {
+			return map[string]string{"REGISTRY": registry}, nil
+		}
+		destDir := filepath.Join(t.TempDir(), "image")
+		checksums, err := pullImageToDirReal(config, "v1", destDir)
+		if err != nil {
+			t.Fatalf("pullImageToDirReal() error = %v", err)
+		}
+		data, err := os.ReadFile(filepath.Join(destDir, "policy.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj := unstructured.Unstructured{}
+		if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+			t.Fatal(err)
+		}
+		if pattern, _, _ := unstructured.NestedString(obj.Object, "spec", "pattern"); pattern != registry+"/*" {
+			t.Errorf("spec.pattern = %q, want %q", pattern, registry+"/*")
+		}
+		for _, checksum := range checksums {
+			return checksum
+		}
+		t.Fatal("no checksum returned")
+		return ""
+	}
+
+	first := pull("registry.example.com")
+	if variablesChanged(config) {
+		t.Error("variablesChanged() should be false right after a pull")
+	}
+
+	resolveVariablesFunc = func(config *Config, dynamicClient dynamic.Interface) (map[string]string, error) {
+		return map[string]string{"REGISTRY": "mirror.example.com"}, nil
+	}
+	if !variablesChanged(config) {
+		t.Error("variablesChanged() should be true after a value changed")
+	}
+	if second := pull("mirror.example.com"); second == first {
+		t.Error("checksum should change when a substituted value changes")
+	}
+}
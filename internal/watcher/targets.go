@@ -0,0 +1,257 @@
+package watcher
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"github.com/OctoKode/kyverno-artifact-operator/internal/k8s"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// defaultKubeconfigKey is the key of the kubeconfig Secret read when a target does not name one.
+	defaultKubeconfigKey = "value"
+	// targetTimeout bounds every request to a remote cluster, so that an unreachable cluster cannot stall the
+	// watcher for long.
+	targetTimeout = 30 * time.Second
+)
+
+// getTargetClientsFunc can be overridden in tests
+var getTargetClientsFunc = getTargetClients
+
+// targetSync is the outcome of syncing a revision to one target.
+type targetSync struct {
+	results []ApplyResult
+	stale   []kyvernov1alpha1.ObjectReference
+	// err is set when the cluster could not be synced at all, for example because it is unreachable.
+	err error
+}
+
+// cluster is a cluster the artifact is applied to: the local one, or one of spec.targets.
+type cluster struct {
+	name          string // Name of the target, empty for the local cluster
+	dynamicClient dynamic.Interface
+	mapper        meta.RESTMapper
+}
+
+// describe prefixes message with the name of a target, so that it tells which cluster it is about.
+func (c cluster) describe(message string) string {
+	if c.name == "" {
+		return message
+	}
+	return fmt.Sprintf("cluster %s: %s", c.name, message)
+}
+
+// appliedClusters returns the clusters the artifact is applied to: every target when spec.targets is set, the
+// local cluster otherwise. Checks that must see what is applied, such as safety limits, holds, freezes and smoke
+// tests, run against these rather than the local cluster. A target that cannot be reached fails the call.
+func appliedClusters(config *Config, localClient dynamic.Interface, localMapper meta.RESTMapper) ([]cluster, error) {
+	if len(config.Targets) == 0 {
+		return []cluster{{dynamicClient: localClient, mapper: localMapper}}, nil
+	}
+	clusters := make([]cluster, 0, len(config.Targets))
+	for _, target := range config.Targets {
+		dynamicClient, mapper, err := getTargetClientsFunc(config, localClient, target)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %w", target.Name, err)
+		}
+		clusters = append(clusters, cluster{name: target.Name, dynamicClient: dynamicClient, mapper: mapper})
+	}
+	return clusters, nil
+}
+
+// getTargetClients reads the kubeconfig of target from its Secret in the namespace of the KyvernoArtifact, using
+// localClient, and returns a dynamic client and REST mapper for the cluster it points to.
+func getTargetClients(config *Config, localClient dynamic.Interface, target kyvernov1alpha1.ClusterTarget) (dynamic.Interface, meta.RESTMapper, error) {
+	ref := target.KubeconfigSecretRef
+	secret, err := localClient.Resource(secretsGVR).Namespace(config.PodNamespace).Get(context.Background(), ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get Secret %s/%s: %w", config.PodNamespace, ref.Name, err)
+	}
+	encoded, found, err := unstructured.NestedString(secret.Object, "data", ref.Key)
+	if !found || err != nil {
+		return nil, nil, fmt.Errorf("secret %s/%s has no key %s", config.PodNamespace, ref.Name, ref.Key)
+	}
+	kubeconfig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode key %s of Secret %s/%s: %w", ref.Key, config.PodNamespace, ref.Name, err)
+	}
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid kubeconfig in Secret %s/%s: %w", config.PodNamespace, ref.Name, err)
+	}
+	restConfig.Timeout = targetTimeout
+	if err := k8s.ApplyRateLimits(restConfig); err != nil {
+		return nil, nil, err
+	}
+	return newKubernetesClients(restConfig)
+}
+
+// syncTargets applies the revision prepared in destDir to every target in parallel and records the outcome per
+// target in status.targets and for the artifact as a whole. In place of checksum reconciliation for the local
+// cluster, checksums is set and each target gets only the files that drifted; otherwise files are applied.
+// The revision only counts as applied once it was applied to every target, which is reported as applied.
+func syncTargets(config *Config, localClient dynamic.Interface, revision, destDir string, files []string, checksums map[string]string, retry *retryState) (bool, error) {
+	syncs := make([]targetSync, len(config.Targets))
+	var wg sync.WaitGroup
+	for i, target := range config.Targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			syncs[i] = syncTarget(config, localClient, target, destDir, files, checksums)
+		}()
+	}
+	wg.Wait()
+
+	reportTargetResults(config, localClient, revision, syncs)
+
+	var results []ApplyResult
+	for i, s := range syncs {
+		for _, r := range s.results {
+			if r.Reason != "" {
+				r.Reason = fmt.Sprintf("cluster %s: %s", config.Targets[i].Name, r.Reason)
+			}
+			results = append(results, r)
+		}
+	}
+	if checksums != nil && len(results) == 0 {
+		log.Println("All targets are up to date, no manifests to apply.")
+		return false, nil
+	}
+	if err := recordApplyResults(config, localClient, revision, results, retry); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// finishTargetSync reports the held objects of every target and, once the revision was applied to all of them,
+// smoke tests it there, like a sync of the local cluster does.
+func finishTargetSync(config *Config, localClient dynamic.Interface, mapper meta.RESTMapper, destDir, revision, previous string, applied bool, err error) error {
+	reportHeldObjects(config, localClient, mapper)
+	if err != nil || !applied {
+		return err
+	}
+	return verifyRevision(config, localClient, mapper, destDir, revision, previous)
+}
+
+// syncTarget applies, drift-checks and prunes a single target. When the cluster cannot be reached every file is
+// reported as failed, so that it is retried with the usual backoff.
+func syncTarget(config *Config, localClient dynamic.Interface, target kyvernov1alpha1.ClusterTarget, destDir string, files []string, checksums map[string]string) targetSync {
+	if checksums != nil {
+		files = make([]string, 0, len(checksums))
+		for f := range checksums {
+			files = append(files, f)
+		}
+		sort.Strings(files)
+	}
+	unreachable := func(err error) targetSync {
+		log.Printf("Failed to sync cluster %s: %v\n", target.Name, err)
+		results := make([]ApplyResult, 0, len(files))
+		for _, f := range files {
+			results = append(results, ApplyResult{File: f, Outcome: kyvernov1alpha1.ApplyOutcomeFailed, Reason: err.Error()})
+		}
+		return targetSync{results: results, err: err}
+	}
+
+	dynamicClient, mapper, err := getTargetClientsFunc(config, localClient, target)
+	if err != nil {
+		return unreachable(err)
+	}
+
+	toApply := files
+	if checksums != nil {
+		changed, changedFiles, err := checksumsChangedFunc(checksums, dynamicClient, mapper)
+		if err != nil {
+			log.Printf("Error during checksum comparison for cluster %s: %v", target.Name, err)
+		}
+		toApply = nil
+		if changed {
+			toApply = changedFiles
+		}
+	}
+
+	var synced targetSync
+	if len(toApply) > 0 {
+		log.Printf("Applying %d manifest(s) to cluster %s\n", len(toApply), target.Name)
+		synced.results, err = applyManifestsFunc(config, toApply, mapper, dynamicClient)
+		if err != nil {
+			return unreachable(fmt.Errorf("apply manifests failed: %w", err))
+		}
+	}
+
+	allFiles, err := findYAMLFiles(destDir)
+	if err == nil {
+		var pruned []ApplyResult
+		pruned, synced.stale, err = pruneStaleObjects(config, dynamicClient, mapper, allFiles)
+		synced.results = append(synced.results, pruned...)
+	}
+	if err != nil {
+		log.Printf("Warning: skipping stale object check in cluster %s: %v\n", target.Name, err)
+	}
+	return synced
+}
+
+// reportTargetResults records the outcome of syncing each target in status.targets. Targets no longer in
+// spec.targets are dropped.
+func reportTargetResults(config *Config, localClient dynamic.Interface, revision string, syncs []targetSync) {
+	err := updateArtifactStatusFunc(config, localClient, func(status *kyvernov1alpha1.KyvernoArtifactStatus) {
+		previous := make(map[string]string, len(status.Targets))
+		for _, t := range status.Targets {
+			previous[t.Name] = t.AppliedVersion
+		}
+		now := metav1.Now()
+		targets := make([]kyvernov1alpha1.TargetStatus, 0, len(config.Targets))
+		for i, target := range config.Targets {
+			s := syncs[i]
+			summary := summarizeResults(s.results)
+			t := kyvernov1alpha1.TargetStatus{
+				Name:           target.Name,
+				AppliedVersion: previous[target.Name],
+				LastSyncTime:   &now,
+				ApplySummary:   &summary,
+				FailedObjects:  failedObjectStatuses(s.results),
+				StaleObjects:   s.stale,
+			}
+			if s.err != nil {
+				t.Message = s.err.Error()
+			} else if len(t.FailedObjects) == 0 && summary.Conflicts == 0 {
+				t.AppliedVersion = revision
+			}
+			targets = append(targets, t)
+		}
+		status.Targets = targets
+	})
+	if err != nil {
+		log.Printf("Warning: failed to update KyvernoArtifact status: %v\n", err)
+	}
+}
+
+// cleanupTargets deletes the policies of this watcher from every target. A target that cannot be reached is
+// skipped, so that the others are still cleaned up.
+func cleanupTargets(config *Config, localClient dynamic.Interface) {
+	var wg sync.WaitGroup
+	for _, target := range config.Targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dynamicClient, mapper, err := getTargetClientsFunc(config, localClient, target)
+			if err != nil {
+				log.Printf("Warning: failed to clean up cluster %s: %v\n", target.Name, err)
+				return
+			}
+			log.Printf("Cleaning up cluster %s\n", target.Name)
+			cleanupPolicies(config, dynamicClient, mapper)
+		}()
+	}
+	wg.Wait()
+}
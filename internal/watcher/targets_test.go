@@ -0,0 +1,288 @@
+package watcher
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+func newKubeconfigSecret(name string, data map[string]string) *unstructured.Unstructured {
+	encoded := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		encoded[k] = base64.StdEncoding.EncodeToString([]byte(v))
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		"data":       encoded,
+	}}
+}
+
+func TestGetTargetClients_Errors(t *testing.T) {
+	localClient, _ := newFakePolicyClients(
+		newKubeconfigSecret("wrong-key", map[string]string{"kubeconfig": "apiVersion: v1\nkind: Config\n"}),
+		newKubeconfigSecret("invalid", map[string]string{"value": "not a kubeconfig"}),
+	)
+	config := &Config{PodNamespace: "default"}
+
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr string
+	}{
+		{name: "missing secret", secret: "missing", wantErr: "failed to get Secret default/missing"},
+		{name: "missing key", secret: "wrong-key", wantErr: "has no key value"},
+		{name: "invalid kubeconfig", secret: "invalid", wantErr: "invalid kubeconfig"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := kyvernov1alpha1.ClusterTarget{
+				Name:                "eu-1",
+				KubeconfigSecretRef: kyvernov1alpha1.KubeconfigSecretReference{Name: tt.secret, Key: defaultKubeconfigKey},
+			}
+			_, _, err := getTargetClients(config, localClient, target)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("getTargetClients() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSyncTargets_UnreachableClusterDoesNotBlockOthers(t *testing.T) {
+	owned := map[string]interface{}{"managed-by": "kyverno-watcher", "artifact-name": "security"}
+	destDir := t.TempDir()
+	file := filepath.Join(destDir, "require-labels.yaml")
+	if err := os.WriteFile(file, []byte("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: require-labels\n"+
+		"  labels:\n    managed-by: kyverno-watcher\n    artifact-name: security\nspec:\n  background: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	localClient, _ := newFakePolicyClients(newTestArtifact("security", "default"))
+	remoteClient, remoteMapper := newFakePolicyClients(newClusterPolicy("dropped", owned, map[string]interface{}{}))
+
+	originalGetTargetClients := getTargetClientsFunc
+	getTargetClientsFunc = func(config *Config, _ dynamic.Interface, target kyvernov1alpha1.ClusterTarget) (dynamic.Interface, meta.RESTMapper, error) {
+		if target.Name == "down" {
+			return nil, nil, errors.New("connection refused")
+		}
+		return remoteClient, remoteMapper, nil
+	}
+	defer func() { getTargetClientsFunc = originalGetTargetClients }()
+
+	config := &Config{
+		ArtifactName:     "security",
+		PodNamespace:     "default",
+		Prune:            true,
+		ApplyConcurrency: 1,
+		LastFile:         filepath.Join(t.TempDir(), "last_seen"),
+		Targets:          []kyvernov1alpha1.ClusterTarget{{Name: "down"}, {Name: "up"}},
+	}
+
+	if _, err := syncTargets(config, localClient, "v1", destDir, []string{file}, nil, nil); err == nil {
+		t.Error("syncTargets() should fail while a target is unreachable")
+	}
+
+	ctx := context.Background()
+	if _, err := remoteClient.Resource(clusterPoliciesGVR).Get(ctx, "require-labels", metav1.GetOptions{}); err != nil {
+		t.Errorf("the reachable target should get the policy: %v", err)
+	}
+	if _, err := remoteClient.Resource(clusterPoliciesGVR).Get(ctx, "dropped", metav1.GetOptions{}); err == nil {
+		t.Error("the stale policy should be pruned from the reachable target")
+	}
+	if retry, err := loadRetryState(config); err != nil || retry == nil || len(retry.Files) != 1 {
+		t.Errorf("retry state = %+v, %v, want the file to be retried", retry, err)
+	}
+
+	obj, err := localClient.Resource(kyvernoArtifactsGVR).Namespace("default").Get(ctx, "security", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var artifact kyvernov1alpha1.KyvernoArtifact
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &artifact); err != nil {
+		t.Fatal(err)
+	}
+	targets := artifact.Status.Targets
+	if len(targets) != 2 {
+		t.Fatalf("status.targets = %+v, want both targets", targets)
+	}
+	if down := targets[0]; down.AppliedVersion != "" || !strings.Contains(down.Message, "connection refused") {
+		t.Errorf("down = %+v, want it to report the unreachable cluster", down)
+	}
+	if up := targets[1]; up.AppliedVersion != "v1" || up.ApplySummary.Created != 1 || up.ApplySummary.Pruned != 1 || up.Message != "" {
+		t.Errorf("up = %+v, want v1 applied with one policy created and one pruned", up)
+	}
+	if failed := artifact.Status.FailedObjects; len(failed) != 1 || !strings.HasPrefix(failed[0].Reason, "cluster down: ") {
+		t.Errorf("failedObjects = %+v, want the file that failed on the down cluster", failed)
+	}
+	if artifact.Status.AppliedVersion != "" {
+		t.Errorf("appliedVersion = %q, the revision is not applied to every target yet", artifact.Status.AppliedVersion)
+	}
+}
+
+func TestLoadConfig_Targets(t *testing.T) {
+	originalStateDirBase := stateDirBase
+	stateDirBase = t.TempDir()
+	defer func() { stateDirBase = originalStateDirBase }()
+
+	envVars := map[string]string{
+		"GITHUB_TOKEN":               "ghp_test123",
+		"IMAGE_BASE":                 "ghcr.io/owner/package",
+		"WATCHER_TARGETS":            `[{"name":"eu-1","kubeconfigSecretRef":{"name":"eu-1-kubeconfig"}}]`,
+		"WATCHER_NAMESPACE_SELECTOR": `{"matchLabels":{"team":"payments"}}`,
+	}
+	originalGetEnvFunc := getEnvFunc
+	getEnvFunc = func(key string) string { return envVars[key] }
+	defer func() { getEnvFunc = originalGetEnvFunc }()
+
+	config := loadConfig()
+
+	if len(config.Targets) != 1 || config.Targets[0].KubeconfigSecretRef.Key != defaultKubeconfigKey {
+		t.Errorf("Targets = %+v, want one target reading the default key", config.Targets)
+	}
+	if config.NamespaceSelector != "" {
+		t.Errorf("NamespaceSelector = %q, it is not supported with targets", config.NamespaceSelector)
+	}
+}
+
+// withTargetClients has every target but the one named down use the given clients.
+func withTargetClients(t *testing.T, dynamicClient dynamic.Interface, mapper meta.RESTMapper) {
+	t.Helper()
+	originalGetTargetClients := getTargetClientsFunc
+	getTargetClientsFunc = func(config *Config, _ dynamic.Interface, target kyvernov1alpha1.ClusterTarget) (dynamic.Interface, meta.RESTMapper, error) {
+		if target.Name == "down" {
+			return nil, nil, errors.New("connection refused")
+		}
+		return dynamicClient, mapper, nil
+	}
+	t.Cleanup(func() { getTargetClientsFunc = originalGetTargetClients })
+}
+
+func TestCheckSafetyLimits_Targets(t *testing.T) {
+	// The policies exist in the target only, so the local cluster would see a first install.
+	localClient, localMapper := newFakePolicyClients(newTestArtifact("vendor", "default"))
+	remoteClient, remoteMapper := newFakePolicyClients(
+		newManagedPolicy("a", "vendor", "1"),
+		newManagedPolicy("b", "vendor", "1"),
+		newManagedPolicy("c", "vendor", "1"),
+	)
+	withTargetClients(t, remoteClient, remoteMapper)
+
+	destDir := t.TempDir()
+	writeManagedPolicies(t, destDir, "vendor", "1", "a")
+
+	config := &Config{
+		ArtifactName: "vendor",
+		PodNamespace: "default",
+		SafetyLimits: &kyvernov1alpha1.SafetyLimits{MaxRemoved: ptrInt32(1)},
+		Targets:      []kyvernov1alpha1.ClusterTarget{{Name: "up"}},
+	}
+	if !checkSafetyLimits(config, localClient, localMapper, destDir, "v2") {
+		t.Fatal("checkSafetyLimits() should hold back a revision removing too much from a target")
+	}
+	condition := meta.FindStatusCondition(getArtifactStatus(t, localClient, config).Conditions, kyvernov1alpha1.ConditionBlocked)
+	if condition == nil || condition.Reason != "LimitExceeded" || !strings.Contains(condition.Message, "cluster up: removes 2 policies") {
+		t.Errorf("Blocked condition = %+v, want the breach of the target", condition)
+	}
+
+	// An unreachable target cannot be checked, so the revision is held back.
+	config.Targets = append(config.Targets, kyvernov1alpha1.ClusterTarget{Name: "down"})
+	writeManagedPolicies(t, destDir, "vendor", "1", "b", "c")
+	if !checkSafetyLimits(config, localClient, localMapper, destDir, "v2") {
+		t.Fatal("checkSafetyLimits() should hold back a revision while a target is unreachable")
+	}
+	condition = meta.FindStatusCondition(getArtifactStatus(t, localClient, config).Conditions, kyvernov1alpha1.ConditionBlocked)
+	if condition == nil || condition.Reason != "LimitCheckFailed" {
+		t.Errorf("Blocked condition = %+v, want reason LimitCheckFailed", condition)
+	}
+}
+
+func TestReportHeldObjects_Targets(t *testing.T) {
+	localClient, localMapper := newFakePolicyClients(newTestArtifact("security", "default"))
+	remoteClient, remoteMapper := newFakePolicyClients(newHeldClusterPolicy("require-labels", nil, time.Now().Add(time.Hour)))
+	withTargetClients(t, remoteClient, remoteMapper)
+
+	config := &Config{
+		ArtifactName: "security",
+		PodNamespace: "default",
+		LastFile:     filepath.Join(t.TempDir(), "last_seen"),
+		Targets:      []kyvernov1alpha1.ClusterTarget{{Name: "up"}},
+	}
+	reportHeldObjects(config, localClient, localMapper)
+
+	held := getArtifactStatus(t, localClient, config).HeldObjects
+	if len(held) != 1 || held[0].Cluster != "up" || held[0].Name != "require-labels" {
+		t.Errorf("HeldObjects = %+v, want the policy held in the target", held)
+	}
+	if _, err := os.Stat(heldUntilPath(config)); err != nil {
+		t.Errorf("the expiry of the hold in the target should be recorded: %v", err)
+	}
+}
+
+func TestCheckFreeze_Targets(t *testing.T) {
+	owned := map[string]interface{}{"managed-by": "kyverno-watcher", "artifact-name": "security"}
+	localClient, localMapper := newFakePolicyClients(newTestArtifact("security", "default"))
+	remoteClient, remoteMapper := newFakePolicyClients(
+		newClusterPolicy("require-labels", owned, map[string]interface{}{"validationFailureAction": "Enforce"}),
+	)
+	withTargetClients(t, remoteClient, remoteMapper)
+
+	originalGetKubernetesClients := getKubernetesClientsFunc
+	getKubernetesClientsFunc = func() (dynamic.Interface, meta.RESTMapper, error) { return localClient, localMapper, nil }
+	defer func() { getKubernetesClientsFunc = originalGetKubernetesClients }()
+
+	config := &Config{
+		ArtifactName: "security",
+		PodNamespace: "default",
+		LastFile:     filepath.Join(t.TempDir(), "last_seen"),
+		Targets:      []kyvernov1alpha1.ClusterTarget{{Name: "up"}},
+	}
+	setFrozenCondition(t, localClient, config, kyvernov1alpha1.FrozenReasonAudit)
+	if frozen, _ := checkFreeze(config); !frozen {
+		t.Fatal("checkFreeze() should report the freeze")
+	}
+	obj, err := remoteClient.Resource(clusterPoliciesGVR).Get(context.Background(), "require-labels", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action, _, _ := unstructured.NestedString(obj.Object, "spec", "validationFailureAction"); action != "Audit" {
+		t.Errorf("validationFailureAction in the target = %s, want it switched to Audit", action)
+	}
+}
+
+func TestRunSmokeTestsOnClusters_Targets(t *testing.T) {
+	localClient, localMapper := newFakePolicyClients()
+	remoteClient, remoteMapper := newSmokeTestClients()
+	withTargetClients(t, remoteClient, remoteMapper)
+
+	config := &Config{ArtifactName: "vendor", PodNamespace: "policies", Targets: []kyvernov1alpha1.ClusterTarget{{Name: "up"}}}
+	dir := t.TempDir()
+	if err := runSmokeTestsOnClusters(config, localClient, localMapper, filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("runSmokeTestsOnClusters() without fixtures error = %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "pod.yaml"), []byte(smokeTestPod("unprivileged", "deny", "", nil)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := runSmokeTestsOnClusters(config, localClient, localMapper, dir)
+	var testErr *smokeTestError
+	if !errors.As(err, &testErr) || len(testErr.Failures) != 1 || testErr.Failures[0].Cluster != "up" {
+		t.Fatalf("runSmokeTestsOnClusters() error = %v, want the fixture to fail in the target", err)
+	}
+	if failed := testErr.objectFailures(); !strings.HasPrefix(failed[0].Reason, "cluster up: smoke test: ") {
+		t.Errorf("failed object reason = %q, want it to name the cluster", failed[0].Reason)
+	}
+}
@@ -3,6 +3,7 @@ package watcher
 import (
 	"context"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,14 +12,17 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
 	"github.com/OctoKode/kyverno-artifact-operator/internal/k8s"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -83,16 +87,10 @@ func Run(version string) {
 		signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
 		go func() {
 			<-c
-			log.Println("Received termination signal, cleaning up policies...")
-			kubeConfig, err := k8s.GetConfig()
-			if err != nil {
-				log.Fatalf("Error getting Kubernetes config for cleanup: %v", err)
-			}
-			dynamicClient, err := dynamic.NewForConfig(kubeConfig)
-			if err != nil {
-				log.Fatalf("Error creating dynamic client for cleanup: %v", err)
+			log.Println("Received termination signal")
+			if err := Cleanup(config); err != nil {
+				log.Fatalf("Error cleaning up policies: %v", err)
 			}
-			cleanupPolicies(config, dynamicClient)
 			os.Exit(0)
 		}()
 	}
@@ -104,82 +102,133 @@ func Run(version string) {
 		log.Printf("Starting Artifactory watcher for %s\n", config.ImageBase)
 	}
 
-	// This is the main reconciliation loop. It will run indefinitely.
+	// Replicas of the watcher elect the one that polls and applies; the others stand by until it goes away.
+	if config.LeaseName != "" {
+		if err := runElected(config, func(ctx context.Context) { poll(ctx, config) }); err != nil {
+			logFatal(err.Error())
+		}
+		return
+	}
+	poll(context.Background(), config)
+}
+
+// poll runs the main reconciliation loop until ctx is done.
+func poll(ctx context.Context, config *Config) {
+	// Namespaces starting or stopping to match the namespace selector are reconciled right away.
+	namespaceEvents := make(chan struct{}, 1)
+	if config.NamespaceSelector != "" {
+		dynamicClient, err := getDynamicClientFunc()
+		if err != nil {
+			log.Printf("Warning: failed to watch namespaces, changes are picked up on the next poll: %v\n", err)
+		} else {
+			go watchNamespaces(ctx, config, dynamicClient, namespaceEvents)
+		}
+	}
+
 	for {
 		// watchLoop contains the core logic for checking for new artifacts and applying them.
 		if err := watchLoop(config); err != nil {
 			log.Printf("Error in watch loop: %v\n", err)
 		}
 		// Wait for the configured polling interval before the next reconciliation cycle.
-		time.Sleep(time.Duration(config.PollInterval) * time.Second)
+		select {
+		case <-time.After(time.Duration(config.PollInterval) * time.Second):
+		case <-namespaceEvents:
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
-// cleanupPolicies deletes all policies and clusterpolicies associated with this watcher
-func cleanupPolicies(config *Config, dynamicClient dynamic.Interface) {
-	log.Println("Cleaning up policies...")
-
-	labelSelector := fmt.Sprintf("artifact-name=%s", config.ArtifactName)
+// Sync runs a single poll of the watcher, as the watcher pod does every polling interval. The operator uses it to
+// sync artifacts in-process.
+func Sync(config *Config) error {
+	return watchLoop(config)
+}
 
-	// Define GVRs for Kyverno policies
-	policyGVR := schema.GroupVersionResource{
-		Group:    "kyverno.io",
-		Version:  "v1",
-		Resource: "policies",
+// Cleanup deletes the policies of this watcher when it stops, unless changes are frozen or deletion has to wait
+// for a sync window. Watchers also stop for rolling updates, node drains and scale downs, so the policies are only
+// deleted once the artifact itself is gone or being deleted.
+func Cleanup(config *Config) error {
+	deleted, err := artifactDeleted(config)
+	if err != nil {
+		return err
 	}
-	clusterPolicyGVR := schema.GroupVersionResource{
-		Group:    "kyverno.io",
-		Version:  "v1",
-		Resource: "clusterpolicies",
+	if !deleted {
+		log.Println("Leaving policies in place, the artifact still exists")
+		return nil
 	}
-
-	// Delete namespaced Policies
-	if err := deleteResourcesByLabel(dynamicClient, policyGVR, "", labelSelector); err != nil {
-		log.Printf("Warning: failed to delete Policy resources: %v\n", err)
+	if frozen, _ := checkFreeze(config); frozen {
+		log.Println("Leaving policies in place while changes are frozen")
+		return nil
 	}
-
-	// Delete ClusterPolicies
-	if err := deleteResourcesByLabel(dynamicClient, clusterPolicyGVR, "", labelSelector); err != nil {
-		log.Printf("Warning: failed to delete ClusterPolicy resources: %v\n", err)
+	if !deletionAllowed(config) {
+		log.Println("Leaving policies in place outside the sync windows")
+		return nil
 	}
-
-	log.Println("Policy cleanup complete.")
+	dynamicClient, mapper, err := getKubernetesClientsFunc()
+	if err != nil {
+		return fmt.Errorf("failed to get Kubernetes clients for cleanup: %w", err)
+	}
+	if len(config.Targets) > 0 {
+		cleanupTargets(config, dynamicClient)
+	} else {
+		cleanupPolicies(config, dynamicClient, mapper)
+	}
+	return nil
 }
 
-// deleteResourcesByLabel deletes all resources of a specific kind matching the label selector
-func deleteResourcesByLabel(dynamicClient dynamic.Interface, gvr schema.GroupVersionResource, namespace string, labelSelector string) error {
-	ctx := context.Background()
+// artifactDeleted reports whether the KyvernoArtifact of this watcher is gone or being deleted. A watcher that
+// does not know its artifact cannot tell, and is treated as deleted.
+func artifactDeleted(config *Config) (bool, error) {
+	if config.ArtifactName == "" || config.PodNamespace == "" {
+		return true, nil
+	}
+	dynamicClient, err := getDynamicClientFunc()
+	if err != nil {
+		return false, fmt.Errorf("failed to get dynamic client for cleanup: %w", err)
+	}
+	obj, err := dynamicClient.Resource(kyvernoArtifactsGVR).Namespace(config.PodNamespace).Get(context.Background(), config.ArtifactName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get KyvernoArtifact %s/%s: %w", config.PodNamespace, config.ArtifactName, err)
+	}
+	return obj.GetDeletionTimestamp() != nil, nil
+}
 
-	var list *unstructured.UnstructuredList
-	var err error
+// cleanupPolicies deletes all policies associated with this watcher, of every managed Kyverno kind
+func cleanupPolicies(config *Config, dynamicClient dynamic.Interface, mapper meta.RESTMapper) {
+	log.Println("Cleaning up policies...")
 
-	if namespace == "" {
-		// List across all namespaces
-		list, err = dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{
-			LabelSelector: labelSelector,
-		})
-	} else {
-		list, err = dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{
-			LabelSelector: labelSelector,
-		})
-	}
+	resources, err := k8s.ManagedResources(mapper)
 	if err != nil {
-		return fmt.Errorf("failed to list %s: %w", gvr.Resource, err)
+		log.Printf("Warning: failed to discover managed policy kinds: %v\n", err)
+		return
 	}
 
-	for _, item := range list.Items {
-		log.Printf("Deleting %s %s...\n", item.GetKind(), item.GetName())
-		if namespace != "" {
-			err = dynamicClient.Resource(gvr).Namespace(namespace).Delete(ctx, item.GetName(), metav1.DeleteOptions{})
-		} else {
-			err = dynamicClient.Resource(gvr).Delete(ctx, item.GetName(), metav1.DeleteOptions{})
-		}
+	ctx := context.Background()
+	for _, resource := range resources {
+		list, err := listArtifactObjects(ctx, config, dynamicClient, resource.GVR)
 		if err != nil {
-			log.Printf("Failed to delete %s %s: %v\n", item.GetKind(), item.GetName(), err)
+			log.Printf("Warning: failed to delete %s: failed to list %s: %v\n", resource.GVR.Resource, resource.GVR.Resource, err)
+			continue
+		}
+		for _, item := range list.Items {
+			log.Printf("Deleting %s %s...\n", item.GetKind(), item.GetName())
+			if item.GetNamespace() != "" {
+				err = dynamicClient.Resource(resource.GVR).Namespace(item.GetNamespace()).Delete(ctx, item.GetName(), metav1.DeleteOptions{})
+			} else {
+				err = dynamicClient.Resource(resource.GVR).Delete(ctx, item.GetName(), metav1.DeleteOptions{})
+			}
+			if err != nil {
+				log.Printf("Failed to delete %s %s: %v\n", item.GetKind(), item.GetName(), err)
+			}
 		}
 	}
 
-	return nil
+	log.Println("Policy cleanup complete.")
 }
 
 // watchLoop is the core reconciliation logic for the watcher.
@@ -189,6 +238,12 @@ func watchLoop(config *Config) error {
 	var latest, prevTag string
 	var err error
 
+	// During an operator-wide freeze nothing is applied, pruned or corrected until it is lifted.
+	frozen, freezeLifted := checkFreeze(config)
+	if frozen {
+		return nil
+	}
+
 	// The behavior of the watcher depends on whether we are polling for new tags or are pinned to a specific tag.
 	if config.PollForTagChanges {
 		// If polling is enabled, check the remote registry for the latest tag.
@@ -235,6 +290,37 @@ func watchLoop(config *Config) error {
 		isTagChanged = (latest != prevTag && prevTag != "")
 	}
 
+	// Substitution variables read from ConfigMaps and Secrets can change without a new tag. The artifact
+	// rendered with the old values no longer matches, so it is applied again as if the tag had changed.
+	if !isTagChanged && prevTag != "" && variablesChanged(config) {
+		log.Printf("Substitution variables changed, reapplying %s\n", latest)
+		isTagChanged = true
+	}
+
+	// Common labels and annotations are not part of the policy checksums, so a change is applied like a new tag.
+	if !isTagChanged && prevTag != "" && commonMetadataChanged(config) {
+		log.Printf("Common labels or annotations changed, reapplying %s\n", latest)
+		isTagChanged = true
+	}
+
+	// Namespaces starting or stopping to match the namespace selector change the copies to apply and remove.
+	if !isTagChanged && prevTag != "" && namespacesChanged(config) {
+		log.Printf("Namespaces matching the namespace selector changed, reapplying %s\n", latest)
+		isTagChanged = true
+	}
+
+	// An object held with the hold-until annotation gets the artifact's version back once the hold expires.
+	if !isTagChanged && prevTag != "" && holdExpired(config) {
+		log.Printf("A hold on an object expired, reapplying %s\n", latest)
+		isTagChanged = true
+	}
+
+	// Policies switched to Audit by a freeze get the artifact's version back once it is lifted.
+	if !isTagChanged && prevTag != "" && freezeLifted {
+		log.Printf("The freeze was lifted, reapplying %s\n", latest)
+		isTagChanged = true
+	}
+
 	// The most common case is that nothing has changed. If the tag is the same and checksum-based
 	// reconciliation is disabled, we can exit early to avoid unnecessary work.
 	if !isTagChanged && !config.ReconcilePoliciesFromChecksum {
@@ -242,48 +328,120 @@ func watchLoop(config *Config) error {
 		return nil
 	}
 
+	// A revision that could not be fully applied is retried with backoff. Until the backoff expires we
+	// leave the cluster alone instead of hammering the API server with the same failing objects.
+	retry, err := loadRetryState(config)
+	if err != nil {
+		log.Printf("Warning: %v\n", err)
+	}
+	if retry != nil && retry.Revision != latest {
+		// A newer revision supersedes whatever was left to retry from the previous one.
+		log.Printf("Discarding retry state for revision %s, now at %s\n", retry.Revision, latest)
+		clearRetryState(config)
+		retry = nil
+	}
+	if retry != nil && time.Now().Before(retry.NextAttempt) {
+		log.Printf("Revision %s has %d file(s) pending retry, next attempt at %s\n",
+			latest, len(retry.Files), retry.NextAttempt.Format(time.RFC3339))
+		return nil
+	}
+
 	appliedSomething := false
+	var results []ApplyResult
+	destDir := revisionDir(config, latest)
 
 	dynamicClient, mapper, err := getKubernetesClientsFunc()
 	if err != nil {
 		return fmt.Errorf("failed to get Kubernetes clients: %w", err)
 	}
 
+	// A revision that was reverted because its smoke tests failed is not applied again until a newer one
+	// is published.
+	if config.SmokeTests != nil && config.SmokeTests.RevertOnFailure {
+		if rejected := rejectedRevision(config, dynamicClient); rejected != "" && rejected == latest {
+			log.Printf("Revision %s failed its smoke tests and was reverted, waiting for a newer revision\n", latest)
+			return nil
+		}
+	}
+
+	// Outside the sync windows, a new tag waits for the next window. The last seen tag is not updated, so it is
+	// picked up then. Reapplying after variables, common metadata, namespaces, a hold or a freeze changed waits
+	// as well; those changes are detected again on the next poll.
+	if checkSyncWindows(config, dynamicClient, latest, isTagChanged || latest != prevTag) {
+		if freezeLifted {
+			keepFreezeLifted(config)
+		}
+		return nil
+	}
+
 	// If a new tag is detected, we must re-apply all policies from the new artifact.
 	// This is the primary mechanism for rolling out new policy versions.
 	if isTagChanged {
 		log.Printf("Detected new tag: previous='%s' new='%s'. Applying all manifests.\n", prevTag, latest)
-		destDir := fmt.Sprintf("/tmp/image-%s", sanitizePath(latest))
 
 		newChecksums, err := pullImageToDirFunc(config, latest, destDir)
 		if err != nil {
+			reportRevisionFailure(config, dynamicClient, latest, pullFailureReason(err), err)
 			return fmt.Errorf("pull failed: %w", err)
 		}
 
-		var allFiles []string
+		// A revision that is not approved yet, or that changes too much at once, waits for approval. The
+		// last seen tag is not updated, so it is checked again on the next poll.
+		if checkApproval(config, dynamicClient, mapper, destDir, latest) || checkSafetyLimits(config, dynamicClient, mapper, destDir, latest) {
+			return nil
+		}
+
+		var filesToApply []string
 		for filePath := range newChecksums {
-			allFiles = append(allFiles, filePath)
+			filesToApply = append(filesToApply, filePath)
+		}
+		// When retrying, only the files that failed last time need to be applied again.
+		if retry != nil {
+			log.Printf("Retrying %d file(s) that failed to apply (attempt %d)\n", len(retry.Files), retry.Attempts+1)
+			filesToApply = retry.Files
 		}
 
-		if err := applyManifestsFunc(config, allFiles, mapper, dynamicClient); err != nil {
+		// With targets, the artifact is applied to the remote clusters instead of this one.
+		if len(config.Targets) > 0 {
+			applied, err := syncTargets(config, dynamicClient, latest, destDir, filesToApply, nil, retry)
+			return finishTargetSync(config, dynamicClient, mapper, destDir, latest, prevTag, applied, err)
+		}
+
+		results, err = applyManifestsFunc(config, filesToApply, mapper, dynamicClient)
+		if err != nil {
 			return fmt.Errorf("apply manifests failed: %w", err)
 		}
 		appliedSomething = true
 
+		results = append(results, skippedRuleResults(destDir)...)
+		results = append(results, handleStaleObjectsInDir(config, dynamicClient, mapper, destDir)...)
+
 	} else if config.ReconcilePoliciesFromChecksum {
 		// If the tag hasn't changed but checksum reconciliation is enabled, we perform a deeper check.
 		// This logic handles cases where the policy content may have changed even though the image tag
 		// is the same (e.g., a mutable tag like 'latest' was overwritten). It also helps to self-heal
 		// if policies in the cluster have been manually modified or deleted.
 		log.Printf("No tag change, but checksum reconciliation is enabled. Checking manifests.\n")
-		destDir := fmt.Sprintf("/tmp/image-%s", sanitizePath(latest))
 
 		// Pull the artifact to get the current "source of truth" checksums.
 		newChecksums, err := pullImageToDirFunc(config, latest, destDir)
 		if err != nil {
+			reportRevisionFailure(config, dynamicClient, latest, pullFailureReason(err), err)
 			return fmt.Errorf("pull failed: %w", err)
 		}
 
+		// A mutable tag can be overwritten with an artifact that is not approved or changes too much at once, too.
+		// Correcting drift of an unchanged revision is not held back by the safety limits.
+		if checkApproval(config, dynamicClient, mapper, destDir, latest) ||
+			(revisionContentChanged(config, dynamicClient, destDir, latest) && checkSafetyLimits(config, dynamicClient, mapper, destDir, latest)) {
+			return nil
+		}
+
+		if len(config.Targets) > 0 {
+			applied, err := syncTargets(config, dynamicClient, latest, destDir, nil, newChecksums, retry)
+			return finishTargetSync(config, dynamicClient, mapper, destDir, latest, prevTag, applied, err)
+		}
+
 		// Compare the checksums from the artifact with the policies currently in the cluster.
 		changed, filesToApply, err := checksumsChangedFunc(newChecksums, dynamicClient, mapper)
 		if err != nil {
@@ -292,26 +450,70 @@ func watchLoop(config *Config) error {
 
 		if changed {
 			// If any discrepancies are found, apply only the manifests that have changed.
-			if err := applyManifestsFunc(config, filesToApply, mapper, dynamicClient); err != nil {
+			results, err = applyManifestsFunc(config, filesToApply, mapper, dynamicClient)
+			if err != nil {
 				return fmt.Errorf("apply manifests failed: %w", err)
 			}
 			appliedSomething = true
+			results = append(results, skippedRuleResults(destDir)...)
 		} else {
 			log.Println("All policies are up to date, no manifests to apply.")
 		}
+
+		if pruned := handleStaleObjectsInDir(config, dynamicClient, mapper, destDir); len(pruned) > 0 {
+			results = append(results, pruned...)
+			appliedSomething = true
+		}
 	}
 
-	// If any policies were successfully applied, update the state file with the latest tag.
-	// This file acts as a bookmark, so we know which version is currently running in the cluster.
+	reportHeldObjects(config, dynamicClient, mapper)
+
 	if appliedSomething {
-		if err := os.WriteFile(config.LastFile, []byte(latest), 0644); err != nil {
-			return fmt.Errorf("failed to write last file: %w", err)
+		if err := recordApplyResults(config, dynamicClient, latest, results, retry); err != nil {
+			return err
 		}
+		// Only a fully applied revision is smoke tested.
+		return verifyRevision(config, dynamicClient, mapper, destDir, latest, prevTag)
 	}
 
 	return nil
 }
 
+// recordApplyResults decides whether a revision counts as applied. Only when every object succeeded is the
+// state file updated with the latest tag; it acts as a bookmark, so we know which version is running in the
+// cluster. Otherwise the failed files are remembered and retried with backoff on a later cycle.
+func recordApplyResults(config *Config, dynamicClient dynamic.Interface, revision string, results []ApplyResult, prev *retryState) error {
+	failed := failedFiles(results)
+	if len(failed) == 0 {
+		clearRetryState(config)
+		if err := os.WriteFile(config.LastFile, []byte(revision), 0644); err != nil {
+			return fmt.Errorf("failed to write last file: %w", err)
+		}
+		reportApplyResults(config, dynamicClient, revision, results, nil)
+		return nil
+	}
+
+	attempts := 1
+	if prev != nil {
+		attempts = prev.Attempts + 1
+	}
+	delay := retryBackoff(attempts)
+	state := &retryState{
+		Revision:    revision,
+		Files:       failed,
+		Attempts:    attempts,
+		NextAttempt: time.Now().Add(delay),
+	}
+	if err := saveRetryState(config, state); err != nil {
+		log.Printf("Warning: %v\n", err)
+	}
+	reportApplyResults(config, dynamicClient, revision, results, state)
+
+	summary := summarizeResults(results)
+	return fmt.Errorf("%d object(s) in %d file(s) failed to apply for revision %s, retrying in %s",
+		summary.Failed+summary.Conflicts, len(failed), revision, delay)
+}
+
 // getLatestTagOrDigestReal fetches the latest tag or digest for a GitHub Container Registry (GHCR) package.
 // It queries the GitHub Packages API to find the most recently updated version.
 func getLatestTagOrDigestReal(config *Config) (string, error) {
@@ -468,6 +670,10 @@ func pullImageToDirReal(config *Config, tag, destDir string) (map[string]string,
 	if err := os.RemoveAll(destDir); err != nil {
 		log.Printf("Warning: failed to remove directory %s: %v", destDir, err)
 	}
+	if err := os.RemoveAll(smokeTestDir(destDir)); err != nil {
+		log.Printf("Warning: failed to remove directory %s: %v", smokeTestDir(destDir), err)
+	}
+	saveSkippedRules(destDir, nil)
 	// Create the destination directory.
 	if err := os.MkdirAll(destDir, 0755); err != nil {
 		return nil, err
@@ -509,15 +715,50 @@ func pullImageToDirReal(config *Config, tag, destDir string) (map[string]string,
 		}
 	}
 
+	// Render a Helm chart or build a kustomization in the artifact first; the rendered objects replace the
+	// sources below.
+	if err := renderHelmChart(config, destDir); err != nil {
+		return nil, err
+	}
+	if err := renderKustomization(config, destDir); err != nil {
+		return nil, err
+	}
+
 	// After pulling, process the downloaded YAML manifests.
-	// This involves adding labels (like managed-by, policy-version, artifact-name, policy-checksum)
-	// and calculating checksums for reconciliation.
+	// This involves substituting ${VAR} placeholders, dropping objects that the include/exclude filters do not select,
+	// applying the patches, merging the global exclude into every rule, rewriting names with the
+	// configured prefix and suffix, merging the common labels and annotations,
+	// adding labels (like managed-by, policy-version, artifact-name, artifact-namespace, policy-checksum) and calculating checksums for
+	// reconciliation. The operator's labels are written last, so they always win.
 	files, err := findYAMLFiles(destDir)
 	if err != nil {
 		return nil, err
 	}
 
+	// Resolve the substitution variables once for the whole artifact.
+	var vars map[string]string
+	if substitutionEnabled(config) {
+		dynamicClient, err := getDynamicClientFunc()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Kubernetes client for substitution: %w", err)
+		}
+		vars, err = resolveVariablesFunc(config, dynamicClient)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve substitution variables: %w", err)
+		}
+	}
+
+	// Look up the namespaces to stamp namespaced objects into once for the whole artifact.
+	fanOut, err := newNamespaceFanOut(config)
+	if err != nil {
+		return nil, err
+	}
+
 	manifestChecksums := make(map[string]string)
+	var patchFailures []patchFailure
+	var excludeFailures []globalExcludeFailure
+	var skippedRules []kyvernov1alpha1.ObjectStatus
+	patchMatched := make(map[int]bool)
 	for _, f := range files {
 		data, err := os.ReadFile(f)
 		if err != nil {
@@ -525,12 +766,74 @@ func pullImageToDirReal(config *Config, tag, destDir string) (map[string]string,
 			continue
 		}
 
+		// Substitute ${VAR} placeholders first, so that everything below, including the checksum,
+		// sees the values for this cluster.
+		if vars != nil {
+			data, err = substituteVariables(f, data, vars, config.SubstituteStrict)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		var obj unstructured.Unstructured
 		if err := yaml.Unmarshal(data, &obj); err != nil {
 			log.Printf("Warning: could not unmarshal yaml for %s: %v", f, err)
 			continue
 		}
 
+		// Test fixtures are not applied. They are set aside, with their variables substituted, and submitted
+		// as dry-run creates once the revision is applied.
+		if isSmokeTest(&obj) {
+			if err := moveSmokeTest(destDir, f, data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// Drop objects the include/exclude filters do not select. Removing the file keeps them out of
+		// every later step, which all start from the files in destDir.
+		relPath, err := filepath.Rel(destDir, f)
+		if err != nil {
+			relPath = filepath.Base(f)
+		}
+		if !selectObject(config, filepath.ToSlash(relPath), &obj) {
+			log.Printf("Skipping %s %s from %s, it is filtered out\n", obj.GetKind(), obj.GetName(), relPath)
+			if err := os.Remove(f); err != nil {
+				log.Printf("Warning: failed to remove filtered file %s: %v\n", f, err)
+			}
+			continue
+		}
+
+		// Patch the object and merge the global exclude before the checksum is calculated, so that drift
+		// detection compares against the modified object. The global exclude comes last, so patches cannot
+		// remove it.
+		matched, failures := applyPatches(config, filepath.ToSlash(relPath), &obj)
+		if len(failures) > 0 {
+			patchFailures = append(patchFailures, failures...)
+			continue
+		}
+		for _, i := range matched {
+			patchMatched[i] = true
+		}
+		excluded, skipped, err := applyGlobalExclude(config.GlobalExcludeFilters, &obj)
+		skippedRules = append(skippedRules, skipped...)
+		if err != nil {
+			excludeFailures = append(excludeFailures, globalExcludeFailure{
+				APIVersion: obj.GetAPIVersion(),
+				Kind:       obj.GetKind(),
+				Namespace:  obj.GetNamespace(),
+				Name:       obj.GetName(),
+				Err:        err,
+			})
+			continue
+		}
+		if len(matched) > 0 || excluded {
+			if data, err = yaml.Marshal(&obj); err != nil {
+				log.Printf("Warning: could not marshal patched yaml for %s: %v", f, err)
+				continue
+			}
+		}
+
 		var checksum string
 		// Extract checksum from the 'spec' field if available to avoid changes in metadata
 		// triggering unnecessary updates. Fallback to full content checksum if spec is not found.
@@ -548,6 +851,11 @@ func pullImageToDirReal(config *Config, tag, destDir string) (map[string]string,
 		}
 		manifestChecksums[f] = checksum[:48] // Store first 48 chars of SHA256
 
+		// Rewrite the name before anything else reads the file, so apply, checksum reconciliation,
+		// cleanup and garbage collection all see the same name.
+		rewriteName(config, &obj)
+		applyCommonMetadata(config, &obj)
+
 		// Add standard labels to the manifest for tracking and garbage collection.
 		labels := obj.GetLabels()
 		if labels == nil {
@@ -557,10 +865,30 @@ func pullImageToDirReal(config *Config, tag, destDir string) (map[string]string,
 		labels["policy-version"] = tag
 		if config.ArtifactName != "" {
 			labels["artifact-name"] = config.ArtifactName
+			// Artifacts in different namespaces may share a name, so the namespace identifies the owner.
+			if config.PodNamespace != "" {
+				labels["artifact-namespace"] = config.PodNamespace
+			}
 		}
 		labels["policy-checksum"] = checksum[:48]
 		obj.SetLabels(labels)
 
+		// Namespaced objects are replaced by a copy in every namespace the namespace selector matches.
+		if fanOut != nil && fanOut.namespaced(&obj) {
+			copies, err := fanOut.stamp(destDir, relPath, &obj)
+			if err != nil {
+				return nil, err
+			}
+			delete(manifestChecksums, f)
+			for _, c := range copies {
+				manifestChecksums[c] = checksum[:48]
+			}
+			if err := os.Remove(f); err != nil {
+				log.Printf("Warning: failed to remove fanned out file %s: %v\n", f, err)
+			}
+			continue
+		}
+
 		// Marshal the updated manifest back to YAML and write it to disk.
 		updatedData, err := yaml.Marshal(&obj)
 		if err != nil {
@@ -574,6 +902,28 @@ func pullImageToDirReal(config *Config, tag, destDir string) (map[string]string,
 		}
 	}
 
+	if len(patchFailures) > 0 {
+		return nil, &patchError{Failures: patchFailures}
+	}
+	if len(excludeFailures) > 0 {
+		return nil, &globalExcludeError{Failures: excludeFailures}
+	}
+	for i := range config.Patches {
+		if !patchMatched[i] {
+			log.Printf("Warning: patch %d did not match any object of the artifact\n", i)
+		}
+	}
+
+	if vars != nil {
+		saveVariablesHash(config, vars)
+	}
+	saveCommonMetadataHash(config)
+	saveSkippedRules(destDir, skippedRules)
+	if fanOut != nil {
+		log.Printf("Stamping namespaced objects into %d namespace(s) matching %s\n", len(fanOut.namespaces), config.NamespaceSelector)
+		saveNamespacesHash(config, fanOut.namespaces)
+	}
+
 	return manifestChecksums, nil
 }
 
@@ -631,10 +981,15 @@ func orasPull(config *Config, destDir string) error {
 	copyOpts := oras.DefaultCopyOptions
 	copyOpts.Concurrency = 1 // Process layers sequentially.
 
-	_, err = oras.Copy(ctx, repo, tag, fs, tag, copyOpts)
+	desc, err := oras.Copy(ctx, repo, tag, fs, tag, copyOpts)
 	if err != nil {
 		return fmt.Errorf("failed to pull artifact: %w", err)
 	}
+	if config.ArtifactType == kyvernov1alpha1.ArtifactTypeHelmChart {
+		if err := saveHelmChartLayers(ctx, fs, desc, destDir); err != nil {
+			return err
+		}
+	}
 
 	log.Printf("Successfully pulled artifact to %s\n", destDir)
 
@@ -685,10 +1040,21 @@ func pullOCI(ctx context.Context, imageRef, outputDir string) error {
 
 	log.Printf("Found %d layers\n", len(layers))
 
+	// The manifest carries the org.opencontainers.image.title of each layer, which is the file name the
+	// artifact was pushed with. Using it keeps file names identical to an ORAS pull.
+	manifest, err := img.Manifest()
+	if err != nil {
+		return fmt.Errorf("getting image manifest: %w", err)
+	}
+
 	// Process each layer, extracting its content to the specified output directory.
 	fileCount := 0
 	for i, layer := range layers {
-		if err := processLayer(layer, outputDir, i, &fileCount); err != nil {
+		title := ""
+		if i < len(manifest.Layers) {
+			title = manifest.Layers[i].Annotations[ocispec.AnnotationTitle]
+		}
+		if err := processLayer(layer, outputDir, i, title, &fileCount); err != nil {
 			return fmt.Errorf("processing layer %d: %w", i, err)
 		}
 	}
@@ -703,8 +1069,9 @@ func pullOCI(ctx context.Context, imageRef, outputDir string) error {
 }
 
 // processLayer extracts the content of a single OCI layer and saves it to a file.
-// It tries to determine if the layer contains a policy and names the file accordingly.
-func processLayer(layer v1.Layer, outputDir string, layerIndex int, fileCount *int) error {
+// The file is named after the layer's title annotation when it is a safe relative path; otherwise it tries to
+// determine if the layer contains a policy and names the file accordingly.
+func processLayer(layer v1.Layer, outputDir string, layerIndex int, title string, fileCount *int) error {
 	// Determine the media type of the layer, which can hint at its content (e.g., a policy layer).
 	mediaType, err := layer.MediaType()
 	if err != nil {
@@ -743,6 +1110,23 @@ func processLayer(layer v1.Layer, outputDir string, layerIndex int, fileCount *i
 		filename = filepath.Join(outputDir, fmt.Sprintf("policy-%d.yaml", layerIndex))
 	}
 
+	// helm push does not name the chart layer, so it is saved where renderHelmChart looks for it.
+	if mediaType == HelmChartContentMediaType && title == "" {
+		filename = filepath.Join(outputDir, helmChartFile)
+	}
+
+	// Prefer the title the artifact was pushed with, as long as it stays inside outputDir.
+	if title != "" {
+		if clean := filepath.Clean(filepath.FromSlash(title)); filepath.IsLocal(clean) {
+			filename = filepath.Join(outputDir, clean)
+			if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+				return fmt.Errorf("creating directory for %s: %w", title, err)
+			}
+		} else {
+			log.Printf("  Ignoring unsafe title %q for layer %d\n", title, layerIndex)
+		}
+	}
+
 	// Write the layer's content to the file system.
 	if err := os.WriteFile(filename, content, 0644); err != nil {
 		return fmt.Errorf("writing file: %w", err)
@@ -755,40 +1139,114 @@ func processLayer(layer v1.Layer, outputDir string, layerIndex int, fileCount *i
 	return nil
 }
 
+// handleStaleObjectsInDir runs handleStaleObjects against every manifest that was pulled into destDir.
+func handleStaleObjectsInDir(config *Config, dynamicClient dynamic.Interface, mapper meta.RESTMapper, destDir string) []ApplyResult {
+	files, err := findYAMLFiles(destDir)
+	if err != nil {
+		log.Printf("Warning: skipping stale object check: %v\n", err)
+		return nil
+	}
+	return handleStaleObjects(config, dynamicClient, mapper, files)
+}
+
 // applyManifests is a wrapper for applyManifestsFunc (used for testing).
-func applyManifests(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) error {
+func applyManifests(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) ([]ApplyResult, error) {
 	return applyManifestsFunc(config, files, mapper, dynamicClient)
 }
 
-// applyManifestsReal iterates through a list of YAML files and applies each one to the Kubernetes cluster.
-// It logs the application status for each file.
-func applyManifestsReal(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) error {
+// applyManifestsReal applies a list of YAML files to the Kubernetes cluster using a pool of
+// config.ApplyConcurrency workers. It returns one result per object, in file order, so callers can tell
+// exactly what was created, updated, left unchanged or failed. A failing object never stops the remaining
+// objects from being applied. Files defining admission policy bindings are applied after all other files,
+// so that the policies they refer to exist by then.
+func applyManifestsReal(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) ([]ApplyResult, error) {
 	if len(files) == 0 {
 		log.Printf("No YAML manifests found to apply\n")
-		return nil
+		return nil, nil
+	}
+
+	workers := config.ApplyConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(files) {
+		workers = len(files)
 	}
 
-	log.Printf("Applying %d manifests ...\n", len(files))
+	log.Printf("Applying %d manifests with %d worker(s) ...\n", len(files), workers)
 
-	for _, f := range files {
-		log.Printf("Applying %s\n", f)
-		if err := applyManifestFile(f, dynamicClient, mapper); err != nil {
-			log.Printf("Failed to apply %s: %v\n", f, err)
-			// Continue with other files even if one fails, to ensure as many policies as possible are applied.
-			continue
+	var policies, bindings []int
+	for i, f := range files {
+		if hasAdmissionPolicyBinding(f) {
+			bindings = append(bindings, i)
+		} else {
+			policies = append(policies, i)
 		}
-		log.Printf("Successfully applied %s\n", f)
 	}
 
-	return nil
+	// Each worker writes only to its own slot, so results keep the order of files without locking.
+	perFile := make([][]ApplyResult, len(files))
+	for _, wave := range [][]int{policies, bindings} {
+		indexes := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range indexes {
+					perFile[i] = applyManifestFileWithResults(config, files[i], dynamicClient, mapper)
+				}
+			}()
+		}
+		for _, i := range wave {
+			indexes <- i
+		}
+		close(indexes)
+		wg.Wait()
+	}
+
+	var results []ApplyResult
+	for _, fileResults := range perFile {
+		results = append(results, fileResults...)
+	}
+
+	summary := summarizeResults(results)
+	log.Printf("Apply complete: %d created, %d updated, %d unchanged, %d failed, %d conflicting\n",
+		summary.Created, summary.Updated, summary.Unchanged, summary.Failed, summary.Conflicts)
+
+	return results, nil
+}
+
+// applyManifestFileWithResults applies a single file and logs the outcome of each object. A file that
+// cannot be read or decoded is reported as a single failed result.
+func applyManifestFileWithResults(config *Config, f string, dynamicClient dynamic.Interface, mapper meta.RESTMapper) []ApplyResult {
+	log.Printf("Applying %s\n", f)
+	results, err := applyManifestFile(config, f, dynamicClient, mapper)
+	if err != nil {
+		log.Printf("Failed to apply %s: %v\n", f, err)
+		return append(results, ApplyResult{
+			File:    f,
+			Outcome: kyvernov1alpha1.ApplyOutcomeFailed,
+			Reason:  err.Error(),
+		})
+	}
+	for _, r := range results {
+		if r.Outcome == kyvernov1alpha1.ApplyOutcomeFailed || r.Outcome == kyvernov1alpha1.ApplyOutcomeConflict {
+			log.Printf("Failed to apply %s %s/%s from %s: %s\n", r.Kind, r.Namespace, r.Name, f, r.Reason)
+		} else {
+			log.Printf("%s %s %s/%s from %s\n", r.Outcome, r.Kind, r.Namespace, r.Name, f)
+		}
+	}
+	return results
 }
 
 // applyManifestFile reads a YAML file and applies its content(s) to the Kubernetes cluster.
-// It supports multi-document YAML files (where documents are separated by '---').
-func applyManifestFile(filePath string, dynamicClient dynamic.Interface, mapper meta.RESTMapper) error {
+// It supports multi-document YAML files (where documents are separated by '---') and returns a result
+// for every document it applied. The error is only set when the file itself cannot be read or decoded.
+func applyManifestFile(config *Config, filePath string, dynamicClient dynamic.Interface, mapper meta.RESTMapper) ([]ApplyResult, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer func() {
 		_ = f.Close() // Close the file when the function exits.
@@ -797,6 +1255,7 @@ func applyManifestFile(filePath string, dynamicClient dynamic.Interface, mapper
 	// Use a YAML or JSON decoder to handle different input formats.
 	decoder := k8syaml.NewYAMLOrJSONDecoder(f, 4096)
 	docIndex := 0
+	var results []ApplyResult
 
 	// Iterate through each document in the (potentially multi-document) YAML file.
 	for {
@@ -805,7 +1264,7 @@ func applyManifestFile(filePath string, dynamicClient dynamic.Interface, mapper
 			if err == io.EOF {
 				break // End of file, no more documents.
 			}
-			return fmt.Errorf("failed to decode YAML document %d: %w", docIndex, err)
+			return results, fmt.Errorf("failed to decode YAML document %d: %w", docIndex, err)
 		}
 
 		// Skip empty documents (e.g., documents with only comments or whitespace).
@@ -815,25 +1274,55 @@ func applyManifestFile(filePath string, dynamicClient dynamic.Interface, mapper
 		}
 
 		// Apply the current Kubernetes resource (document) to the cluster.
-		if err := applyResource(obj, dynamicClient, mapper); err != nil {
-			return fmt.Errorf("failed to apply document %d: %w", docIndex, err)
+		result := ApplyResult{
+			File:       filePath,
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+		}
+		if isAdmissionPolicyBinding(obj) {
+			if err := checkBoundPolicy(obj, dynamicClient, mapper); err != nil {
+				result.Outcome = kyvernov1alpha1.ApplyOutcomeFailed
+				result.Reason = fmt.Sprintf("document %d: %v", docIndex, err)
+				results = append(results, result)
+				docIndex++
+				continue
+			}
 		}
+		outcome, err := applyResource(config, obj, dynamicClient, mapper)
+		result.Outcome = outcome
+		// applyResource may have cleared the namespace of a cluster-scoped object.
+		result.Namespace = obj.GetNamespace()
+		if err != nil {
+			result.Reason = fmt.Sprintf("document %d: %v", docIndex, err)
+		}
+		var conflict *ownershipConflictError
+		if stderrors.As(err, &conflict) {
+			result.Owner = conflict.Owner
+			result.OwnerNamespace = conflict.OwnerNamespace
+		}
+		results = append(results, result)
 
 		docIndex++
 	}
 
-	return nil
+	return results, nil
 }
 
 // applyResource applies a single unstructured Kubernetes resource (e.g., a Policy or ClusterPolicy) to the cluster.
 // It handles both creation and updates, and correctly identifies whether a resource is namespaced or cluster-scoped.
-func applyResource(obj *unstructured.Unstructured, dynamicClient dynamic.Interface, mapper meta.RESTMapper) error {
+// An existing object whose spec, labels and annotations already match is left untouched, and an existing object
+// that belongs to another artifact is refused with an ownershipConflictError unless it was handed over. An existing
+// object that is not managed by any watcher is adopted or refused according to spec.adoption. An existing object
+// held with the hold-until annotation is left as it is until the hold expires.
+func applyResource(config *Config, obj *unstructured.Unstructured, dynamicClient dynamic.Interface, mapper meta.RESTMapper) (kyvernov1alpha1.ApplyOutcome, error) {
 	// Use the Kubernetes REST mapper to get the GroupVersionResource (GVR) for the object.
 	// The GVR is needed to interact with the dynamic client and correctly pluralize resource names.
 	gvk := obj.GroupVersionKind()
 	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
 	if err != nil {
-		return fmt.Errorf("failed to get REST mapping for %s (CRD may not be installed): %w", gvk.String(), err)
+		return kyvernov1alpha1.ApplyOutcomeFailed, fmt.Errorf("failed to get REST mapping for %s (CRD may not be installed): %w", gvk.String(), err)
 	}
 	gvr := mapping.Resource
 
@@ -873,26 +1362,67 @@ func applyResource(obj *unstructured.Unstructured, dynamicClient dynamic.Interfa
 			_, err = dynamicClient.Resource(gvr).Create(ctx, obj, metav1.CreateOptions{})
 		}
 		if err != nil {
-			return fmt.Errorf("failed to create resource: %w", err)
+			return kyvernov1alpha1.ApplyOutcomeFailed, fmt.Errorf("failed to create resource: %w", err)
 		}
+		return kyvernov1alpha1.ApplyOutcomeCreated, nil
 	} else if err != nil {
 		// An unexpected error occurred while trying to fetch the resource.
-		return fmt.Errorf("failed to get existing resource: %w", err)
+		return kyvernov1alpha1.ApplyOutcomeFailed, fmt.Errorf("failed to get existing resource: %w", err)
+	}
+
+	if err := checkOwnership(existing, obj); err != nil {
+		return kyvernov1alpha1.ApplyOutcomeConflict, err
+	}
+	if _, held := isHeld(existing); held {
+		return kyvernov1alpha1.ApplyOutcomeHeld, nil
+	}
+	if err := checkAdoption(config, existing, obj); err != nil {
+		return kyvernov1alpha1.ApplyOutcomeConflict, err
+	}
+
+	if isUpToDate(existing, obj) {
+		return kyvernov1alpha1.ApplyOutcomeUnchanged, nil
+	}
+
+	// Resource already exists, so update it.
+	// It's crucial to set the ResourceVersion from the existing object to prevent conflicts.
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	if isNamespaced && namespace != "" {
+		_, err = dynamicClient.Resource(gvr).Namespace(namespace).Update(ctx, obj, metav1.UpdateOptions{})
 	} else {
-		// Resource already exists, so update it.
-		// It's crucial to set the ResourceVersion from the existing object to prevent conflicts.
-		obj.SetResourceVersion(existing.GetResourceVersion())
-		if isNamespaced && namespace != "" {
-			_, err = dynamicClient.Resource(gvr).Namespace(namespace).Update(ctx, obj, metav1.UpdateOptions{})
-		} else {
-			_, err = dynamicClient.Resource(gvr).Update(ctx, obj, metav1.UpdateOptions{})
+		_, err = dynamicClient.Resource(gvr).Update(ctx, obj, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return kyvernov1alpha1.ApplyOutcomeFailed, fmt.Errorf("failed to update resource: %w", err)
+	}
+
+	return kyvernov1alpha1.ApplyOutcomeUpdated, nil
+}
+
+// isUpToDate reports whether the object in the cluster already carries the desired spec, labels and annotations.
+// Only the spec fields set in the artifact are compared, since Kyverno fills in defaults for the others. Fields
+// removed from the artifact change the policy-checksum label, so they are still caught by the label check.
+func isUpToDate(existing, desired *unstructured.Unstructured) bool {
+	if _, ok := containsFields(existing.Object["spec"], desired.Object["spec"], "spec"); !ok {
+		return false
+	}
+	existingLabels := existing.GetLabels()
+	for k, v := range desired.GetLabels() {
+		if existingLabels[k] != v {
+			return false
 		}
-		if err != nil {
-			return fmt.Errorf("failed to update resource: %w", err)
+	}
+	existingAnnotations := existing.GetAnnotations()
+	// A changed hash means common labels or annotations were changed or removed, which the subset checks cannot see.
+	if existingAnnotations[kyvernov1alpha1.CommonMetadataHashAnnotation] != desired.GetAnnotations()[kyvernov1alpha1.CommonMetadataHashAnnotation] {
+		return false
+	}
+	for k, v := range desired.GetAnnotations() {
+		if existingAnnotations[k] != v {
+			return false
 		}
 	}
-
-	return nil
+	return true
 }
 
 func findYAMLFiles(dir string) ([]string, error) {
@@ -912,6 +1442,15 @@ func findYAMLFiles(dir string) ([]string, error) {
 	return files, err
 }
 
+// revisionDir returns the directory revision is pulled into.
+func revisionDir(config *Config, revision string) string {
+	pullDir := config.PullDir
+	if pullDir == "" {
+		pullDir = "/tmp"
+	}
+	return filepath.Join(pullDir, "image-"+sanitizePath(revision))
+}
+
 func sanitizePath(s string) string {
 	s = strings.ReplaceAll(s, ":", "_")
 	s = strings.ReplaceAll(s, "/", "_")
@@ -1,17 +1,27 @@
 package watcher
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -197,7 +207,7 @@ func TestGetEnvOrDefault(t *testing.T) {
 				t.Setenv(tt.key, tt.envValue)
 			}
 
-			got := getEnvOrDefault(tt.key, tt.defaultValue)
+			got := getEnvOrDefault(getEnvFunc, tt.key, tt.defaultValue)
 			if got != tt.want {
 				t.Errorf("getEnvOrDefault(%q, %q) = %q, want %q", tt.key, tt.defaultValue, got, tt.want)
 			}
@@ -262,7 +272,7 @@ func TestGetEnvAsIntOrDefault(t *testing.T) {
 				t.Setenv(tt.key, tt.envValue)
 			}
 
-			got := getEnvAsIntOrDefault(tt.key, tt.defaultValue)
+			got := getEnvAsIntOrDefault(getEnvFunc, tt.key, tt.defaultValue)
 			if got != tt.want {
 				t.Errorf("getEnvAsIntOrDefault(%q, %d) = %d, want %d", tt.key, tt.defaultValue, got, tt.want)
 			}
@@ -337,7 +347,7 @@ func TestLoadConfigProvider(t *testing.T) {
 				"IMAGE_BASE":   "ghcr.io/owner/package",
 			},
 			wantErr:     true,
-			errContains: "Unsupported PROVIDER: invalid",
+			errContains: "unsupported PROVIDER: invalid",
 		},
 		{
 			name: "github provider - missing token",
@@ -383,7 +393,7 @@ func TestLoadConfigProvider(t *testing.T) {
 				"IMAGE_BASE":   "invalid",
 			},
 			wantErr:     true,
-			errContains: "Failed to parse IMAGE_BASE",
+			errContains: "failed to parse IMAGE_BASE",
 		},
 	}
 
@@ -530,9 +540,9 @@ func TestWatchLoopProviderBehavior(t *testing.T) {
 
 			originalApplyManifestsFunc := applyManifestsFunc
 			applyManifestsCalled := false
-			applyManifestsFunc = func(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) error {
+			applyManifestsFunc = func(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) ([]ApplyResult, error) {
 				applyManifestsCalled = true
-				return nil
+				return nil, nil
 			}
 			defer func() {
 				applyManifestsFunc = originalApplyManifestsFunc
@@ -815,7 +825,7 @@ func TestProcessLayer(t *testing.T) {
 				mediaType: tt.mediaType,
 			}
 
-			err := processLayer(layer, tmpDir, i, &fileCount)
+			err := processLayer(layer, tmpDir, i, "", &fileCount)
 			if err != nil {
 				t.Errorf("processLayer() error = %v", err)
 			}
@@ -1079,10 +1089,10 @@ func TestWatchLoopReconciliationLogic(t *testing.T) {
 
 			// Mock applyManifestsFunc
 			originalApplyManifestsFunc := applyManifestsFunc
-			applyManifestsFunc = func(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) error {
+			applyManifestsFunc = func(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) ([]ApplyResult, error) {
 				applyCalled = true
 				appliedFiles = files
-				return nil
+				return nil, nil
 			}
 			defer func() { applyManifestsFunc = originalApplyManifestsFunc }()
 
@@ -1307,9 +1317,9 @@ func TestWatchLoop_PollingDisabled(t *testing.T) {
 			defer func() { checksumsChangedFunc = originalChecksumsChanged }()
 
 			originalApplyManifestsFunc := applyManifestsFunc
-			applyManifestsFunc = func(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) error {
+			applyManifestsFunc = func(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) ([]ApplyResult, error) {
 				applyCalled = true
-				return nil
+				return nil, nil
 			}
 			defer func() { applyManifestsFunc = originalApplyManifestsFunc }()
 
@@ -1347,3 +1357,832 @@ func TestWatchLoop_PollingDisabled(t *testing.T) {
 		})
 	}
 }
+
+// validatingPoliciesGVR is the GroupVersionResource of the ValidatingPolicy kind newFakePolicyClients serves.
+var validatingPoliciesGVR = schema.GroupVersionResource{Group: "policies.kyverno.io", Version: "v1alpha1", Resource: "validatingpolicies"}
+
+// newFakePolicyClients returns a fake dynamic client and REST mapper that know about Kyverno
+// Policy, ClusterPolicy and ValidatingPolicy resources, seeded with the given objects.
+func newFakePolicyClients(objects ...runtime.Object) (*fakedynamic.FakeDynamicClient, meta.RESTMapper) {
+	policyGVK := schema.GroupVersionKind{Group: "kyverno.io", Version: "v1", Kind: "Policy"}
+	clusterPolicyGVK := schema.GroupVersionKind{Group: "kyverno.io", Version: "v1", Kind: "ClusterPolicy"}
+
+	validatingPolicyGVK := schema.GroupVersionKind{Group: "policies.kyverno.io", Version: "v1alpha1", Kind: "ValidatingPolicy"}
+
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{policyGVK.GroupVersion(), validatingPolicyGVK.GroupVersion()})
+	mapper.Add(policyGVK, meta.RESTScopeNamespace)
+	mapper.Add(clusterPolicyGVK, meta.RESTScopeRoot)
+	mapper.Add(validatingPolicyGVK, meta.RESTScopeRoot)
+
+	scheme := runtime.NewScheme()
+	listKinds := map[schema.GroupVersionResource]string{
+		{Group: "kyverno.io", Version: "v1", Resource: "policies"}:        "PolicyList",
+		{Group: "kyverno.io", Version: "v1", Resource: "clusterpolicies"}: "ClusterPolicyList",
+		validatingPoliciesGVR: "ValidatingPolicyList",
+		kyvernoArtifactsGVR:   "KyvernoArtifactList",
+		namespacesGVR:         "NamespaceList",
+	}
+	return fakedynamic.NewSimpleDynamicClientWithCustomListKinds(scheme, listKinds, objects...), mapper
+}
+
+func newValidatingPolicy(name string, labels map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "policies.kyverno.io/v1alpha1",
+			"kind":       "ValidatingPolicy",
+			"metadata": map[string]interface{}{
+				"name":   name,
+				"labels": labels,
+			},
+			"spec": map[string]interface{}{},
+		},
+	}
+}
+
+func newClusterPolicy(name string, labels map[string]interface{}, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "kyverno.io/v1",
+			"kind":       "ClusterPolicy",
+			"metadata": map[string]interface{}{
+				"name":   name,
+				"labels": labels,
+			},
+			"spec": spec,
+		},
+	}
+}
+
+func TestApplyResource_Outcomes(t *testing.T) {
+	spec := map[string]interface{}{"background": true}
+	labels := map[string]interface{}{"managed-by": "kyverno-watcher", "policy-checksum": "abc"}
+
+	tests := []struct {
+		name     string
+		existing []runtime.Object
+		desired  *unstructured.Unstructured
+		want     kyvernov1alpha1.ApplyOutcome
+		wantErr  bool
+	}{
+		{
+			name:    "created when missing",
+			desired: newClusterPolicy("require-labels", labels, spec),
+			want:    kyvernov1alpha1.ApplyOutcomeCreated,
+		},
+		{
+			name:     "unchanged when spec and labels match",
+			existing: []runtime.Object{newClusterPolicy("require-labels", labels, spec)},
+			desired:  newClusterPolicy("require-labels", labels, spec),
+			want:     kyvernov1alpha1.ApplyOutcomeUnchanged,
+		},
+		{
+			name: "unchanged when the server defaulted fields",
+			existing: []runtime.Object{newClusterPolicy("require-labels", labels, map[string]interface{}{
+				"background":              true,
+				"admission":               true,
+				"validationFailureAction": "Audit",
+				"rules": []interface{}{map[string]interface{}{
+					"name":                   "check-team",
+					"skipBackgroundRequests": true,
+					"match":                  map[string]interface{}{"any": []interface{}{map[string]interface{}{"resources": map[string]interface{}{"kinds": []interface{}{"Pod"}}}}},
+				}},
+			})},
+			desired: newClusterPolicy("require-labels", labels, map[string]interface{}{
+				"background": true,
+				"rules": []interface{}{map[string]interface{}{
+					"name":  "check-team",
+					"match": map[string]interface{}{"any": []interface{}{map[string]interface{}{"resources": map[string]interface{}{"kinds": []interface{}{"Pod"}}}}},
+				}},
+			}),
+			want: kyvernov1alpha1.ApplyOutcomeUnchanged,
+		},
+		{
+			name: "updated when a rule was removed from the cluster",
+			existing: []runtime.Object{newClusterPolicy("require-labels", labels, map[string]interface{}{
+				"background": true,
+				"rules":      []interface{}{},
+			})},
+			desired: newClusterPolicy("require-labels", labels, map[string]interface{}{
+				"background": true,
+				"rules":      []interface{}{map[string]interface{}{"name": "check-team"}},
+			}),
+			want: kyvernov1alpha1.ApplyOutcomeUpdated,
+		},
+		{
+			name:     "updated when spec differs",
+			existing: []runtime.Object{newClusterPolicy("require-labels", labels, map[string]interface{}{"background": false})},
+			desired:  newClusterPolicy("require-labels", labels, spec),
+			want:     kyvernov1alpha1.ApplyOutcomeUpdated,
+		},
+		{
+			name:     "updated when a label differs",
+			existing: []runtime.Object{newClusterPolicy("require-labels", map[string]interface{}{"policy-checksum": "old"}, spec)},
+			desired:  newClusterPolicy("require-labels", labels, spec),
+			want:     kyvernov1alpha1.ApplyOutcomeUpdated,
+		},
+		{
+			name:     "conflict when owned by another artifact",
+			existing: []runtime.Object{newClusterPolicy("require-labels", map[string]interface{}{"artifact-name": "team-a"}, spec)},
+			desired:  newClusterPolicy("require-labels", map[string]interface{}{"artifact-name": "team-b"}, spec),
+			want:     kyvernov1alpha1.ApplyOutcomeConflict,
+			wantErr:  true,
+		},
+		{
+			name:     "conflict when owned by an artifact of the same name in another namespace",
+			existing: []runtime.Object{newClusterPolicy("require-labels", map[string]interface{}{"artifact-name": "team-a", "artifact-namespace": "ns-a"}, spec)},
+			desired:  newClusterPolicy("require-labels", map[string]interface{}{"artifact-name": "team-a", "artifact-namespace": "ns-b"}, spec),
+			want:     kyvernov1alpha1.ApplyOutcomeConflict,
+			wantErr:  true,
+		},
+		{
+			name: "updated when handed over to this artifact",
+			existing: []runtime.Object{func() *unstructured.Unstructured {
+				obj := newClusterPolicy("require-labels", map[string]interface{}{"artifact-name": "team-a"}, spec)
+				obj.SetAnnotations(map[string]string{kyvernov1alpha1.HandoverAnnotation: "team-b"})
+				return obj
+			}()},
+			desired: newClusterPolicy("require-labels", map[string]interface{}{"artifact-name": "team-b"}, spec),
+			want:    kyvernov1alpha1.ApplyOutcomeUpdated,
+		},
+		{
+			name: "updated when common metadata was removed",
+			existing: []runtime.Object{func() *unstructured.Unstructured {
+				obj := newClusterPolicy("require-labels", map[string]interface{}{"managed-by": "kyverno-watcher", "policy-checksum": "abc", "team": "platform"}, spec)
+				obj.SetAnnotations(map[string]string{kyvernov1alpha1.CommonMetadataHashAnnotation: "0123456789abcdef"})
+				return obj
+			}()},
+			desired: newClusterPolicy("require-labels", labels, spec),
+			want:    kyvernov1alpha1.ApplyOutcomeUpdated,
+		},
+		{
+			name: "failed when kind is unknown",
+			desired: &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "example.com/v1",
+				"kind":       "Unknown",
+				"metadata":   map[string]interface{}{"name": "x"},
+			}},
+			want:    kyvernov1alpha1.ApplyOutcomeFailed,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dynamicClient, mapper := newFakePolicyClients(tt.existing...)
+
+			got, err := applyResource(&Config{Adoption: kyvernov1alpha1.AdoptionAlways}, tt.desired, dynamicClient, mapper)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyResource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("applyResource() outcome = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyResource_Adoption(t *testing.T) {
+	clusterPolicyGVR := schema.GroupVersionResource{Group: "kyverno.io", Version: "v1", Resource: "clusterpolicies"}
+	spec := map[string]interface{}{"background": true}
+	managed := map[string]interface{}{"managed-by": "kyverno-watcher", "artifact-name": "vendor", "policy-checksum": "abc"}
+
+	tests := []struct {
+		name        string
+		adoption    string
+		existing    *unstructured.Unstructured
+		want        kyvernov1alpha1.ApplyOutcome
+		wantAdopted bool
+	}{
+		{
+			name:     "never leaves an unmanaged object alone",
+			adoption: kyvernov1alpha1.AdoptionNever,
+			existing: newClusterPolicy("require-labels", nil, spec),
+			want:     kyvernov1alpha1.ApplyOutcomeConflict,
+		},
+		{
+			name:        "ifIdentical adopts an object with the same spec",
+			adoption:    kyvernov1alpha1.AdoptionIfIdentical,
+			existing:    newClusterPolicy("require-labels", map[string]interface{}{"team": "platform"}, spec),
+			want:        kyvernov1alpha1.ApplyOutcomeUpdated,
+			wantAdopted: true,
+		},
+		{
+			name:     "ifIdentical adopts an object whose spec was defaulted",
+			adoption: kyvernov1alpha1.AdoptionIfIdentical,
+			existing: newClusterPolicy("require-labels", nil, map[string]interface{}{
+				"background": true, "admission": true, "validationFailureAction": "Audit",
+			}),
+			want:        kyvernov1alpha1.ApplyOutcomeUpdated,
+			wantAdopted: true,
+		},
+		{
+			name:     "ifIdentical leaves an object with another spec alone",
+			adoption: kyvernov1alpha1.AdoptionIfIdentical,
+			existing: newClusterPolicy("require-labels", nil, map[string]interface{}{"background": false}),
+			want:     kyvernov1alpha1.ApplyOutcomeConflict,
+		},
+		{
+			name:        "always adopts and overwrites",
+			adoption:    kyvernov1alpha1.AdoptionAlways,
+			existing:    newClusterPolicy("require-labels", nil, map[string]interface{}{"background": false}),
+			want:        kyvernov1alpha1.ApplyOutcomeUpdated,
+			wantAdopted: true,
+		},
+		{
+			name:     "never does not affect managed objects",
+			adoption: kyvernov1alpha1.AdoptionNever,
+			existing: newClusterPolicy("require-labels", managed, map[string]interface{}{"background": false}),
+			want:     kyvernov1alpha1.ApplyOutcomeUpdated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dynamicClient, mapper := newFakePolicyClients(tt.existing)
+
+			got, err := applyResource(&Config{Adoption: tt.adoption}, newClusterPolicy("require-labels", managed, spec), dynamicClient, mapper)
+			if got != tt.want {
+				t.Fatalf("applyResource() outcome = %s, want %s (error: %v)", got, tt.want, err)
+			}
+			if _, unmanaged := err.(*unmanagedObjectError); unmanaged != (tt.want == kyvernov1alpha1.ApplyOutcomeConflict) {
+				t.Errorf("applyResource() error = %v", err)
+			}
+
+			obj, err := dynamicClient.Resource(clusterPolicyGVR).Get(context.Background(), "require-labels", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			adoptedAt, adopted := obj.GetAnnotations()[kyvernov1alpha1.AdoptedAtAnnotation]
+			if adopted != tt.wantAdopted {
+				t.Errorf("adopted-at annotation = %q, want adopted %v", adoptedAt, tt.wantAdopted)
+			}
+			if tt.wantAdopted && obj.GetLabels()["artifact-name"] != "vendor" {
+				t.Errorf("labels = %v, an adopted object should get the tracking labels", obj.GetLabels())
+			}
+			if tt.want == kyvernov1alpha1.ApplyOutcomeConflict && obj.GetLabels()["managed-by"] != "" {
+				t.Errorf("labels = %v, a refused object must not be changed", obj.GetLabels())
+			}
+
+			// The annotation survives later updates, which replace the object with the one from the artifact.
+			if tt.wantAdopted {
+				desired := newClusterPolicy("require-labels", managed, map[string]interface{}{"background": false})
+				if _, err := applyResource(&Config{Adoption: tt.adoption}, desired, dynamicClient, mapper); err != nil {
+					t.Fatal(err)
+				}
+				obj, err := dynamicClient.Resource(clusterPolicyGVR).Get(context.Background(), "require-labels", metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := obj.GetAnnotations()[kyvernov1alpha1.AdoptedAtAnnotation]; got != adoptedAt {
+					t.Errorf("adopted-at annotation after update = %q, want %q", got, adoptedAt)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyManifestsReal_PerObjectResults(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.yaml")
+	bad := filepath.Join(dir, "bad.yaml")
+	multi := "apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: a\nspec: {}\n---\n" +
+		"apiVersion: example.com/v1\nkind: Unknown\nmetadata:\n  name: b\n"
+	if err := os.WriteFile(good, []byte("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: c\nspec: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bad, []byte(multi), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dynamicClient, mapper := newFakePolicyClients()
+	results, err := applyManifestsReal(&Config{}, []string{good, bad}, mapper, dynamicClient)
+	if err != nil {
+		t.Fatalf("applyManifestsReal() error = %v", err)
+	}
+
+	summary := summarizeResults(results)
+	if summary.Created != 2 || summary.Failed != 1 {
+		t.Errorf("summary = %+v, want 2 created and 1 failed", summary)
+	}
+	if got := failedFiles(results); len(got) != 1 || got[0] != bad {
+		t.Errorf("failedFiles() = %v, want [%s]", got, bad)
+	}
+}
+
+func TestWatchLoop_FailedApplyIsRetriedWithBackoff(t *testing.T) {
+	originalGetK8sClients := getKubernetesClientsFunc
+	getKubernetesClientsFunc = func() (dynamic.Interface, meta.RESTMapper, error) { return nil, nil, nil }
+	defer func() { getKubernetesClientsFunc = originalGetK8sClients }()
+
+	originalTagChangedFunc := tagChangedFunc
+	tagChangedFunc = func(config *Config) (bool, string, string, error) {
+		prev, _ := os.ReadFile(config.LastFile)
+		return string(prev) != "v2", "v2", string(prev), nil
+	}
+	defer func() { tagChangedFunc = originalTagChangedFunc }()
+
+	originalPullImageToDirFunc := pullImageToDirFunc
+	pullImageToDirFunc = func(config *Config, tag, destDir string) (map[string]string, error) {
+		return map[string]string{"a.yaml": "1", "b.yaml": "2"}, nil
+	}
+	defer func() { pullImageToDirFunc = originalPullImageToDirFunc }()
+
+	var appliedFiles []string
+	failB := true
+	originalApplyManifestsFunc := applyManifestsFunc
+	applyManifestsFunc = func(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) ([]ApplyResult, error) {
+		appliedFiles = append([]string(nil), files...)
+		var results []ApplyResult
+		for _, f := range files {
+			outcome := kyvernov1alpha1.ApplyOutcomeCreated
+			if f == "b.yaml" && failB {
+				outcome = kyvernov1alpha1.ApplyOutcomeFailed
+			}
+			results = append(results, ApplyResult{File: f, Outcome: outcome})
+		}
+		return results, nil
+	}
+	defer func() { applyManifestsFunc = originalApplyManifestsFunc }()
+
+	config := &Config{PollForTagChanges: true, StateDir: t.TempDir()}
+	config.LastFile = filepath.Join(config.StateDir, "last_seen")
+
+	// First cycle: b.yaml fails, so the revision must not be recorded as applied.
+	if err := watchLoop(config); err == nil {
+		t.Fatal("watchLoop() expected an error when an object fails to apply")
+	}
+	if _, err := os.Stat(config.LastFile); !os.IsNotExist(err) {
+		t.Fatal("last_seen must not be written when an object failed")
+	}
+	state, err := loadRetryState(config)
+	if err != nil || state == nil {
+		t.Fatalf("expected retry state, got %v (err %v)", state, err)
+	}
+	if state.Attempts != 1 || len(state.Files) != 1 || state.Files[0] != "b.yaml" {
+		t.Errorf("unexpected retry state %+v", state)
+	}
+
+	// Second cycle within the backoff window does nothing.
+	appliedFiles = nil
+	if err := watchLoop(config); err != nil {
+		t.Fatalf("watchLoop() during backoff returned error: %v", err)
+	}
+	if appliedFiles != nil {
+		t.Errorf("expected no apply during backoff, applied %v", appliedFiles)
+	}
+
+	// Once the backoff has expired only the failed file is retried, and success records the revision.
+	state.NextAttempt = time.Now().Add(-time.Second)
+	if err := saveRetryState(config, state); err != nil {
+		t.Fatal(err)
+	}
+	failB = false
+	if err := watchLoop(config); err != nil {
+		t.Fatalf("watchLoop() retry returned error: %v", err)
+	}
+	if len(appliedFiles) != 1 || appliedFiles[0] != "b.yaml" {
+		t.Errorf("expected only b.yaml to be retried, applied %v", appliedFiles)
+	}
+	if last, _ := os.ReadFile(config.LastFile); string(last) != "v2" {
+		t.Errorf("last_seen = %q, want v2", string(last))
+	}
+	if state, _ := loadRetryState(config); state != nil {
+		t.Errorf("retry state should be cleared after success, got %+v", state)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 3, want: 2 * time.Minute},
+		{attempts: 10, want: retryMaxDelay},
+	}
+	for _, tt := range tests {
+		if got := retryBackoff(tt.attempts); got != tt.want {
+			t.Errorf("retryBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestChecksumsChanged_ListsEachResourceOnce(t *testing.T) {
+	dir := t.TempDir()
+	labels := map[string]interface{}{"managed-by": "kyverno-watcher"}
+	spec := map[string]interface{}{"background": true}
+
+	specBytes, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameChecksum := calculateSHA256(specBytes)[:48]
+
+	checksums := make(map[string]string)
+	for _, name := range []string{"unchanged", "changed", "missing"} {
+		f := filepath.Join(dir, name+".yaml")
+		content := fmt.Sprintf("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: %s\nspec:\n  background: true\n", name)
+		if err := os.WriteFile(f, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		checksums[f] = sameChecksum
+	}
+
+	dynamicClient, mapper := newFakePolicyClients(
+		newClusterPolicy("unchanged", labels, spec),
+		newClusterPolicy("changed", labels, map[string]interface{}{"background": false}),
+	)
+
+	changed, files, err := checksumsChanged(checksums, dynamicClient, mapper)
+	if err != nil {
+		t.Fatalf("checksumsChanged() error = %v", err)
+	}
+	if !changed {
+		t.Error("checksumsChanged() should report a change")
+	}
+	want := []string{filepath.Join(dir, "changed.yaml"), filepath.Join(dir, "missing.yaml")}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Errorf("checksumsChanged() files = %v, want %v", files, want)
+	}
+
+	var lists, gets int
+	for _, action := range dynamicClient.Actions() {
+		switch action.GetVerb() {
+		case "list":
+			lists++
+		case "get":
+			gets++
+		}
+	}
+	if lists != 1 || gets != 0 {
+		t.Errorf("expected 1 list and 0 gets, got %d lists and %d gets", lists, gets)
+	}
+}
+
+func TestApplyManifestsReal_ConcurrentKeepsFileOrder(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for i := 0; i < 20; i++ {
+		f := filepath.Join(dir, fmt.Sprintf("policy-%02d.yaml", i))
+		content := fmt.Sprintf("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: policy-%02d\nspec: {}\n", i)
+		if err := os.WriteFile(f, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+
+	dynamicClient, mapper := newFakePolicyClients()
+	results, err := applyManifestsReal(&Config{ApplyConcurrency: 8}, files, mapper, dynamicClient)
+	if err != nil {
+		t.Fatalf("applyManifestsReal() error = %v", err)
+	}
+	if len(results) != len(files) {
+		t.Fatalf("got %d results, want %d", len(results), len(files))
+	}
+	for i, r := range results {
+		if r.File != files[i] {
+			t.Errorf("result %d is for %s, want %s", i, r.File, files[i])
+		}
+		if r.Outcome != kyvernov1alpha1.ApplyOutcomeCreated {
+			t.Errorf("result %d outcome = %s, want Created", i, r.Outcome)
+		}
+	}
+}
+
+func TestRewriteName(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		wantName   string
+		wantOrigin string
+	}{
+		{
+			name:     "no prefix or suffix",
+			config:   &Config{},
+			wantName: "require-labels",
+		},
+		{
+			name:       "prefix and suffix",
+			config:     &Config{NamePrefix: "vendor-", NameSuffix: "-v2"},
+			wantName:   "vendor-require-labels-v2",
+			wantOrigin: "require-labels",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := newClusterPolicy("require-labels", nil, map[string]interface{}{})
+			rewriteName(tt.config, obj)
+			if obj.GetName() != tt.wantName {
+				t.Errorf("name = %q, want %q", obj.GetName(), tt.wantName)
+			}
+			if got := obj.GetAnnotations()[kyvernov1alpha1.OriginalNameAnnotation]; got != tt.wantOrigin {
+				t.Errorf("original-name annotation = %q, want %q", got, tt.wantOrigin)
+			}
+		})
+	}
+}
+
+func TestPullImageToDirReal_RewritesNames(t *testing.T) {
+	originalOrasPull := orasPullFunc
+	defer func() { orasPullFunc = originalOrasPull }()
+	orasPullFunc = func(config *Config, destDir string) error {
+		return os.WriteFile(filepath.Join(destDir, "policy.yaml"),
+			[]byte("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: require-labels\nspec:\n  background: true\n"), 0644)
+	}
+
+	config := &Config{
+		Provider:     ProviderArtifactory,
+		ImageBase:    "registry.example.com/policies",
+		ArtifactName: "vendor-bundle",
+		NamePrefix:   "vendor-",
+	}
+	destDir := t.TempDir()
+	checksums, err := pullImageToDirReal(config, "v1", destDir)
+	if err != nil {
+		t.Fatalf("pullImageToDirReal() error = %v", err)
+	}
+
+	// Every later step reads the rewritten file, so the renamed object is what gets applied and compared.
+	dynamicClient, mapper := newFakePolicyClients()
+	changed, files, err := checksumsChanged(checksums, dynamicClient, mapper)
+	if err != nil || !changed || len(files) != 1 {
+		t.Fatalf("checksumsChanged() = %v, %v, %v; want the new file to be applied", changed, files, err)
+	}
+	if _, err := applyManifestsReal(config, files, mapper, dynamicClient); err != nil {
+		t.Fatalf("applyManifestsReal() error = %v", err)
+	}
+	gvr := schema.GroupVersionResource{Group: "kyverno.io", Version: "v1", Resource: "clusterpolicies"}
+	obj, err := dynamicClient.Resource(gvr).Get(context.Background(), "vendor-require-labels", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("renamed policy not found: %v", err)
+	}
+	if obj.GetLabels()["artifact-name"] != "vendor-bundle" {
+		t.Errorf("artifact-name label = %q, want vendor-bundle", obj.GetLabels()["artifact-name"])
+	}
+
+	changed, _, err = checksumsChanged(checksums, dynamicClient, mapper)
+	if err != nil || changed {
+		t.Errorf("checksumsChanged() after apply = %v, %v; want no change", changed, err)
+	}
+}
+
+func TestPullImageToDirReal_CommonMetadata(t *testing.T) {
+	originalOrasPull := orasPullFunc
+	defer func() { orasPullFunc = originalOrasPull }()
+	orasPullFunc = func(config *Config, destDir string) error {
+		return os.WriteFile(filepath.Join(destDir, "policy.yaml"),
+			[]byte("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: require-labels\n  labels:\n    team: vendor\nspec:\n  background: true\n"), 0644)
+	}
+
+	config := &Config{
+		Provider:          ProviderArtifactory,
+		ImageBase:         "registry.example.com/policies",
+		ArtifactName:      "security",
+		CommonLabels:      map[string]string{"team": "platform", "artifact-name": "spoofed"},
+		CommonAnnotations: map[string]string{"policies.kyverno.io/severity": "medium"},
+	}
+	destDir := t.TempDir()
+	if _, err := pullImageToDirReal(config, "v1", destDir); err != nil {
+		t.Fatalf("pullImageToDirReal() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(destDir, "policy.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var obj unstructured.Unstructured
+	if err := yaml.Unmarshal(data, &obj); err != nil {
+		t.Fatal(err)
+	}
+	labels := obj.GetLabels()
+	if labels["team"] != "platform" {
+		t.Errorf("team label = %q, want the common label to override the artifact's", labels["team"])
+	}
+	if labels["artifact-name"] != "security" {
+		t.Errorf("artifact-name label = %q, want the operator's label to win", labels["artifact-name"])
+	}
+	annotations := obj.GetAnnotations()
+	if annotations["policies.kyverno.io/severity"] != "medium" {
+		t.Errorf("severity annotation = %q, want medium", annotations["policies.kyverno.io/severity"])
+	}
+	if annotations[kyvernov1alpha1.CommonMetadataHashAnnotation] == "" {
+		t.Error("common metadata hash annotation should be set")
+	}
+}
+
+func TestWatchLoop_CommonMetadataChanged(t *testing.T) {
+	var applied []string
+	originalGetK8sClients := getKubernetesClientsFunc
+	getKubernetesClientsFunc = func() (dynamic.Interface, meta.RESTMapper, error) { return nil, nil, nil }
+	defer func() { getKubernetesClientsFunc = originalGetK8sClients }()
+	originalPullImageToDirFunc := pullImageToDirFunc
+	pullImageToDirFunc = func(config *Config, tag, destDir string) (map[string]string, error) {
+		saveCommonMetadataHash(config)
+		return map[string]string{"file.yaml": "checksum"}, nil
+	}
+	defer func() { pullImageToDirFunc = originalPullImageToDirFunc }()
+	originalChecksumsChanged := checksumsChangedFunc
+	checksumsChangedFunc = func(newChecksums map[string]string, dynamicClient dynamic.Interface, mapper meta.RESTMapper) (bool, []string, error) {
+		return false, nil, nil
+	}
+	defer func() { checksumsChangedFunc = originalChecksumsChanged }()
+	originalApplyManifestsFunc := applyManifestsFunc
+	applyManifestsFunc = func(config *Config, files []string, mapper meta.RESTMapper, dynamicClient dynamic.Interface) ([]ApplyResult, error) {
+		applied = append(applied, files...)
+		return nil, nil
+	}
+	defer func() { applyManifestsFunc = originalApplyManifestsFunc }()
+
+	config := &Config{
+		ImageBase:                     "ghcr.io/owner/image:v1.0.0",
+		ReconcilePoliciesFromChecksum: true,
+		LastFile:                      filepath.Join(t.TempDir(), "last_seen"),
+	}
+	if err := os.WriteFile(config.LastFile, []byte("v1.0.0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	saveCommonMetadataHash(config)
+
+	// The policy checksums do not cover common metadata, so only the stored hash reveals the change.
+	config.CommonLabels = map[string]string{"team": "platform"}
+	if err := watchLoop(config); err != nil {
+		t.Fatalf("watchLoop() error = %v", err)
+	}
+	if len(applied) != 1 {
+		t.Fatalf("applied = %v, want every file reapplied after common labels changed", applied)
+	}
+
+	applied = nil
+	if err := watchLoop(config); err != nil {
+		t.Fatalf("watchLoop() error = %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("applied = %v, want nothing applied once the common labels were rendered", applied)
+	}
+
+	// Removing the common metadata is a change as well.
+	config.CommonLabels = nil
+	if err := watchLoop(config); err != nil {
+		t.Fatalf("watchLoop() error = %v", err)
+	}
+	if len(applied) != 1 {
+		t.Errorf("applied = %v, want every file reapplied after common labels were removed", applied)
+	}
+}
+
+func TestLoadConfig_CommonMetadata(t *testing.T) {
+	originalStateDirBase := stateDirBase
+	stateDirBase = t.TempDir()
+	defer func() { stateDirBase = originalStateDirBase }()
+
+	envVars := map[string]string{
+		"GITHUB_TOKEN":               "ghp_test123",
+		"IMAGE_BASE":                 "ghcr.io/owner/package",
+		"WATCHER_COMMON_LABELS":      `{"team":"platform","managed-by":"someone-else"}`,
+		"WATCHER_COMMON_ANNOTATIONS": `{"policies.kyverno.io/severity":"medium"}`,
+	}
+	originalGetEnvFunc := getEnvFunc
+	getEnvFunc = func(key string) string { return envVars[key] }
+	defer func() { getEnvFunc = originalGetEnvFunc }()
+
+	config := loadConfig()
+
+	if config.CommonLabels["team"] != "platform" {
+		t.Errorf("CommonLabels = %v, want team=platform", config.CommonLabels)
+	}
+	if _, ok := config.CommonLabels["managed-by"]; ok {
+		t.Error("reserved label managed-by should be dropped from CommonLabels")
+	}
+	if config.CommonAnnotations["policies.kyverno.io/severity"] != "medium" {
+		t.Errorf("CommonAnnotations = %v, want severity=medium", config.CommonAnnotations)
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	envVars := map[string]string{
+		"GITHUB_TOKEN":     "ghp_test123",
+		"IMAGE_BASE":       "ghcr.io/owner/package",
+		"ARTIFACT_NAME":    "security",
+		"WATCHER_ADOPTION": `"never"`,
+	}
+	stateDir := filepath.Join(t.TempDir(), "default", "security")
+
+	config, err := NewConfig(func(key string) string { return envVars[key] }, stateDir)
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+	if config.ArtifactName != "security" || config.Adoption != kyvernov1alpha1.AdoptionNever {
+		t.Errorf("NewConfig() = %+v, want it read from getenv", config)
+	}
+	if config.LastFile != filepath.Join(stateDir, "last_seen") {
+		t.Errorf("LastFile = %s, want it in the state directory", config.LastFile)
+	}
+
+	// Invalid settings are returned instead of exiting, since the operator syncs in-process artifacts with it.
+	envVars["WATCHER_ADOPTION"] = `"sometimes"`
+	if _, err := NewConfig(func(key string) string { return envVars[key] }, stateDir); err == nil || !strings.Contains(err.Error(), "invalid adoption") {
+		t.Errorf("NewConfig() error = %v, want the invalid adoption reported", err)
+	}
+
+	// The lease of the replicas lives in their namespace.
+	envVars["WATCHER_ADOPTION"] = ""
+	envVars["WATCHER_LEASE_NAME"] = "kyverno-artifact-manager-security"
+	if _, err := NewConfig(func(key string) string { return envVars[key] }, stateDir); err == nil || !strings.Contains(err.Error(), "requires POD_NAMESPACE") {
+		t.Errorf("NewConfig() error = %v, want the missing namespace reported", err)
+	}
+	envVars["POD_NAMESPACE"] = "default"
+	envVars["HOSTNAME"] = "kyverno-artifact-manager-security-7d9f8-x2k4p"
+	config, err = NewConfig(func(key string) string { return envVars[key] }, stateDir)
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+	if config.LeaseName != "kyverno-artifact-manager-security" || config.Identity != envVars["HOSTNAME"] {
+		t.Errorf("NewConfig() = %+v, want the lease and the identity of the replica", config)
+	}
+
+	// Plain artifacts are the default, also under the name the documentation used to give them.
+	if config.ArtifactType != kyvernov1alpha1.ArtifactTypeOCIImage {
+		t.Errorf("ArtifactType = %q, want %q", config.ArtifactType, kyvernov1alpha1.ArtifactTypeOCIImage)
+	}
+	for value, want := range map[string]string{"oci": kyvernov1alpha1.ArtifactTypeOCIImage, "helm-chart": kyvernov1alpha1.ArtifactTypeHelmChart} {
+		envVars["WATCHER_ARTIFACT_TYPE"] = value
+		config, err = NewConfig(func(key string) string { return envVars[key] }, stateDir)
+		if err != nil || config.ArtifactType != want {
+			t.Errorf("NewConfig() with type %s = %v, %v, want %s", value, config, err, want)
+		}
+	}
+}
+
+func TestPullImageToDirReal_Filters(t *testing.T) {
+	originalOrasPull := orasPullFunc
+	defer func() { orasPullFunc = originalOrasPull }()
+	orasPullFunc = func(config *Config, destDir string) error {
+		for _, name := range []string{"baseline/require-labels", "restricted/disallow-privileged"} {
+			file := filepath.Join(destDir, name+".yaml")
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				return err
+			}
+			content := "apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: " + filepath.Base(name) + "\nspec: {}\n"
+			if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	config := &Config{
+		Provider:  ProviderArtifactory,
+		ImageBase: "registry.example.com/policies",
+		Include:   []kyvernov1alpha1.ObjectFilter{{Path: "baseline/*.yaml"}},
+	}
+	destDir := t.TempDir()
+	checksums, err := pullImageToDirReal(config, "v1", destDir)
+	if err != nil {
+		t.Fatalf("pullImageToDirReal() error = %v", err)
+	}
+
+	if len(checksums) != 1 {
+		t.Errorf("checksums = %v, want only the baseline policy", checksums)
+	}
+	files, err := findYAMLFiles(destDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || !strings.HasSuffix(files[0], filepath.Join("baseline", "require-labels.yaml")) {
+		t.Errorf("files left in destDir = %v, want only baseline/require-labels.yaml", files)
+	}
+}
+
+func TestProcessLayer_UsesTitle(t *testing.T) {
+	tests := []struct {
+		name      string
+		title     string
+		mediaType string
+		wantFile  string
+	}{
+		{name: "title with directory", title: "baseline/require-labels.yaml", wantFile: "baseline/require-labels.yaml"},
+		{name: "unsafe title falls back", title: "../escape.yaml", wantFile: "policy-0.yaml"},
+		{name: "unnamed chart layer", mediaType: HelmChartContentMediaType, wantFile: helmChartFile},
+		{name: "named chart layer", title: "kyverno-policies-3.0.0.tgz", mediaType: HelmChartContentMediaType, wantFile: "kyverno-policies-3.0.0.tgz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fileCount := 0
+			mediaType := tt.mediaType
+			if mediaType == "" {
+				mediaType = PolicyLayerMediaType
+			}
+			layer := &mockLayer{content: []byte("kind: ClusterPolicy"), mediaType: mediaType}
+			if err := processLayer(layer, dir, 0, tt.title, &fileCount); err != nil {
+				t.Fatalf("processLayer() error = %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(tt.wantFile))); err != nil {
+				t.Errorf("expected %s to be written: %v", tt.wantFile, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package watcher
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+// maxWindowSteps bounds the search for the next time applying is allowed, for schedules that never allow it.
+const maxWindowSteps = 10000
+
+// syncWindow is a parsed spec.syncWindows.windows entry.
+type syncWindow struct {
+	allow    bool
+	schedule cron.Schedule
+	duration time.Duration
+}
+
+// syncWindows is a parsed spec.syncWindows.
+type syncWindows struct {
+	location *time.Location
+	windows  []syncWindow
+	hasAllow bool
+}
+
+// parseSyncWindows parses spec, which is nil when no windows are configured.
+func parseSyncWindows(spec *kyvernov1alpha1.SyncWindows) (*syncWindows, error) {
+	if spec == nil {
+		return nil, nil
+	}
+	location := time.UTC
+	if spec.TimeZone != "" {
+		var err error
+		if location, err = time.LoadLocation(spec.TimeZone); err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", spec.TimeZone, err)
+		}
+	}
+	parsed := &syncWindows{location: location}
+	for _, w := range spec.Windows {
+		schedule, err := cron.ParseStandard(w.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", w.Schedule, err)
+		}
+		if w.Duration.Duration <= 0 {
+			return nil, fmt.Errorf("window %q must have a positive duration", w.Schedule)
+		}
+		allow := w.Kind == kyvernov1alpha1.SyncWindowAllow
+		parsed.hasAllow = parsed.hasAllow || allow
+		parsed.windows = append(parsed.windows, syncWindow{allow: allow, schedule: schedule, duration: w.Duration.Duration})
+	}
+	return parsed, nil
+}
+
+// openedAt returns when the earliest occurrence of w that is open at t opened.
+func (w syncWindow) openedAt(t time.Time) (time.Time, bool) {
+	start := w.schedule.Next(t.Add(-w.duration))
+	return start, !start.After(t)
+}
+
+// allowed reports whether applying is allowed at t: no deny window is open and, if there are allow windows,
+// one of them is.
+func (s *syncWindows) allowed(t time.Time) bool {
+	t = t.In(s.location)
+	allowed := !s.hasAllow
+	for _, w := range s.windows {
+		if _, open := w.openedAt(t); open {
+			if !w.allow {
+				return false
+			}
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+// nextAllowed returns the first time from t on at which applying is allowed. It steps through the times at which
+// windows open and close, as only those can change the outcome.
+func (s *syncWindows) nextAllowed(t time.Time) (time.Time, bool) {
+	t = t.In(s.location)
+	for i := 0; i < maxWindowSteps; i++ {
+		if s.allowed(t) {
+			return t, true
+		}
+		var next time.Time
+		for _, w := range s.windows {
+			candidates := []time.Time{w.schedule.Next(t)}
+			if start, open := w.openedAt(t); open {
+				candidates = append(candidates, start.Add(w.duration))
+			}
+			for _, c := range candidates {
+				if !c.IsZero() && c.After(t) && (next.IsZero() || c.Before(next)) {
+					next = c
+				}
+			}
+		}
+		if next.IsZero() {
+			return time.Time{}, false
+		}
+		t = next
+	}
+	return time.Time{}, false
+}
+
+// syncWindowsFor parses config.SyncWindows, which loadConfig validated. It returns nil when there are none.
+func syncWindowsFor(config *Config) *syncWindows {
+	windows, err := parseSyncWindows(config.SyncWindows)
+	if err != nil {
+		log.Printf("Warning: ignoring invalid sync windows: %v\n", err)
+		return nil
+	}
+	return windows
+}
+
+// obeysSyncWindows reports whether an operation configured with setting waits for an allowed window. It obeys
+// them unless setting is ignore, or when setting is unset and defaultObey is false.
+func obeysSyncWindows(setting *string, defaultObey bool) bool {
+	if setting == nil {
+		return defaultObey
+	}
+	return *setting == kyvernov1alpha1.SyncWindowObey
+}
+
+// deletionAllowed reports whether policies may be deleted now.
+func deletionAllowed(config *Config) bool {
+	windows := syncWindowsFor(config)
+	return windows == nil || !obeysSyncWindows(config.SyncWindows.Deletion, true) || windows.allowed(time.Now())
+}
+
+// checkSyncWindows reports whether a revision must wait for the next sync window, and records whether one is open
+// in the OutsideSyncWindow condition. A new revision, or the current one rendered differently, always obeys the
+// windows; reapplying it to correct drift only obeys them when spec.syncWindows.driftCorrection is obey.
+func checkSyncWindows(config *Config, dynamicClient dynamic.Interface, revision string, newRevision bool) bool {
+	windows := syncWindowsFor(config)
+	if windows == nil {
+		return false
+	}
+
+	now := time.Now()
+	open, reason, message := true, "WindowOpen", "A sync window is open"
+	if !windows.allowed(now) {
+		open, reason = false, "WindowClosed"
+		message = "No sync window is open and the schedules never open one"
+		if next, ok := windows.nextAllowed(now); ok {
+			message = fmt.Sprintf("No sync window is open, the next one opens at %s", next.Format(time.RFC3339))
+		}
+	}
+
+	if dynamicClient != nil {
+		status := metav1.ConditionTrue
+		if open {
+			status = metav1.ConditionFalse
+		}
+		err := updateArtifactStatusFunc(config, dynamicClient, func(s *kyvernov1alpha1.KyvernoArtifactStatus) {
+			meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+				Type:    kyvernov1alpha1.ConditionOutsideSyncWindow,
+				Status:  status,
+				Reason:  reason,
+				Message: message,
+			})
+		})
+		if err != nil {
+			log.Printf("Warning: failed to update KyvernoArtifact status: %v\n", err)
+		}
+	}
+
+	if open || (!newRevision && !obeysSyncWindows(config.SyncWindows.DriftCorrection, false)) {
+		return false
+	}
+	log.Printf("Revision %s waits for the next sync window. %s\n", revision, message)
+	return true
+}
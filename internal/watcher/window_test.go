@@ -0,0 +1,260 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	kyvernov1alpha1 "github.com/OctoKode/kyverno-artifact-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+func newSyncWindow(kind, schedule string, duration time.Duration) kyvernov1alpha1.SyncWindow {
+	return kyvernov1alpha1.SyncWindow{Kind: kind, Schedule: schedule, Duration: metav1.Duration{Duration: duration}}
+}
+
+func TestSyncWindows_NextAllowed(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data is not available: %v", err)
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, berlin)
+	}
+
+	// Monday to Thursday from 8:00 to 16:00, except over lunch.
+	workdays := &kyvernov1alpha1.SyncWindows{
+		TimeZone: "Europe/Berlin",
+		Windows: []kyvernov1alpha1.SyncWindow{
+			newSyncWindow(kyvernov1alpha1.SyncWindowAllow, "0 8 * * 1-4", 8*time.Hour),
+			newSyncWindow(kyvernov1alpha1.SyncWindowDeny, "0 12 * * *", time.Hour),
+		},
+	}
+	nightly := &kyvernov1alpha1.SyncWindows{
+		Windows: []kyvernov1alpha1.SyncWindow{newSyncWindow(kyvernov1alpha1.SyncWindowDeny, "0 2 * * *", 4*time.Hour)},
+	}
+
+	tests := []struct {
+		name     string
+		spec     *kyvernov1alpha1.SyncWindows
+		now      time.Time
+		wantOpen bool
+		wantNext time.Time
+	}{
+		{name: "inside an allow window", spec: workdays, now: at(19, 9, 0), wantOpen: true, wantNext: at(19, 9, 0)},
+		{name: "deny window wins", spec: workdays, now: at(19, 12, 30), wantNext: at(19, 13, 0)},
+		{name: "allow window is closed at its end", spec: workdays, now: at(22, 16, 0), wantNext: at(26, 8, 0)},
+		{name: "over the weekend and a time zone change", spec: workdays, now: at(23, 9, 0), wantNext: at(26, 8, 0)},
+		{
+			name:     "only deny windows",
+			spec:     nightly,
+			now:      time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2026, 10, 19, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "outside deny windows",
+			spec:     nightly,
+			now:      time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC),
+			wantOpen: true,
+			wantNext: time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := parseSyncWindows(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if open := windows.allowed(tt.now); open != tt.wantOpen {
+				t.Errorf("allowed() = %v, want %v", open, tt.wantOpen)
+			}
+			next, ok := windows.nextAllowed(tt.now)
+			if !ok || !next.Equal(tt.wantNext) {
+				t.Errorf("nextAllowed() = %v, %v, want %v", next, ok, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestParseSyncWindows_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    *kyvernov1alpha1.SyncWindows
+		wantErr string
+	}{
+		{
+			name: "invalid time zone",
+			spec: &kyvernov1alpha1.SyncWindows{TimeZone: "Mars/Olympus", Windows: []kyvernov1alpha1.SyncWindow{
+				newSyncWindow(kyvernov1alpha1.SyncWindowAllow, "0 8 * * *", time.Hour),
+			}},
+			wantErr: "invalid time zone",
+		},
+		{
+			name: "invalid schedule",
+			spec: &kyvernov1alpha1.SyncWindows{Windows: []kyvernov1alpha1.SyncWindow{
+				newSyncWindow(kyvernov1alpha1.SyncWindowAllow, "every morning", time.Hour),
+			}},
+			wantErr: "invalid schedule",
+		},
+		{
+			name: "no duration",
+			spec: &kyvernov1alpha1.SyncWindows{Windows: []kyvernov1alpha1.SyncWindow{
+				newSyncWindow(kyvernov1alpha1.SyncWindowAllow, "0 8 * * *", 0),
+			}},
+			wantErr: "positive duration",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseSyncWindows(tt.spec); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseSyncWindows() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSyncWindows(t *testing.T) {
+	// Open only at midnight on leap days, so closed whenever the test runs.
+	closed := []kyvernov1alpha1.SyncWindow{newSyncWindow(kyvernov1alpha1.SyncWindowAllow, "0 0 29 2 *", time.Minute)}
+	open := []kyvernov1alpha1.SyncWindow{newSyncWindow(kyvernov1alpha1.SyncWindowDeny, "0 0 29 2 *", time.Minute)}
+
+	tests := []struct {
+		name            string
+		windows         []kyvernov1alpha1.SyncWindow
+		driftCorrection *string
+		newRevision     bool
+		wantWait        bool
+		wantCondition   metav1.ConditionStatus
+	}{
+		{name: "new revision inside a window", windows: open, newRevision: true, wantCondition: metav1.ConditionFalse},
+		{name: "new revision outside the windows", windows: closed, newRevision: true, wantWait: true, wantCondition: metav1.ConditionTrue},
+		{name: "drift correction ignores the windows by default", windows: closed, wantCondition: metav1.ConditionTrue},
+		{
+			name:            "drift correction obeying the windows",
+			windows:         closed,
+			driftCorrection: ptrString(kyvernov1alpha1.SyncWindowObey),
+			wantWait:        true,
+			wantCondition:   metav1.ConditionTrue,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				ArtifactName: "security",
+				PodNamespace: "default",
+				SyncWindows:  &kyvernov1alpha1.SyncWindows{Windows: tt.windows, DriftCorrection: tt.driftCorrection},
+			}
+			dynamicClient, _ := newFakePolicyClients(newTestArtifact("security", "default"))
+
+			if wait := checkSyncWindows(config, dynamicClient, "v2", tt.newRevision); wait != tt.wantWait {
+				t.Errorf("checkSyncWindows() = %v, want %v", wait, tt.wantWait)
+			}
+			status := getArtifactStatus(t, dynamicClient, config)
+			condition := meta.FindStatusCondition(status.Conditions, kyvernov1alpha1.ConditionOutsideSyncWindow)
+			if condition == nil || condition.Status != tt.wantCondition {
+				t.Fatalf("OutsideSyncWindow condition = %+v, want status %s", condition, tt.wantCondition)
+			}
+			if tt.wantCondition == metav1.ConditionTrue && !strings.Contains(condition.Message, "the next one opens at") {
+				t.Errorf("OutsideSyncWindow message = %q, want the time the next window opens", condition.Message)
+			}
+		})
+	}
+}
+
+func TestWatchLoop_ReapplyObeysSyncWindows(t *testing.T) {
+	dynamicClient, mapper := newFakePolicyClients(newTestArtifact("security", "default"))
+	originalGetK8sClients := getKubernetesClientsFunc
+	getKubernetesClientsFunc = func() (dynamic.Interface, meta.RESTMapper, error) { return dynamicClient, mapper, nil }
+	defer func() { getKubernetesClientsFunc = originalGetK8sClients }()
+
+	originalTagChangedFunc := tagChangedFunc
+	tagChangedFunc = func(config *Config) (bool, string, string, error) { return false, "v1", "v1", nil }
+	defer func() { tagChangedFunc = originalTagChangedFunc }()
+
+	pulled := false
+	originalPullImageToDirFunc := pullImageToDirFunc
+	pullImageToDirFunc = func(config *Config, tag, destDir string) (map[string]string, error) {
+		pulled = true
+		return map[string]string{}, nil
+	}
+	defer func() { pullImageToDirFunc = originalPullImageToDirFunc }()
+
+	// Open only at midnight on leap days, so closed whenever the test runs.
+	closed := []kyvernov1alpha1.SyncWindow{newSyncWindow(kyvernov1alpha1.SyncWindowAllow, "0 0 29 2 *", time.Minute)}
+	config := &Config{
+		PollForTagChanges: true,
+		StateDir:          t.TempDir(),
+		ArtifactName:      "security",
+		PodNamespace:      "default",
+		CommonLabels:      map[string]string{"team": "platform"},
+		SyncWindows:       &kyvernov1alpha1.SyncWindows{Windows: closed},
+	}
+	config.LastFile = filepath.Join(config.StateDir, "last_seen")
+	if err := os.WriteFile(config.LastFile, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// An audit freeze was lifted since the last poll.
+	if err := os.WriteFile(freezePath(config), []byte(kyvernov1alpha1.FrozenReasonAudit), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := watchLoop(config); err != nil {
+		t.Fatalf("watchLoop() error = %v", err)
+	}
+	if pulled {
+		t.Fatal("changed common labels and a lifted freeze must not be applied outside the sync windows")
+	}
+	if reason, _ := os.ReadFile(freezePath(config)); string(reason) != kyvernov1alpha1.FrozenReasonAudit {
+		t.Errorf("freeze file = %q, want the lifted freeze kept for the next window", reason)
+	}
+}
+
+func TestHandleStaleObjects_DeletionObeysSyncWindows(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "keep.yaml")
+	if err := os.WriteFile(file, []byte("apiVersion: kyverno.io/v1\nkind: ClusterPolicy\nmetadata:\n  name: keep\nspec: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	owned := map[string]interface{}{"managed-by": "kyverno-watcher", "artifact-name": "security"}
+	closed := []kyvernov1alpha1.SyncWindow{newSyncWindow(kyvernov1alpha1.SyncWindowAllow, "0 0 29 2 *", time.Minute)}
+
+	tests := []struct {
+		name       string
+		deletion   *string
+		wantPruned bool
+	}{
+		{name: "deletion obeys the windows by default"},
+		{name: "deletion ignoring the windows", deletion: ptrString(kyvernov1alpha1.SyncWindowIgnore), wantPruned: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				ArtifactName: "security",
+				PodNamespace: "default",
+				Prune:        true,
+				SyncWindows:  &kyvernov1alpha1.SyncWindows{Windows: closed, Deletion: tt.deletion},
+			}
+			dynamicClient, mapper := newFakePolicyClients(
+				newClusterPolicy("keep", owned, map[string]interface{}{}),
+				newClusterPolicy("dropped", owned, map[string]interface{}{}),
+				newTestArtifact("security", "default"),
+			)
+
+			results := handleStaleObjects(config, dynamicClient, mapper, []string{file})
+			if pruned := len(results) == 1; pruned != tt.wantPruned {
+				t.Errorf("handleStaleObjects() = %+v, want pruned %v", results, tt.wantPruned)
+			}
+			if stale := getArtifactStatus(t, dynamicClient, config).StaleObjects; (len(stale) == 1) == tt.wantPruned {
+				t.Errorf("staleObjects = %+v, want the policy reported as stale until it is deleted", stale)
+			}
+		})
+	}
+}